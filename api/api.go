@@ -6,6 +6,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -26,13 +27,17 @@ const (
 )
 
 var (
-	TooManyRequestsError = errors.New("Too Many Requests, please wait for 10 seconds before trying again")
+	TooManyRequestsError  = errors.New("Too Many Requests, please wait for 10 seconds before trying again")
+	OrderEntryHaltedError = errors.New("Order entry is halted on this client")
 )
 
 // Error type for errors returned by the API
 type APIError struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+
+	// HTTP status of the response, 0 for errors not returned by the API
+	StatusCode int `json:"-"`
 }
 
 // APIError implements the error interface
@@ -44,10 +49,15 @@ func (e APIError) Error() string {
 type Params map[string]string
 
 // APIClient provides all API-endpoints available as methods.
+// The embedded http.Client can be configured with a custom Transport, which is wrapped by the middlewares added with Use.
 type APIClient struct {
 	URL, Service, Version, Credentials, SessionKey string
 	ExpiresAt, LastUsageAt                         time.Time
 
+	orderEntryHalted bool
+	middlewares      []Middleware
+	hooks            []Hook
+
 	http.Client
 	sync.RWMutex
 }
@@ -109,6 +119,9 @@ func (c *APIClient) AccountOrders(accountno int64, params *Params) (res []Order,
 
 // Enter a new order, market_id + identifier is the identifier of the tradable.
 func (c *APIClient) CreateOrder(accountno int64, params *Params) (res *OrderReply, err error) {
+	if c.OrderEntryHalted() {
+		return nil, OrderEntryHaltedError
+	}
 	res = &OrderReply{}
 	err = c.Perform("POST", fmt.Sprintf("accounts/%d/orders", accountno), params, res)
 	return
@@ -116,6 +129,9 @@ func (c *APIClient) CreateOrder(accountno int64, params *Params) (res *OrderRepl
 
 // Activate an inactive order. Please note that it is not possible to deactivate an order. The order must be entered as inactive.
 func (c *APIClient) ActivateOrder(accountno int64, orderId int64) (res *OrderReply, err error) {
+	if c.OrderEntryHalted() {
+		return nil, OrderEntryHaltedError
+	}
 	res = &OrderReply{}
 	err = c.Perform("PUT", fmt.Sprintf("accounts/%d/orders/%d/activate", accountno, orderId), nil, res)
 	return
@@ -123,6 +139,9 @@ func (c *APIClient) ActivateOrder(accountno int64, orderId int64) (res *OrderRep
 
 // Modify price and or volume on an order.
 func (c *APIClient) UpdateOrder(accountno int64, orderId int64, params *Params) (res *OrderReply, err error) {
+	if c.OrderEntryHalted() {
+		return nil, OrderEntryHaltedError
+	}
 	res = &OrderReply{}
 	err = c.Perform("PUT", fmt.Sprintf("accounts/%d/orders/%d", accountno, orderId), params, res)
 	return
@@ -135,6 +154,27 @@ func (c *APIClient) DeleteOrder(accountno int64, orderId int64) (res *OrderReply
 	return
 }
 
+// Blocks CreateOrder, UpdateOrder and ActivateOrder until ResumeOrderEntry is called. DeleteOrder is never blocked.
+func (c *APIClient) HaltOrderEntry() {
+	c.Lock()
+	c.orderEntryHalted = true
+	c.Unlock()
+}
+
+// Allows order entry again after a call to HaltOrderEntry.
+func (c *APIClient) ResumeOrderEntry() {
+	c.Lock()
+	c.orderEntryHalted = false
+	c.Unlock()
+}
+
+// Reports whether order entry is currently halted.
+func (c *APIClient) OrderEntryHalted() bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.orderEntryHalted
+}
+
 // Returns a list of all positions of the account.
 func (c *APIClient) AccountPositions(accountno int64) (res []Position, err error) {
 	res = []Position{}
@@ -152,7 +192,7 @@ func (c *APIClient) AccountTrades(accountno int64, params *Params) (res []Trade,
 // Get a list of all countries in the system. Please note that trading is not available everywhere.
 func (c *APIClient) Countries() (res []Country, err error) {
 	res = []Country{}
-	c.Perform("GET", "countries", nil, &res)
+	err = c.Perform("GET", "countries", nil, &res)
 	return
 }
 
@@ -309,7 +349,7 @@ func (c *APIClient) Touch() (res *LoggedInStatus, err error) {
 	return
 }
 
-//Get all tradable markets. Market 80 is the smart order market. Instruments that can be traded on 2 or more markets gets a tradable on the smart order market. Orders entered with the smart order tradable get smart order routed with the current Nordnet best execution policy.
+// Get all tradable markets. Market 80 is the smart order market. Instruments that can be traded on 2 or more markets gets a tradable on the smart order market. Orders entered with the smart order tradable get smart order routed with the current Nordnet best execution policy.
 func (c *APIClient) Markets() (res []Market, err error) {
 	res = []Market{}
 	err = c.Perform("GET", "markets", nil, &res)
@@ -335,7 +375,7 @@ func (c *APIClient) SearchNews(params *Params) (res []NewsPreview, err error) {
 func (c *APIClient) News(ids string) (res []NewsItem, err error) {
 	res = []NewsItem{}
 	err = c.Perform("GET", fmt.Sprintf("news/%s", ids), nil, &res)
-	return res, nil
+	return
 }
 
 // Returns a list of news sources the user has access to
@@ -387,22 +427,40 @@ func (c *APIClient) TradableTrades(ids string) (res []PublicTrades, err error) {
 	return
 }
 
-func (c *APIClient) Perform(method, path string, params *Params, res interface{}) (err error) {
+// Performs a request against the API and decodes the response into res. The middlewares added with Use
+// wrap the transport of the request and the hooks added with AddHook are called when the request is done.
+func (c *APIClient) Perform(method, path string, params *Params, res interface{}) error {
+	return c.PerformContext(context.Background(), method, path, params, res)
+}
+
+// Performs a request like Perform with the given context, the middlewares find the RequestInfo of the
+// request in the context of the request with RequestInfoFrom.
+func (c *APIClient) PerformContext(ctx context.Context, method, path string, params *Params, res interface{}) (err error) {
+	info := &RequestInfo{Method: method, Path: path, Endpoint: Endpoint(path), Start: time.Now()}
+	defer func() {
+		info.Duration = time.Since(info.Start)
+		info.Err = err
+		c.runHooks(info)
+	}()
+
 	reqURL, err := c.formatURL(path, params)
 	if err != nil {
 		return
 	}
 
-	req, err := http.NewRequest(method, reqURL.String(), nil)
+	req, err := http.NewRequestWithContext(context.WithValue(ctx, requestInfoKey{}, info), method, reqURL.String(), nil)
 	if err != nil {
 		return
 	}
+	info.Request = req
 
 	resp, err := c.perform(req)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
+	info.Response = resp
+	info.StatusCode = resp.StatusCode
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -413,10 +471,11 @@ func (c *APIClient) Perform(method, path string, params *Params, res interface{}
 	case 204:
 		return
 	case 400, 401, 404:
-		errRes := APIError{}
+		errRes := APIError{StatusCode: resp.StatusCode}
 		if err = json.Unmarshal(body, &errRes); err != nil {
 			return
 		}
+		info.APIError = &errRes
 		return errRes
 	case 429:
 		return TooManyRequestsError
@@ -425,6 +484,7 @@ func (c *APIClient) Perform(method, path string, params *Params, res interface{}
 	if err = json.Unmarshal(body, res); err != nil {
 		return
 	}
+	info.Result = res
 
 	return
 }
@@ -438,9 +498,11 @@ func (c *APIClient) perform(req *http.Request) (resp *http.Response, err error)
 	if c.SessionKey != "" {
 		req.SetBasicAuth(c.SessionKey, c.SessionKey)
 	}
+	client := c.Client
+	client.Transport = chain(c.Transport, c.middlewares)
 	c.RUnlock()
 
-	resp, err = c.Do(req)
+	resp, err = client.Do(req)
 
 	c.Lock()
 	c.LastUsageAt = time.Now()
@@ -76,21 +76,21 @@ func TestAccountIntegration(t *testing.T) {
 		assert := assert.New(t)
 
 		assert.Equal("test", resp.AccountCurrency)
-		assert.Equal(Amount{1.1, "test"}, resp.AccountCredit)
-		assert.Equal(Amount{1.1, "test"}, resp.AccountSum)
-		assert.Equal(Amount{1.1, "test"}, resp.Collateral)
-		assert.Equal(Amount{1.1, "test"}, resp.CreditAccountSum)
-		assert.Equal(Amount{1.1, "test"}, resp.ForwardSum)
-		assert.Equal(Amount{1.1, "test"}, resp.FutureSum)
-		assert.Equal(Amount{1.1, "test"}, resp.UnrealizedFutureProfitLoss)
-		assert.Equal(Amount{1.1, "test"}, resp.FullMarketvalue)
-		assert.Equal(Amount{1.1, "test"}, resp.Interest)
-		assert.Equal(Amount{1.1, "test"}, resp.IntradayCredit)
-		assert.Equal(Amount{1.1, "test"}, resp.LoanLimit)
-		assert.Equal(Amount{1.1, "test"}, resp.OwnCapital)
-		assert.Equal(Amount{1.1, "test"}, resp.OwnCapitalMorning)
-		assert.Equal(Amount{1.1, "test"}, resp.PawnValue)
-		assert.Equal(Amount{1.1, "test"}, resp.TradingPower)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.AccountCredit)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.AccountSum)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.Collateral)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.CreditAccountSum)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.ForwardSum)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.FutureSum)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.UnrealizedFutureProfitLoss)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.FullMarketvalue)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.Interest)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.IntradayCredit)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.LoanLimit)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.OwnCapital)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.OwnCapitalMorning)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.PawnValue)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, resp.TradingPower)
 	}
 }
 
@@ -106,19 +106,19 @@ func TestAccountLedgersIntegration(t *testing.T) {
 		assert.NotEmpty(resp)
 
 		accLedger := resp[0]
-		assert.Equal(Amount{1.1, "test"}, accLedger.TotalAccIntDeb)
-		assert.Equal(Amount{1.1, "test"}, accLedger.TotalAccIntCred)
-		assert.Equal(Amount{1.1, "test"}, accLedger.Total)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, accLedger.TotalAccIntDeb)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, accLedger.TotalAccIntCred)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, accLedger.Total)
 
 		assert.NotEmpty(accLedger.Ledgers)
 
 		ledger := accLedger.Ledgers[0]
 		assert.Equal("test", ledger.Currency)
-		assert.Equal(Amount{1.1, "test"}, ledger.AccountSum)
-		assert.Equal(Amount{1.1, "test"}, ledger.AccountSumAcc)
-		assert.Equal(Amount{1.1, "test"}, ledger.AccIntDeb)
-		assert.Equal(Amount{1.1, "test"}, ledger.AccIntCred)
-		assert.Equal(Amount{1.1, "test"}, ledger.ExchangeRate)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, ledger.AccountSum)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, ledger.AccountSumAcc)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, ledger.AccIntDeb)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, ledger.AccIntCred)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, ledger.ExchangeRate)
 	}
 }
 
@@ -136,20 +136,20 @@ func TestAccountOrdersIntegration(t *testing.T) {
 		order := resp[0]
 		assert.EqualValues(123, order.Accno)
 		assert.EqualValues(123, order.OrderId)
-		assert.Equal(Amount{1.1, "test"}, order.Price)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, order.Price)
 		assert.Equal(1.1, order.Volume)
 		assert.Equal(TradableId{"test", 123}, order.Tradable)
 		assert.Equal(1.1, order.OpenVolume)
 		assert.Equal(1.1, order.TradedVolume)
-		assert.Equal("test", order.Side)
+		assert.Equal(Side("test"), order.Side)
 		assert.EqualValues(123, order.Modified)
 		assert.Equal("test", order.Reference)
-		assert.Equal(ActivationCondition{"test", 1.1, 1.1, "test"}, order.ActivationCondition)
+		assert.Equal(ActivationCondition{"test", NewDecimal(11, -1), NewDecimal(11, -1), "test"}, order.ActivationCondition)
 		assert.Equal("test", order.PriceCondition)
 		assert.Equal("test", order.VolumeCondition)
 		assert.Equal(Validity{"test", 123}, order.Validity)
-		assert.Equal("test", order.ActionState)
-		assert.Equal("test", order.OrderState)
+		assert.Equal(ActionState("test"), order.ActionState)
+		assert.Equal(OrderState("test"), order.OrderState)
 	}
 }
 
@@ -228,11 +228,11 @@ func TestAccountPositionsIntegration(t *testing.T) {
 
 		assert.Equal(1.1, position.Qty)
 		assert.Equal(1.1, position.PawnPercent)
-		assert.Equal(Amount{1.1, "test"}, position.MarketValueAcc)
-		assert.Equal(Amount{1.1, "test"}, position.MarketValue)
-		assert.Equal(Amount{1.1, "test"}, position.AcqPriceAcc)
-		assert.Equal(Amount{1.1, "test"}, position.AcqPrice)
-		assert.Equal(Amount{1.1, "test"}, position.MorningPrice)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, position.MarketValueAcc)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, position.MarketValue)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, position.AcqPriceAcc)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, position.AcqPrice)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, position.MorningPrice)
 	}
 }
 
@@ -253,9 +253,9 @@ func TestAccountTradesIntegration(t *testing.T) {
 		assert.EqualValues(123, trade.OrderId)
 		assert.Equal("test", trade.TradeId)
 		assert.Equal(TradableId{"test", 123}, trade.Tradable)
-		assert.Equal(Amount{1.1, "test"}, trade.Price)
+		assert.Equal(Amount{NewDecimal(11, -1), "test"}, trade.Price)
 		assert.Equal(1.1, trade.Volume)
-		assert.Equal("test", trade.Side)
+		assert.Equal(Side("test"), trade.Side)
 		assert.Equal("test", trade.Counterparty)
 		assert.EqualValues(123, trade.Tradetime)
 	}
@@ -278,6 +278,23 @@ func TestCountriesIntegration(t *testing.T) {
 	}
 }
 
+func TestErrorsReturnedIntegration(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		w.Write([]byte(`{"code":"NOT_FOUND","message":"Not found."}`))
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	client := &APIClient{URL: ts.URL, Service: NNSERVICE, Version: NNAPIVERSION}
+	assert := assert.New(t)
+
+	_, err := client.Countries()
+	assert.EqualError(err, "NOT_FOUND: Not found.")
+	_, err = client.News("123")
+	assert.EqualError(err, "NOT_FOUND: Not found.")
+}
+
 func TestLookupCountriesIntegration(t *testing.T) {
 	client, ts := setup(t, "GET", "/2/countries/US,SV", defSessionKey, countriesJSON)
 	defer ts.Close()
@@ -397,7 +414,7 @@ func TestInstrumentLeverageFiltersIntegration(t *testing.T) {
 		assert.Equal("test", resp.MarketView[0])
 
 		assert.NotEmpty(resp.ExpirationDates)
-		assert.Equal("test", resp.ExpirationDates[0])
+		assert.Equal(Date("test"), resp.ExpirationDates[0])
 
 		assert.NotEmpty(resp.InstrumentTypes)
 		assert.Equal("test", resp.InstrumentTypes[0])
@@ -425,8 +442,8 @@ func TestInstrumentOptionPairsIntegration(t *testing.T) {
 		assert.NotEmpty(resp)
 
 		optionPair := resp[0]
-		assert.Equal(1.1, optionPair.StrikePrice)
-		assert.Equal("test", optionPair.ExpirationDate)
+		assert.Equal(NewDecimal(11, -1), optionPair.StrikePrice)
+		assert.Equal(Date("test"), optionPair.ExpirationDate)
 
 		assertInstrument(assert, &optionPair.Call)
 		assertInstrument(assert, &optionPair.Put)
@@ -445,7 +462,7 @@ func TestInstrumentOptionPairFiltersIntegration(t *testing.T) {
 
 		assert.NotEmpty(resp.ExpirationDates)
 
-		assert.Equal("test", resp.ExpirationDates[0])
+		assert.Equal(Date("test"), resp.ExpirationDates[0])
 	}
 }
 
@@ -514,7 +531,7 @@ func TestInstrumentTypesIntegration(t *testing.T) {
 		assert.NotEmpty(resp)
 
 		instrumentType := resp[0]
-		assert.Equal("test", instrumentType.InstrumentType)
+		assert.Equal(InstrumentKind("test"), instrumentType.InstrumentType)
 		assert.Equal("test", instrumentType.Name)
 	}
 }
@@ -531,7 +548,7 @@ func TestInstrumentTypeIntegration(t *testing.T) {
 		assert.NotEmpty(resp)
 
 		instrumentType := resp[0]
-		assert.Equal("test", instrumentType.InstrumentType)
+		assert.Equal(InstrumentKind("test"), instrumentType.InstrumentType)
 		assert.Equal("test", instrumentType.Name)
 	}
 }
@@ -789,9 +806,9 @@ func TestTickSizesIntegration(t *testing.T) {
 
 		tickSizeInterval := tickSize.Ticks[0]
 		assert.EqualValues(123, tickSizeInterval.Decimals)
-		assert.Equal(1.1, tickSizeInterval.FromPrice)
-		assert.Equal(1.1, tickSizeInterval.ToPrice)
-		assert.Equal(1.1, tickSizeInterval.Tick)
+		assert.Equal(NewDecimal(11, -1), tickSizeInterval.FromPrice)
+		assert.Equal(NewDecimal(11, -1), tickSizeInterval.ToPrice)
+		assert.Equal(NewDecimal(11, -1), tickSizeInterval.Tick)
 	}
 }
 
@@ -810,9 +827,9 @@ func TestTickSizeIntegration(t *testing.T) {
 
 		tickSizeInterval := tickSize.Ticks[0]
 		assert.EqualValues(123, tickSizeInterval.Decimals)
-		assert.Equal(1.1, tickSizeInterval.FromPrice)
-		assert.Equal(1.1, tickSizeInterval.ToPrice)
-		assert.Equal(1.1, tickSizeInterval.Tick)
+		assert.Equal(NewDecimal(11, -1), tickSizeInterval.FromPrice)
+		assert.Equal(NewDecimal(11, -1), tickSizeInterval.ToPrice)
+		assert.Equal(NewDecimal(11, -1), tickSizeInterval.Tick)
 	}
 }
 
@@ -831,7 +848,7 @@ func TestTradableInfoIntegration(t *testing.T) {
 		assert.Equal(true, tradableInfo.Iceberg)
 
 		calendarDay := tradableInfo.Calendar[0]
-		assert.Equal("test", calendarDay.Date)
+		assert.Equal(Date("test"), calendarDay.Date)
 		assert.EqualValues(123, calendarDay.Open)
 		assert.EqualValues(123, calendarDay.Close)
 
@@ -859,9 +876,9 @@ func TestTradableIntradayIntegration(t *testing.T) {
 
 		tick := tradableIntraday.Ticks[0]
 		assert.EqualValues(123, tick.Timestamp)
-		assert.Equal(1.1, tick.Last)
-		assert.Equal(1.1, tick.Low)
-		assert.Equal(1.1, tick.High)
+		assert.Equal(NewDecimal(11, -1), tick.Last)
+		assert.Equal(NewDecimal(11, -1), tick.Low)
+		assert.Equal(NewDecimal(11, -1), tick.High)
 		assert.Equal(1.1, tick.Volume)
 		assert.EqualValues(123, tick.NoOfTrades)
 	}
@@ -887,7 +904,7 @@ func TestTradableTradesIntegration(t *testing.T) {
 		assert.Equal("test", trade.BrokerBuying)
 		assert.Equal("test", trade.BrokerSelling)
 		assert.EqualValues(123, trade.Volume)
-		assert.Equal(1.1, trade.Price)
+		assert.Equal(NewDecimal(11, -1), trade.Price)
 		assert.Equal("test", trade.TradeId)
 		assert.Equal("test", trade.TradeType)
 		assert.EqualValues(123, trade.TradeTimestamp)
@@ -898,8 +915,8 @@ func TestTradableTradesIntegration(t *testing.T) {
 func assertOrder(assert *assert.Assertions, order *OrderReply) {
 	assert.EqualValues(123, order.OrderId)
 	assert.Equal("test", order.ResultCode)
-	assert.Equal("test", order.OrderState)
-	assert.Equal("test", order.ActionState)
+	assert.Equal(OrderState("test"), order.OrderState)
+	assert.Equal(ActionState("test"), order.ActionState)
 	assert.Equal("test", order.Message)
 }
 
@@ -933,15 +950,15 @@ func assertInstrument(assert *assert.Assertions, instrument *Instrument) {
 
 	assert.Equal("test", instrument.Currency)
 	assert.Equal("test", instrument.InstrumentGroupType)
-	assert.Equal("test", instrument.InstrumentType)
+	assert.Equal(InstrumentKind("test"), instrument.InstrumentType)
 	assert.Equal(1.1, instrument.Multiplier)
 	assert.Equal("test", instrument.Symbol)
 	assert.Equal("test", instrument.IsinCode)
 	assert.Equal("test", instrument.MarketView)
-	assert.Equal(1.1, instrument.StrikePrice)
+	assert.Equal(NewDecimal(11, -1), instrument.StrikePrice)
 	assert.Equal(1.1, instrument.NumberOfSecurities)
 	assert.Equal("test", instrument.ProspectusUrl)
-	assert.Equal("test", instrument.ExpirationDate)
+	assert.Equal(Date("test"), instrument.ExpirationDate)
 	assert.Equal("test", instrument.Name)
 	assert.Equal("test", instrument.Sector)
 	assert.Equal("test", instrument.SectorGroup)
@@ -981,3 +998,27 @@ func setup(t *testing.T, method, path, session, stubData string) (*APIClient, *h
 	client := &APIClient{URL: testServer.URL, Service: NNSERVICE, Version: NNAPIVERSION, SessionKey: session}
 	return client, testServer
 }
+
+func TestHaltOrderEntry(t *testing.T) {
+	client, ts := setup(t, "DELETE", "/2/accounts/1000000/orders/1000", defSessionKey, orderJSON)
+	defer ts.Close()
+
+	assert := assert.New(t)
+
+	client.HaltOrderEntry()
+	assert.True(client.OrderEntryHalted())
+
+	_, err := client.CreateOrder(1000000, &Params{})
+	assert.Equal(OrderEntryHaltedError, err)
+	_, err = client.UpdateOrder(1000000, 1000, &Params{})
+	assert.Equal(OrderEntryHaltedError, err)
+	_, err = client.ActivateOrder(1000000, 1000)
+	assert.Equal(OrderEntryHaltedError, err)
+
+	if resp, err := client.DeleteOrder(1000000, 1000); assert.NoError(err) {
+		assertOrder(assert, resp)
+	}
+
+	client.ResumeOrderEntry()
+	assert.False(client.OrderEntryHalted())
+}
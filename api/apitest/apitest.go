@@ -0,0 +1,462 @@
+// Package apitest provides a mock of the api.Client interface for testing code using the API without HTTP.
+//
+// Code that only needs account reading and order entry can also use a paper.Broker directly,
+// it implements both api.AccountReader and api.OrderEntry.
+package apitest
+
+import (
+	"sync"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/paper"
+	. "github.com/denro/nordnet/util/models"
+)
+
+// A recorded call to the Mock
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Mock implements api.Client. Every method records the call and calls the function field
+// with the same name suffixed by Func, methods without a function return zero values.
+type Mock struct {
+	SystemStatusFunc                func() (*SystemStatus, error)
+	LoginFunc                       func() (*Login, error)
+	LogoutFunc                      func() (*LoggedInStatus, error)
+	TouchFunc                       func() (*LoggedInStatus, error)
+	AccountsFunc                    func() ([]Account, error)
+	AccountFunc                     func(accountno int64) (*AccountInfo, error)
+	AccountLedgersFunc              func(accountno int64) ([]LedgerInformation, error)
+	AccountOrdersFunc               func(accountno int64, params *api.Params) ([]Order, error)
+	AccountPositionsFunc            func(accountno int64) ([]Position, error)
+	AccountTradesFunc               func(accountno int64, params *api.Params) ([]Trade, error)
+	CreateOrderFunc                 func(accountno int64, params *api.Params) (*OrderReply, error)
+	ActivateOrderFunc               func(accountno int64, orderId int64) (*OrderReply, error)
+	UpdateOrderFunc                 func(accountno int64, orderId int64, params *api.Params) (*OrderReply, error)
+	DeleteOrderFunc                 func(accountno int64, orderId int64) (*OrderReply, error)
+	CountriesFunc                   func() ([]Country, error)
+	LookupCountriesFunc             func(countries string) ([]Country, error)
+	SearchInstrumentsFunc           func(params *api.Params) ([]Instrument, error)
+	InstrumentsFunc                 func(ids string) ([]Instrument, error)
+	InstrumentLeveragesFunc         func(id int64, params *api.Params) ([]Instrument, error)
+	InstrumentLeverageFiltersFunc   func(id int64, params *api.Params) (*LeverageFilter, error)
+	InstrumentOptionPairsFunc       func(id int64, params *api.Params) ([]OptionPair, error)
+	InstrumentOptionPairFiltersFunc func(id int64, params *api.Params) (*OptionPairFilter, error)
+	InstrumentLookupFunc            func(lookupType string, lookup string) ([]Instrument, error)
+	InstrumentSectorsFunc           func(params *api.Params) ([]Sector, error)
+	InstrumentSectorFunc            func(sectors string) ([]Sector, error)
+	InstrumentTypesFunc             func() ([]InstrumentType, error)
+	InstrumentTypeFunc              func(instrumentType string) ([]InstrumentType, error)
+	InstrumentUnderlyingsFunc       func(derivateType string, currency string) ([]Instrument, error)
+	ListsFunc                       func() ([]List, error)
+	ListFunc                        func(id int64) ([]Instrument, error)
+	MarketsFunc                     func() ([]Market, error)
+	MarketFunc                      func(ids string) ([]Market, error)
+	TickSizesFunc                   func() ([]TicksizeTable, error)
+	TickSizeFunc                    func(ids string) ([]TicksizeTable, error)
+	TradableInfoFunc                func(ids string) ([]TradableInfo, error)
+	IndicatorsFunc                  func() ([]Indicator, error)
+	LookupIndicatorsFunc            func(indicators string) ([]Indicator, error)
+	RealtimeAccessFunc              func() ([]RealtimeAccess, error)
+	TradableIntradayFunc            func(ids string) ([]IntradayGraph, error)
+	TradableTradesFunc              func(ids string) ([]PublicTrades, error)
+	SearchNewsFunc                  func(params *api.Params) ([]NewsPreview, error)
+	NewsFunc                        func(ids string) ([]NewsItem, error)
+	NewsSourcesFunc                 func() ([]NewsSource, error)
+
+	calls []Call
+	sync.Mutex
+}
+
+var _ api.Client = (*Mock)(nil)
+
+// Returns the calls made so far, in order.
+func (m *Mock) Calls() []Call {
+	m.Lock()
+	defer m.Unlock()
+	return append([]Call{}, m.calls...)
+}
+
+// Returns the calls made to the named method.
+func (m *Mock) CallsTo(method string) (res []Call) {
+	for _, call := range m.Calls() {
+		if call.Method == method {
+			res = append(res, call)
+		}
+	}
+	return
+}
+
+// Forgets all recorded calls.
+func (m *Mock) Reset() {
+	m.Lock()
+	m.calls = nil
+	m.Unlock()
+}
+
+func (m *Mock) record(method string, args ...interface{}) {
+	m.Lock()
+	m.calls = append(m.calls, Call{Method: method, Args: args})
+	m.Unlock()
+}
+
+func (m *Mock) SystemStatus() (*SystemStatus, error) {
+	m.record("SystemStatus")
+	if m.SystemStatusFunc != nil {
+		return m.SystemStatusFunc()
+	}
+	return nil, nil
+}
+
+func (m *Mock) Login() (*Login, error) {
+	m.record("Login")
+	if m.LoginFunc != nil {
+		return m.LoginFunc()
+	}
+	return nil, nil
+}
+
+func (m *Mock) Logout() (*LoggedInStatus, error) {
+	m.record("Logout")
+	if m.LogoutFunc != nil {
+		return m.LogoutFunc()
+	}
+	return nil, nil
+}
+
+func (m *Mock) Touch() (*LoggedInStatus, error) {
+	m.record("Touch")
+	if m.TouchFunc != nil {
+		return m.TouchFunc()
+	}
+	return nil, nil
+}
+
+func (m *Mock) Accounts() ([]Account, error) {
+	m.record("Accounts")
+	if m.AccountsFunc != nil {
+		return m.AccountsFunc()
+	}
+	return nil, nil
+}
+
+func (m *Mock) Account(accountno int64) (*AccountInfo, error) {
+	m.record("Account", accountno)
+	if m.AccountFunc != nil {
+		return m.AccountFunc(accountno)
+	}
+	return nil, nil
+}
+
+func (m *Mock) AccountLedgers(accountno int64) ([]LedgerInformation, error) {
+	m.record("AccountLedgers", accountno)
+	if m.AccountLedgersFunc != nil {
+		return m.AccountLedgersFunc(accountno)
+	}
+	return nil, nil
+}
+
+func (m *Mock) AccountOrders(accountno int64, params *api.Params) ([]Order, error) {
+	m.record("AccountOrders", accountno, params)
+	if m.AccountOrdersFunc != nil {
+		return m.AccountOrdersFunc(accountno, params)
+	}
+	return nil, nil
+}
+
+func (m *Mock) AccountPositions(accountno int64) ([]Position, error) {
+	m.record("AccountPositions", accountno)
+	if m.AccountPositionsFunc != nil {
+		return m.AccountPositionsFunc(accountno)
+	}
+	return nil, nil
+}
+
+func (m *Mock) AccountTrades(accountno int64, params *api.Params) ([]Trade, error) {
+	m.record("AccountTrades", accountno, params)
+	if m.AccountTradesFunc != nil {
+		return m.AccountTradesFunc(accountno, params)
+	}
+	return nil, nil
+}
+
+func (m *Mock) CreateOrder(accountno int64, params *api.Params) (*OrderReply, error) {
+	m.record("CreateOrder", accountno, params)
+	if m.CreateOrderFunc != nil {
+		return m.CreateOrderFunc(accountno, params)
+	}
+	return nil, nil
+}
+
+func (m *Mock) ActivateOrder(accountno int64, orderId int64) (*OrderReply, error) {
+	m.record("ActivateOrder", accountno, orderId)
+	if m.ActivateOrderFunc != nil {
+		return m.ActivateOrderFunc(accountno, orderId)
+	}
+	return nil, nil
+}
+
+func (m *Mock) UpdateOrder(accountno int64, orderId int64, params *api.Params) (*OrderReply, error) {
+	m.record("UpdateOrder", accountno, orderId, params)
+	if m.UpdateOrderFunc != nil {
+		return m.UpdateOrderFunc(accountno, orderId, params)
+	}
+	return nil, nil
+}
+
+func (m *Mock) DeleteOrder(accountno int64, orderId int64) (*OrderReply, error) {
+	m.record("DeleteOrder", accountno, orderId)
+	if m.DeleteOrderFunc != nil {
+		return m.DeleteOrderFunc(accountno, orderId)
+	}
+	return nil, nil
+}
+
+func (m *Mock) Countries() ([]Country, error) {
+	m.record("Countries")
+	if m.CountriesFunc != nil {
+		return m.CountriesFunc()
+	}
+	return nil, nil
+}
+
+func (m *Mock) LookupCountries(countries string) ([]Country, error) {
+	m.record("LookupCountries", countries)
+	if m.LookupCountriesFunc != nil {
+		return m.LookupCountriesFunc(countries)
+	}
+	return nil, nil
+}
+
+func (m *Mock) SearchInstruments(params *api.Params) ([]Instrument, error) {
+	m.record("SearchInstruments", params)
+	if m.SearchInstrumentsFunc != nil {
+		return m.SearchInstrumentsFunc(params)
+	}
+	return nil, nil
+}
+
+func (m *Mock) Instruments(ids string) ([]Instrument, error) {
+	m.record("Instruments", ids)
+	if m.InstrumentsFunc != nil {
+		return m.InstrumentsFunc(ids)
+	}
+	return nil, nil
+}
+
+func (m *Mock) InstrumentLeverages(id int64, params *api.Params) ([]Instrument, error) {
+	m.record("InstrumentLeverages", id, params)
+	if m.InstrumentLeveragesFunc != nil {
+		return m.InstrumentLeveragesFunc(id, params)
+	}
+	return nil, nil
+}
+
+func (m *Mock) InstrumentLeverageFilters(id int64, params *api.Params) (*LeverageFilter, error) {
+	m.record("InstrumentLeverageFilters", id, params)
+	if m.InstrumentLeverageFiltersFunc != nil {
+		return m.InstrumentLeverageFiltersFunc(id, params)
+	}
+	return nil, nil
+}
+
+func (m *Mock) InstrumentOptionPairs(id int64, params *api.Params) ([]OptionPair, error) {
+	m.record("InstrumentOptionPairs", id, params)
+	if m.InstrumentOptionPairsFunc != nil {
+		return m.InstrumentOptionPairsFunc(id, params)
+	}
+	return nil, nil
+}
+
+func (m *Mock) InstrumentOptionPairFilters(id int64, params *api.Params) (*OptionPairFilter, error) {
+	m.record("InstrumentOptionPairFilters", id, params)
+	if m.InstrumentOptionPairFiltersFunc != nil {
+		return m.InstrumentOptionPairFiltersFunc(id, params)
+	}
+	return nil, nil
+}
+
+func (m *Mock) InstrumentLookup(lookupType string, lookup string) ([]Instrument, error) {
+	m.record("InstrumentLookup", lookupType, lookup)
+	if m.InstrumentLookupFunc != nil {
+		return m.InstrumentLookupFunc(lookupType, lookup)
+	}
+	return nil, nil
+}
+
+func (m *Mock) InstrumentSectors(params *api.Params) ([]Sector, error) {
+	m.record("InstrumentSectors", params)
+	if m.InstrumentSectorsFunc != nil {
+		return m.InstrumentSectorsFunc(params)
+	}
+	return nil, nil
+}
+
+func (m *Mock) InstrumentSector(sectors string) ([]Sector, error) {
+	m.record("InstrumentSector", sectors)
+	if m.InstrumentSectorFunc != nil {
+		return m.InstrumentSectorFunc(sectors)
+	}
+	return nil, nil
+}
+
+func (m *Mock) InstrumentTypes() ([]InstrumentType, error) {
+	m.record("InstrumentTypes")
+	if m.InstrumentTypesFunc != nil {
+		return m.InstrumentTypesFunc()
+	}
+	return nil, nil
+}
+
+func (m *Mock) InstrumentType(instrumentType string) ([]InstrumentType, error) {
+	m.record("InstrumentType", instrumentType)
+	if m.InstrumentTypeFunc != nil {
+		return m.InstrumentTypeFunc(instrumentType)
+	}
+	return nil, nil
+}
+
+func (m *Mock) InstrumentUnderlyings(derivateType string, currency string) ([]Instrument, error) {
+	m.record("InstrumentUnderlyings", derivateType, currency)
+	if m.InstrumentUnderlyingsFunc != nil {
+		return m.InstrumentUnderlyingsFunc(derivateType, currency)
+	}
+	return nil, nil
+}
+
+func (m *Mock) Lists() ([]List, error) {
+	m.record("Lists")
+	if m.ListsFunc != nil {
+		return m.ListsFunc()
+	}
+	return nil, nil
+}
+
+func (m *Mock) List(id int64) ([]Instrument, error) {
+	m.record("List", id)
+	if m.ListFunc != nil {
+		return m.ListFunc(id)
+	}
+	return nil, nil
+}
+
+func (m *Mock) Markets() ([]Market, error) {
+	m.record("Markets")
+	if m.MarketsFunc != nil {
+		return m.MarketsFunc()
+	}
+	return nil, nil
+}
+
+func (m *Mock) Market(ids string) ([]Market, error) {
+	m.record("Market", ids)
+	if m.MarketFunc != nil {
+		return m.MarketFunc(ids)
+	}
+	return nil, nil
+}
+
+func (m *Mock) TickSizes() ([]TicksizeTable, error) {
+	m.record("TickSizes")
+	if m.TickSizesFunc != nil {
+		return m.TickSizesFunc()
+	}
+	return nil, nil
+}
+
+func (m *Mock) TickSize(ids string) ([]TicksizeTable, error) {
+	m.record("TickSize", ids)
+	if m.TickSizeFunc != nil {
+		return m.TickSizeFunc(ids)
+	}
+	return nil, nil
+}
+
+func (m *Mock) TradableInfo(ids string) ([]TradableInfo, error) {
+	m.record("TradableInfo", ids)
+	if m.TradableInfoFunc != nil {
+		return m.TradableInfoFunc(ids)
+	}
+	return nil, nil
+}
+
+func (m *Mock) Indicators() ([]Indicator, error) {
+	m.record("Indicators")
+	if m.IndicatorsFunc != nil {
+		return m.IndicatorsFunc()
+	}
+	return nil, nil
+}
+
+func (m *Mock) LookupIndicators(indicators string) ([]Indicator, error) {
+	m.record("LookupIndicators", indicators)
+	if m.LookupIndicatorsFunc != nil {
+		return m.LookupIndicatorsFunc(indicators)
+	}
+	return nil, nil
+}
+
+func (m *Mock) RealtimeAccess() ([]RealtimeAccess, error) {
+	m.record("RealtimeAccess")
+	if m.RealtimeAccessFunc != nil {
+		return m.RealtimeAccessFunc()
+	}
+	return nil, nil
+}
+
+func (m *Mock) TradableIntraday(ids string) ([]IntradayGraph, error) {
+	m.record("TradableIntraday", ids)
+	if m.TradableIntradayFunc != nil {
+		return m.TradableIntradayFunc(ids)
+	}
+	return nil, nil
+}
+
+func (m *Mock) TradableTrades(ids string) ([]PublicTrades, error) {
+	m.record("TradableTrades", ids)
+	if m.TradableTradesFunc != nil {
+		return m.TradableTradesFunc(ids)
+	}
+	return nil, nil
+}
+
+func (m *Mock) SearchNews(params *api.Params) ([]NewsPreview, error) {
+	m.record("SearchNews", params)
+	if m.SearchNewsFunc != nil {
+		return m.SearchNewsFunc(params)
+	}
+	return nil, nil
+}
+
+func (m *Mock) News(ids string) ([]NewsItem, error) {
+	m.record("News", ids)
+	if m.NewsFunc != nil {
+		return m.NewsFunc(ids)
+	}
+	return nil, nil
+}
+
+func (m *Mock) NewsSources() ([]NewsSource, error) {
+	m.record("NewsSources")
+	if m.NewsSourcesFunc != nil {
+		return m.NewsSourcesFunc()
+	}
+	return nil, nil
+}
+
+// Returns a Mock whose account reading and order entry methods are served by the paper trading broker.
+func NewPaperMock(b *paper.Broker) *Mock {
+	return &Mock{
+		AccountsFunc:         b.Accounts,
+		AccountFunc:          b.Account,
+		AccountLedgersFunc:   b.AccountLedgers,
+		AccountOrdersFunc:    b.AccountOrders,
+		AccountPositionsFunc: b.AccountPositions,
+		AccountTradesFunc:    b.AccountTrades,
+		CreateOrderFunc:      b.CreateOrder,
+		ActivateOrderFunc:    b.ActivateOrder,
+		UpdateOrderFunc:      b.UpdateOrder,
+		DeleteOrderFunc:      b.DeleteOrder,
+	}
+}
@@ -0,0 +1,63 @@
+package apitest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+	"github.com/denro/nordnet/paper"
+	. "github.com/denro/nordnet/util/models"
+)
+
+func TestMock(t *testing.T) {
+	m := &Mock{
+		AccountsFunc: func() ([]Account, error) {
+			return []Account{{Accno: 1}}, nil
+		},
+		DeleteOrderFunc: func(accountno, orderId int64) (*OrderReply, error) {
+			return nil, errors.New("fail")
+		},
+	}
+
+	assert := assert.New(t)
+
+	accounts, err := m.Accounts()
+	assert.NoError(err)
+	assert.Equal([]Account{{Accno: 1}}, accounts)
+
+	_, err = m.DeleteOrder(1, 2)
+	assert.EqualError(err, "fail")
+
+	instruments, err := m.Instruments("1,2")
+	assert.NoError(err)
+	assert.Nil(instruments)
+
+	assert.Equal([]Call{
+		{Method: "Accounts"},
+		{Method: "DeleteOrder", Args: []interface{}{int64(1), int64(2)}},
+		{Method: "Instruments", Args: []interface{}{"1,2"}},
+	}, m.Calls())
+	assert.Len(m.CallsTo("DeleteOrder"), 1)
+
+	m.Reset()
+	assert.Empty(m.Calls())
+}
+
+func TestPaperMock(t *testing.T) {
+	b := paper.NewBroker()
+	b.OpenAccount(1, "SEK", 1000)
+	b.Update(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "101", M: 11, Ask: NewDecimal(10, 0), AskVolume: 100}})
+
+	var client api.Client = NewPaperMock(b)
+
+	reply, err := client.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "10", "volume": "5", "side": "BUY"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, OrderDone, reply.OrderState)
+	}
+
+	ledgers, _ := client.AccountLedgers(1)
+	assert.Equal(t, NewDecimal(950, 0), ledgers[0].Total.Value)
+}
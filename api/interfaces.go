@@ -0,0 +1,84 @@
+package api
+
+import (
+	. "github.com/denro/nordnet/util/models"
+)
+
+// Session covers logging in and out and the system status.
+type Session interface {
+	SystemStatus() (*SystemStatus, error)
+	Login() (*Login, error)
+	Logout() (*LoggedInStatus, error)
+	Touch() (*LoggedInStatus, error)
+}
+
+// AccountReader covers reading accounts and their orders, positions and trades.
+type AccountReader interface {
+	Accounts() ([]Account, error)
+	Account(accountno int64) (*AccountInfo, error)
+	AccountLedgers(accountno int64) ([]LedgerInformation, error)
+	AccountOrders(accountno int64, params *Params) ([]Order, error)
+	AccountPositions(accountno int64) ([]Position, error)
+	AccountTrades(accountno int64, params *Params) ([]Trade, error)
+}
+
+// OrderEntry covers entering, modifying and deleting orders.
+type OrderEntry interface {
+	CreateOrder(accountno int64, params *Params) (*OrderReply, error)
+	ActivateOrder(accountno int64, orderId int64) (*OrderReply, error)
+	UpdateOrder(accountno int64, orderId int64, params *Params) (*OrderReply, error)
+	DeleteOrder(accountno int64, orderId int64) (*OrderReply, error)
+}
+
+// InstrumentFinder covers the instrument, market and other reference data lookups.
+type InstrumentFinder interface {
+	Countries() ([]Country, error)
+	LookupCountries(countries string) ([]Country, error)
+	SearchInstruments(params *Params) ([]Instrument, error)
+	Instruments(ids string) ([]Instrument, error)
+	InstrumentLeverages(id int64, params *Params) ([]Instrument, error)
+	InstrumentLeverageFilters(id int64, params *Params) (*LeverageFilter, error)
+	InstrumentOptionPairs(id int64, params *Params) ([]OptionPair, error)
+	InstrumentOptionPairFilters(id int64, params *Params) (*OptionPairFilter, error)
+	InstrumentLookup(lookupType string, lookup string) ([]Instrument, error)
+	InstrumentSectors(params *Params) ([]Sector, error)
+	InstrumentSector(sectors string) ([]Sector, error)
+	InstrumentTypes() ([]InstrumentType, error)
+	InstrumentType(instrumentType string) ([]InstrumentType, error)
+	InstrumentUnderlyings(derivateType string, currency string) ([]Instrument, error)
+	Lists() ([]List, error)
+	List(id int64) ([]Instrument, error)
+	Markets() ([]Market, error)
+	Market(ids string) ([]Market, error)
+	TickSizes() ([]TicksizeTable, error)
+	TickSize(ids string) ([]TicksizeTable, error)
+	TradableInfo(ids string) ([]TradableInfo, error)
+}
+
+// MarketData covers indicators, realtime access and the price and trade history of tradables.
+type MarketData interface {
+	Indicators() ([]Indicator, error)
+	LookupIndicators(indicators string) ([]Indicator, error)
+	RealtimeAccess() ([]RealtimeAccess, error)
+	TradableIntraday(ids string) ([]IntradayGraph, error)
+	TradableTrades(ids string) ([]PublicTrades, error)
+}
+
+// NewsReader covers searching and reading news.
+type NewsReader interface {
+	SearchNews(params *Params) ([]NewsPreview, error)
+	News(ids string) ([]NewsItem, error)
+	NewsSources() ([]NewsSource, error)
+}
+
+// Client covers every endpoint of the API, it is implemented by APIClient.
+type Client interface {
+	Session
+	AccountReader
+	OrderEntry
+	InstrumentFinder
+	MarketData
+	NewsReader
+}
+
+var _ Client = (*APIClient)(nil)
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Middleware wraps the transport used to send every request of the client
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to the http.RoundTripper interface
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTripperFunc implements the RoundTripper interface
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Information about a request passed to the hooks when it is done
+type RequestInfo struct {
+	Method     string
+	Path       string
+	Endpoint   string
+	Start      time.Time
+	Duration   time.Duration
+	StatusCode int
+
+	// Decoded error returned by the API, if any
+	APIError *APIError
+
+	// Error returned by Perform, if any
+	Err error
+
+	// The decoded response of successful requests
+	Result interface{}
+
+	// The request and response, the response body is already consumed
+	Request  *http.Request
+	Response *http.Response
+}
+
+// Hook is called after every request performed by the client
+type Hook func(*RequestInfo)
+
+type requestInfoKey struct{}
+
+// Returns the information about the request performed with the context, nil for requests not performed by an APIClient.
+func RequestInfoFrom(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info
+}
+
+// Adds middlewares to the client, the first middleware added is the outermost.
+func (c *APIClient) Use(middlewares ...Middleware) {
+	c.Lock()
+	c.middlewares = append(c.middlewares, middlewares...)
+	c.Unlock()
+}
+
+// Adds a hook called after every request, hooks are called in the order they were added.
+func (c *APIClient) AddHook(hook Hook) {
+	c.Lock()
+	c.hooks = append(c.hooks, hook)
+	c.Unlock()
+}
+
+var idSegment = regexp.MustCompile(`^[0-9][0-9,:]*$`)
+
+// Returns the endpoint of a request path with ids replaced by placeholders, "accounts/1/orders/2" becomes "accounts/:id/orders/:id".
+func Endpoint(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if idSegment.MatchString(s) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func (c *APIClient) runHooks(info *RequestInfo) {
+	c.RLock()
+	hooks := c.hooks
+	c.RUnlock()
+
+	for _, hook := range hooks {
+		hook(info)
+	}
+}
+
+// Wraps the transport with the middlewares, falling back to http.DefaultTransport
+func chain(transport http.RoundTripper, middlewares []Middleware) http.RoundTripper {
+	if len(middlewares) == 0 {
+		return transport
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		transport = middlewares[i](transport)
+	}
+	return transport
+}
+
+// Header set by the RequestID middleware
+const RequestIDHeader = "X-Request-Id"
+
+// Returns a middleware setting a random X-Request-Id header on requests that do not already have one.
+func RequestID() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(RequestIDHeader) == "" {
+				b := make([]byte, 16)
+				if _, err := rand.Read(b); err != nil {
+					return nil, err
+				}
+				req = req.Clone(req.Context())
+				req.Header.Set(RequestIDHeader, hex.EncodeToString(b))
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// Returns a middleware writing every request and response to w, with session keys and credentials redacted.
+func DebugDump(w io.Writer) Middleware {
+	var mu sync.Mutex
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			dump, err := httputil.DumpRequestOut(req, true)
+			if err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			fmt.Fprintf(w, "%s\n\n", Redact(string(dump)))
+			mu.Unlock()
+
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				return nil, err
+			}
+
+			if dump, err = httputil.DumpResponse(resp, true); err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			fmt.Fprintf(w, "%s\n\n", Redact(string(dump)))
+			mu.Unlock()
+
+			return resp, nil
+		})
+	}
+}
+
+// Used when redacting secrets
+const redacted = "[REDACTED]"
+
+var redactPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?i)(authorization:\s*\w+\s+)\S+`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)([?&](?:auth|password|session_key)=)[^&\s]*`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)("(?:auth|password|session_key|credentials)"\s*:\s*)"[^"]*"`), `${1}"` + redacted + `"`},
+}
+
+// Redacts session keys, credentials and passwords from dumped requests, responses and URLs.
+func Redact(s string) string {
+	for _, p := range redactPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
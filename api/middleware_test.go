@@ -0,0 +1,142 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	client, ts := setup(t, "GET", "/2/accounts", defSessionKey, accountsJSON)
+	defer ts.Close()
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+" before")
+				resp, err := next.RoundTrip(req)
+				order = append(order, name+" after")
+				return resp, err
+			})
+		}
+	}
+	client.Use(trace("outer"), trace("inner"))
+
+	_, err := client.Accounts()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outer before", "inner before", "inner after", "outer after"}, order)
+}
+
+func TestMiddlewareFaultInjection(t *testing.T) {
+	client, ts := setup(t, "GET", "/2/accounts", defSessionKey, accountsJSON)
+	defer ts.Close()
+
+	fault := errors.New("injected")
+	client.Use(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, fault
+		})
+	})
+
+	var info *RequestInfo
+	client.AddHook(func(i *RequestInfo) { info = i })
+
+	_, err := client.Accounts()
+	assert.Error(t, err)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, "accounts", info.Path)
+		assert.Equal(t, err, info.Err)
+		assert.Zero(t, info.StatusCode)
+	}
+}
+
+func TestHookAPIError(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		w.Write([]byte(`{"code":"NEXT_NOT_FOUND","message":"Not found"}`))
+	})
+	client, ts := setupHandler(handler)
+	defer ts.Close()
+
+	var info *RequestInfo
+	client.AddHook(func(i *RequestInfo) { info = i })
+
+	_, err := client.Account(1)
+
+	assert := assert.New(t)
+	assert.EqualError(err, "NEXT_NOT_FOUND: Not found")
+	if assert.NotNil(info) {
+		assert.Equal("GET", info.Method)
+		assert.Equal("accounts/1", info.Path)
+		assert.Equal("accounts/:id", info.Endpoint)
+		assert.Equal(404, info.StatusCode)
+		assert.Equal(&APIError{Code: "NEXT_NOT_FOUND", Message: "Not found", StatusCode: 404}, info.APIError)
+		assert.True(info.Duration > 0)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var id string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = r.Header.Get(RequestIDHeader)
+		w.Write([]byte(accountsJSON))
+	})
+	client, ts := setupHandler(handler)
+	defer ts.Close()
+	client.Use(RequestID())
+
+	client.Accounts()
+	assert.Len(t, id, 32)
+}
+
+func TestDebugDump(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"environment": "test", "session_key": "SECRETSESSION", "expires_in": 123}`))
+	})
+	client, ts := setupHandler(handler)
+	defer ts.Close()
+
+	client.Credentials = "SECRETCREDENTIALS"
+	buf := &bytes.Buffer{}
+	client.Use(DebugDump(buf))
+
+	client.Login()
+	client.Accounts()
+
+	dump := buf.String()
+	assert := assert.New(t)
+	assert.Contains(dump, "POST /2/login?auth=[REDACTED]")
+	assert.Contains(dump, "Authorization: Basic [REDACTED]")
+	assert.Contains(dump, `"session_key": "[REDACTED]"`)
+	assert.False(strings.Contains(dump, "SECRETCREDENTIALS"))
+	assert.False(strings.Contains(dump, "SECRETSESSION"))
+}
+
+func TestEndpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("", Endpoint(""))
+	assert.Equal("accounts/:id/orders/:id/activate", Endpoint("accounts/123/orders/456/activate"))
+	assert.Equal("instruments/:id", Endpoint("instruments/1,2,3"))
+	assert.Equal("tradables/info/:id", Endpoint("tradables/info/11:101"))
+	assert.Equal("news_sources", Endpoint("news_sources"))
+}
+
+func TestRedact(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("https://x/login?auth=[REDACTED]&service=NEXTAPI", Redact("https://x/login?auth=abc%3D&service=NEXTAPI"))
+	assert.Equal(`{"password":"[REDACTED]"}`, Redact(`{"password":"hunter2"}`))
+	assert.Equal("authorization: Basic [REDACTED]", Redact("authorization: Basic QUJDOkFCQw=="))
+}
+
+func setupHandler(handler http.Handler) (*APIClient, *httptest.Server) {
+	ts := httptest.NewServer(handler)
+	return &APIClient{URL: ts.URL, Service: NNSERVICE, Version: NNAPIVERSION, SessionKey: defSessionKey}, ts
+}
@@ -0,0 +1,283 @@
+// Package backtest evaluates trading strategies offline against recorded or historical market data.
+//
+// The Engine replays events from one or more Sources through a simulated paper.Broker using a
+// simulated clock, so a run never touches the network and always gives the same result.
+package backtest
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+	"github.com/denro/nordnet/paper"
+	. "github.com/denro/nordnet/util/models"
+)
+
+// Account number of the simulated account
+const Accno = 1
+
+// Strategy receives typed market events and fills, and places orders through the Context.
+type Strategy interface {
+	OnPrice(ctx *Context, price feed.PublicPrice)
+	OnDepth(ctx *Context, depth feed.PublicDepth)
+	OnTrade(ctx *Context, trade feed.PublicTrade)
+	OnTradingStatus(ctx *Context, status feed.PublicTradingStatus)
+	OnOrder(ctx *Context, order feed.PrivateOrder)
+	OnFill(ctx *Context, trade feed.PrivateTrade)
+}
+
+// NopStrategy ignores every event, embed it to only implement the events needed.
+type NopStrategy struct{}
+
+func (NopStrategy) OnPrice(ctx *Context, price feed.PublicPrice)                  {}
+func (NopStrategy) OnDepth(ctx *Context, depth feed.PublicDepth)                  {}
+func (NopStrategy) OnTrade(ctx *Context, trade feed.PublicTrade)                  {}
+func (NopStrategy) OnTradingStatus(ctx *Context, status feed.PublicTradingStatus) {}
+func (NopStrategy) OnOrder(ctx *Context, order feed.PrivateOrder)                 {}
+func (NopStrategy) OnFill(ctx *Context, trade feed.PrivateTrade)                  {}
+
+// Engine runs a strategy against the events of a source.
+type Engine struct {
+	Strategy Strategy
+	Source   Source
+
+	// Starting cash of the simulated account
+	Cash     float64
+	Currency string
+
+	// Optional cost models
+	Commission CommissionModel
+	Slippage   SlippageModel
+
+	// Number of periods per year used to annualize the Sharpe ratio, the equity curve
+	// is sampled once per Period. Defaults to 252 periods of 24 hours.
+	Period         time.Duration
+	PeriodsPerYear float64
+}
+
+// Context gives the strategy access to the simulated account during a run.
+type Context struct {
+	Time   time.Time
+	Broker *paper.Broker
+}
+
+// Enters a buy order on the simulated account.
+func (c *Context) Buy(id TradableId, price Decimal, volume float64) (*OrderReply, error) {
+	return c.order(id, Buy, price, volume)
+}
+
+// Enters a sell order on the simulated account.
+func (c *Context) Sell(id TradableId, price Decimal, volume float64) (*OrderReply, error) {
+	return c.order(id, Sell, price, volume)
+}
+
+// Deletes an order on the simulated account.
+func (c *Context) Cancel(orderId int64) (*OrderReply, error) {
+	return c.Broker.DeleteOrder(Accno, orderId)
+}
+
+// Returns the current holding of a tradable.
+func (c *Context) Position(id TradableId) float64 {
+	positions, _ := c.Broker.AccountPositions(Accno)
+	for _, pos := range positions {
+		if pos.Instrument.Tradables[0].TradableId == id {
+			return pos.Qty
+		}
+	}
+	return 0
+}
+
+func (c *Context) order(id TradableId, side Side, price Decimal, volume float64) (*OrderReply, error) {
+	return c.Broker.CreateOrder(Accno, &api.Params{
+		"identifier": id.Identifier,
+		"market_id":  strconv.FormatInt(id.MarketId, 10),
+		"price":      price.String(),
+		"volume":     strconv.FormatFloat(volume, 'f', -1, 64),
+		"side":       side.String(),
+	})
+}
+
+// A point on the equity curve
+type EquityPoint struct {
+	Time   time.Time
+	Equity float64
+}
+
+// A fill in the trade log
+type Fill struct {
+	Time       time.Time
+	Trade      feed.PrivateTrade
+	Commission float64
+}
+
+// Result of a backtest run
+type Result struct {
+	Equity      []EquityPoint
+	Fills       []Fill
+	StartEquity float64
+	EndEquity   float64
+
+	// Largest peak to trough decline of the equity, as a fraction of the peak
+	MaxDrawdown float64
+
+	// Annualized Sharpe ratio of the periodic returns, with a zero risk free rate
+	Sharpe float64
+
+	// Traded value divided by the average equity
+	Turnover float64
+}
+
+// Runs the strategy until the source is exhausted.
+func (e *Engine) Run() (*Result, error) {
+	ctx := &Context{Broker: paper.NewBroker()}
+	ctx.Broker.Now = func() time.Time { return ctx.Time }
+	if e.Commission != nil {
+		ctx.Broker.Commission = e.Commission.Commission
+	}
+	if e.Slippage != nil {
+		ctx.Broker.Slippage = e.Slippage.Slip
+	}
+	ctx.Broker.OpenAccount(Accno, e.Currency, e.Cash)
+
+	var pending []*feed.PrivateMsg
+	ctx.Broker.Notify(func(msg *feed.PrivateMsg) { pending = append(pending, msg) })
+
+	res := &Result{StartEquity: e.Cash}
+	deliver := func() {
+		for len(pending) > 0 {
+			msg := pending[0]
+			pending = pending[1:]
+			switch data := msg.Data.(type) {
+			case feed.PrivateOrder:
+				e.Strategy.OnOrder(ctx, data)
+			case feed.PrivateTrade:
+				fill := Fill{Time: ctx.Time, Trade: data}
+				if e.Commission != nil {
+					fill.Commission = e.Commission.Commission(data.Price.Float64(), data.Volume)
+				}
+				res.Fills = append(res.Fills, fill)
+				e.Strategy.OnFill(ctx, data)
+			}
+		}
+	}
+
+	for {
+		event, err := e.Source.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		ctx.Time = event.Time
+		ctx.Broker.Update(event.Msg)
+		deliver()
+
+		switch data := event.Msg.Data.(type) {
+		case feed.PublicPrice:
+			e.Strategy.OnPrice(ctx, data)
+		case feed.PublicDepth:
+			e.Strategy.OnDepth(ctx, data)
+		case feed.PublicTrade:
+			e.Strategy.OnTrade(ctx, data)
+		case feed.PublicTradingStatus:
+			e.Strategy.OnTradingStatus(ctx, data)
+		}
+		deliver()
+
+		info, err := ctx.Broker.Account(Accno)
+		if err != nil {
+			return nil, err
+		}
+		res.Equity = append(res.Equity, EquityPoint{event.Time, info.OwnCapital.Float64()})
+	}
+
+	e.summarize(res)
+	return res, nil
+}
+
+func (e *Engine) summarize(res *Result) {
+	res.EndEquity = res.StartEquity
+	if len(res.Equity) == 0 {
+		return
+	}
+	res.EndEquity = res.Equity[len(res.Equity)-1].Equity
+
+	var peak, sum float64
+	for _, p := range res.Equity {
+		peak = math.Max(peak, p.Equity)
+		if peak > 0 {
+			res.MaxDrawdown = math.Max(res.MaxDrawdown, (peak-p.Equity)/peak)
+		}
+		sum += p.Equity
+	}
+
+	var traded float64
+	for _, f := range res.Fills {
+		traded += f.Trade.Price.Float64() * f.Trade.Volume
+	}
+	if avg := sum / float64(len(res.Equity)); avg != 0 {
+		res.Turnover = traded / avg
+	}
+
+	res.Sharpe = sharpe(e.returns(res.Equity), e.periodsPerYear())
+}
+
+// Returns of the equity curve sampled at the end of each period
+func (e *Engine) returns(equity []EquityPoint) (res []float64) {
+	period := e.Period
+	if period <= 0 {
+		period = 24 * time.Hour
+	}
+
+	var samples []float64
+	var current time.Time
+	for i, p := range equity {
+		bucket := p.Time.Truncate(period)
+		if i == 0 || !bucket.Equal(current) {
+			samples = append(samples, p.Equity)
+			current = bucket
+		} else {
+			samples[len(samples)-1] = p.Equity
+		}
+	}
+
+	for i := 1; i < len(samples); i++ {
+		if samples[i-1] != 0 {
+			res = append(res, samples[i]/samples[i-1]-1)
+		}
+	}
+	return
+}
+
+func (e *Engine) periodsPerYear() float64 {
+	if e.PeriodsPerYear > 0 {
+		return e.PeriodsPerYear
+	}
+	return 252
+}
+
+func sharpe(returns []float64, periodsPerYear float64) float64 {
+	if len(returns) < 2 {
+		return 0
+	}
+
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	var variance float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	if std == 0 {
+		return 0
+	}
+	return mean / std * math.Sqrt(periodsPerYear)
+}
@@ -0,0 +1,147 @@
+package backtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+)
+
+var tradable = TradableId{Identifier: "101", MarketId: 11}
+
+// Buys on the first price and sells once the price has risen by two, with limits room away from the quotes
+type testStrategy struct {
+	NopStrategy
+	room   Decimal
+	entry  Decimal
+	orders []string
+}
+
+func (s *testStrategy) OnPrice(ctx *Context, price feed.PublicPrice) {
+	switch pos := ctx.Position(tradable); {
+	case s.entry.IsZero():
+		s.entry = price.Ask
+		ctx.Buy(tradable, price.Ask.Add(s.room), 10)
+	case pos > 0 && price.Bid.Cmp(s.entry.Add(NewDecimal(2, 0))) >= 0:
+		ctx.Sell(tradable, price.Bid.Sub(s.room), pos)
+	}
+}
+
+func (s *testStrategy) OnOrder(ctx *Context, order feed.PrivateOrder) {
+	s.orders = append(s.orders, order.Side.String()+" "+order.OrderState.String())
+}
+
+func day(n int) Timestamp {
+	return NewTimestamp(time.Date(2016, 1, n, 12, 0, 0, 0, time.UTC))
+}
+
+func graph() []IntradayGraph {
+	return []IntradayGraph{{
+		TradableId: tradable,
+		Ticks: []IntradayTick{
+			{Timestamp: day(1), Last: NewDecimal(100, 0), Volume: 100},
+			{Timestamp: day(2), Last: NewDecimal(98, 0), Volume: 100},
+			{Timestamp: day(3), Last: NewDecimal(101, 0), Volume: 100},
+			{Timestamp: day(4), Last: NewDecimal(103, 0), Volume: 100},
+			{Timestamp: day(5), Last: NewDecimal(104, 0), Volume: 100},
+		},
+	}}
+}
+
+func TestRun(t *testing.T) {
+	strategy := &testStrategy{}
+	engine := &Engine{
+		Strategy:   strategy,
+		Source:     NewIntradaySource(graph()),
+		Cash:       10000,
+		Currency:   "SEK",
+		Commission: FixedCommission(1),
+	}
+
+	res, err := engine.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert := assert.New(t)
+	assert.Equal([]string{"BUY ON_MARKET", "BUY DONE", "SELL ON_MARKET", "SELL DONE"}, strategy.orders)
+	if assert.Len(res.Fills, 2) {
+		assert.Equal(NewDecimal(100, 0), res.Fills[0].Trade.Price.Value)
+		assert.Equal(NewDecimal(103, 0), res.Fills[1].Trade.Price.Value)
+		assert.Equal(1.0, res.Fills[1].Commission)
+		assert.Equal(time.Unix(0, int64(day(4))*int64(time.Millisecond)), res.Fills[1].Time)
+	}
+
+	assert.Len(res.Equity, 5)
+	assert.Equal(10000.0, res.StartEquity)
+	assert.Equal(10028.0, res.EndEquity)
+	assert.InDelta(0.0020, res.MaxDrawdown, 0.0001)
+	assert.InDelta(0.2028, res.Turnover, 0.0001)
+	assert.NotZero(res.Sharpe)
+
+	again, _ := (&Engine{
+		Strategy:   &testStrategy{},
+		Source:     NewIntradaySource(graph()),
+		Cash:       10000,
+		Currency:   "SEK",
+		Commission: FixedCommission(1),
+	}).Run()
+	assert.Equal(res, again)
+}
+
+func TestRunWithSlippage(t *testing.T) {
+	assert := assert.New(t)
+
+	for slippage, expected := range map[FixedSlippage][]Decimal{
+		// the orders are filled worse than the quotes of 100 and 103
+		0.5: {NewDecimal(1005, -1), NewDecimal(1025, -1)},
+		// but never past their limits of 101 and 102
+		2: {NewDecimal(101, 0), NewDecimal(102, 0)},
+	} {
+		engine := &Engine{
+			Strategy: &testStrategy{room: NewDecimal(1, 0)},
+			Source:   NewIntradaySource(graph()),
+			Cash:     10000,
+			Currency: "SEK",
+			Slippage: slippage,
+		}
+
+		res, err := engine.Run()
+		if !assert.NoError(err) {
+			continue
+		}
+		if assert.Len(res.Fills, 2) {
+			assert.Equal(expected[0], res.Fills[0].Trade.Price.Value)
+			assert.Equal(expected[1], res.Fills[1].Trade.Price.Value)
+		}
+	}
+
+	// marketable orders at the quotes are filled at them
+	res, err := (&Engine{
+		Strategy: &testStrategy{},
+		Source:   NewIntradaySource(graph()),
+		Cash:     10000,
+		Currency: "SEK",
+		Slippage: PercentSlippage(0.01),
+	}).Run()
+	if assert.NoError(err) && assert.Len(res.Fills, 2) {
+		assert.Equal(NewDecimal(100, 0), res.Fills[0].Trade.Price.Value)
+		assert.Equal(NewDecimal(103, 0), res.Fills[1].Trade.Price.Value)
+	}
+}
+
+func TestCostModels(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(39.0, FixedCommission(39).Commission(100, 10))
+	assert.Equal(39.0, PercentCommission{Rate: 0.001, Minimum: 39}.Commission(100, 10))
+	assert.Equal(50.0, PercentCommission{Rate: 0.001, Minimum: 39}.Commission(100, 500))
+
+	assert.Equal(101.0, FixedSlippage(1).Slip(100, true))
+	assert.Equal(99.0, FixedSlippage(1).Slip(100, false))
+	assert.Equal(101.0, PercentSlippage(0.01).Slip(100, true))
+	assert.Equal(99.0, PercentSlippage(0.01).Slip(100, false))
+}
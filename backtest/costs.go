@@ -0,0 +1,54 @@
+package backtest
+
+import (
+	"math"
+)
+
+// CommissionModel calculates the commission charged for a fill
+type CommissionModel interface {
+	Commission(price, volume float64) float64
+}
+
+// A fixed commission per fill
+type FixedCommission float64
+
+func (c FixedCommission) Commission(price, volume float64) float64 {
+	return float64(c)
+}
+
+// A commission proportional to the traded value, with an optional minimum per fill
+type PercentCommission struct {
+	Rate    float64
+	Minimum float64
+}
+
+func (c PercentCommission) Commission(price, volume float64) float64 {
+	return math.Max(c.Rate*price*volume, c.Minimum)
+}
+
+// SlippageModel adjusts the prices the simulated orders are filled at. The broker never fills at a better
+// price than the market or past the limit of the order, whatever the model returns.
+type SlippageModel interface {
+	// Returns the price a buy (or sell) order matching the given price would actually be filled at
+	Slip(price float64, buy bool) float64
+}
+
+// A fixed price offset against the order
+type FixedSlippage float64
+
+func (s FixedSlippage) Slip(price float64, buy bool) float64 {
+	if buy {
+		return price + float64(s)
+	}
+	return price - float64(s)
+}
+
+// A price offset against the order proportional to the price
+type PercentSlippage float64
+
+func (s PercentSlippage) Slip(price float64, buy bool) float64 {
+	if buy {
+		return price * (1 + float64(s))
+	}
+	return price * (1 - float64(s))
+}
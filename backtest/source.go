@@ -0,0 +1,183 @@
+package backtest
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+)
+
+// A market event at a point in time
+type Event struct {
+	Time time.Time
+	Msg  *feed.PublicMsg
+}
+
+// Source provides market events in chronological order, Next returns io.EOF when there are no more events.
+type Source interface {
+	Next() (Event, error)
+}
+
+// Source backed by a slice of events
+type sliceSource struct {
+	events []Event
+}
+
+func (s *sliceSource) Next() (Event, error) {
+	if len(s.events) == 0 {
+		return Event{}, io.EOF
+	}
+	e := s.events[0]
+	s.events = s.events[1:]
+	return e, nil
+}
+
+// Returns a source emitting the events as given.
+func NewEventSource(events []Event) Source {
+	return &sliceSource{events}
+}
+
+// Returns a source emitting one price message per intraday tick, the last price is used as both bid and ask.
+func NewIntradaySource(graphs []IntradayGraph) Source {
+	events := []Event{}
+	for _, graph := range graphs {
+		for _, tick := range graph.Ticks {
+			events = append(events, Event{
+				Time: millis(tick.Timestamp),
+				Msg: &feed.PublicMsg{Type: "price", Data: feed.PublicPrice{
+					I:              graph.Identifier,
+					M:              graph.MarketId,
+					TickTimestamp:  tick.Timestamp,
+					TradeTimestamp: tick.Timestamp,
+					Bid:            tick.Last,
+					BidVolume:      tick.Volume,
+					Ask:            tick.Last,
+					AskVolume:      tick.Volume,
+					Last:           tick.Last,
+					LastVolume:     tick.Volume,
+					High:           tick.High,
+					Low:            tick.Low,
+				}},
+			})
+		}
+	}
+	return &sliceSource{sortEvents(events)}
+}
+
+// Returns a source emitting one trade message per public trade.
+func NewTradesSource(trades []PublicTrades) Source {
+	events := []Event{}
+	for _, tradable := range trades {
+		for _, trade := range tradable.Trades {
+			events = append(events, Event{
+				Time: millis(trade.TradeTimestamp),
+				Msg: &feed.PublicMsg{Type: "trade", Data: feed.PublicTrade{
+					I:              tradable.Identifier,
+					M:              tradable.MarketId,
+					TradeTimestamp: trade.TradeTimestamp,
+					Price:          trade.Price,
+					Volume:         float64(trade.Volume),
+					BrokerBuying:   trade.BrokerBuying,
+					BrokerSelling:  trade.BrokerSelling,
+					TradeId:        trade.TradeId,
+					TradeType:      trade.TradeType,
+				}},
+			})
+		}
+	}
+	return &sliceSource{sortEvents(events)}
+}
+
+// Source reading messages recorded from the public feed
+type recordingSource struct {
+	decoder *json.Decoder
+	last    time.Time
+}
+
+// Returns a source reading a recording of public feed messages, one JSON message per line as sent by the feed.
+// The event time is taken from the message timestamps, messages without a timestamp keep the previous time.
+func NewRecordingSource(r io.Reader) Source {
+	return &recordingSource{decoder: json.NewDecoder(r)}
+}
+
+func (s *recordingSource) Next() (Event, error) {
+	msg := &feed.PublicMsg{}
+	if err := s.decoder.Decode(msg); err != nil {
+		return Event{}, err
+	}
+
+	if ts := timestamp(msg); ts != 0 {
+		s.last = millis(ts)
+	}
+	return Event{Time: s.last, Msg: msg}, nil
+}
+
+// Source merging several sources by time
+type mergedSource struct {
+	sources []Source
+	heads   []*Event
+}
+
+// Returns a source merging the events of all sources in chronological order.
+// Events at the same time are emitted in the order of the sources.
+func NewMergedSource(sources ...Source) Source {
+	return &mergedSource{sources: sources, heads: make([]*Event, len(sources))}
+}
+
+func (s *mergedSource) Next() (Event, error) {
+	next := -1
+	for i, source := range s.sources {
+		if s.heads[i] == nil && source != nil {
+			e, err := source.Next()
+			if err == io.EOF {
+				s.sources[i] = nil
+				continue
+			} else if err != nil {
+				return Event{}, err
+			}
+			s.heads[i] = &e
+		}
+		if s.heads[i] != nil && (next == -1 || s.heads[i].Time.Before(s.heads[next].Time)) {
+			next = i
+		}
+	}
+
+	if next == -1 {
+		return Event{}, io.EOF
+	}
+	e := *s.heads[next]
+	s.heads[next] = nil
+	return e, nil
+}
+
+func sortEvents(events []Event) []Event {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
+
+// Returns the timestamp in milliseconds of a public message
+func timestamp(msg *feed.PublicMsg) Timestamp {
+	switch data := msg.Data.(type) {
+	case feed.PublicPrice:
+		if data.TickTimestamp != 0 {
+			return data.TickTimestamp
+		}
+		return data.TradeTimestamp
+	case feed.PublicDepth:
+		return data.TickTimestamp
+	case feed.PublicTrade:
+		return data.TradeTimestamp
+	case feed.PublicTradingStatus:
+		return data.TickTimestamp
+	case feed.PublicIndicator:
+		return data.TickTimestamp
+	}
+	return 0
+}
+
+func millis(ms Timestamp) time.Time {
+	return time.Unix(0, int64(ms)*int64(time.Millisecond))
+}
@@ -0,0 +1,75 @@
+package backtest
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+)
+
+var recording = `{"type":"price","data":{"i":"101","m":11,"tick_timestamp":2000,"bid":1,"ask":2}}
+{"type":"heartbeat","data":{}}
+{"type":"trade","data":{"i":"101","m":11,"trade_timestamp":3000,"price":2,"volume":10}}
+`
+
+func collect(t *testing.T, s Source) (res []Event) {
+	for {
+		e, err := s.Next()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, e)
+	}
+}
+
+func TestRecordingSource(t *testing.T) {
+	events := collect(t, NewRecordingSource(strings.NewReader(recording)))
+
+	assert := assert.New(t)
+	if assert.Len(events, 3) {
+		assert.Equal(time.Unix(2, 0), events[0].Time)
+		assert.Equal(NewDecimal(2, 0), events[0].Msg.Data.(feed.PublicPrice).Ask)
+		assert.Equal(time.Unix(2, 0), events[1].Time)
+		assert.Equal("heartbeat", events[1].Msg.Type)
+		assert.Equal(time.Unix(3, 0), events[2].Time)
+	}
+}
+
+func TestTradesSource(t *testing.T) {
+	events := collect(t, NewTradesSource([]PublicTrades{{
+		TradableId: TradableId{Identifier: "101", MarketId: 11},
+		Trades:     []PublicTrade{{Price: NewDecimal(2, 0), Volume: 5, TradeTimestamp: 2000}, {Price: NewDecimal(1, 0), Volume: 5, TradeTimestamp: 1000}},
+	}}))
+
+	assert := assert.New(t)
+	if assert.Len(events, 2) {
+		trade := events[0].Msg.Data.(feed.PublicTrade)
+		assert.Equal(NewDecimal(1, 0), trade.Price)
+		assert.Equal(5.0, trade.Volume)
+		assert.Equal("101", trade.I)
+	}
+}
+
+func TestMergedSource(t *testing.T) {
+	at := func(s int64, typ string) Event {
+		return Event{Time: time.Unix(s, 0), Msg: &feed.PublicMsg{Type: typ}}
+	}
+	events := collect(t, NewMergedSource(
+		NewEventSource([]Event{at(1, "a"), at(3, "a"), at(5, "a")}),
+		NewEventSource([]Event{at(2, "b"), at(3, "b")}),
+		NewEventSource(nil),
+	))
+
+	var order []string
+	for _, e := range events {
+		order = append(order, e.Msg.Type)
+	}
+	assert.Equal(t, []string{"a", "b", "a", "b", "a"}, order)
+}
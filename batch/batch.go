@@ -0,0 +1,313 @@
+// Package batch looks up many ids at once with the endpoints taking comma separated ids.
+//
+// A Batcher takes the ids as slices, splits them into requests of at most ChunkSize ids, runs the requests
+// concurrently, waiting for the Limiter if one is set, and returns the results in the order of the ids.
+// Lookups made within the Window of each other are joined, so many callers looking up single ids at the
+// same time share one request.
+package batch
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/denro/nordnet/util/models"
+)
+
+// Defaults of the Batcher
+const (
+	DefaultChunkSize   = 50
+	DefaultConcurrency = 4
+	DefaultWindow      = 5 * time.Millisecond
+)
+
+// The methods used by the Batcher, implemented by api.APIClient
+type Client interface {
+	Instruments(ids string) ([]Instrument, error)
+	Market(ids string) ([]Market, error)
+	TickSize(ids string) ([]TicksizeTable, error)
+	TradableInfo(ids string) ([]TradableInfo, error)
+	TradableIntraday(ids string) ([]IntradayGraph, error)
+	TradableTrades(ids string) ([]PublicTrades, error)
+	News(ids string) ([]NewsItem, error)
+	LookupCountries(countries string) ([]Country, error)
+	LookupIndicators(indicators string) ([]Indicator, error)
+}
+
+// Limiter is waited for before every request, like the gateway.Limiter shared by all users of a session
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// Batcher makes the lookups of a client in batches, it is safe for concurrent use.
+type Batcher struct {
+	Client Client
+
+	// Largest number of ids in one request
+	ChunkSize int
+
+	// Largest number of requests of a lookup in flight at once
+	Concurrency int
+
+	// Time a lookup waits for others to join its requests, lookups are not joined when it is 0
+	Window time.Duration
+
+	// Waited for before every request when set
+	Limiter Limiter
+
+	// the *endpoint of each lookup, of the type of its results
+	endpoints map[string]interface{}
+	mu        sync.Mutex
+}
+
+// Constructor function with the default chunk size, concurrency and window.
+func New(client Client) *Batcher {
+	return &Batcher{Client: client, ChunkSize: DefaultChunkSize, Concurrency: DefaultConcurrency, Window: DefaultWindow}
+}
+
+// Returns the instruments with the ids, leaving out the ids unknown to the API
+func (b *Batcher) Instruments(ids []int64) ([]Instrument, error) {
+	return lookup(b, "instruments", formatIds(ids), b.Client.Instruments, func(item Instrument) string {
+		return strconv.FormatInt(item.InstrumentId, 10)
+	})
+}
+
+// Returns the markets with the ids, leaving out the ids unknown to the API
+func (b *Batcher) Market(ids []int64) ([]Market, error) {
+	return lookup(b, "market", formatIds(ids), b.Client.Market, func(item Market) string {
+		return strconv.FormatInt(item.MarketId, 10)
+	})
+}
+
+// Returns the tick size tables with the ids, leaving out the ids unknown to the API
+func (b *Batcher) TickSize(ids []int64) ([]TicksizeTable, error) {
+	return lookup(b, "tick_size", formatIds(ids), b.Client.TickSize, func(item TicksizeTable) string {
+		return strconv.FormatInt(item.TickSizeId, 10)
+	})
+}
+
+// Returns the intraday graphs of the tradables, leaving out the tradables unknown to the API
+func (b *Batcher) TradableIntraday(ids []TradableId) ([]IntradayGraph, error) {
+	return lookup(b, "tradable_intraday", formatTradables(ids), b.Client.TradableIntraday, func(item IntradayGraph) string {
+		return item.Key().String()
+	})
+}
+
+// Returns the public trades of the tradables, leaving out the tradables unknown to the API
+func (b *Batcher) TradableTrades(ids []TradableId) ([]PublicTrades, error) {
+	return lookup(b, "tradable_trades", formatTradables(ids), b.Client.TradableTrades, func(item PublicTrades) string {
+		return item.Key().String()
+	})
+}
+
+// Returns the news items with the ids, leaving out the ids unknown to the API
+func (b *Batcher) News(ids []int64) ([]NewsItem, error) {
+	return lookup(b, "news", formatIds(ids), b.Client.News, func(item NewsItem) string {
+		return strconv.FormatInt(item.NewsId, 10)
+	})
+}
+
+// Returns the countries with the country codes, like "SE", leaving out the codes unknown to the API
+func (b *Batcher) LookupCountries(countries []string) ([]Country, error) {
+	return lookup(b, "countries", countries, b.Client.LookupCountries, func(item Country) string {
+		return item.Country
+	})
+}
+
+// Returns the indicators with the keys of source and identifier, like "SIX:OMXS30", leaving out the
+// indicators unknown to the API
+func (b *Batcher) LookupIndicators(indicators []TradableKey) ([]Indicator, error) {
+	keys := make([]string, len(indicators))
+	for i, k := range indicators {
+		keys[i] = k.String()
+	}
+
+	return lookup(b, "indicators", keys, b.Client.LookupIndicators, func(item Indicator) string {
+		return NewIndicatorKey(item.Src, item.Identifier).String()
+	})
+}
+
+// Returns the trading calendars and order types of the tradables. The results carry no identifier
+// to tell them apart, so the lookups are split into chunks but never joined with other lookups and
+// the results are returned in the order the API sent them.
+func (b *Batcher) TradableInfo(ids []TradableId) ([]TradableInfo, error) {
+	chunks, err := fetchChunks(b, formatTradables(ids), b.Client.TradableInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []TradableInfo
+	for _, chunk := range chunks {
+		res = append(res, chunk...)
+	}
+	return res, nil
+}
+
+// Looks up the ids with the endpoint of the given name and returns the results in the order of the ids,
+// id returns the id of a result
+func lookup[T any](b *Batcher, name string, ids []string, fetch func(ids string) ([]T, error), id func(T) string) ([]T, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	b.mu.Lock()
+	if b.endpoints == nil {
+		b.endpoints = map[string]interface{}{}
+	}
+	e, ok := b.endpoints[name].(*endpoint[T])
+	if !ok {
+		e = &endpoint[T]{}
+		b.endpoints[name] = e
+	}
+	b.mu.Unlock()
+
+	results, err := e.get(b, ids, fetch, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []T
+	for _, id := range ids {
+		if item, ok := results[id]; ok {
+			res = append(res, item)
+		}
+	}
+	return res, nil
+}
+
+// Fetches the ids in chunks of at most ChunkSize ids, running up to Concurrency requests at once.
+// Returns the results of every chunk or the first error.
+func fetchChunks[T any](b *Batcher, ids []string, fetch func(ids string) ([]T, error)) ([][]T, error) {
+	size := b.ChunkSize
+	if size <= 0 {
+		size = len(ids)
+	}
+	var chunks []string
+	for start := 0; start < len(ids); start += size {
+		end := start + size
+		if end > len(ids) {
+			end = len(ids)
+		}
+		chunks = append(chunks, strings.Join(ids[start:end], ","))
+	}
+
+	concurrency := b.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var (
+		wg       sync.WaitGroup
+		results  = make([][]T, len(chunks))
+		errs     = make([]error, len(chunks))
+		requests = make(chan struct{}, concurrency)
+	)
+	for i, chunk := range chunks {
+		wg.Add(1)
+		requests <- struct{}{}
+		go func(i int, chunk string) {
+			defer func() {
+				<-requests
+				wg.Done()
+			}()
+			if b.Limiter != nil {
+				if errs[i] = b.Limiter.Wait(context.Background()); errs[i] != nil {
+					return
+				}
+			}
+			results[i], errs[i] = fetch(chunk)
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// Joins the lookups of an endpoint made within the window of the first one
+type endpoint[T any] struct {
+	pending *pending[T]
+	mu      sync.Mutex
+}
+
+// Ids waiting for the window to pass and the results once fetched
+type pending[T any] struct {
+	ids     []string
+	seen    map[string]bool
+	results map[string]T
+	err     error
+	done    chan struct{}
+}
+
+// Adds the ids to the pending lookup, starting one when there is none, and waits for its results
+func (e *endpoint[T]) get(b *Batcher, ids []string, fetch func(ids string) ([]T, error), id func(T) string) (map[string]T, error) {
+	e.mu.Lock()
+	p := e.pending
+	if p == nil {
+		p = &pending[T]{seen: map[string]bool{}, done: make(chan struct{})}
+	}
+	for _, id := range ids {
+		if !p.seen[id] {
+			p.seen[id] = true
+			p.ids = append(p.ids, id)
+		}
+	}
+
+	if e.pending == nil {
+		if b.Window <= 0 {
+			e.mu.Unlock()
+			p.run(b, fetch, id)
+			return p.results, p.err
+		}
+		e.pending = p
+		time.AfterFunc(b.Window, func() {
+			e.mu.Lock()
+			e.pending = nil
+			e.mu.Unlock()
+			p.run(b, fetch, id)
+		})
+	}
+	e.mu.Unlock()
+
+	<-p.done
+	return p.results, p.err
+}
+
+// Fetches the ids and indexes the results by their id
+func (p *pending[T]) run(b *Batcher, fetch func(ids string) ([]T, error), id func(T) string) {
+	defer close(p.done)
+
+	chunks, err := fetchChunks(b, p.ids, fetch)
+	if err != nil {
+		p.err = err
+		return
+	}
+	p.results = map[string]T{}
+	for _, chunk := range chunks {
+		for _, item := range chunk {
+			p.results[id(item)] = item
+		}
+	}
+}
+
+func formatIds(ids []int64) []string {
+	res := make([]string, len(ids))
+	for i, id := range ids {
+		res[i] = strconv.FormatInt(id, 10)
+	}
+	return res
+}
+
+func formatTradables(ids []TradableId) []string {
+	res := make([]string, len(ids))
+	for i, id := range ids {
+		res[i] = id.Key().String()
+	}
+	return res
+}
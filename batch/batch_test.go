@@ -0,0 +1,195 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/api/apitest"
+	. "github.com/denro/nordnet/util/models"
+)
+
+// Returns a mock knowing the instruments with ids below 100, in reverse order of the requested ids
+func newMock() *apitest.Mock {
+	return &apitest.Mock{
+		InstrumentsFunc: func(ids string) (res []Instrument, err error) {
+			for _, s := range strings.Split(ids, ",") {
+				if id, _ := strconv.ParseInt(s, 10, 64); id < 100 {
+					res = append([]Instrument{{InstrumentId: id, Symbol: "I" + s}}, res...)
+				}
+			}
+			return
+		},
+	}
+}
+
+func TestChunks(t *testing.T) {
+	assert := assert.New(t)
+
+	mock := newMock()
+	b := New(mock)
+	b.ChunkSize = 2
+	b.Window = 0
+
+	instruments, err := b.Instruments([]int64{5, 4, 100, 2, 1})
+	assert.NoError(err)
+	assert.Equal([]Instrument{{InstrumentId: 5, Symbol: "I5"}, {InstrumentId: 4, Symbol: "I4"}, {InstrumentId: 2, Symbol: "I2"}, {InstrumentId: 1, Symbol: "I1"}}, instruments)
+
+	var requested []string
+	for _, call := range mock.CallsTo("Instruments") {
+		requested = append(requested, call.Args[0].(string))
+	}
+	sort.Strings(requested)
+	assert.Equal([]string{"1", "100,2", "5,4"}, requested)
+
+	instruments, err = b.Instruments(nil)
+	assert.NoError(err)
+	assert.Empty(instruments)
+	assert.Len(mock.CallsTo("Instruments"), 3)
+}
+
+func TestConcurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	var inFlight, maxInFlight int32
+	mock := &apitest.Mock{
+		MarketFunc: func(ids string) ([]Market, error) {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			id, _ := strconv.ParseInt(ids, 10, 64)
+			return []Market{{MarketId: id}}, nil
+		},
+	}
+	b := New(mock)
+	b.ChunkSize = 1
+	b.Concurrency = 3
+
+	ids := []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	markets, err := b.Market(ids)
+	assert.NoError(err)
+	for i, market := range markets {
+		assert.Equal(ids[i], market.MarketId)
+	}
+	assert.Len(mock.CallsTo("Market"), 10)
+	assert.Equal(int32(3), maxInFlight)
+}
+
+func TestCoalescing(t *testing.T) {
+	assert := assert.New(t)
+
+	mock := newMock()
+	b := New(mock)
+	b.Window = 50 * time.Millisecond
+
+	var wg sync.WaitGroup
+	for i := int64(1); i <= 10; i++ {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			instruments, err := b.Instruments([]int64{id, 1})
+			if assert.NoError(err) && assert.Len(instruments, 2) {
+				assert.Equal(id, instruments[0].InstrumentId)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	calls := mock.CallsTo("Instruments")
+	if assert.Len(calls, 1) {
+		ids := strings.Split(calls[0].Args[0].(string), ",")
+		sort.Strings(ids)
+		assert.Equal([]string{"1", "10", "2", "3", "4", "5", "6", "7", "8", "9"}, ids)
+	}
+
+	// a later lookup makes a request of its own
+	b.Instruments([]int64{1})
+	assert.Len(mock.CallsTo("Instruments"), 2)
+}
+
+type limiter struct {
+	waits int32
+	err   error
+}
+
+func (l *limiter) Wait(ctx context.Context) error {
+	atomic.AddInt32(&l.waits, 1)
+	return l.err
+}
+
+func TestLimiterAndErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	mock := newMock()
+	l := &limiter{}
+	b := New(mock)
+	b.ChunkSize = 2
+	b.Limiter = l
+
+	_, err := b.Instruments([]int64{1, 2, 3})
+	assert.NoError(err)
+	assert.Equal(int32(2), l.waits)
+
+	l.err = errors.New("rate limited")
+	_, err = b.Instruments([]int64{1})
+	assert.EqualError(err, "rate limited")
+	assert.Len(mock.CallsTo("Instruments"), 2)
+
+	l.err = nil
+	mock.NewsFunc = func(ids string) ([]NewsItem, error) {
+		if ids == "3" {
+			return nil, errors.New("failed")
+		}
+		return []NewsItem{{NewsId: 1}, {NewsId: 2}}, nil
+	}
+	news, err := b.News([]int64{1, 2, 3})
+	assert.EqualError(err, "failed")
+	assert.Nil(news)
+}
+
+func TestKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	eric := TradableId{Identifier: "101", MarketId: 11}
+	volvo := TradableId{Identifier: "1869", MarketId: 11}
+	mock := &apitest.Mock{
+		TradableTradesFunc: func(ids string) ([]PublicTrades, error) {
+			return []PublicTrades{{TradableId: volvo}, {TradableId: eric}}, nil
+		},
+		TradableInfoFunc: func(ids string) ([]TradableInfo, error) {
+			return []TradableInfo{{MarketId: 11, Iceberg: ids == "11:101"}}, nil
+		},
+		LookupIndicatorsFunc: func(indicators string) ([]Indicator, error) {
+			return []Indicator{{Src: "SIX", Identifier: "OMXS30"}}, nil
+		},
+	}
+	b := New(mock)
+	b.ChunkSize = 1
+
+	trades, err := b.TradableTrades([]TradableId{eric, volvo})
+	assert.NoError(err)
+	assert.Equal([]PublicTrades{{TradableId: eric}, {TradableId: volvo}}, trades)
+
+	info, err := b.TradableInfo([]TradableId{eric, volvo})
+	assert.NoError(err)
+	assert.Equal([]TradableInfo{{MarketId: 11, Iceberg: true}, {MarketId: 11}}, info)
+
+	indicators, err := b.LookupIndicators([]TradableKey{"SIX:OMXS30", "SIX:OMXS30"})
+	assert.NoError(err)
+	assert.Len(indicators, 2)
+	assert.Equal(apitest.Call{"LookupIndicators", []interface{}{"SIX:OMXS30"}}, mock.CallsTo("LookupIndicators")[0])
+}
@@ -0,0 +1,404 @@
+// Package bridge multiplexes one upstream public and private feed connection to many clients.
+//
+// Clients subscribe with the same arguments as the public feed and only receive the messages of
+// their own subscriptions. Upstream subscriptions are reference counted, the first client needing
+// one subscribes and the last client leaving unsubscribes. Every client has a buffer of its own and a
+// Policy deciding what happens when it falls behind, so a slow client never stalls the others.
+// The Bridge serves clients over WebSockets, other transports can use NewClient directly.
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/denro/nordnet/feed"
+)
+
+// Returned when subscribing on a closed client
+var ClientClosedError = errors.New("Client is closed")
+
+// Returned for private subscriptions of WebSocket clients when the Bridge has no Authorize function
+var PrivateDeniedError = errors.New("Private subscriptions are not allowed")
+
+// Policy decides what happens to the messages of a client whose buffer is full
+type Policy int
+
+const (
+	// Drops the oldest buffered message to make room, clients see the latest messages
+	DropOldest Policy = iota
+
+	// Drops the new message, clients see the buffered messages first
+	DropNewest
+
+	// Disconnects the client
+	Disconnect
+)
+
+var policyNames = []string{"drop_oldest", "drop_newest", "disconnect"}
+
+// Policy implements the Stringer interface
+func (p Policy) String() string {
+	if p < 0 || int(p) >= len(policyNames) {
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+	return policyNames[p]
+}
+
+// Parses a policy by its name, "drop_oldest", "drop_newest" or "disconnect"
+func ParsePolicy(s string) (Policy, error) {
+	for i, name := range policyNames {
+		if s == name {
+			return Policy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown policy %q, use %s", s, strings.Join(policyNames, ", "))
+}
+
+// Subscribes to the upstream public feed, implemented by feed.PublicFeed
+type Subscriber interface {
+	Subscribe(args interface{}) error
+	Unsubscribe(args interface{}) error
+}
+
+// Arguments for subscribing a client to the orders and trades of the private feed, an Accno of 0 subscribes to all accounts
+type PrivateArgs struct {
+	T     string `json:"t"`
+	Accno int64  `json:"accno,omitempty"`
+}
+
+// An upstream subscription shared by the clients needing it
+type subscription struct {
+	args  interface{}
+	count int
+}
+
+// Bridge delivers the messages of the upstream feeds to its clients, it is safe for concurrent use.
+type Bridge struct {
+	// Policy of the clients served over WebSockets, they may choose another one with the policy query parameter
+	Policy Policy
+
+	// Number of messages buffered for each client
+	Buffer int
+
+	// Upgrades the WebSocket requests, the default only accepts requests from the same origin
+	Upgrader websocket.Upgrader
+
+	// Decides whether the WebSocket request may subscribe to the private feed with the arguments, an error
+	// denies the subscription. It must check the Accno, an Accno of 0 subscribes to all accounts of the
+	// session. Private subscriptions of WebSocket clients are denied when nil.
+	Authorize func(r *http.Request, args *PrivateArgs) error
+
+	upstream      Subscriber
+	subscriptions map[string]*subscription
+	clients       map[*Client]bool
+	mu            sync.Mutex
+}
+
+// Constructor function taking the upstream public feed, which may be nil until it is attached.
+// Clients buffer 256 messages and drop the oldest when they fall behind.
+func New(upstream Subscriber) *Bridge {
+	return &Bridge{
+		Policy:        DropOldest,
+		Buffer:        256,
+		upstream:      upstream,
+		subscriptions: map[string]*subscription{},
+		clients:       map[*Client]bool{},
+	}
+}
+
+// Replaces the upstream public feed and subscribes it to everything the clients need, used after
+// reconnecting. A nil upstream detaches the feed, subscriptions are then only remembered.
+func (b *Bridge) Attach(upstream Subscriber) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.upstream = upstream
+	if upstream == nil {
+		return nil
+	}
+	for _, s := range b.subscriptions {
+		if err := upstream.Subscribe(s.args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sends a message of the public feed to the clients subscribing to it, heartbeats are sent to all clients.
+func (b *Bridge) Public(msg *feed.PublicMsg) {
+	key := messageKey(msg)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for c := range b.clients {
+		if c.keys[key] || msg.Type == "heartbeat" {
+			c.send((*feed.FeedMsg)(msg))
+		}
+	}
+}
+
+// Sends a message of the private feed to the clients subscribing to the account.
+func (b *Bridge) Private(msg *feed.PrivateMsg) {
+	var accno int64
+	switch data := msg.Data.(type) {
+	case feed.PrivateOrder:
+		accno = data.Accno
+	case feed.PrivateTrade:
+		accno = data.Accno
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for c := range b.clients {
+		if c.keys[privateKey(0)] || c.keys[privateKey(accno)] || msg.Type == "heartbeat" {
+			c.send((*feed.FeedMsg)(msg))
+		}
+	}
+}
+
+// Returns a new client with the given policy, it receives nothing until it subscribes.
+func (b *Bridge) NewClient(policy Policy) *Client {
+	buffer := b.Buffer
+	if buffer < 1 {
+		buffer = 1
+	}
+	c := &Client{
+		bridge: b,
+		policy: policy,
+		keys:   map[string]bool{},
+		msgs:   make(chan *feed.FeedMsg, buffer),
+		done:   make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	b.clients[c] = true
+	b.mu.Unlock()
+	return c
+}
+
+// Returns the number of connected clients.
+func (b *Bridge) Clients() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clients)
+}
+
+// Disconnects every client.
+func (b *Bridge) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for c := range b.clients {
+		c.close()
+	}
+}
+
+// Adds a reference to the upstream subscription, the lock must be held
+func (b *Bridge) subscribe(key string, args interface{}) error {
+	s, ok := b.subscriptions[key]
+	if !ok {
+		if b.upstream != nil {
+			if err := b.upstream.Subscribe(args); err != nil {
+				return err
+			}
+		}
+		s = &subscription{args: args}
+		b.subscriptions[key] = s
+	}
+	s.count++
+	return nil
+}
+
+// Removes a reference to the upstream subscription, the lock must be held
+func (b *Bridge) unsubscribe(key string) error {
+	s := b.subscriptions[key]
+	if s.count--; s.count > 0 {
+		return nil
+	}
+	delete(b.subscriptions, key)
+	if b.upstream != nil {
+		return b.upstream.Unsubscribe(s.args)
+	}
+	return nil
+}
+
+// Client receives the messages of its subscriptions
+type Client struct {
+	bridge  *Bridge
+	policy  Policy
+	keys    map[string]bool
+	msgs    chan *feed.FeedMsg
+	done    chan struct{}
+	dropped int64
+}
+
+// Returns the channel of messages for the client.
+func (c *Client) Messages() <-chan *feed.FeedMsg {
+	return c.msgs
+}
+
+// Returns a channel closed when the client is closed, by Close or by the Disconnect policy.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Returns the number of messages dropped because the client fell behind.
+func (c *Client) Dropped() int64 {
+	return atomic.LoadInt64(&c.dropped)
+}
+
+// Subscribes the client with the arguments of the public feed, e.g. a *feed.PriceArgs, or with *PrivateArgs.
+// Subscribing twice to the same data has no effect.
+func (c *Client) Subscribe(args interface{}) error {
+	key := subscriptionKey(args)
+	if key == "" {
+		return fmt.Errorf("unsupported subscription %T", args)
+	}
+
+	c.bridge.mu.Lock()
+	defer c.bridge.mu.Unlock()
+
+	if c.closed() {
+		return ClientClosedError
+	}
+	if c.keys[key] {
+		return nil
+	}
+	if _, private := args.(*PrivateArgs); !private {
+		if err := c.bridge.subscribe(key, args); err != nil {
+			return err
+		}
+	}
+	c.keys[key] = true
+	return nil
+}
+
+// Unsubscribes the client, the upstream is unsubscribed when no other client needs the data.
+func (c *Client) Unsubscribe(args interface{}) error {
+	key := subscriptionKey(args)
+
+	c.bridge.mu.Lock()
+	defer c.bridge.mu.Unlock()
+
+	if !c.keys[key] {
+		return nil
+	}
+	delete(c.keys, key)
+	if _, private := args.(*PrivateArgs); !private {
+		return c.bridge.unsubscribe(key)
+	}
+	return nil
+}
+
+// Closes the client and releases its subscriptions.
+func (c *Client) Close() {
+	c.bridge.mu.Lock()
+	defer c.bridge.mu.Unlock()
+	c.close()
+}
+
+func (c *Client) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Closes the client, the bridge lock must be held
+func (c *Client) close() {
+	if c.closed() {
+		return
+	}
+	close(c.done)
+	delete(c.bridge.clients, c)
+
+	for key := range c.keys {
+		if !strings.HasPrefix(key, "private/") {
+			c.bridge.unsubscribe(key)
+		}
+	}
+	c.keys = map[string]bool{}
+}
+
+// Buffers the message following the policy when the buffer is full, the bridge lock must be held
+func (c *Client) send(msg *feed.FeedMsg) {
+	select {
+	case c.msgs <- msg:
+		return
+	default:
+	}
+
+	switch c.policy {
+	case DropOldest:
+		// the client may have read a message meanwhile, then nothing is dropped
+		select {
+		case <-c.msgs:
+			atomic.AddInt64(&c.dropped, 1)
+		default:
+		}
+		select {
+		case c.msgs <- msg:
+		default:
+			atomic.AddInt64(&c.dropped, 1)
+		}
+	case DropNewest:
+		atomic.AddInt64(&c.dropped, 1)
+	case Disconnect:
+		atomic.AddInt64(&c.dropped, 1)
+		c.close()
+	}
+}
+
+// Returns the key identifying the messages of a subscription, the same key is returned by messageKey
+func subscriptionKey(args interface{}) string {
+	switch args := args.(type) {
+	case *feed.PriceArgs:
+		return "price/" + args.Key().String()
+	case *feed.DepthArgs:
+		return "depth/" + args.Key().String()
+	case *feed.TradeArgs:
+		return "trade/" + args.Key().String()
+	case *feed.TradingStatusArgs:
+		return "trading_status/" + args.Key().String()
+	case *feed.NewsArgs:
+		return fmt.Sprintf("news/%d", args.S)
+	case *feed.IndicatorArgs:
+		return "indicator/" + args.Key().String()
+	case *PrivateArgs:
+		return privateKey(args.Accno)
+	}
+	return ""
+}
+
+// Returns the key of the subscription a message belongs to
+func messageKey(msg *feed.PublicMsg) string {
+	switch data := msg.Data.(type) {
+	case feed.PublicPrice:
+		return "price/" + data.Key().String()
+	case feed.PublicDepth:
+		return "depth/" + data.Key().String()
+	case feed.PublicTrade:
+		return "trade/" + data.Key().String()
+	case feed.PublicTradingStatus:
+		return "trading_status/" + data.Key().String()
+	case feed.PublicNews:
+		return "news/" + data.SourceId
+	case feed.PublicIndicator:
+		return "indicator/" + data.Key().String()
+	}
+	return ""
+}
+
+func privateKey(accno int64) string {
+	return fmt.Sprintf("private/%d", accno)
+}
@@ -0,0 +1,176 @@
+package bridge
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/feed"
+	"github.com/denro/nordnet/util/models"
+)
+
+type fakeSubscriber struct {
+	subscribed, unsubscribed []interface{}
+	sync.Mutex
+}
+
+func (s *fakeSubscriber) Subscribe(args interface{}) error {
+	s.Lock()
+	s.subscribed = append(s.subscribed, args)
+	s.Unlock()
+	return nil
+}
+
+func (s *fakeSubscriber) Unsubscribe(args interface{}) error {
+	s.Lock()
+	s.unsubscribed = append(s.unsubscribed, args)
+	s.Unlock()
+	return nil
+}
+
+func (s *fakeSubscriber) calls() (subscribed, unsubscribed []interface{}) {
+	s.Lock()
+	defer s.Unlock()
+	return append([]interface{}{}, s.subscribed...), append([]interface{}{}, s.unsubscribed...)
+}
+
+func price(identifier string, last int64) *feed.PublicMsg {
+	return &feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: identifier, M: 11, Last: models.NewDecimal(last, 0)}}
+}
+
+// Returns the buffered messages of the client
+func received(c *Client) (res []*feed.FeedMsg) {
+	for {
+		select {
+		case msg := <-c.Messages():
+			res = append(res, msg)
+		default:
+			return
+		}
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	upstream := &fakeSubscriber{}
+	b := New(upstream)
+
+	assert := assert.New(t)
+
+	first, second := b.NewClient(DropOldest), b.NewClient(DropOldest)
+	assert.NoError(first.Subscribe(&feed.PriceArgs{T: "price", I: "101", M: 11}))
+	assert.NoError(first.Subscribe(&feed.PriceArgs{T: "price", I: "101", M: 11}))
+	assert.NoError(first.Subscribe(&PrivateArgs{T: "private", Accno: 1}))
+	assert.NoError(second.Subscribe(&feed.PriceArgs{T: "price", I: "101", M: 11}))
+	assert.NoError(second.Subscribe(&feed.PriceArgs{T: "price", I: "102", M: 11}))
+	assert.NoError(second.Subscribe(&PrivateArgs{T: "private"}))
+	assert.EqualError(second.Subscribe(struct{}{}), "unsupported subscription struct {}")
+
+	subscribed, _ := upstream.calls()
+	assert.Equal([]interface{}{
+		&feed.PriceArgs{T: "price", I: "101", M: 11},
+		&feed.PriceArgs{T: "price", I: "102", M: 11},
+	}, subscribed)
+
+	b.Public(price("101", 1))
+	b.Public(price("102", 2))
+	b.Public(price("103", 3))
+	b.Public(&feed.PublicMsg{Type: "heartbeat", Data: struct{}{}})
+	b.Private(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{Accno: 1, OrderId: 5}})
+	b.Private(&feed.PrivateMsg{Type: "trade", Data: feed.PrivateTrade{Accno: 2, OrderId: 6}})
+
+	assert.Equal([]*feed.FeedMsg{
+		{Type: "price", Data: feed.PublicPrice{I: "101", M: 11, Last: models.NewDecimal(1, 0)}},
+		{Type: "heartbeat", Data: struct{}{}},
+		{Type: "order", Data: feed.PrivateOrder{Accno: 1, OrderId: 5}},
+	}, received(first))
+	assert.Equal([]*feed.FeedMsg{
+		{Type: "price", Data: feed.PublicPrice{I: "101", M: 11, Last: models.NewDecimal(1, 0)}},
+		{Type: "price", Data: feed.PublicPrice{I: "102", M: 11, Last: models.NewDecimal(2, 0)}},
+		{Type: "heartbeat", Data: struct{}{}},
+		{Type: "order", Data: feed.PrivateOrder{Accno: 1, OrderId: 5}},
+		{Type: "trade", Data: feed.PrivateTrade{Accno: 2, OrderId: 6}},
+	}, received(second))
+
+	// the upstream is unsubscribed when the last client leaves
+	assert.NoError(first.Unsubscribe(&feed.PriceArgs{T: "price", I: "101", M: 11}))
+	_, unsubscribed := upstream.calls()
+	assert.Empty(unsubscribed)
+	second.Close()
+	_, unsubscribed = upstream.calls()
+	assert.ElementsMatch([]interface{}{
+		&feed.PriceArgs{T: "price", I: "101", M: 11},
+		&feed.PriceArgs{T: "price", I: "102", M: 11},
+	}, unsubscribed)
+	assert.Equal(ClientClosedError, second.Subscribe(&feed.NewsArgs{T: "news", S: 1}))
+	assert.Equal(1, b.Clients())
+
+	// subscriptions made while detached are subscribed on the next upstream
+	assert.NoError(b.Attach(nil))
+	assert.NoError(first.Subscribe(&feed.NewsArgs{T: "news", S: 2}))
+	reconnected := &fakeSubscriber{}
+	assert.NoError(b.Attach(reconnected))
+	subscribed, _ = reconnected.calls()
+	assert.Equal([]interface{}{&feed.NewsArgs{T: "news", S: 2}}, subscribed)
+
+	b.Close()
+	assert.Equal(0, b.Clients())
+	select {
+	case <-first.Done():
+	default:
+		t.Error("client not closed with the bridge")
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	upstream := &fakeSubscriber{}
+	b := New(upstream)
+	b.Buffer = 2
+
+	assert := assert.New(t)
+
+	clients := map[Policy]*Client{}
+	for _, policy := range []Policy{DropOldest, DropNewest, Disconnect} {
+		clients[policy] = b.NewClient(policy)
+		clients[policy].Subscribe(&feed.PriceArgs{T: "price", I: "101", M: 11})
+	}
+
+	for i := 1; i <= 3; i++ {
+		b.Public(price("101", int64(i)))
+	}
+
+	lasts := func(c *Client) (res []float64) {
+		for _, msg := range received(c) {
+			res = append(res, msg.Data.(feed.PublicPrice).Last.Float64())
+		}
+		return
+	}
+	assert.Equal([]float64{2, 3}, lasts(clients[DropOldest]))
+	assert.Equal(int64(1), clients[DropOldest].Dropped())
+	assert.Equal([]float64{1, 2}, lasts(clients[DropNewest]))
+	assert.Equal(int64(1), clients[DropNewest].Dropped())
+
+	select {
+	case <-clients[Disconnect].Done():
+	default:
+		t.Error("client not disconnected")
+	}
+	assert.Equal(int64(1), clients[Disconnect].Dropped())
+	assert.Equal(2, b.Clients())
+
+	_, unsubscribed := upstream.calls()
+	assert.Empty(unsubscribed)
+}
+
+func TestParsePolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, policy := range []Policy{DropOldest, DropNewest, Disconnect} {
+		parsed, err := ParsePolicy(policy.String())
+		assert.NoError(err)
+		assert.Equal(policy, parsed)
+	}
+	_, err := ParsePolicy("block")
+	assert.EqualError(err, `unknown policy "block", use drop_oldest, drop_newest, disconnect`)
+	assert.Equal("Policy(7)", Policy(7).String())
+}
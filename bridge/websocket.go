@@ -0,0 +1,157 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/denro/nordnet/feed"
+)
+
+// Time allowed for writing the close message to a WebSocket
+const closeTimeout = time.Second
+
+// Command sent by WebSocket clients, the same format as feed.FeedCmd
+type command struct {
+	Cmd  string          `json:"cmd"`
+	Args json.RawMessage `json:"args"`
+}
+
+// Data of the error messages sent to WebSocket clients for rejected commands
+type CommandError struct {
+	Cmd     string `json:"cmd"`
+	Message string `json:"message"`
+}
+
+// Bridge implements the http.Handler interface, upgrading the request to a WebSocket.
+//
+// Clients send subscribe and unsubscribe commands in the format of the feed, e.g.
+// {"cmd": "subscribe", "args": {"t": "price", "i": "101", "m": 11}}, and {"t": "private", "accno": 1}
+// subscribes to the orders and trades of an account when allowed by Authorize. Messages are sent in the format of the feed and
+// rejected commands are answered with an "error" message with CommandError data. The policy query
+// parameter selects the Policy of the client.
+func (b *Bridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	policy := b.Policy
+	if name := r.URL.Query().Get("policy"); name != "" {
+		var err error
+		if policy, err = ParsePolicy(name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	conn, err := b.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has responded with the error
+		return
+	}
+	defer conn.Close()
+
+	c := b.NewClient(policy)
+	defer c.Close()
+	go c.readCommands(conn, r)
+
+	for {
+		select {
+		case msg := <-c.Messages():
+			if err = conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-c.Done():
+			code, reason := websocket.CloseGoingAway, "bridge closed"
+			if policy == Disconnect && c.Dropped() > 0 {
+				code, reason = websocket.CloseTryAgainLater, "client fell behind"
+			}
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(closeTimeout))
+			return
+		}
+	}
+}
+
+// Reads the commands of the WebSocket client of the request until the connection is closed
+func (c *Client) readCommands(conn *websocket.Conn, r *http.Request) {
+	defer c.Close()
+
+	for {
+		cmd := command{}
+		if err := conn.ReadJSON(&cmd); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				c.reply(&CommandError{Message: err.Error()})
+				continue
+			}
+			return
+		}
+
+		args, err := parseArgs(cmd.Args)
+		if err == nil {
+			switch cmd.Cmd {
+			case "subscribe":
+				if private, ok := args.(*PrivateArgs); ok {
+					if err = c.bridge.authorize(r, private); err != nil {
+						break
+					}
+				}
+				err = c.Subscribe(args)
+			case "unsubscribe":
+				err = c.Unsubscribe(args)
+			default:
+				err = fmt.Errorf("unknown command %q", cmd.Cmd)
+			}
+		}
+		if err != nil {
+			c.reply(&CommandError{Cmd: cmd.Cmd, Message: err.Error()})
+		}
+	}
+}
+
+// Sends an error message to the client
+func (c *Client) reply(e *CommandError) {
+	c.bridge.mu.Lock()
+	defer c.bridge.mu.Unlock()
+
+	if !c.closed() {
+		c.send(&feed.FeedMsg{Type: "error", Data: e})
+	}
+}
+
+// Checks a private subscription of a WebSocket client with Authorize
+func (b *Bridge) authorize(r *http.Request, args *PrivateArgs) error {
+	if b.Authorize == nil {
+		return PrivateDeniedError
+	}
+	return b.Authorize(r, args)
+}
+
+// Decodes the arguments of a command into the argument type of the subscription type
+func parseArgs(raw json.RawMessage) (args interface{}, err error) {
+	t := struct {
+		T string `json:"t"`
+	}{}
+	if err = json.Unmarshal(raw, &t); err != nil {
+		return
+	}
+
+	switch t.T {
+	case "price":
+		args = &feed.PriceArgs{}
+	case "depth":
+		args = &feed.DepthArgs{}
+	case "trade":
+		args = &feed.TradeArgs{}
+	case "trading_status":
+		args = &feed.TradingStatusArgs{}
+	case "indicator":
+		args = &feed.IndicatorArgs{}
+	case "news":
+		args = &feed.NewsArgs{}
+	case "private":
+		args = &PrivateArgs{}
+	default:
+		return nil, fmt.Errorf("unknown subscription type %q", t.T)
+	}
+	err = json.Unmarshal(raw, args)
+	return
+}
@@ -0,0 +1,146 @@
+package bridge
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/feed"
+)
+
+func dial(t *testing.T, ts *httptest.Server, query string) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	return conn
+}
+
+func TestWebSocket(t *testing.T) {
+	upstream := &fakeSubscriber{}
+	b := New(upstream)
+	b.Authorize = func(r *http.Request, args *PrivateArgs) error { return nil }
+	ts := httptest.NewServer(b)
+	defer ts.Close()
+
+	assert := assert.New(t)
+
+	conn := dial(t, ts, "?policy=drop_newest")
+	defer conn.Close()
+
+	assert.NoError(conn.WriteJSON(&feed.FeedCmd{Cmd: "subscribe", Args: &feed.PriceArgs{T: "price", I: "101", M: 11}}))
+	assert.NoError(conn.WriteJSON(&feed.FeedCmd{Cmd: "subscribe", Args: &PrivateArgs{T: "private", Accno: 1}}))
+	assert.NoError(conn.WriteJSON(&feed.FeedCmd{Cmd: "subscribe", Args: map[string]string{"t": "quotes"}}))
+
+	var msg map[string]interface{}
+	if assert.NoError(conn.ReadJSON(&msg)) {
+		assert.Equal(map[string]interface{}{"type": "error", "data": map[string]interface{}{
+			"cmd": "subscribe", "message": `unknown subscription type "quotes"`,
+		}}, msg)
+	}
+	subscribed, _ := upstream.calls()
+	assert.Equal([]interface{}{&feed.PriceArgs{T: "price", I: "101", M: 11}}, subscribed)
+
+	b.Public(price("102", 1))
+	b.Public(price("101", 2))
+	b.Private(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{Accno: 1, OrderId: 5}})
+
+	if assert.NoError(conn.ReadJSON(&msg)) {
+		assert.Equal("price", msg["type"])
+		assert.Equal("101", msg["data"].(map[string]interface{})["i"])
+		assert.Equal(float64(2), msg["data"].(map[string]interface{})["last"])
+	}
+	if assert.NoError(conn.ReadJSON(&msg)) {
+		assert.Equal("order", msg["type"])
+		assert.Equal(float64(5), msg["data"].(map[string]interface{})["order_id"])
+	}
+
+	assert.NoError(conn.WriteJSON(&feed.FeedCmd{Cmd: "unsubscribe", Args: &feed.PriceArgs{T: "price", I: "101", M: 11}}))
+	assert.Eventually(func() bool {
+		_, unsubscribed := upstream.calls()
+		return len(unsubscribed) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// closing the bridge closes the WebSocket
+	b.Close()
+	_, _, err := conn.ReadMessage()
+	assert.True(websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+}
+
+func TestWebSocketAuthorize(t *testing.T) {
+	b := New(&fakeSubscriber{})
+	ts := httptest.NewServer(b)
+	defer ts.Close()
+
+	assert := assert.New(t)
+
+	denied := func(conn *websocket.Conn, args *PrivateArgs, message string) {
+		assert.NoError(conn.WriteJSON(&feed.FeedCmd{Cmd: "subscribe", Args: args}))
+		var msg map[string]interface{}
+		if assert.NoError(conn.ReadJSON(&msg)) {
+			assert.Equal(map[string]interface{}{"type": "error", "data": map[string]interface{}{
+				"cmd": "subscribe", "message": message,
+			}}, msg)
+		}
+	}
+
+	// private subscriptions are denied without Authorize
+	conn := dial(t, ts, "")
+	defer conn.Close()
+	denied(conn, &PrivateArgs{T: "private", Accno: 1}, PrivateDeniedError.Error())
+
+	b.Authorize = func(r *http.Request, args *PrivateArgs) error {
+		if r.URL.Query().Get("user") == "1" && args.Accno == 1 {
+			return nil
+		}
+		return fmt.Errorf("account %d is not allowed", args.Accno)
+	}
+	conn = dial(t, ts, "?user=1")
+	defer conn.Close()
+	denied(conn, &PrivateArgs{T: "private"}, "account 0 is not allowed")
+	denied(conn, &PrivateArgs{T: "private", Accno: 2}, "account 2 is not allowed")
+
+	// the commands are handled in order, the subscription is made once the next command is denied
+	assert.NoError(conn.WriteJSON(&feed.FeedCmd{Cmd: "subscribe", Args: &PrivateArgs{T: "private", Accno: 1}}))
+	denied(conn, &PrivateArgs{T: "private", Accno: 3}, "account 3 is not allowed")
+
+	b.Private(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{Accno: 1, OrderId: 5}})
+	var msg map[string]interface{}
+	if assert.NoError(conn.ReadJSON(&msg)) {
+		assert.Equal("order", msg["type"])
+	}
+}
+
+func TestWebSocketDisconnect(t *testing.T) {
+	b := New(&fakeSubscriber{})
+	ts := httptest.NewServer(b)
+	defer ts.Close()
+
+	assert := assert.New(t)
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"?policy=block", nil)
+	if assert.Equal(websocket.ErrBadHandshake, err) {
+		assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	}
+
+	conn := dial(t, ts, "")
+	assert.NoError(conn.WriteJSON(&feed.FeedCmd{Cmd: "subscribe", Args: &feed.NewsArgs{T: "news", S: 2}}))
+	assert.Eventually(func() bool {
+		subscribed, _ := b.upstream.(*fakeSubscriber).calls()
+		return len(subscribed) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// clients leaving are closed and their subscriptions released
+	conn.Close()
+	assert.Eventually(func() bool {
+		_, unsubscribed := b.upstream.(*fakeSubscriber).calls()
+		return b.Clients() == 0 && len(unsubscribed) == 1
+	}, time.Second, 10*time.Millisecond)
+}
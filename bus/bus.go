@@ -0,0 +1,318 @@
+// Package bus fans the messages of the feeds out to many subscribers within a process.
+//
+// Dispatch sends every message on one channel, so a single slow reader stalls the decoder and the
+// connection backs up towards the server. A Bus reads that channel without waiting and buffers the
+// messages for each subscriber separately, the Policy of a subscriber decides what happens when it
+// falls behind. Dropped messages are counted per subscriber and for the whole bus.
+package bus
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/denro/nordnet/feed"
+)
+
+// Policy decides what happens to the messages of a subscriber whose buffer is full
+type Policy int
+
+const (
+	// Waits for the subscriber, stalling the publisher and every other subscriber
+	Block Policy = iota
+
+	// Drops the oldest buffered message to make room
+	DropOldest
+
+	// Drops the new message
+	DropNewest
+
+	// Replaces the buffered message of the same type and instrument with the new one, see Key.
+	// Messages without a key are never replaced and the oldest message is dropped when the buffer is full.
+	Conflate
+)
+
+var policyNames = []string{"block", "drop_oldest", "drop_newest", "conflate"}
+
+// Policy implements the Stringer interface
+func (p Policy) String() string {
+	if p < 0 || int(p) >= len(policyNames) {
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+	return policyNames[p]
+}
+
+// Parses a policy by its name, "block", "drop_oldest", "drop_newest" or "conflate"
+func ParsePolicy(s string) (Policy, error) {
+	for i, name := range policyNames {
+		if s == name {
+			return Policy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown policy %q, use %s", s, strings.Join(policyNames, ", "))
+}
+
+// Returns the conflation key of a message, the type and tradable of prices, depths and trading statuses
+// and the type and indicator of indicators. Other messages, like trades, news and private messages,
+// have no key as every one of them matters.
+func Key(msg interface{}) string {
+	m, ok := msg.(*feed.PublicMsg)
+	if !ok {
+		return ""
+	}
+	switch data := m.Data.(type) {
+	case feed.PublicPrice:
+		return "price/" + data.Key().String()
+	case feed.PublicDepth:
+		return "depth/" + data.Key().String()
+	case feed.PublicTradingStatus:
+		return "trading_status/" + data.Key().String()
+	case feed.PublicIndicator:
+		return "indicator/" + data.Key().String()
+	}
+	return ""
+}
+
+// Bus delivers every published message to all subscribers, it is safe for concurrent use.
+type Bus struct {
+	subscribers map[*Subscriber]bool
+	dropped     int64
+	mu          sync.RWMutex
+}
+
+// Constructor function for a bus without subscribers.
+func New() *Bus {
+	return &Bus{subscribers: map[*Subscriber]bool{}}
+}
+
+// Adds a subscriber buffering up to buffer messages, at least one.
+func (b *Bus) Subscribe(buffer int, policy Policy) *Subscriber {
+	if buffer < 1 {
+		buffer = 1
+	}
+	s := &Subscriber{
+		bus:     b,
+		policy:  policy,
+		buffer:  buffer,
+		pending: map[string]*entry{},
+		c:       make(chan interface{}),
+		done:    make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	b.mu.Lock()
+	b.subscribers[s] = true
+	b.mu.Unlock()
+
+	go s.pump()
+	return s
+}
+
+// Delivers the message to every subscriber, only waiting for subscribers with the Block policy.
+func (b *Bus) Publish(msg interface{}) {
+	b.mu.RLock()
+	subscribers := make([]*Subscriber, 0, len(b.subscribers))
+	for s := range b.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	b.mu.RUnlock()
+
+	for _, s := range subscribers {
+		s.push(msg)
+	}
+}
+
+// Returns a channel to pass to PublicFeed.Dispatch, the messages sent on it are published.
+// Messages failing to decode are skipped, their errors are sent on the error channel of Dispatch.
+func (b *Bus) PublicChan() chan *feed.PublicMsg {
+	msgs := make(chan *feed.PublicMsg)
+	go func() {
+		for msg := range msgs {
+			if msg.Data != nil {
+				b.Publish(msg)
+			}
+		}
+	}()
+	return msgs
+}
+
+// Returns a channel to pass to PrivateFeed.Dispatch, the messages sent on it are published.
+func (b *Bus) PrivateChan() chan *feed.PrivateMsg {
+	msgs := make(chan *feed.PrivateMsg)
+	go func() {
+		for msg := range msgs {
+			if msg.Data != nil {
+				b.Publish(msg)
+			}
+		}
+	}()
+	return msgs
+}
+
+// Returns the number of messages dropped for all subscribers, including those already closed.
+func (b *Bus) Dropped() int64 {
+	return atomic.LoadInt64(&b.dropped)
+}
+
+// Returns the number of subscribers.
+func (b *Bus) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subscribers)
+}
+
+// Closes every subscriber.
+func (b *Bus) Close() {
+	b.mu.RLock()
+	subscribers := make([]*Subscriber, 0, len(b.subscribers))
+	for s := range b.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	b.mu.RUnlock()
+
+	for _, s := range subscribers {
+		s.Close()
+	}
+}
+
+// A buffered message, the message of a conflated entry is replaced by newer ones
+type entry struct {
+	key string
+	msg interface{}
+}
+
+// Subscriber receives the messages published on the bus
+type Subscriber struct {
+	bus    *Bus
+	policy Policy
+	buffer int
+
+	queue   []*entry
+	pending map[string]*entry
+	closed  bool
+	dropped int64
+
+	c    chan interface{}
+	done chan struct{}
+	mu   sync.Mutex
+	cond *sync.Cond
+}
+
+// Returns the channel of messages, *feed.PublicMsg or *feed.PrivateMsg when published from the feed
+// channels. The channel is closed when the subscriber is closed.
+func (s *Subscriber) C() <-chan interface{} {
+	return s.c
+}
+
+// Returns the number of messages dropped or replaced because the subscriber fell behind.
+func (s *Subscriber) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Returns the number of buffered messages.
+func (s *Subscriber) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// Removes the subscriber from the bus and closes its channel, buffered messages are discarded.
+func (s *Subscriber) Close() {
+	s.bus.mu.Lock()
+	delete(s.bus.subscribers, s)
+	s.bus.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.queue, s.pending = nil, nil
+	close(s.done)
+	s.cond.Broadcast()
+}
+
+// Buffers the message following the policy
+func (s *Subscriber) push(msg interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var key string
+	if s.policy == Conflate {
+		if key = Key(msg); key != "" {
+			if e, ok := s.pending[key]; ok {
+				e.msg = msg
+				s.drop()
+				return
+			}
+		}
+	}
+
+	for !s.closed && len(s.queue) >= s.buffer {
+		switch s.policy {
+		case Block:
+			s.cond.Wait()
+			continue
+		case DropNewest:
+			s.drop()
+			return
+		}
+		s.pop()
+		s.drop()
+	}
+	if s.closed {
+		return
+	}
+
+	e := &entry{key: key, msg: msg}
+	s.queue = append(s.queue, e)
+	if key != "" {
+		s.pending[key] = e
+	}
+	s.cond.Broadcast()
+}
+
+// Removes the oldest message from the buffer, the lock must be held
+func (s *Subscriber) pop() *entry {
+	e := s.queue[0]
+	s.queue[0] = nil
+	s.queue = s.queue[1:]
+	if e.key != "" {
+		delete(s.pending, e.key)
+	}
+	return e
+}
+
+// Counts a dropped message, the lock must be held
+func (s *Subscriber) drop() {
+	atomic.AddInt64(&s.dropped, 1)
+	atomic.AddInt64(&s.bus.dropped, 1)
+}
+
+// Sends the buffered messages on the channel until the subscriber is closed
+func (s *Subscriber) pump() {
+	defer close(s.c)
+
+	for {
+		s.mu.Lock()
+		for !s.closed && len(s.queue) == 0 {
+			s.cond.Wait()
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		e := s.pop()
+		// wakes publishers blocked on a full buffer
+		s.cond.Broadcast()
+		s.mu.Unlock()
+
+		select {
+		case s.c <- e.msg:
+		case <-s.done:
+			return
+		}
+	}
+}
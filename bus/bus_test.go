@@ -0,0 +1,171 @@
+package bus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/feed"
+	"github.com/denro/nordnet/util/models"
+)
+
+func price(identifier string, last int64) *feed.PublicMsg {
+	return &feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: identifier, M: 11, Last: models.NewDecimal(last, 0)}}
+}
+
+func trade(identifier string, price int64) *feed.PublicMsg {
+	return &feed.PublicMsg{Type: "trade", Data: feed.PublicTrade{I: identifier, M: 11, Price: models.NewDecimal(price, 0)}}
+}
+
+// Publishes the first message and waits until the subscriber holds it, leaving the buffer empty
+func publishFirst(t *testing.T, b *Bus, s *Subscriber, msg interface{}) {
+	b.Publish(msg)
+	assert.Eventually(t, func() bool { return s.Len() == 0 }, time.Second, time.Millisecond)
+}
+
+func receive(t *testing.T, s *Subscriber, n int) (res []interface{}) {
+	for i := 0; i < n; i++ {
+		select {
+		case msg := <-s.C():
+			res = append(res, msg)
+		case <-time.After(time.Second):
+			t.Fatalf("received %d of %d messages", i, n)
+		}
+	}
+	return
+}
+
+func TestDropPolicies(t *testing.T) {
+	assert := assert.New(t)
+
+	for policy, expected := range map[Policy][]interface{}{
+		DropOldest: {price("1", 1), price("3", 3), price("4", 4)},
+		DropNewest: {price("1", 1), price("2", 2), price("3", 3)},
+	} {
+		b := New()
+		s := b.Subscribe(2, policy)
+		publishFirst(t, b, s, price("1", 1))
+		b.Publish(price("2", 2))
+		b.Publish(price("3", 3))
+		b.Publish(price("4", 4))
+
+		assert.Equal(expected, receive(t, s, 3), policy.String())
+		assert.Equal(int64(1), s.Dropped(), policy.String())
+		assert.Equal(int64(1), b.Dropped(), policy.String())
+	}
+}
+
+func TestConflate(t *testing.T) {
+	b := New()
+	s := b.Subscribe(3, Conflate)
+
+	assert := assert.New(t)
+
+	publishFirst(t, b, s, price("101", 1))
+	b.Publish(price("101", 2))
+	b.Publish(price("102", 3))
+	b.Publish(price("101", 4))
+	b.Publish(trade("101", 10))
+
+	// the latest price keeps the place of the first buffered one
+	assert.Equal([]interface{}{price("101", 1), price("101", 4), price("102", 3), trade("101", 10)}, receive(t, s, 4))
+	assert.Equal(int64(1), s.Dropped())
+
+	// trades are never conflated, the oldest message is dropped when the buffer is full
+	publishFirst(t, b, s, price("101", 5))
+	b.Publish(trade("101", 11))
+	b.Publish(trade("101", 12))
+	b.Publish(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{OrderId: 5}})
+	b.Publish(price("101", 6))
+	assert.Equal([]interface{}{
+		price("101", 5),
+		trade("101", 12),
+		&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{OrderId: 5}},
+		price("101", 6),
+	}, receive(t, s, 4))
+	assert.Equal(int64(2), s.Dropped())
+	assert.Equal(0, s.Len())
+}
+
+func TestBlock(t *testing.T) {
+	b := New()
+	s := b.Subscribe(1, Block)
+
+	assert := assert.New(t)
+
+	publishFirst(t, b, s, price("1", 1))
+	b.Publish(price("2", 2))
+
+	published := make(chan struct{})
+	go func() {
+		b.Publish(price("3", 3))
+		close(published)
+	}()
+
+	select {
+	case <-published:
+		t.Fatal("publish did not wait for the subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.Equal([]interface{}{price("1", 1), price("2", 2), price("3", 3)}, receive(t, s, 3))
+	<-published
+	assert.Equal(int64(0), s.Dropped())
+
+	// closing releases a blocked publisher
+	publishFirst(t, b, s, price("4", 4))
+	b.Publish(price("5", 5))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.Close()
+	}()
+	b.Publish(price("6", 6))
+}
+
+func TestFeedChannels(t *testing.T) {
+	b := New()
+	slow := b.Subscribe(1, DropNewest)
+	fast := b.Subscribe(100, Block)
+
+	assert := assert.New(t)
+
+	public, private := b.PublicChan(), b.PrivateChan()
+	for i := 0; i < 50; i++ {
+		public <- price("101", int64(i))
+	}
+	public <- &feed.PublicMsg{Type: "price"}
+	private <- &feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{OrderId: 5}}
+
+	msgs := receive(t, fast, 51)
+	assert.Equal(price("101", 49), msgs[49])
+	assert.Equal(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{OrderId: 5}}, msgs[50])
+	// the slow subscriber keeps at most one message buffered and one waiting to be received
+	assert.Eventually(func() bool { return slow.Dropped() >= 49 }, time.Second, time.Millisecond)
+	assert.Equal(slow.Dropped(), b.Dropped())
+
+	assert.Equal(2, b.Subscribers())
+	b.Close()
+	assert.Equal(0, b.Subscribers())
+	for range slow.C() {
+	}
+	_, open := <-fast.C()
+	assert.False(open)
+	assert.Equal(slow.Dropped(), b.Dropped())
+}
+
+func TestParsePolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, policy := range []Policy{Block, DropOldest, DropNewest, Conflate} {
+		parsed, err := ParsePolicy(policy.String())
+		assert.NoError(err)
+		assert.Equal(policy, parsed)
+	}
+	_, err := ParsePolicy("latest")
+	assert.EqualError(err, `unknown policy "latest", use block, drop_oldest, drop_newest, conflate`)
+
+	assert.Equal("price/11:101", Key(price("101", 1)))
+	assert.Equal("", Key(trade("101", 1)))
+	assert.Equal("", Key(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{}}))
+}
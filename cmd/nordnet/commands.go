@@ -0,0 +1,391 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/util/models"
+)
+
+// State shared by the commands
+type cli struct {
+	config  *Config
+	client  *api.APIClient
+	session *models.Login
+	out     *output
+
+	// Opens a connection to a feed from the login response
+	connect func(models.Feed) (io.ReadWriteCloser, error)
+
+	stdout, stderr io.Writer
+}
+
+type command struct {
+	name, args, help string
+
+	// Whether the client must be logged in before running the command
+	login bool
+
+	run func(c *cli, args []string) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"status", "", "show the system status", false, status},
+		{"accounts", "", "list the accounts", true, accounts},
+		{"account", "<accno>", "show the account summary", true, account},
+		{"ledgers", "<accno>", "list the currency ledgers of an account", true, ledgers},
+		{"positions", "<accno>", "list the positions of an account", true, positions},
+		{"orders", "[-deleted] <accno>", "list the orders of an account", true, orders},
+		{"trades", "[-days n] <accno>", "list the trades of an account", true, trades},
+		{"order create", "[flags] <accno> [key=value...]", "enter a new order", true, createOrder},
+		{"order update", "[flags] <accno> <order_id> [key=value...]", "modify the price and volume of an order", true, updateOrder},
+		{"order delete", "<accno> <order_id>", "delete an order", true, deleteOrder},
+		{"order activate", "<accno> <order_id>", "activate an inactive order", true, activateOrder},
+		{"instruments search", "[-type t] [-limit n] <query>", "free text search for instruments", true, searchInstruments},
+		{"instruments lookup", "<type> <value>", "lookup instruments, e.g. market_id_identifier 11:101", true, lookupInstruments},
+		{"stream", "[flags] [market:identifier...]", "print live events from the public and private feeds", true, stream},
+		{"dashboard", "[-news ids] <accno>", "interactive dashboard of positions, orders and news", true, dashboardCmd},
+	}
+}
+
+// Finds a command by name, the commands grouped under order and instruments are named by the first two arguments
+func findCommand(args []string) (*command, []string) {
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd, args[1:]
+		}
+		if len(args) > 1 && cmd.name == args[0]+" "+args[1] {
+			return cmd, args[2:]
+		}
+	}
+	return nil, nil
+}
+
+// Returns a flag set for the arguments of a command
+func (c *cli) flags(name, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: nordnet %s %s\n", name, args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// Parses the flags of a command and checks the number of positional arguments
+func parse(flags *flag.FlagSet, args []string, min int) ([]string, error) {
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() < min {
+		flags.Usage()
+		return nil, fmt.Errorf("%s: expected at least %d arguments", flags.Name(), min)
+	}
+	return flags.Args(), nil
+}
+
+func parseId(name, s string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", name, s)
+	}
+	return id, nil
+}
+
+// Parses the account number and the optional order id of a command
+func parseIds(args []string, order bool) (accno, orderId int64, err error) {
+	if accno, err = parseId("account number", args[0]); err != nil || !order {
+		return
+	}
+	orderId, err = parseId("order id", args[1])
+	return
+}
+
+// Adds the key=value arguments to the params
+func parseParams(params api.Params, args []string) error {
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid parameter %q, expected key=value", arg)
+		}
+		params[kv[0]] = kv[1]
+	}
+	return nil
+}
+
+func status(c *cli, args []string) error {
+	res, err := c.client.SystemStatus()
+	if err != nil {
+		return err
+	}
+	return c.out.write(res)
+}
+
+func accounts(c *cli, args []string) error {
+	res, err := c.client.Accounts()
+	if err != nil {
+		return err
+	}
+	return c.out.write(res)
+}
+
+func account(c *cli, args []string) error {
+	args, err := parse(c.flags("account", "<accno>"), args, 1)
+	if err != nil {
+		return err
+	}
+	accno, _, err := parseIds(args, false)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.client.Account(accno)
+	if err != nil {
+		return err
+	}
+	return c.out.write(res)
+}
+
+func ledgers(c *cli, args []string) error {
+	args, err := parse(c.flags("ledgers", "<accno>"), args, 1)
+	if err != nil {
+		return err
+	}
+	accno, _, err := parseIds(args, false)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.client.AccountLedgers(accno)
+	if err != nil {
+		return err
+	}
+	if c.out.format == "json" {
+		return c.out.write(res)
+	}
+
+	// the totals are left out of tables, they are per ledger currency
+	rows := []models.Ledger{}
+	for _, info := range res {
+		rows = append(rows, info.Ledgers...)
+	}
+	return c.out.write(rows)
+}
+
+func positions(c *cli, args []string) error {
+	args, err := parse(c.flags("positions", "<accno>"), args, 1)
+	if err != nil {
+		return err
+	}
+	accno, _, err := parseIds(args, false)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.client.AccountPositions(accno)
+	if err != nil {
+		return err
+	}
+	return c.out.write(res)
+}
+
+func orders(c *cli, args []string) error {
+	flags := c.flags("orders", "[-deleted] <accno>")
+	deleted := flags.Bool("deleted", false, "include deleted orders")
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	accno, _, err := parseIds(args, false)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.client.AccountOrders(accno, &api.Params{"deleted": strconv.FormatBool(*deleted)})
+	if err != nil {
+		return err
+	}
+	return c.out.write(res)
+}
+
+func trades(c *cli, args []string) error {
+	flags := c.flags("trades", "[-days n] <accno>")
+	days := flags.Int("days", 0, "number of days of trades to list, today only when 0")
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	accno, _, err := parseIds(args, false)
+	if err != nil {
+		return err
+	}
+
+	params := &api.Params{}
+	if *days > 0 {
+		(*params)["days"] = strconv.Itoa(*days)
+	}
+	res, err := c.client.AccountTrades(accno, params)
+	if err != nil {
+		return err
+	}
+	return c.out.write(res)
+}
+
+// Flags of order create and order update mapped to their API parameters
+type orderFlags map[string]*string
+
+func (f orderFlags) params() api.Params {
+	params := api.Params{}
+	for key, value := range f {
+		if *value != "" {
+			params[key] = *value
+		}
+	}
+	return params
+}
+
+func createOrder(c *cli, args []string) error {
+	flags := c.flags("order create", "[flags] <accno> [key=value...]")
+	f := orderFlags{
+		"market_id":            flags.String("market", "", "market id of the tradable"),
+		"identifier":           flags.String("identifier", "", "identifier of the tradable"),
+		"price":                flags.String("price", "", "limit price"),
+		"currency":             flags.String("currency", "", "currency of the price"),
+		"volume":               flags.String("volume", "", "volume"),
+		"side":                 flags.String("side", "", "BUY or SELL"),
+		"order_type":           flags.String("type", "", "order type, e.g. NORMAL, FAK or FOK"),
+		"valid_until":          flags.String("valid-until", "", "last day the order is valid, YYYY-MM-DD"),
+		"open_volume":          flags.String("open-volume", "", "visible volume of an iceberg order"),
+		"reference":            flags.String("reference", "", "reference returned on the private feed"),
+		"activation_condition": flags.String("activation", "", "activation condition, e.g. MANUAL for an inactive order"),
+	}
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	accno, _, err := parseIds(args, false)
+	if err != nil {
+		return err
+	}
+
+	params := f.params()
+	if err = parseParams(params, args[1:]); err != nil {
+		return err
+	}
+	for _, required := range []string{"market_id", "identifier", "volume", "side"} {
+		if params[required] == "" {
+			return fmt.Errorf("order create: %s is required", required)
+		}
+	}
+
+	res, err := c.client.CreateOrder(accno, &params)
+	if err != nil {
+		return err
+	}
+	return c.out.write(res)
+}
+
+func updateOrder(c *cli, args []string) error {
+	flags := c.flags("order update", "[flags] <accno> <order_id> [key=value...]")
+	f := orderFlags{
+		"price":    flags.String("price", "", "new limit price"),
+		"currency": flags.String("currency", "", "currency of the price"),
+		"volume":   flags.String("volume", "", "new volume"),
+	}
+	args, err := parse(flags, args, 2)
+	if err != nil {
+		return err
+	}
+	accno, orderId, err := parseIds(args, true)
+	if err != nil {
+		return err
+	}
+
+	params := f.params()
+	if err = parseParams(params, args[2:]); err != nil {
+		return err
+	}
+
+	res, err := c.client.UpdateOrder(accno, orderId, &params)
+	if err != nil {
+		return err
+	}
+	return c.out.write(res)
+}
+
+func deleteOrder(c *cli, args []string) error {
+	args, err := parse(c.flags("order delete", "<accno> <order_id>"), args, 2)
+	if err != nil {
+		return err
+	}
+	accno, orderId, err := parseIds(args, true)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.client.DeleteOrder(accno, orderId)
+	if err != nil {
+		return err
+	}
+	return c.out.write(res)
+}
+
+func activateOrder(c *cli, args []string) error {
+	args, err := parse(c.flags("order activate", "<accno> <order_id>"), args, 2)
+	if err != nil {
+		return err
+	}
+	accno, orderId, err := parseIds(args, true)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.client.ActivateOrder(accno, orderId)
+	if err != nil {
+		return err
+	}
+	return c.out.write(res)
+}
+
+func searchInstruments(c *cli, args []string) error {
+	flags := c.flags("instruments search", "[-type t] [-limit n] <query>")
+	instrumentType := flags.String("type", "", "instrument type, e.g. ESH")
+	limit := flags.Int("limit", 0, "maximum number of instruments")
+	args, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	params := &api.Params{"query": strings.Join(args, " ")}
+	if *instrumentType != "" {
+		(*params)["instrument_type"] = *instrumentType
+	}
+	if *limit > 0 {
+		(*params)["limit"] = strconv.Itoa(*limit)
+	}
+	res, err := c.client.SearchInstruments(params)
+	if err != nil {
+		return err
+	}
+	return c.out.write(res)
+}
+
+func lookupInstruments(c *cli, args []string) error {
+	args, err := parse(c.flags("instruments lookup", "<type> <value>"), args, 2)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.client.InstrumentLookup(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	return c.out.write(res)
+}
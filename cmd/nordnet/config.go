@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/util"
+)
+
+// Name of the default config file in the home directory
+const defaultConfigFile = ".nordnet.json"
+
+// Settings read from the config file and the environment
+type Config struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	PemFile     string `json:"pem_file"`
+	Environment string `json:"environment"`
+	URL         string `json:"url"`
+}
+
+// Reads the config file at path, or the default config file if path is empty, and applies the environment variables.
+// A missing default config file is not an error.
+func loadConfig(path string, getenv func(string) string) (config *Config, err error) {
+	config = &Config{}
+
+	if path == "" {
+		path = getenv("NORDNET_CONFIG")
+	}
+	explicit := path != ""
+	if !explicit {
+		if home := getenv("HOME"); home != "" {
+			path = filepath.Join(home, defaultConfigFile)
+		}
+	}
+
+	if path != "" {
+		var b []byte
+		if b, err = ioutil.ReadFile(path); err != nil {
+			if explicit || !os.IsNotExist(err) {
+				return nil, err
+			}
+			err = nil
+		} else if err = json.Unmarshal(b, config); err != nil {
+			return nil, fmt.Errorf("config %s: %v", path, err)
+		}
+	}
+
+	for env, field := range map[string]*string{
+		"NORDNET_USERNAME":    &config.Username,
+		"NORDNET_PASSWORD":    &config.Password,
+		"NORDNET_PEM_FILE":    &config.PemFile,
+		"NORDNET_ENVIRONMENT": &config.Environment,
+		"NORDNET_URL":         &config.URL,
+	} {
+		if value := getenv(env); value != "" {
+			*field = value
+		}
+	}
+
+	return
+}
+
+// Returns a client for the configured environment, the credentials are only generated when needed for logging in.
+func (config *Config) client(login bool) (client *api.APIClient, err error) {
+	var credentials string
+	if login {
+		if config.Username == "" || config.Password == "" || config.PemFile == "" {
+			return nil, errors.New("username, password and pem_file must be configured")
+		}
+		var pem []byte
+		if pem, err = ioutil.ReadFile(config.PemFile); err != nil {
+			return
+		}
+		if credentials, err = util.GenerateCredentials([]byte(config.Username), []byte(config.Password), pem); err != nil {
+			return
+		}
+	}
+
+	switch config.Environment {
+	case "", "test":
+		client = api.NewAPITestClient(credentials)
+	case "production":
+		client = api.NewAPIClient(credentials)
+	default:
+		return nil, fmt.Errorf("unknown environment %q, use \"test\" or \"production\"", config.Environment)
+	}
+	if config.URL != "" {
+		client.URL = config.URL
+	}
+	return
+}
@@ -0,0 +1,626 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+	"github.com/denro/nordnet/util/models"
+)
+
+// Interval between redraws of the dashboard
+const dashboardRefresh = 250 * time.Millisecond
+
+// Number of news items kept in the ticker
+const newsItems = 50
+
+// Sections of the dashboard the selection can move in
+const (
+	focusPositions = iota
+	focusOrders
+)
+
+// Subscribes and unsubscribes on the public feed, implemented by feed.PublicFeed
+type subscriber interface {
+	Subscribe(args interface{}) error
+	Unsubscribe(args interface{}) error
+}
+
+// Delay after the first trade before the account and positions are reloaded, fills arriving within
+// the delay share a single reload
+const reloadDelay = time.Second
+
+// Account and positions fetched from the REST API
+type holdings struct {
+	account   *models.AccountInfo
+	positions []models.Position
+	err       error
+}
+
+// State of the dashboard, updated from the REST API and the feeds and drawn by render
+type dashboard struct {
+	client api.Client
+	accno  int64
+	public subscriber
+	now    func() time.Time
+
+	account   *models.AccountInfo
+	positions []models.Position
+	orders    map[int64]models.Order
+	prices    map[models.TradableKey]feed.PublicPrice
+	depths    map[models.TradableKey]feed.PublicDepth
+	news      []feed.PublicNews
+
+	subscribed    map[models.TradableKey]bool
+	focus         int
+	selected      [2]int
+	ladder        models.TradableKey
+	pendingCancel int64
+	status        string
+
+	reloadAt  time.Time
+	reloading bool
+}
+
+func newDashboard(client api.Client, accno int64, public subscriber) *dashboard {
+	return &dashboard{
+		client:     client,
+		accno:      accno,
+		public:     public,
+		now:        time.Now,
+		orders:     map[int64]models.Order{},
+		prices:     map[models.TradableKey]feed.PublicPrice{},
+		depths:     map[models.TradableKey]feed.PublicDepth{},
+		subscribed: map[models.TradableKey]bool{},
+	}
+}
+
+// Loads the account, positions and working orders and subscribes to the prices of their tradables
+func (d *dashboard) load() error {
+	if err := d.applyHoldings(d.fetchHoldings()); err != nil {
+		return err
+	}
+
+	orders, err := d.client.AccountOrders(d.accno, nil)
+	if err != nil {
+		return err
+	}
+	d.orders = map[int64]models.Order{}
+	for _, order := range orders {
+		if order.OrderState.IsWorking() {
+			d.orders[order.OrderId] = order
+		}
+	}
+	for _, order := range d.orders {
+		d.subscribe(order.Tradable)
+	}
+	return nil
+}
+
+// Fetches the account and positions, only reads the client and account number so it can run in another goroutine
+func (d *dashboard) fetchHoldings() (h holdings) {
+	if h.account, h.err = d.client.Account(d.accno); h.err != nil {
+		return
+	}
+	h.positions, h.err = d.client.AccountPositions(d.accno)
+	return
+}
+
+// Replaces the account and positions with fetched ones and subscribes to the prices of the positions
+func (d *dashboard) applyHoldings(h holdings) error {
+	if h.err != nil {
+		return h.err
+	}
+	d.account, d.positions = h.account, h.positions
+	for _, p := range d.positions {
+		if t, ok := positionTradable(p); ok {
+			d.subscribe(t)
+		}
+	}
+	return nil
+}
+
+// Starts fetching the account and positions in the background when a reload is due, the
+// result is sent on done to be applied with reloaded
+func (d *dashboard) reload(done chan<- holdings) {
+	if d.reloadAt.IsZero() || d.reloading || d.now().Before(d.reloadAt) {
+		return
+	}
+	d.reloadAt, d.reloading = time.Time{}, true
+	go func() {
+		done <- d.fetchHoldings()
+	}()
+}
+
+// Applies the account and positions fetched by reload
+func (d *dashboard) reloaded(h holdings) {
+	d.reloading = false
+	if err := d.applyHoldings(h); err != nil {
+		d.status = err.Error()
+	}
+}
+
+// Subscribes to the prices of a tradable once
+func (d *dashboard) subscribe(t models.TradableId) {
+	k := t.Key()
+	if d.public == nil || d.subscribed[k] {
+		return
+	}
+	d.subscribed[k] = true
+	if err := d.public.Subscribe(&feed.PriceArgs{T: "price", I: t.Identifier, M: t.MarketId}); err != nil {
+		d.status = err.Error()
+	}
+}
+
+// Updates the prices, depths and news from a public feed message
+func (d *dashboard) onPublic(msg *feed.PublicMsg) {
+	switch data := msg.Data.(type) {
+	case feed.PublicPrice:
+		d.prices[data.Key()] = data
+	case feed.PublicDepth:
+		d.depths[data.Key()] = data
+	case feed.PublicNews:
+		d.news = append([]feed.PublicNews{data}, d.news...)
+		if len(d.news) > newsItems {
+			d.news = d.news[:newsItems]
+		}
+	}
+}
+
+// Updates the working orders from a private feed message, trades schedule a reload of the account and positions
+func (d *dashboard) onPrivate(msg *feed.PrivateMsg) {
+	switch data := msg.Data.(type) {
+	case feed.PrivateOrder:
+		order := models.Order(data)
+		if order.Accno != d.accno {
+			return
+		}
+		if order.OrderState.IsWorking() {
+			d.orders[order.OrderId] = order
+			d.subscribe(order.Tradable)
+		} else {
+			delete(d.orders, order.OrderId)
+		}
+	case feed.PrivateTrade:
+		if data.Accno != d.accno {
+			return
+		}
+		d.status = fmt.Sprintf("traded %s %v %s @ %v", data.Side, data.Volume, data.Key(), data.Price.Value)
+		// later fills keep the pending deadline so a steady stream of fills cannot postpone the reload
+		if d.reloadAt.IsZero() {
+			d.reloadAt = d.now().Add(reloadDelay)
+		}
+	}
+}
+
+// Handles a key press, returns true when the dashboard should quit
+func (d *dashboard) key(k string) (quit bool) {
+	if k != "c" {
+		d.pendingCancel = 0
+	}
+
+	switch k {
+	case "q", "ctrl-c":
+		return true
+	case "esc":
+		d.closeLadder()
+	case "tab":
+		d.focus = (d.focus + 1) % 2
+	case "up", "k":
+		if d.selected[d.focus] > 0 {
+			d.selected[d.focus]--
+		}
+	case "down", "j":
+		if d.selected[d.focus] < d.rows(d.focus)-1 {
+			d.selected[d.focus]++
+		}
+	case "c":
+		d.cancel()
+	case "d":
+		if d.ladder != "" {
+			d.closeLadder()
+		} else {
+			d.openLadder()
+		}
+	case "r":
+		if err := d.load(); err != nil {
+			d.status = err.Error()
+		} else {
+			d.status = "reloaded"
+		}
+	}
+	return false
+}
+
+func (d *dashboard) rows(focus int) int {
+	if focus == focusOrders {
+		return len(d.orders)
+	}
+	return len(d.positions)
+}
+
+// Returns the working orders sorted by id
+func (d *dashboard) sortedOrders() []models.Order {
+	orders := make([]models.Order, 0, len(d.orders))
+	for _, order := range d.orders {
+		orders = append(orders, order)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].OrderId < orders[j].OrderId })
+	return orders
+}
+
+// Returns the tradable of the selected position or order
+func (d *dashboard) selectedTradable() (models.TradableId, bool) {
+	i := d.selected[d.focus]
+	if d.focus == focusOrders {
+		if orders := d.sortedOrders(); i < len(orders) {
+			return orders[i].Tradable, true
+		}
+		return models.TradableId{}, false
+	}
+	if i < len(d.positions) {
+		return positionTradable(d.positions[i])
+	}
+	return models.TradableId{}, false
+}
+
+// Deletes the selected order, the first press asks for confirmation
+func (d *dashboard) cancel() {
+	orders := d.sortedOrders()
+	if d.focus != focusOrders || d.selected[focusOrders] >= len(orders) {
+		d.status = "select an order to cancel with tab"
+		return
+	}
+
+	order := orders[d.selected[focusOrders]]
+	if d.pendingCancel != order.OrderId {
+		d.pendingCancel = order.OrderId
+		d.status = fmt.Sprintf("press c again to cancel order %d", order.OrderId)
+		return
+	}
+
+	d.pendingCancel = 0
+	if _, err := d.client.DeleteOrder(d.accno, order.OrderId); err != nil {
+		d.status = fmt.Sprintf("cancel order %d: %v", order.OrderId, err)
+		return
+	}
+	delete(d.orders, order.OrderId)
+	if d.selected[focusOrders] > 0 && d.selected[focusOrders] >= len(d.orders) {
+		d.selected[focusOrders]--
+	}
+	d.status = fmt.Sprintf("order %d cancelled", order.OrderId)
+}
+
+func (d *dashboard) openLadder() {
+	t, ok := d.selectedTradable()
+	if !ok {
+		d.status = "select a position or order to show its depth"
+		return
+	}
+	d.ladder = t.Key()
+	if d.public != nil {
+		if err := d.public.Subscribe(&feed.DepthArgs{T: "depth", I: t.Identifier, M: t.MarketId}); err != nil {
+			d.status = err.Error()
+		}
+	}
+}
+
+func (d *dashboard) closeLadder() {
+	if d.ladder == "" {
+		return
+	}
+	if d.public != nil {
+		t, _ := d.ladder.TradableId()
+		d.public.Unsubscribe(&feed.DepthArgs{T: "depth", I: t.Identifier, M: t.MarketId})
+	}
+	delete(d.depths, d.ladder)
+	d.ladder = ""
+}
+
+// Returns the tradable a position is priced by, the first tradable of the instrument
+func positionTradable(p models.Position) (models.TradableId, bool) {
+	if len(p.Instrument.Tradables) == 0 {
+		return models.TradableId{}, false
+	}
+	return p.Instrument.Tradables[0].TradableId, true
+}
+
+// Returns the live profit or loss of a position, false when there is no live price
+func (d *dashboard) profitLoss(p models.Position) (last, pl float64, ok bool) {
+	t, ok := positionTradable(p)
+	if !ok {
+		return
+	}
+	price, ok := d.prices[t.Key()]
+	if !ok || price.Last.IsZero() {
+		return 0, 0, false
+	}
+
+	multiplier := p.Instrument.Multiplier
+	if multiplier == 0 {
+		multiplier = 1
+	}
+	return price.Last.Float64(), price.Last.Sub(p.AcqPrice.Value).Float64() * p.Qty * multiplier, true
+}
+
+// Draws the dashboard, lines are cut to the width and sections to the height of the terminal
+func (d *dashboard) render(w io.Writer, width, height int) {
+	var lines []string
+	if d.ladder != "" {
+		lines = d.renderLadder()
+	} else {
+		lines = d.renderMain(height)
+	}
+
+	if len(lines) > height-1 {
+		lines = lines[:height-1]
+	}
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	help := "tab switch  ↑/↓ select  c cancel order  d depth  r reload  q quit"
+	if d.status != "" {
+		help = d.status + "  |  " + help
+	}
+	lines = append(lines, help)
+
+	b := &bytes.Buffer{}
+	b.WriteString("\033[H\033[2J")
+	for i, line := range lines {
+		if r := []rune(line); len(r) > width {
+			line = string(r[:width])
+		}
+		b.WriteString(line)
+		if i < len(lines)-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	w.Write(b.Bytes())
+}
+
+func (d *dashboard) renderMain(height int) (lines []string) {
+	if a := d.account; a != nil {
+		lines = append(lines, fmt.Sprintf("ACCOUNT %d  %s  own capital %.2f  trading power %.2f  account sum %.2f  market value %.2f",
+			d.accno, a.AccountCurrency, a.OwnCapital.Float64(), a.TradingPower.Float64(), a.AccountSum.Float64(), a.FullMarketvalue.Float64()))
+	}
+	lines = append(lines, "")
+
+	var total float64
+	positions := [][]string{{"TRADABLE", "NAME", "QTY", "ACQ PRICE", "LAST", "MARKET VALUE", "P&L"}}
+	for _, p := range d.positions {
+		t, _ := positionTradable(p)
+		row := []string{t.Key().String(), p.Instrument.Symbol, fmt.Sprint(p.Qty), p.AcqPrice.Value.StringFixed(2), "", p.MarketValue.Value.StringFixed(2), ""}
+		if last, pl, ok := d.profitLoss(p); ok {
+			row[4], row[6] = fmt.Sprintf("%.2f", last), fmt.Sprintf("%+.2f", pl)
+			total += pl
+		}
+		positions = append(positions, row)
+	}
+	lines = append(lines, fmt.Sprintf("POSITIONS  P&L %+.2f", total))
+	lines = append(lines, table(positions, d.focus == focusPositions, d.selected[focusPositions])...)
+	lines = append(lines, "")
+
+	orders := [][]string{{"ORDER", "TRADABLE", "SIDE", "VOLUME", "TRADED", "PRICE", "STATE"}}
+	for _, o := range d.sortedOrders() {
+		orders = append(orders, []string{fmt.Sprint(o.OrderId), o.Key().String(), o.Side.String(), fmt.Sprint(o.Volume), fmt.Sprint(o.TradedVolume),
+			o.Price.Value.StringFixed(2) + " " + o.Price.Currency, o.OrderState.String()})
+	}
+	lines = append(lines, "WORKING ORDERS")
+	lines = append(lines, table(orders, d.focus == focusOrders, d.selected[focusOrders])...)
+	lines = append(lines, "")
+
+	lines = append(lines, "NEWS")
+	for i := 0; i < len(d.news) && len(lines) < height-1; i++ {
+		n := d.news[i]
+		lines = append(lines, fmt.Sprintf("  %s  %s", n.Datetime, n.Headline))
+	}
+	return
+}
+
+func (d *dashboard) renderLadder() (lines []string) {
+	lines = append(lines, fmt.Sprintf("DEPTH %s  (d or esc to close)", d.ladder))
+	if price, ok := d.prices[d.ladder]; ok {
+		lines = append(lines, fmt.Sprintf("last %v  high %v  low %v  volume %v", price.Last, price.High, price.Low, price.TurnoverVolume))
+	}
+	lines = append(lines, "")
+
+	depth, ok := d.depths[d.ladder]
+	if !ok {
+		return append(lines, "waiting for depth...")
+	}
+	levels := [][]string{{"BID VOL", "BID", "ASK", "ASK VOL"}}
+	for _, level := range [][4]interface{}{
+		{depth.BidVolume1, depth.Bid1, depth.Ask1, depth.AskVolume1},
+		{depth.BidVolume2, depth.Bid2, depth.Ask2, depth.AskVolume2},
+		{depth.BidVolume3, depth.Bid3, depth.Ask3, depth.AskVolume3},
+		{depth.BidVolume4, depth.Bid4, depth.Ask4, depth.AskVolume4},
+		{depth.BidVolume5, depth.Bid5, depth.Ask5, depth.AskVolume5},
+	} {
+		levels = append(levels, []string{fmt.Sprint(level[0]), fmt.Sprint(level[1]), fmt.Sprint(level[2]), fmt.Sprint(level[3])})
+	}
+	return append(lines, table(levels, false, 0)...)
+}
+
+// Aligns the rows into lines, the selected row is marked when the table has focus
+func table(rows [][]string, focus bool, selected int) []string {
+	b := &bytes.Buffer{}
+	w := tabwriter.NewWriter(b, 0, 4, 2, ' ', 0)
+	for i, row := range rows {
+		marker := "  "
+		if focus && i == selected+1 {
+			marker = "> "
+		}
+		fmt.Fprintln(w, marker+strings.Join(row, "\t"))
+	}
+	w.Flush()
+	return strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+}
+
+// Reads key presses from the terminal and sends their names, such as "up", "tab" or "q"
+func readKeys(r io.Reader, keys chan<- string) {
+	buf := make([]byte, 16)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		for i := 0; i < n; i++ {
+			switch b := buf[i]; {
+			case b == 0x1b && i+2 < n && buf[i+1] == '[':
+				switch buf[i+2] {
+				case 'A':
+					keys <- "up"
+				case 'B':
+					keys <- "down"
+				}
+				i += 2
+			case b == 0x1b:
+				keys <- "esc"
+			case b == '\t':
+				keys <- "tab"
+			case b == 3:
+				keys <- "ctrl-c"
+			default:
+				keys <- string(b)
+			}
+		}
+	}
+}
+
+func dashboardCmd(c *cli, args []string) (err error) {
+	flags := c.flags("dashboard", "[-news ids] <accno>")
+	news := flags.String("news", "", "comma separated news source ids for the ticker, all available sources by default")
+	if args, err = parse(flags, args, 1); err != nil {
+		return
+	}
+	accno, _, err := parseIds(args, false)
+	if err != nil {
+		return
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("dashboard: stdin is not a terminal")
+	}
+
+	var sources []int64
+	if *news != "" {
+		for _, s := range feed.SplitList(*news) {
+			id, err := parseId("news source", s)
+			if err != nil {
+				return err
+			}
+			sources = append(sources, id)
+		}
+	} else if all, err := c.client.NewsSources(); err == nil {
+		for _, source := range all {
+			sources = append(sources, source.SourceId)
+		}
+	}
+
+	conn, err := c.connect(c.session.PublicFeed)
+	if err != nil {
+		return fmt.Errorf("public feed: %v", err)
+	}
+	publicFeed := &feed.PublicFeed{Feed: feed.NewFeed(conn)}
+	defer publicFeed.Close()
+	if err = publicFeed.Login(c.session.SessionKey, nil); err != nil {
+		return
+	}
+
+	if conn, err = c.connect(c.session.PrivateFeed); err != nil {
+		return fmt.Errorf("private feed: %v", err)
+	}
+	privateFeed := &feed.PrivateFeed{Feed: feed.NewFeed(conn)}
+	defer privateFeed.Close()
+	if err = privateFeed.Login(c.session.SessionKey, nil); err != nil {
+		return
+	}
+
+	d := newDashboard(c.client, accno, publicFeed)
+	if err = d.load(); err != nil {
+		return
+	}
+	for _, id := range sources {
+		if err = publicFeed.Subscribe(&feed.NewsArgs{T: "news", S: id}); err != nil {
+			return
+		}
+	}
+
+	publicMsgs, publicErrs := make(chan *feed.PublicMsg), make(chan error)
+	privateMsgs, privateErrs := make(chan *feed.PrivateMsg), make(chan error)
+	publicFeed.Dispatch(publicMsgs, publicErrs)
+	privateFeed.Dispatch(privateMsgs, privateErrs)
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return
+	}
+	defer term.Restore(fd, state)
+
+	// alternate screen without cursor, restored when the dashboard quits
+	fmt.Fprint(c.stdout, "\033[?1049h\033[?25l")
+	defer fmt.Fprint(c.stdout, "\033[?25h\033[?1049l")
+
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+
+	ticker := time.NewTicker(dashboardRefresh)
+	defer ticker.Stop()
+
+	reloads := make(chan holdings, 1)
+	dirty := true
+	for {
+		select {
+		case k, ok := <-keys:
+			if !ok || d.key(k) {
+				return nil
+			}
+			dirty = true
+		case msg := <-publicMsgs:
+			if msg.Data != nil {
+				d.onPublic(msg)
+				dirty = true
+			}
+		case msg := <-privateMsgs:
+			if msg.Data != nil {
+				d.onPrivate(msg)
+				dirty = true
+			}
+		case err = <-publicErrs:
+			if isEOF(err) {
+				return errors.New("public feed disconnected")
+			}
+			d.status = "public feed: " + err.Error()
+		case err = <-privateErrs:
+			if isEOF(err) {
+				return errors.New("private feed disconnected")
+			}
+			d.status = "private feed: " + err.Error()
+		case h := <-reloads:
+			d.reloaded(h)
+			dirty = true
+		case <-ticker.C:
+			d.reload(reloads)
+			if dirty {
+				width, height, err := term.GetSize(fd)
+				if err != nil {
+					width, height = 120, 40
+				}
+				d.render(c.stdout, width, height)
+				dirty = false
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/api/apitest"
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+)
+
+type fakeSubscriber struct {
+	subscribed, unsubscribed []interface{}
+}
+
+func (s *fakeSubscriber) Subscribe(args interface{}) error {
+	s.subscribed = append(s.subscribed, args)
+	return nil
+}
+
+func (s *fakeSubscriber) Unsubscribe(args interface{}) error {
+	s.unsubscribed = append(s.unsubscribed, args)
+	return nil
+}
+
+func setupDashboard(t *testing.T) (*dashboard, *apitest.Mock, *fakeSubscriber) {
+	mock := &apitest.Mock{
+		AccountFunc: func(accno int64) (*AccountInfo, error) {
+			return &AccountInfo{AccountCurrency: "SEK", OwnCapital: Amount{NewDecimal(10000, 0), "SEK"}}, nil
+		},
+		AccountPositionsFunc: func(accno int64) ([]Position, error) {
+			return []Position{{
+				Accno:      1,
+				Instrument: Instrument{Symbol: "ERIC B", Tradables: []Tradable{{TradableId: TradableId{"101", 11}}}},
+				Qty:        100,
+				AcqPrice:   Amount{NewDecimal(50, 0), "SEK"},
+			}}, nil
+		},
+		AccountOrdersFunc: func(accno int64, params *api.Params) ([]Order, error) {
+			return []Order{
+				{Accno: 1, OrderId: 7, Tradable: TradableId{"202", 11}, Side: "BUY", Volume: 10, OrderState: "ON_MARKET"},
+				{Accno: 1, OrderId: 6, Tradable: TradableId{"101", 11}, Side: "SELL", Volume: 5, OrderState: "DELETED"},
+			}, nil
+		},
+		DeleteOrderFunc: func(accno, orderId int64) (*OrderReply, error) {
+			return &OrderReply{OrderId: orderId, OrderState: "DELETED"}, nil
+		},
+	}
+	sub := &fakeSubscriber{}
+	d := newDashboard(mock, 1, sub)
+	if err := d.load(); err != nil {
+		t.Fatal(err)
+	}
+	return d, mock, sub
+}
+
+func render(d *dashboard) string {
+	b := &bytes.Buffer{}
+	d.render(b, 200, 30)
+	return b.String()
+}
+
+func TestDashboardPositions(t *testing.T) {
+	d, _, sub := setupDashboard(t)
+
+	assert := assert.New(t)
+	assert.Equal([]interface{}{
+		&feed.PriceArgs{T: "price", I: "101", M: 11},
+		&feed.PriceArgs{T: "price", I: "202", M: 11},
+	}, sub.subscribed)
+	assert.Len(d.orders, 1)
+
+	d.onPublic(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "101", M: 11, Last: NewDecimal(55, 0)}})
+	d.onPublic(&feed.PublicMsg{Type: "news", Data: feed.PublicNews{Datetime: "2026-10-18 09:00:00", Headline: "Ericsson wins contract"}})
+
+	screen := render(d)
+	assert.True(strings.HasPrefix(screen, "\033[H\033[2J"))
+	assert.Contains(screen, "ACCOUNT 1  SEK  own capital 10000.00")
+	assert.Contains(screen, "POSITIONS  P&L +500.00")
+	assert.Regexp(`> 11:101\s+ERIC B\s+100\s+50.00\s+55.00\s+0.00\s+\+500.00`, screen)
+	assert.Regexp(`  7\s+11:202\s+BUY\s+10`, screen)
+	assert.Contains(screen, "2026-10-18 09:00:00  Ericsson wins contract")
+	assert.Equal(30, len(strings.Split(screen, "\r\n")))
+}
+
+func TestDashboardOrders(t *testing.T) {
+	d, mock, _ := setupDashboard(t)
+
+	assert := assert.New(t)
+
+	d.onPrivate(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{Accno: 1, OrderId: 8, Tradable: TradableId{"101", 11}, OrderState: "ON_MARKET"}})
+	d.onPrivate(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{Accno: 2, OrderId: 9, OrderState: "ON_MARKET"}})
+	assert.Len(d.orders, 2)
+
+	d.key("c")
+	assert.Equal("select an order to cancel with tab", d.status)
+
+	d.key("tab")
+	d.key("down")
+	d.key("down")
+	assert.Equal(1, d.selected[focusOrders])
+
+	d.key("c")
+	assert.Equal("press c again to cancel order 8", d.status)
+	assert.Empty(mock.CallsTo("DeleteOrder"))
+
+	d.key("c")
+	assert.Equal("order 8 cancelled", d.status)
+	if calls := mock.CallsTo("DeleteOrder"); assert.Len(calls, 1) {
+		assert.Equal([]interface{}{int64(1), int64(8)}, calls[0].Args)
+	}
+	assert.Equal(0, d.selected[focusOrders])
+
+	mock.DeleteOrderFunc = func(accno, orderId int64) (*OrderReply, error) { return nil, errors.New("rejected") }
+	d.key("c")
+	d.key("c")
+	assert.Equal("cancel order 7: rejected", d.status)
+	assert.Len(d.orders, 1)
+
+	d.onPrivate(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{Accno: 1, OrderId: 7, OrderState: "DONE"}})
+	assert.Empty(d.orders)
+
+	d.onPrivate(&feed.PrivateMsg{Type: "trade", Data: feed.PrivateTrade{Accno: 1, OrderId: 7, Side: "BUY", Volume: 10, Tradable: TradableId{"202", 11}, Price: Amount{Value: NewDecimal(20, 0)}}})
+	assert.Equal("traded BUY 10 11:202 @ 20", d.status)
+	assert.Len(mock.CallsTo("AccountPositions"), 1)
+}
+
+func TestDashboardReload(t *testing.T) {
+	d, mock, _ := setupDashboard(t)
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	assert := assert.New(t)
+	reloads := make(chan holdings, 1)
+	trade := &feed.PrivateMsg{Type: "trade", Data: feed.PrivateTrade{Accno: 1, OrderId: 7, Side: "BUY", Volume: 5, Tradable: TradableId{"202", 11}, Price: Amount{Value: NewDecimal(20, 0)}}}
+
+	d.onPrivate(trade)
+	now = now.Add(reloadDelay / 2)
+	d.onPrivate(trade)
+	d.reload(reloads)
+	assert.Len(mock.CallsTo("AccountPositions"), 1)
+
+	// fills within the delay share one reload, due a delay after the first fill
+	mock.AccountPositionsFunc = func(accno int64) ([]Position, error) { return nil, nil }
+	now = now.Add(reloadDelay / 2)
+	d.reload(reloads)
+	d.reload(reloads)
+	d.reloaded(<-reloads)
+	assert.Len(mock.CallsTo("AccountPositions"), 2)
+	assert.Empty(d.positions)
+	assert.Len(d.orders, 1)
+
+	// a steady stream of fills does not postpone the reload
+	for i := 0; i < 3; i++ {
+		d.onPrivate(trade)
+		now = now.Add(reloadDelay / 2)
+		d.reload(reloads)
+	}
+	d.reloaded(<-reloads)
+	assert.Len(mock.CallsTo("AccountPositions"), 3)
+
+	mock.AccountFunc = func(accno int64) (*AccountInfo, error) { return nil, errors.New("unavailable") }
+	d.onPrivate(trade)
+	now = now.Add(reloadDelay)
+	d.reload(reloads)
+	d.reloaded(<-reloads)
+	assert.Equal("unavailable", d.status)
+	assert.NotNil(d.account)
+}
+
+func TestDashboardLadder(t *testing.T) {
+	d, _, sub := setupDashboard(t)
+
+	assert := assert.New(t)
+
+	d.key("d")
+	assert.Equal(TradableKey("11:101"), d.ladder)
+	assert.Equal(&feed.DepthArgs{T: "depth", I: "101", M: 11}, sub.subscribed[len(sub.subscribed)-1])
+	assert.Contains(render(d), "waiting for depth...")
+
+	d.onPublic(&feed.PublicMsg{Type: "depth", Data: feed.PublicDepth{I: "101", M: 11, Bid1: NewDecimal(99, 0), BidVolume1: 100, Ask1: NewDecimal(100, 0), AskVolume1: 200, Bid2: NewDecimal(98, 0), BidVolume2: 50}})
+	screen := render(d)
+	assert.Contains(screen, "DEPTH 11:101")
+	assert.Regexp(`100\s+99\s+100\s+200`, screen)
+	assert.Regexp(`50\s+98\s+0\s+0`, screen)
+
+	d.key("esc")
+	assert.Empty(d.ladder)
+	assert.Equal([]interface{}{&feed.DepthArgs{T: "depth", I: "101", M: 11}}, sub.unsubscribed)
+
+	assert.True(d.key("q"))
+}
+
+func TestReadKeys(t *testing.T) {
+	keys := make(chan string, 10)
+	readKeys(strings.NewReader("j\033[A\033[B\t\033c\x03"), keys)
+
+	var got []string
+	for k := range keys {
+		got = append(got, k)
+	}
+	assert.Equal(t, []string{"j", "up", "down", "tab", "esc", "c", "ctrl-c"}, got)
+}
@@ -0,0 +1,106 @@
+// Command nordnet is a command-line tool for day-to-day operations on Nordnet accounts.
+//
+// Usage:
+//
+//	nordnet [flags] <command> [arguments]
+//
+// The credentials are read from a JSON config file, ~/.nordnet.json by default, and from the
+// environment. Environment variables take precedence over the config file:
+//
+//	NORDNET_CONFIG       path to the config file
+//	NORDNET_USERNAME     username
+//	NORDNET_PASSWORD     password
+//	NORDNET_PEM_FILE     path to the public key used to encrypt the credentials
+//	NORDNET_ENVIRONMENT  "test" (the default) or "production"
+//	NORDNET_URL          base URL overriding the environment
+//
+// The config file has the same settings:
+//
+//	{"username": "...", "password": "...", "pem_file": "...", "environment": "production"}
+//
+// Output is written as a table, JSON or CSV, selected with the -format flag. Run "nordnet help" for the list of commands.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	// the exchange time zones of the models, also on systems without a time zone database
+	_ "time/tzdata"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr, os.Getenv); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, "nordnet:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// Parses the global flags and runs the command
+func run(args []string, stdout, stderr io.Writer, getenv func(string) string) (err error) {
+	flags := flag.NewFlagSet("nordnet", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "path to the config file")
+	environment := flags.String("env", "", `environment to use, "test" or "production"`)
+	format := flags.String("format", "table", `output format, "table", "json" or "csv"`)
+	columns := flags.String("columns", "", "comma separated columns to output in table and csv formats")
+	flags.Usage = func() { usage(stderr, flags) }
+
+	if err = flags.Parse(args); err != nil {
+		return
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+
+	out, err := newOutput(stdout, *format, *columns)
+	if err != nil {
+		return
+	}
+
+	if flags.Arg(0) == "help" {
+		usage(stdout, flags)
+		return
+	}
+	cmd, args := findCommand(flags.Args())
+	if cmd == nil {
+		return fmt.Errorf("unknown command %q, run \"nordnet help\" for usage", strings.Join(flags.Args(), " "))
+	}
+
+	config, err := loadConfig(*configPath, getenv)
+	if err != nil {
+		return
+	}
+	if *environment != "" {
+		config.Environment = *environment
+	}
+
+	c := &cli{config: config, out: out, stdout: stdout, stderr: stderr, connect: connect}
+	if c.client, err = config.client(cmd.login); err != nil {
+		return
+	}
+	if cmd.login {
+		if c.session, err = c.client.Login(); err != nil {
+			return fmt.Errorf("login: %v", err)
+		}
+		defer c.client.Logout()
+	}
+
+	return cmd.run(c, args)
+}
+
+func usage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: nordnet [flags] <command> [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-44s %s\n", cmd.name+" "+cmd.args, cmd.help)
+	}
+	fmt.Fprintf(w, "\nFlags:\n")
+	flags.SetOutput(w)
+	flags.PrintDefaults()
+}
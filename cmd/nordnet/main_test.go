@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/denro/nordnet/util/models"
+)
+
+type request struct {
+	method, path string
+	query        map[string]string
+}
+
+func setup(t *testing.T) (*httptest.Server, *[]request, func(string) string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemFile := filepath.Join(t.TempDir(), "key.pem")
+	if err = ioutil.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := &[]request{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := map[string]string{}
+		for key := range r.URL.Query() {
+			query[key] = r.URL.Query().Get(key)
+		}
+		*requests = append(*requests, request{r.Method, r.URL.Path, query})
+
+		switch r.URL.Path {
+		case "/2":
+			w.Write([]byte(`{"timestamp": 123, "valid_version": true, "system_running": true, "message": "ok"}`))
+		case "/2/login":
+			w.Write([]byte(`{"session_key": "SESSION", "public_feed": {"hostname": "public", "port": 443}, "private_feed": {"hostname": "private", "port": 443}}`))
+		case "/2/accounts":
+			w.Write([]byte(`[{"accno": 1, "type": "ISK", "default": true}, {"accno": 2, "type": "AF"}]`))
+		case "/2/accounts/1/orders":
+			w.Write([]byte(`{"order_id": 5, "result_code": "OK", "order_state": "ON_MARKET", "action_state": "INS_CONF"}`))
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`{"code": "NOT_FOUND", "message": "not found"}`))
+		}
+	}))
+
+	env := map[string]string{
+		"NORDNET_USERNAME": "user",
+		"NORDNET_PASSWORD": "pass",
+		"NORDNET_PEM_FILE": pemFile,
+		"NORDNET_URL":      ts.URL,
+		"HOME":             t.TempDir(),
+	}
+	return ts, requests, func(key string) string { return env[key] }
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	ioutil.WriteFile(path, []byte(`{"username": "user", "password": "pass", "pem_file": "key.pem", "environment": "production"}`), 0600)
+
+	assert := assert.New(t)
+
+	config, err := loadConfig(path, func(key string) string {
+		return map[string]string{"NORDNET_PASSWORD": "other"}[key]
+	})
+	if assert.NoError(err) {
+		assert.Equal(&Config{Username: "user", Password: "other", PemFile: "key.pem", Environment: "production"}, config)
+	}
+
+	_, err = loadConfig(filepath.Join(t.TempDir(), "missing.json"), func(string) string { return "" })
+	assert.True(os.IsNotExist(err))
+
+	config, err = loadConfig("", func(key string) string {
+		return map[string]string{"HOME": t.TempDir()}[key]
+	})
+	assert.NoError(err)
+	assert.Equal(&Config{}, config)
+
+	client, err := config.client(false)
+	if assert.NoError(err) {
+		assert.Equal("https://api.test.nordnet.se/next", client.URL)
+	}
+	_, err = config.client(true)
+	assert.Error(err)
+
+	config.Environment = "staging"
+	_, err = config.client(false)
+	assert.Error(err)
+}
+
+func TestRunStatus(t *testing.T) {
+	ts, requests, getenv := setup(t)
+	defer ts.Close()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err := run([]string{"-format", "json", "status"}, stdout, stderr, getenv)
+
+	assert := assert.New(t)
+	assert.NoError(err)
+	assert.Contains(stdout.String(), `"system_running": true`)
+	assert.Equal([]request{{"GET", "/2", map[string]string{}}}, *requests)
+}
+
+func TestRunAccounts(t *testing.T) {
+	ts, requests, getenv := setup(t)
+	defer ts.Close()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err := run([]string{"-columns", "accno,type,default", "accounts"}, stdout, stderr, getenv)
+
+	assert := assert.New(t)
+	assert.NoError(err)
+	assert.Equal("ACCNO  TYPE  DEFAULT\n1      ISK   true\n2      AF    false\n", stdout.String())
+
+	if assert.Len(*requests, 3) {
+		assert.Equal("POST", (*requests)[0].method)
+		assert.NotEmpty((*requests)[0].query["auth"])
+		assert.Equal("GET", (*requests)[1].method)
+		assert.Equal("DELETE", (*requests)[2].method)
+	}
+}
+
+func TestRunCreateOrder(t *testing.T) {
+	ts, requests, getenv := setup(t)
+	defer ts.Close()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err := run([]string{"-format", "csv", "order", "create", "-market", "11", "-identifier", "101", "-price", "100.5", "-currency", "SEK",
+		"-volume", "10", "-side", "BUY", "1", "smart_order=true"}, stdout, stderr, getenv)
+
+	assert := assert.New(t)
+	assert.NoError(err)
+	assert.Equal("order_id,result_code,order_state,action_state,message\n5,OK,ON_MARKET,INS_CONF,\n", stdout.String())
+
+	if assert.Len(*requests, 3) {
+		assert.Equal(request{"POST", "/2/accounts/1/orders", map[string]string{
+			"market_id": "11", "identifier": "101", "price": "100.5", "currency": "SEK", "volume": "10", "side": "BUY", "smart_order": "true",
+		}}, (*requests)[1])
+	}
+
+	err = run([]string{"order", "create", "-market", "11", "1"}, stdout, stderr, getenv)
+	assert.EqualError(err, "order create: identifier is required")
+}
+
+func TestRunErrors(t *testing.T) {
+	ts, _, getenv := setup(t)
+	defer ts.Close()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	assert := assert.New(t)
+
+	assert.EqualError(run([]string{"unknown", "command"}, stdout, stderr, getenv), `unknown command "unknown command", run "nordnet help" for usage`)
+	assert.EqualError(run([]string{"-format", "xml", "accounts"}, stdout, stderr, getenv), `unknown format "xml", use "table", "json" or "csv"`)
+	assert.EqualError(run([]string{"account", "abc"}, stdout, stderr, getenv), `invalid account number "abc"`)
+	assert.EqualError(run([]string{"order", "delete", "1"}, stdout, stderr, getenv), "order delete: expected at least 2 arguments")
+	assert.EqualError(run([]string{"account", "3"}, stdout, stderr, getenv), "NOT_FOUND: not found")
+
+	stdout.Reset()
+	assert.NoError(run([]string{"help"}, stdout, stderr, getenv))
+	assert.Contains(stdout.String(), "instruments lookup")
+}
+
+func TestOutput(t *testing.T) {
+	orders := []Order{{
+		OrderId:  1,
+		Price:    Amount{NewDecimal(1005, -1), "SEK"},
+		Tradable: TradableId{"101", 11},
+		Side:     "BUY",
+	}}
+
+	assert := assert.New(t)
+
+	b := &bytes.Buffer{}
+	out, _ := newOutput(b, "csv", "order_id,price.value,price.currency,tradable.market_id,side")
+	assert.NoError(out.write(orders))
+	assert.Equal("order_id,price.value,price.currency,tradable.market_id,side\n1,100.5,SEK,11,BUY\n", b.String())
+
+	b.Reset()
+	out, _ = newOutput(b, "csv", "")
+	assert.NoError(out.write([]Tradable{{TradableId: TradableId{"101", 11}, LotSize: 1}}))
+	assert.Equal("identifier,market_id,tick_size_id,lot_size,display_order\n101,11,0,1,0\n", b.String())
+
+	b.Reset()
+	out, _ = newOutput(b, "table", "")
+	assert.NoError(out.write(&Amount{NewDecimal(1005, -1), "SEK"}))
+	assert.Equal("VALUE     100.5\nCURRENCY  SEK\n", b.String())
+
+	b.Reset()
+	out, _ = newOutput(b, "csv", "")
+	assert.NoError(out.write([]Instrument{{InstrumentId: 1, Tradables: []Tradable{{TradableId: TradableId{"101", 11}}}}}))
+	assert.True(strings.HasPrefix(strings.Split(b.String(), "\n")[1], `1,"[{""identifier"":""101"",""market_id"":11`))
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+)
+
+// Writes results in the selected format
+type output struct {
+	w       io.Writer
+	format  string
+	columns []string
+}
+
+func newOutput(w io.Writer, format, columns string) (*output, error) {
+	switch format {
+	case "table", "json", "csv":
+	default:
+		return nil, fmt.Errorf("unknown format %q, use \"table\", \"json\" or \"csv\"", format)
+	}
+
+	out := &output{w: w, format: format}
+	if columns != "" {
+		out.columns = strings.Split(columns, ",")
+	}
+	return out, nil
+}
+
+// Writes a struct, a pointer to a struct or a slice of structs. Nested structs are flattened into
+// columns named by their json tags joined with dots, such as "price.value".
+func (o *output) write(v interface{}) error {
+	if o.format == "json" {
+		enc := json.NewEncoder(o.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	single := rv.Kind() != reflect.Slice
+
+	var header []string
+	var rows [][]string
+	if single {
+		header, rows = o.table([]reflect.Value{rv}, rv.Type())
+	} else {
+		values := make([]reflect.Value, rv.Len())
+		for i := range values {
+			values[i] = rv.Index(i)
+		}
+		header, rows = o.table(values, rv.Type().Elem())
+	}
+
+	if o.format == "csv" {
+		w := csv.NewWriter(o.w)
+		w.Write(header)
+		w.WriteAll(rows)
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(o.w, 0, 4, 2, ' ', 0)
+	if single {
+		// one value reads better as a column of fields
+		for i, column := range header {
+			fmt.Fprintf(w, "%s\t%s\n", strings.ToUpper(column), rows[0][i])
+		}
+	} else {
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(header, "\t")))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+	}
+	return w.Flush()
+}
+
+// Flattens the values into rows, restricted to the selected columns
+func (o *output) table(values []reflect.Value, typ reflect.Type) (header []string, rows [][]string) {
+	header = columnNames("", typ)
+	index := map[string]int{}
+	for i, column := range header {
+		index[column] = i
+	}
+
+	selected := header
+	if len(o.columns) > 0 {
+		selected = o.columns
+	}
+
+	for _, v := range values {
+		cells := flatten(v, nil)
+		row := make([]string, len(selected))
+		for i, column := range selected {
+			if j, ok := index[column]; ok {
+				row[i] = cells[j]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return selected, rows
+}
+
+// Returns the flattened column names of a type
+func columnNames(prefix string, typ reflect.Type) (names []string) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if !isStruct(typ) {
+		return []string{strings.TrimSuffix(prefix, ".")}
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous {
+			names = append(names, columnNames(prefix, field.Type)...)
+			continue
+		}
+
+		name := fieldName(field)
+		if isStruct(field.Type) {
+			names = append(names, columnNames(prefix+name+".", field.Type)...)
+		} else {
+			names = append(names, prefix+name)
+		}
+	}
+	return
+}
+
+// Appends the flattened cells of a value in the same order as columnNames
+func flatten(v reflect.Value, cells []string) []string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			for range columnNames("", v.Type()) {
+				cells = append(cells, "")
+			}
+			return cells
+		}
+		v = v.Elem()
+	}
+	if !isStruct(v.Type()) {
+		return append(cells, cell(v))
+	}
+
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous || isStruct(field.Type) {
+			cells = flatten(v.Field(i), cells)
+		} else {
+			cells = append(cells, cell(v.Field(i)))
+		}
+	}
+	return cells
+}
+
+func cell(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return ""
+		}
+	}
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Interface, reflect.Ptr:
+		b, _ := json.Marshal(v.Interface())
+		return string(b)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// Reports whether the type is flattened into columns, structs implementing fmt.Stringer are single cells
+func isStruct(typ reflect.Type) bool {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Struct && !typ.Implements(stringerType) && !reflect.PtrTo(typ).Implements(stringerType)
+}
+
+func fieldName(field reflect.StructField) string {
+	if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+		return tag
+	}
+	return strings.ToLower(field.Name)
+}
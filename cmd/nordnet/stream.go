@@ -0,0 +1,372 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/denro/nordnet/feed"
+	"github.com/denro/nordnet/util/models"
+)
+
+// Interval between redraws of the top-of-book view
+const topRefresh = 250 * time.Millisecond
+
+// Opens a connection to the feed, encrypted when the login response says so
+var connect = func(f models.Feed) (io.ReadWriteCloser, error) {
+	address := net.JoinHostPort(f.Hostname, strconv.FormatInt(f.Port, 10))
+	if f.Encrypted {
+		return tls.Dial("tcp", address, nil)
+	}
+	return net.Dial("tcp", address)
+}
+
+// Latest prices of a tradable shown in the top-of-book view
+type topOfBook struct {
+	BidVolume, AskVolume, TurnoverVolume float64
+	Bid, Ask, Last, High, Low            models.Decimal
+	Status                               models.TradingStatus
+	Updated                              time.Time
+}
+
+// Prints the feed messages in the selected view
+type streamer struct {
+	w    io.Writer
+	view string
+
+	record, recordPrivate *json.Encoder
+
+	top   map[models.TradableKey]*topOfBook
+	dirty bool
+	now   func() time.Time
+}
+
+func stream(c *cli, args []string) (err error) {
+	flags := c.flags("stream", "[flags] [market:identifier...]")
+	types := flags.String("types", "price,trade", "comma separated public data to subscribe to for the tradables: price, depth, trade and trading_status")
+	news := flags.String("news", "", "comma separated news source ids to subscribe to")
+	indicators := flags.String("indicators", "", "comma separated indicators to subscribe to as src:identifier, e.g. SIX:SIX-IDX-DJI")
+	private := flags.Bool("private", false, "connect to the private feed for order and trade events")
+	view := flags.String("view", "", `"table", "json" for JSON lines or "top" for a refreshing top-of-book view, defaults to the output format`)
+	record := flags.String("record", "", "file to record the public feed messages to, one JSON message per line")
+	recordPrivate := flags.String("record-private", "", "file to record the private feed messages to, one JSON message per line")
+	count := flags.Int("count", 0, "stop after this many messages, not counting heartbeats, 0 streams until interrupted")
+	if args, err = parse(flags, args, 0); err != nil {
+		return
+	}
+
+	s := &streamer{w: c.stdout, view: *view, top: map[models.TradableKey]*topOfBook{}, now: time.Now}
+	if s.view == "" {
+		s.view = c.out.format
+		if s.view == "csv" {
+			s.view = "table"
+		}
+	}
+	switch s.view {
+	case "table", "json", "top":
+	default:
+		return fmt.Errorf("unknown view %q, use \"table\", \"json\" or \"top\"", s.view)
+	}
+
+	subscriptions, err := subscriptions(args, *types, *news, *indicators)
+	if err != nil {
+		return
+	}
+	if len(subscriptions) == 0 && !*private {
+		flags.Usage()
+		return errors.New("stream: nothing to subscribe to, give tradables, -news, -indicators or -private")
+	}
+
+	if *record != "" {
+		var f *os.File
+		if f, err = os.Create(*record); err != nil {
+			return
+		}
+		defer f.Close()
+		s.record = json.NewEncoder(f)
+	}
+	if *recordPrivate != "" {
+		var f *os.File
+		if f, err = os.Create(*recordPrivate); err != nil {
+			return
+		}
+		defer f.Close()
+		s.recordPrivate = json.NewEncoder(f)
+	}
+
+	var (
+		publicMsgs  chan *feed.PublicMsg
+		privateMsgs chan *feed.PrivateMsg
+		publicErrs  = make(chan error)
+		privateErrs = make(chan error)
+		conn        io.ReadWriteCloser
+		publicFeed  *feed.PublicFeed
+		privateFeed *feed.PrivateFeed
+		sessionKey  = c.session.SessionKey
+		interrupt   = make(chan os.Signal, 1)
+		refresh     <-chan time.Time
+		received    int
+	)
+
+	if len(subscriptions) > 0 {
+		if conn, err = c.connect(c.session.PublicFeed); err != nil {
+			return fmt.Errorf("public feed: %v", err)
+		}
+		publicFeed = &feed.PublicFeed{Feed: feed.NewFeed(conn)}
+		defer publicFeed.Close()
+
+		if err = publicFeed.Login(sessionKey, nil); err != nil {
+			return
+		}
+		for _, args := range subscriptions {
+			if err = publicFeed.Subscribe(args); err != nil {
+				return
+			}
+		}
+		publicMsgs = make(chan *feed.PublicMsg)
+		publicFeed.Dispatch(publicMsgs, publicErrs)
+	}
+
+	if *private {
+		if conn, err = c.connect(c.session.PrivateFeed); err != nil {
+			return fmt.Errorf("private feed: %v", err)
+		}
+		privateFeed = &feed.PrivateFeed{Feed: feed.NewFeed(conn)}
+		defer privateFeed.Close()
+
+		if err = privateFeed.Login(sessionKey, nil); err != nil {
+			return
+		}
+		privateMsgs = make(chan *feed.PrivateMsg)
+		privateFeed.Dispatch(privateMsgs, privateErrs)
+	}
+
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	if s.view == "top" {
+		ticker := time.NewTicker(topRefresh)
+		defer ticker.Stop()
+		refresh = ticker.C
+		defer s.redraw()
+	}
+
+	for *count == 0 || received < *count {
+		select {
+		case msg := <-publicMsgs:
+			// messages failing to decode are reported on the error channel
+			if msg.Data == nil {
+				continue
+			}
+			if msg.Type != "heartbeat" {
+				received++
+			}
+			if err = s.public(msg); err != nil {
+				return
+			}
+		case msg := <-privateMsgs:
+			if msg.Data == nil {
+				continue
+			}
+			if msg.Type != "heartbeat" {
+				received++
+			}
+			if err = s.private(msg); err != nil {
+				return
+			}
+		case err = <-publicErrs:
+			if isEOF(err) {
+				return errors.New("public feed disconnected")
+			}
+			fmt.Fprintln(c.stderr, "public feed:", err)
+		case err = <-privateErrs:
+			if isEOF(err) {
+				return errors.New("private feed disconnected")
+			}
+			fmt.Fprintln(c.stderr, "private feed:", err)
+		case <-refresh:
+			if s.dirty {
+				s.redraw()
+			}
+		case <-interrupt:
+			return nil
+		}
+	}
+	return nil
+}
+
+// Reports whether the decode error means the connection is lost
+func isEOF(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed)
+}
+
+// Parses the subscriptions given on the command line into feed command arguments
+func subscriptions(tradables []string, types, news, indicators string) (res []interface{}, err error) {
+	for _, tradable := range tradables {
+		for _, t := range feed.SplitList(types) {
+			args, err := feed.ParseTradableSubscriptions(t, tradable)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, args...)
+		}
+	}
+
+	newsArgs, err := feed.ParseNewsSubscriptions(news)
+	if err != nil {
+		return nil, err
+	}
+	indicatorArgs, err := feed.ParseIndicatorSubscriptions(indicators)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(res, newsArgs...), indicatorArgs...), nil
+}
+
+func (s *streamer) public(msg *feed.PublicMsg) error {
+	if s.record != nil {
+		if err := s.record.Encode(msg); err != nil {
+			return err
+		}
+	}
+	if msg.Type == "heartbeat" {
+		return nil
+	}
+
+	switch s.view {
+	case "json":
+		return s.json("public", msg.Type, msg.Data)
+	case "top":
+		s.update(msg)
+		return nil
+	}
+
+	var tradable, details string
+	switch data := msg.Data.(type) {
+	case feed.PublicPrice:
+		tradable = data.Key().String()
+		details = fmt.Sprintf("bid %v x %v  ask %v x %v  last %v x %v", data.Bid, data.BidVolume, data.Ask, data.AskVolume, data.Last, data.LastVolume)
+	case feed.PublicDepth:
+		tradable = data.Key().String()
+		details = fmt.Sprintf("bid %v x %v  ask %v x %v", data.Bid1, data.BidVolume1, data.Ask1, data.AskVolume1)
+	case feed.PublicTrade:
+		tradable = data.Key().String()
+		details = fmt.Sprintf("%v x %v  %s", data.Price, data.Volume, data.TradeId)
+	case feed.PublicTradingStatus:
+		tradable = data.Key().String()
+		details = fmt.Sprintf("%s  halted %s", data.Status, data.Halted)
+	case feed.PublicIndicator:
+		tradable = data.Key().String()
+		details = fmt.Sprintf("last %v  high %v  low %v", data.Last, data.High, data.Low)
+	case feed.PublicNews:
+		tradable = "source " + data.SourceId
+		details = data.Headline
+	default:
+		details = fmt.Sprint(msg.Data)
+	}
+	s.line("public", msg.Type, tradable, details)
+	return nil
+}
+
+func (s *streamer) private(msg *feed.PrivateMsg) error {
+	if s.recordPrivate != nil {
+		if err := s.recordPrivate.Encode(msg); err != nil {
+			return err
+		}
+	}
+	if msg.Type == "heartbeat" {
+		return nil
+	}
+
+	switch s.view {
+	case "json":
+		return s.json("private", msg.Type, msg.Data)
+	case "top":
+		// orders and trades are not part of the top-of-book view
+		return nil
+	}
+
+	var tradable, details string
+	switch data := msg.Data.(type) {
+	case feed.PrivateOrder:
+		tradable = data.Key().String()
+		details = fmt.Sprintf("order %d  %s %v @ %v %s  %s %s", data.OrderId, data.Side, data.Volume, data.Price.Value, data.Price.Currency, data.OrderState, data.ActionState)
+	case feed.PrivateTrade:
+		tradable = data.Key().String()
+		details = fmt.Sprintf("trade %s  order %d  %s %v @ %v %s", data.TradeId, data.OrderId, data.Side, data.Volume, data.Price.Value, data.Price.Currency)
+	default:
+		details = fmt.Sprint(msg.Data)
+	}
+	s.line("private", msg.Type, tradable, details)
+	return nil
+}
+
+func (s *streamer) line(feedName, typ, tradable, details string) {
+	fmt.Fprintf(s.w, "%s  %-7s  %-14s  %-14s  %s\n", s.now().Format("15:04:05.000"), feedName, typ, tradable, details)
+}
+
+func (s *streamer) json(feedName, typ string, data interface{}) error {
+	return json.NewEncoder(s.w).Encode(struct {
+		Feed string      `json:"feed"`
+		Type string      `json:"type"`
+		Time time.Time   `json:"time"`
+		Data interface{} `json:"data"`
+	}{feedName, typ, s.now(), data})
+}
+
+// Updates the top-of-book view with a public message
+func (s *streamer) update(msg *feed.PublicMsg) {
+	book := func(k models.TradableKey) *topOfBook {
+		if s.top[k] == nil {
+			s.top[k] = &topOfBook{}
+		}
+		s.top[k].Updated = s.now()
+		s.dirty = true
+		return s.top[k]
+	}
+
+	switch data := msg.Data.(type) {
+	case feed.PublicPrice:
+		b := book(data.Key())
+		b.Bid, b.BidVolume, b.Ask, b.AskVolume = data.Bid, data.BidVolume, data.Ask, data.AskVolume
+		b.Last, b.High, b.Low, b.TurnoverVolume = data.Last, data.High, data.Low, data.TurnoverVolume
+	case feed.PublicDepth:
+		b := book(data.Key())
+		b.Bid, b.BidVolume, b.Ask, b.AskVolume = data.Bid1, data.BidVolume1, data.Ask1, data.AskVolume1
+	case feed.PublicTrade:
+		b := book(data.Key())
+		b.Last = data.Price
+	case feed.PublicTradingStatus:
+		b := book(data.Key())
+		b.Status = data.Status
+	}
+}
+
+// Clears the terminal and writes the top-of-book view
+func (s *streamer) redraw() {
+	keys := make([]models.TradableKey, 0, len(s.top))
+	for k := range s.top {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	fmt.Fprint(s.w, "\033[H\033[2J")
+	w := tabwriter.NewWriter(s.w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "TRADABLE\tBID VOL\tBID\tASK\tASK VOL\tLAST\tHIGH\tLOW\tVOLUME\tSTATUS\tUPDATED\t")
+	for _, k := range keys {
+		b := s.top[k]
+		fmt.Fprintf(w, "%s\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%s\t%s\t\n",
+			k, b.BidVolume, b.Bid, b.Ask, b.AskVolume, b.Last, b.High, b.Low, b.TurnoverVolume, b.Status, b.Updated.Format("15:04:05"))
+	}
+	w.Flush()
+	s.dirty = false
+}
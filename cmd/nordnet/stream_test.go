@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/backtest"
+	"github.com/denro/nordnet/feed"
+	"github.com/denro/nordnet/util/models"
+)
+
+var (
+	publicStream = strings.Join([]string{
+		`{"type": "heartbeat", "data": {}}`,
+		`{"type": "price", "data": {"i": "101", "m": 11, "tick_timestamp": 1000, "bid": 99.5, "bid_volume": 200, "ask": 100, "ask_volume": 300, "last": 99.75}}`,
+		`{"type": "trade", "data": {"i": "101", "m": 11, "trade_timestamp": 2000, "price": 100, "volume": 50, "trade_id": "T1"}}`,
+		`{"type": "news", "data": {"itemid": "1", "sourceid": "2", "headline": "Earnings beat expectations"}}`,
+	}, "\n") + "\n"
+	privateStream = `{"type": "order", "data": {"accno": 1, "order_id": 5, "price": {"value": 100, "currency": "SEK"}, "volume": 10, "tradable": {"identifier": "101", "market_id": 11}, "side": "BUY", "order_state": "ON_MARKET", "action_state": "INS_CONF"}}` + "\n"
+)
+
+type fakeConnection struct {
+	io.Reader
+	written *bytes.Buffer
+}
+
+func (c *fakeConnection) Write(b []byte) (int, error) {
+	return c.written.Write(b)
+}
+
+func (c *fakeConnection) Close() error {
+	return nil
+}
+
+// Fakes the feed connections, the feeds stay connected after their messages unless disconnect is set
+func fakeConnect(t *testing.T, disconnect bool) map[string]*fakeConnection {
+	var end io.Reader = strings.NewReader("")
+	if !disconnect {
+		end, _ = io.Pipe()
+	}
+	conns := map[string]*fakeConnection{
+		"public":  {io.MultiReader(strings.NewReader(publicStream), end), &bytes.Buffer{}},
+		"private": {io.MultiReader(strings.NewReader(privateStream), end), &bytes.Buffer{}},
+	}
+	original := connect
+	connect = func(f models.Feed) (io.ReadWriteCloser, error) { return conns[f.Hostname], nil }
+	t.Cleanup(func() { connect = original })
+	return conns
+}
+
+func TestStreamTable(t *testing.T) {
+	ts, _, getenv := setup(t)
+	defer ts.Close()
+	conns := fakeConnect(t, false)
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err := run([]string{"stream", "-count", "3", "-news", "2", "-types", "price,depth", "11:101"}, stdout, stderr, getenv)
+
+	assert := assert.New(t)
+	assert.NoError(err)
+
+	written := conns["public"].written.String()
+	assert.Contains(written, `{"cmd":"login","args":{"session_key":"SESSION"}}`)
+	assert.Contains(written, `{"cmd":"subscribe","args":{"t":"price","i":"101","m":11}}`)
+	assert.Contains(written, `{"cmd":"subscribe","args":{"t":"depth","i":"101","m":11}}`)
+	assert.Contains(written, `{"cmd":"subscribe","args":{"t":"news","s":2}}`)
+	assert.Empty(conns["private"].written.String())
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if assert.Len(lines, 3) {
+		assert.Contains(lines[0], "public   price           11:101          bid 99.5 x 200  ask 100 x 300  last 99.75 x 0")
+		assert.Contains(lines[1], "public   trade           11:101          100 x 50  T1")
+		assert.Contains(lines[2], "Earnings beat expectations")
+	}
+}
+
+func TestStreamJSONAndRecord(t *testing.T) {
+	ts, _, getenv := setup(t)
+	defer ts.Close()
+	fakeConnect(t, false)
+
+	dir := t.TempDir()
+	record, recordPrivate := filepath.Join(dir, "public.jsonl"), filepath.Join(dir, "private.jsonl")
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err := run([]string{"-format", "json", "stream", "-count", "4", "-private", "-record", record, "-record-private", recordPrivate, "11:101"}, stdout, stderr, getenv)
+
+	assert := assert.New(t)
+	assert.NoError(err)
+
+	types := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		var e struct{ Feed, Type string }
+		if assert.NoError(json.Unmarshal([]byte(line), &e)) {
+			types[e.Feed+" "+e.Type]++
+		}
+	}
+	assert.Equal(map[string]int{"public price": 1, "public trade": 1, "public news": 1, "private order": 1}, types)
+
+	// the public recording can be replayed by the backtest package
+	b, _ := ioutil.ReadFile(record)
+	source := backtest.NewRecordingSource(bytes.NewReader(b))
+	var msgs []*feed.PublicMsg
+	for {
+		e, err := source.Next()
+		if err != nil {
+			assert.Equal(io.EOF, err)
+			break
+		}
+		msgs = append(msgs, e.Msg)
+	}
+	if assert.Len(msgs, 4) {
+		assert.Equal(feed.PublicTrade{I: "101", M: 11, TradeTimestamp: 2000, Price: models.NewDecimal(100, 0), Volume: 50, TradeId: "T1"}, msgs[2].Data)
+	}
+
+	b, _ = ioutil.ReadFile(recordPrivate)
+	assert.Contains(string(b), `"order_id":5`)
+}
+
+func TestStreamTop(t *testing.T) {
+	ts, _, getenv := setup(t)
+	defer ts.Close()
+	fakeConnect(t, false)
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err := run([]string{"stream", "-view", "top", "-count", "2", "11:101"}, stdout, stderr, getenv)
+
+	assert := assert.New(t)
+	assert.NoError(err)
+
+	screens := strings.Split(stdout.String(), "\033[H\033[2J")
+	last := strings.Split(strings.TrimSpace(screens[len(screens)-1]), "\n")
+	if assert.Len(last, 2) {
+		assert.Equal([]string{"TRADABLE", "BID", "VOL", "BID", "ASK", "ASK", "VOL", "LAST", "HIGH", "LOW", "VOLUME", "STATUS", "UPDATED"}, strings.Fields(last[0]))
+		assert.Equal([]string{"11:101", "200", "99.5", "100", "300", "100", "0", "0", "0"}, strings.Fields(last[1])[:9])
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	ts, _, getenv := setup(t)
+	defer ts.Close()
+	fakeConnect(t, true)
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	assert := assert.New(t)
+
+	assert.EqualError(run([]string{"stream"}, stdout, stderr, getenv), "stream: nothing to subscribe to, give tradables, -news, -indicators or -private")
+	assert.EqualError(run([]string{"stream", "101"}, stdout, stderr, getenv), `invalid tradable "101", expected market:identifier`)
+	assert.EqualError(run([]string{"stream", "-types", "quotes", "11:101"}, stdout, stderr, getenv), `unknown subscription type "quotes"`)
+	assert.EqualError(run([]string{"stream", "-view", "chart", "11:101"}, stdout, stderr, getenv), `unknown view "chart", use "table", "json" or "top"`)
+	assert.EqualError(run([]string{"stream", "11:101"}, stdout, stderr, getenv), "public feed disconnected")
+}
@@ -0,0 +1,125 @@
+// Package conflate thins out the price and depth updates of the public feed for user interfaces and slow consumers.
+//
+// A Conflater holds on to the latest price and depth of every tradable and publishes them at most once
+// per interval, however many updates arrived in between. Trades, trading statuses and all other messages
+// pass straight through, so no trade is ever lost. Prices and depths are snapshots of the tradable, like
+// for every other consumer of the feed, so a later update replaces an earlier one and zero values such as
+// an emptied depth level are published as they are.
+package conflate
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/denro/nordnet/feed"
+	"github.com/denro/nordnet/util/models"
+)
+
+// The interval used when none is given
+const DefaultInterval = 250 * time.Millisecond
+
+// Identifies the updates replacing each other
+type key struct {
+	typ      string
+	tradable models.TradableKey
+}
+
+// Conflater keeps the latest price and depth update of each tradable, it is safe for concurrent use.
+type Conflater struct {
+	// The interval the snapshots are published at, DefaultInterval when not positive
+	Interval time.Duration
+
+	pending map[key]*feed.PublicMsg
+	order   []key
+	merged  int64
+	mu      sync.Mutex
+}
+
+// Constructor function publishing the snapshots at most once per interval, DefaultInterval when the
+// interval is not positive.
+func New(interval time.Duration) *Conflater {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Conflater{Interval: interval, pending: map[key]*feed.PublicMsg{}}
+}
+
+// Takes a message of the feed. Prices and depths replace the earlier update of their tradable, the latest
+// is held until the next Flush and nil is returned. Every other message is returned to be published
+// right away.
+func (c *Conflater) Update(msg *feed.PublicMsg) *feed.PublicMsg {
+	var k key
+	switch data := msg.Data.(type) {
+	case feed.PublicPrice:
+		k = key{msg.Type, data.Key()}
+	case feed.PublicDepth:
+		k = key{msg.Type, data.Key()}
+	default:
+		return msg
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.pending[k]; ok {
+		atomic.AddInt64(&c.merged, 1)
+	} else {
+		c.order = append(c.order, k)
+	}
+	c.pending[k] = msg
+	return nil
+}
+
+// Returns the snapshots updated since the last flush, in the order their tradables were first updated.
+func (c *Conflater) Flush() (res []*feed.PublicMsg) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, k := range c.order {
+		res = append(res, c.pending[k])
+		delete(c.pending, k)
+	}
+	c.order = nil
+	return
+}
+
+// Returns the number of updates replaced by a later update of the same tradable before being published.
+func (c *Conflater) Merged() int64 {
+	return atomic.LoadInt64(&c.merged)
+}
+
+// Reads the messages of the feed, sending the snapshots on out every Interval and the other messages
+// as they arrive. When in is closed the remaining snapshots are sent and out is closed. Messages
+// failing to decode are skipped, their errors are sent on the error channel of Dispatch.
+func (c *Conflater) Run(in <-chan *feed.PublicMsg, out chan<- *feed.PublicMsg) {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-in:
+			if !ok {
+				for _, snapshot := range c.Flush() {
+					out <- snapshot
+				}
+				close(out)
+				return
+			}
+			if msg.Data == nil {
+				continue
+			}
+			if msg = c.Update(msg); msg != nil {
+				out <- msg
+			}
+		case <-ticker.C:
+			for _, snapshot := range c.Flush() {
+				out <- snapshot
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package conflate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/feed"
+	"github.com/denro/nordnet/util/models"
+)
+
+func price(identifier string, last int64) *feed.PublicMsg {
+	return &feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: identifier, M: 11, Last: models.NewDecimal(last, 0)}}
+}
+
+func depth(identifier string, bid int64) *feed.PublicMsg {
+	return &feed.PublicMsg{Type: "depth", Data: feed.PublicDepth{I: identifier, M: 11, Bid1: models.NewDecimal(bid, 0)}}
+}
+
+func TestUpdateAndFlush(t *testing.T) {
+	c := New(time.Second)
+
+	assert := assert.New(t)
+
+	trade := &feed.PublicMsg{Type: "trade", Data: feed.PublicTrade{I: "101", M: 11, Price: models.NewDecimal(100, 0)}}
+	status := &feed.PublicMsg{Type: "trading_status", Data: feed.PublicTradingStatus{I: "101", M: 11, Status: "C"}}
+
+	assert.Nil(c.Update(price("101", 1)))
+	assert.Nil(c.Update(depth("101", 1)))
+	assert.Nil(c.Update(price("102", 2)))
+	assert.Equal(trade, c.Update(trade))
+	assert.Nil(c.Update(price("101", 3)))
+	assert.Equal(status, c.Update(status))
+	assert.Nil(c.Update(depth("101", 4)))
+
+	assert.Equal([]*feed.PublicMsg{price("101", 3), depth("101", 4), price("102", 2)}, c.Flush())
+	assert.Equal(int64(2), c.Merged())
+	assert.Empty(c.Flush())
+
+	assert.Nil(c.Update(price("102", 5)))
+	assert.Equal([]*feed.PublicMsg{price("102", 5)}, c.Flush())
+}
+
+func TestLatestUpdate(t *testing.T) {
+	c := New(0)
+
+	assert := assert.New(t)
+	assert.Equal(DefaultInterval, c.Interval)
+
+	// an emptied level and a volume dropping to zero are published
+	assert.Nil(c.Update(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "101", M: 11, Bid: models.NewDecimal(99, 0), BidVolume: 500}}))
+	assert.Nil(c.Update(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "101", M: 11, Bid: models.NewDecimal(99, 0)}}))
+	assert.Nil(c.Update(&feed.PublicMsg{Type: "depth", Data: feed.PublicDepth{I: "101", M: 11, Bid1: models.NewDecimal(99, 0), BidVolume1: 500, Ask1: models.NewDecimal(101, 0), AskVolume1: 200}}))
+	assert.Equal([]*feed.PublicMsg{
+		{Type: "price", Data: feed.PublicPrice{I: "101", M: 11, Bid: models.NewDecimal(99, 0)}},
+		{Type: "depth", Data: feed.PublicDepth{I: "101", M: 11, Bid1: models.NewDecimal(99, 0), BidVolume1: 500, Ask1: models.NewDecimal(101, 0), AskVolume1: 200}},
+	}, c.Flush())
+
+	assert.Nil(c.Update(&feed.PublicMsg{Type: "depth", Data: feed.PublicDepth{I: "101", M: 11, Bid1: models.NewDecimal(99, 0), BidVolume1: 300}}))
+	assert.Equal([]*feed.PublicMsg{
+		{Type: "depth", Data: feed.PublicDepth{I: "101", M: 11, Bid1: models.NewDecimal(99, 0), BidVolume1: 300}},
+	}, c.Flush())
+}
+
+func TestRun(t *testing.T) {
+	c := New(20 * time.Millisecond)
+	in, out := make(chan *feed.PublicMsg), make(chan *feed.PublicMsg, 100)
+	go c.Run(in, out)
+
+	assert := assert.New(t)
+
+	for i := 1; i <= 100; i++ {
+		in <- price("101", int64(i))
+	}
+	in <- &feed.PublicMsg{Type: "price"}
+	in <- &feed.PublicMsg{Type: "heartbeat", Data: struct{}{}}
+
+	// the heartbeat passes straight through while the prices are thinned out to the latest
+	var snapshots int
+	for heartbeat, last := false, 0.0; !heartbeat || last != 100; {
+		select {
+		case msg := <-out:
+			if msg.Type == "heartbeat" {
+				heartbeat = true
+			} else {
+				snapshots++
+				last = msg.Data.(feed.PublicPrice).Last.Float64()
+			}
+		case <-time.After(time.Second):
+			t.Fatal("snapshot or heartbeat not published")
+		}
+	}
+	assert.True(snapshots < 100)
+
+	in <- price("101", 101)
+	close(in)
+
+	var rest []*feed.PublicMsg
+	for msg := range out {
+		rest = append(rest, msg)
+	}
+	assert.Equal([]*feed.PublicMsg{price("101", 101)}, rest)
+	assert.Equal(int64(100-snapshots), c.Merged())
+}
@@ -5,8 +5,38 @@
 
 	The api package provides a wrapper to the REST-API.
 
+	The batch package splits lookups of many ids into concurrent requests and joins concurrent lookups.
+
+	The bus package fans the feed messages out to many subscribers in a process, each with its own buffer.
+
+	The conflate package publishes the latest price and depth of each tradable at most once per interval.
+
 	The feed package is an implementation for subscribing to the real-time events.
 
+	The backtest package evaluates strategies offline against recorded or historical market data.
+
+	The bridge package multiplexes one connection to the feeds to many WebSocket clients.
+
+	The gateway package serves a curated REST API and the feeds of a single session to other services.
+
+	The killswitch package cancels all working orders on every account in an emergency.
+
+	The logging package writes structured logs about the REST client and the feeds with secrets redacted.
+
+	The metrics package collects statistics about the REST client and the feeds, also as a Prometheus collector.
+
+	The paper package is a simulated broker for paper trading against live market data.
+
+	The portfolio package values the positions of an account with live prices and tracks its profit and loss,
+	and consolidates all accounts in a base currency.
+
+	The refdata package caches markets, tick sizes, sectors, instruments and other reference data, and resolves
+	tickers and ISINs into instruments.
+
+	The tax package rebuilds the realised gains of a trade history with the average cost method for the Swedish K4 form.
+
+	The tracing package creates OpenTelemetry spans for API requests and follows orders through the private feed.
+
 	The util package contans all models used by the packages as well as a function for generating credentials.
 
 */
@@ -15,6 +45,20 @@ package nordnet
 
 import (
 	_ "github.com/denro/nordnet/api"
+	_ "github.com/denro/nordnet/backtest"
+	_ "github.com/denro/nordnet/batch"
+	_ "github.com/denro/nordnet/bridge"
+	_ "github.com/denro/nordnet/bus"
+	_ "github.com/denro/nordnet/conflate"
 	_ "github.com/denro/nordnet/feed"
+	_ "github.com/denro/nordnet/gateway"
+	_ "github.com/denro/nordnet/killswitch"
+	_ "github.com/denro/nordnet/logging"
+	_ "github.com/denro/nordnet/metrics"
+	_ "github.com/denro/nordnet/paper"
+	_ "github.com/denro/nordnet/portfolio"
+	_ "github.com/denro/nordnet/refdata"
+	_ "github.com/denro/nordnet/tax"
+	_ "github.com/denro/nordnet/tracing"
 	_ "github.com/denro/nordnet/util"
 )
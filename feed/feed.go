@@ -8,6 +8,8 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"io"
+	"sync"
+	"time"
 )
 
 // Used in the UnmarshalJSON implementations on PrivateFeed and PublicFeed
@@ -52,11 +54,45 @@ type rawMsg struct {
 	Data json.RawMessage `json:"data"`
 }
 
+// Kinds of events passed to the feed hooks
+const (
+	MessageEvent     = "message"
+	DecodeErrorEvent = "decode_error"
+	LoginEvent       = "login"
+	SubscribeEvent   = "subscribe"
+	UnsubscribeEvent = "unsubscribe"
+	CloseEvent       = "close"
+)
+
+// Information about something happening on the feed, passed to the hooks
+type Event struct {
+	Kind string
+	Time time.Time
+
+	// Type and decoded message for message events, a *PublicMsg or a *PrivateMsg
+	Type string
+	Msg  interface{}
+
+	// Arguments of the subscribe and unsubscribe commands
+	Args interface{}
+
+	// Error for decode error events
+	Err error
+}
+
+// Hook is called for every event on the feed
+type Hook func(*Event)
+
 // Represents the feed connection
 type Feed struct {
 	conn    io.ReadWriteCloser
 	encoder *json.Encoder
 	decoder *json.Decoder
+
+	hooks     []Hook
+	mu        sync.RWMutex
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 // Returns a new Feed connected to the address specified
@@ -66,7 +102,12 @@ func newFeed(address string) (*Feed, error) {
 		return nil, err
 	}
 
-	return &Feed{conn, json.NewEncoder(conn), json.NewDecoder(conn)}, nil
+	return NewFeed(conn), nil
+}
+
+// Returns a new Feed using an already established connection
+func NewFeed(conn io.ReadWriteCloser) *Feed {
+	return &Feed{conn: conn, encoder: json.NewEncoder(conn), decoder: json.NewDecoder(conn), closed: make(chan struct{})}
 }
 
 // Feed implements the Writer interface
@@ -77,10 +118,42 @@ func (f *Feed) Write(any interface{}) error {
 // Feed implements the Closer interface
 // closes the underlying conneciton
 func (f *Feed) Close() error {
+	f.event(&Event{Kind: CloseEvent})
+	if f.closed != nil {
+		f.closeOnce.Do(func() { close(f.closed) })
+	}
 	return f.conn.Close()
 }
 
+// Returns a channel closed when the feed is closed, Dispatch stops sending when it is closed.
+// The channel is nil for a Feed not made by NewFeed.
+func (f *Feed) Done() <-chan struct{} {
+	return f.closed
+}
+
 // Send the login command with the specified session key
 func (f *Feed) Login(session string, getState interface{}) error {
+	f.event(&Event{Kind: LoginEvent})
 	return f.Write(&FeedCmd{Cmd: "login", Args: &LoginArgs{SessionKey: session, GetState: getState}})
 }
+
+// Adds a hook called for every event on the feed, hooks are called in the order they were added.
+func (f *Feed) AddHook(hook Hook) {
+	f.mu.Lock()
+	f.hooks = append(f.hooks, hook)
+	f.mu.Unlock()
+}
+
+func (f *Feed) event(e *Event) {
+	f.mu.RLock()
+	hooks := f.hooks
+	f.mu.RUnlock()
+
+	if len(hooks) == 0 {
+		return
+	}
+	e.Time = time.Now()
+	for _, hook := range hooks {
+		hook(e)
+	}
+}
@@ -40,7 +40,7 @@ var writeTests = []struct {
 
 func TestWrite(t *testing.T) {
 	b := &fakeConnection{&bytes.Buffer{}}
-	f := &Feed{b, json.NewEncoder(b), json.NewDecoder(b)}
+	f := &Feed{conn: b, encoder: json.NewEncoder(b), decoder: json.NewDecoder(b)}
 
 	for _, tt := range writeTests {
 		b.Reset()
@@ -85,7 +85,7 @@ var loginTests = []struct {
 
 func TestLogin(t *testing.T) {
 	b := &fakeConnection{&bytes.Buffer{}}
-	f := &Feed{b, json.NewEncoder(b), json.NewDecoder(b)}
+	f := &Feed{conn: b, encoder: json.NewEncoder(b), decoder: json.NewDecoder(b)}
 
 	for _, tt := range loginTests {
 		b.Reset()
@@ -95,3 +95,34 @@ func TestLogin(t *testing.T) {
 		assert.Equal(t, tt.expected+string('\n'), b.String())
 	}
 }
+
+func TestHooks(t *testing.T) {
+	b := &fakeConnection{&bytes.Buffer{}}
+	f := &PublicFeed{NewFeed(b)}
+
+	events := make(chan *Event, 10)
+	f.AddHook(func(e *Event) { events <- e })
+
+	f.Login("ABC123", nil)
+	f.Subscribe(&PriceArgs{T: "price", I: "101", M: 11})
+	f.Unsubscribe(&PriceArgs{T: "price", I: "101", M: 11})
+
+	b.Reset()
+	b.WriteString(`{"type":"heartbeat","data":{}}` + "\n" + `{"type":`)
+	f.Dispatch(make(chan *PublicMsg, 10), make(chan error, 10))
+
+	assert := assert.New(t)
+	for _, expected := range []string{LoginEvent, SubscribeEvent, UnsubscribeEvent, MessageEvent, DecodeErrorEvent} {
+		e := <-events
+		assert.Equal(expected, e.Kind)
+		assert.False(e.Time.IsZero())
+		switch e.Kind {
+		case SubscribeEvent:
+			assert.Equal(&PriceArgs{T: "price", I: "101", M: 11}, e.Args)
+		case MessageEvent:
+			assert.Equal("heartbeat", e.Type)
+		case DecodeErrorEvent:
+			assert.Error(e.Err)
+		}
+	}
+}
@@ -57,7 +57,7 @@ func (pm *PrivateMsg) UnmarshalJSON(b []byte) (err error) {
 	return
 }
 
-// Starts reading from the connection and sends data through given channels
+// Starts reading from the connection and sends data through given channels, until the feed is closed
 func (pf *PrivateFeed) Dispatch(msgChan chan *PrivateMsg, errChan chan error) {
 	go func(d *json.Decoder, mc chan<- *PrivateMsg, ec chan<- error) {
 		var (
@@ -68,9 +68,20 @@ func (pf *PrivateFeed) Dispatch(msgChan chan *PrivateMsg, errChan chan error) {
 		for {
 			pMsg = new(PrivateMsg)
 			if err = d.Decode(pMsg); err != nil {
-				ec <- err
+				pf.event(&Event{Kind: DecodeErrorEvent, Err: err})
+				select {
+				case ec <- err:
+				case <-pf.closed:
+					return
+				}
+			} else {
+				pf.event(&Event{Kind: MessageEvent, Type: pMsg.Type, Msg: pMsg})
+			}
+			select {
+			case mc <- pMsg:
+			case <-pf.closed:
+				return
 			}
-			msgChan <- pMsg
 		}
 	}(pf.decoder, msgChan, errChan)
 
@@ -60,7 +60,7 @@ var privateUnmarshalTests = []struct {
 		&PrivateMsg{"order", PrivateOrder{
 			Accno:               123,
 			OrderId:             123,
-			Price:               models.Amount{1.1, "test"},
+			Price:               models.Amount{models.NewDecimal(11, -1), "test"},
 			Volume:              1.1,
 			Tradable:            models.TradableId{"test", 123},
 			OpenVolume:          1.1,
@@ -68,7 +68,7 @@ var privateUnmarshalTests = []struct {
 			Side:                "test",
 			Modified:            123,
 			Reference:           "test",
-			ActivationCondition: models.ActivationCondition{"test", 1.1, 1.1, "test"},
+			ActivationCondition: models.ActivationCondition{"test", models.NewDecimal(11, -1), models.NewDecimal(11, -1), "test"},
 			PriceCondition:      "test",
 			VolumeCondition:     "test",
 			Validity:            models.Validity{"test", 123},
@@ -102,7 +102,7 @@ var privateUnmarshalTests = []struct {
 			OrderId:      123,
 			TradeId:      "test",
 			Tradable:     models.TradableId{"test", 123},
-			Price:        models.Amount{1.1, "test"},
+			Price:        models.Amount{models.NewDecimal(11, -1), "test"},
 			Volume:       1.1,
 			Side:         "test",
 			Counterparty: "test",
@@ -141,7 +141,7 @@ var privateDispatchTests = []struct {
 
 func TestPrivateFeedDispatch(t *testing.T) {
 	b := &fakeConnection{&bytes.Buffer{}}
-	f := &Feed{b, json.NewEncoder(b), json.NewDecoder(b)}
+	f := &Feed{conn: b, encoder: json.NewEncoder(b), decoder: json.NewDecoder(b)}
 	feed := &PrivateFeed{f}
 
 	for _, tt := range privateDispatchTests {
@@ -2,6 +2,8 @@ package feed
 
 import (
 	"encoding/json"
+
+	"github.com/denro/nordnet/util/models"
 )
 
 type PublicFeed struct {
@@ -51,106 +53,108 @@ type NewsArgs struct {
 
 // Sends the Subscribe command with the given args
 func (f *PublicFeed) Subscribe(args interface{}) error {
+	f.event(&Event{Kind: SubscribeEvent, Args: args})
 	return f.Write(&FeedCmd{Cmd: "subscribe", Args: args})
 }
 
 // Sends the Unsubscribe command with the given args
 func (f *PublicFeed) Unsubscribe(args interface{}) error {
+	f.event(&Event{Kind: UnsubscribeEvent, Args: args})
 	return f.Write(&FeedCmd{Cmd: "unsubscribe", Args: args})
 }
 
 // Price data section in the public message
 type PublicPrice struct {
-	I              string  `json:"i"`
-	M              int64   `json:"m"`
-	TradeTimestamp int64   `json:"trade_timestamp"`
-	TickTimestamp  int64   `json:"tick_timestamp"`
-	Bid            float64 `json:"bid"`
-	BidVolume      float64 `json:"bid_volume"`
-	Ask            float64 `json:"ask"`
-	AskVolume      float64 `json:"ask_volume"`
-	Close          float64 `json:"close"`
-	High           float64 `json:"high"`
-	Last           float64 `json:"last"`
-	LastVolume     float64 `json:"last_volume"`
-	Low            float64 `json:"low"`
-	Open           float64 `json:"open"`
-	Turnover       float64 `json:"turnover"`
-	TurnoverVolume float64 `json:"turnover_volume"`
-	EP             float64 `json:"ep"`
-	Paired         float64 `json:"paired"`
-	Imbalance      float64 `json:"imbalance"`
+	I              string           `json:"i"`
+	M              int64            `json:"m"`
+	TradeTimestamp models.Timestamp `json:"trade_timestamp"`
+	TickTimestamp  models.Timestamp `json:"tick_timestamp"`
+	Bid            models.Decimal   `json:"bid"`
+	BidVolume      float64          `json:"bid_volume"`
+	Ask            models.Decimal   `json:"ask"`
+	AskVolume      float64          `json:"ask_volume"`
+	Close          models.Decimal   `json:"close"`
+	High           models.Decimal   `json:"high"`
+	Last           models.Decimal   `json:"last"`
+	LastVolume     float64          `json:"last_volume"`
+	Low            models.Decimal   `json:"low"`
+	Open           models.Decimal   `json:"open"`
+	Turnover       models.Decimal   `json:"turnover"`
+	TurnoverVolume float64          `json:"turnover_volume"`
+	EP             models.Decimal   `json:"ep"`
+	Paired         float64          `json:"paired"`
+	Imbalance      float64          `json:"imbalance"`
 }
 
 // Trade data section in the public message
 type PublicTrade struct {
-	I              string  `json:"i"`
-	M              int64   `json:"m"`
-	TradeTimestamp int64   `json:"trade_timestamp"`
-	Price          float64 `json:"price"`
-	Volume         float64 `json:"volume"`
-	BrokerBuying   string  `json:"broker_buying"`
-	BrokerSelling  string  `json:"broker_selling"`
-	TradeId        string  `json:"trade_id"`
-	TradeType      string  `json:"trade_type"`
+	I              string           `json:"i"`
+	M              int64            `json:"m"`
+	TradeTimestamp models.Timestamp `json:"trade_timestamp"`
+	Price          models.Decimal   `json:"price"`
+	Volume         float64          `json:"volume"`
+	BrokerBuying   string           `json:"broker_buying"`
+	BrokerSelling  string           `json:"broker_selling"`
+	TradeId        string           `json:"trade_id"`
+	TradeType      string           `json:"trade_type"`
 }
 
 // Depth data section in the public message
 type PublicDepth struct {
-	I             string  `json:"i"`
-	M             int64   `json:"m"`
-	TickTimestamp int64   `json:"tick_timestamp"`
-	Bid1          float64 `json:"bid1"`
-	BidVolume1    float64 `json:"bid_volume1"`
-	Ask1          float64 `json:"ask1"`
-	AskVolume1    float64 `json:"ask_volume1"`
-	Bid2          float64 `json:"bid2"`
-	BidVolume2    float64 `json:"bid_volume2"`
-	Ask2          float64 `json:"ask2"`
-	AskVolume2    float64 `json:"ask_volume2"`
-	Bid3          float64 `json:"bid3"`
-	BidVolume3    float64 `json:"bid_volume3"`
-	Ask3          float64 `json:"ask3"`
-	AskVolume3    float64 `json:"ask_volume3"`
-	Bid4          float64 `json:"bid4"`
-	BidVolume4    float64 `json:"bid_volume4"`
-	Ask4          float64 `json:"ask4"`
-	AskVolume4    float64 `json:"ask_volume4"`
-	Bid5          float64 `json:"bid5"`
-	BidVolume5    float64 `json:"bid_volume5"`
-	Ask5          float64 `json:"ask5"`
-	AskVolume5    float64 `json:"ask_volume5"`
+	I             string           `json:"i"`
+	M             int64            `json:"m"`
+	TickTimestamp models.Timestamp `json:"tick_timestamp"`
+	Bid1          models.Decimal   `json:"bid1"`
+	BidVolume1    float64          `json:"bid_volume1"`
+	Ask1          models.Decimal   `json:"ask1"`
+	AskVolume1    float64          `json:"ask_volume1"`
+	Bid2          models.Decimal   `json:"bid2"`
+	BidVolume2    float64          `json:"bid_volume2"`
+	Ask2          models.Decimal   `json:"ask2"`
+	AskVolume2    float64          `json:"ask_volume2"`
+	Bid3          models.Decimal   `json:"bid3"`
+	BidVolume3    float64          `json:"bid_volume3"`
+	Ask3          models.Decimal   `json:"ask3"`
+	AskVolume3    float64          `json:"ask_volume3"`
+	Bid4          models.Decimal   `json:"bid4"`
+	BidVolume4    float64          `json:"bid_volume4"`
+	Ask4          models.Decimal   `json:"ask4"`
+	AskVolume4    float64          `json:"ask_volume4"`
+	Bid5          models.Decimal   `json:"bid5"`
+	BidVolume5    float64          `json:"bid_volume5"`
+	Ask5          models.Decimal   `json:"ask5"`
+	AskVolume5    float64          `json:"ask_volume5"`
 }
 
 // Trading Status data section in the public message
 type PublicTradingStatus struct {
-	I             string `json:"i"`
-	M             int64  `json:"m"`
-	TickTimestamp int64  `json:"tick_timestamp"`
-	Status        string `json:"status"`
-	SourceStatus  string `json:"source_status"`
-	Halted        string `json:"halted"`
+	I             string               `json:"i"`
+	M             int64                `json:"m"`
+	TickTimestamp models.Timestamp     `json:"tick_timestamp"`
+	Status        models.TradingStatus `json:"status"`
+	SourceStatus  string               `json:"source_status"`
+	Halted        string               `json:"halted"`
 }
 
 // Indicator data section in the public message
 type PublicIndicator struct {
-	I             string  `json:"i"`
-	M             string  `json:"m"`
-	TickTimestamp int64   `json:"tick_timestamp"`
-	High          float64 `json:"high"`
-	Low           float64 `json:"low"`
-	Last          float64 `json:"last"`
-	Close         float64 `json:"close"`
+	I             string           `json:"i"`
+	M             string           `json:"m"`
+	TickTimestamp models.Timestamp `json:"tick_timestamp"`
+	High          models.Decimal   `json:"high"`
+	Low           models.Decimal   `json:"low"`
+	Last          models.Decimal   `json:"last"`
+	Close         models.Decimal   `json:"close"`
 }
 
 // News data section in the public message
 type PublicNews struct {
-	ItemId      string   `json:"itemid"`
-	Lang        string   `json:"lang"`
-	Datetime    string   `json:"datetime"`
-	SourceId    string   `json:"sourceid"`
-	Headline    string   `json:"headline"`
-	Instruments []string `json:"instruments"`
+	ItemId      string          `json:"itemid"`
+	Lang        string          `json:"lang"`
+	Datetime    models.DateTime `json:"datetime"`
+	SourceId    string          `json:"sourceid"`
+	Headline    string          `json:"headline"`
+	Instruments []string        `json:"instruments"`
 }
 
 // Represents the messages sent on the public feed
@@ -210,7 +214,7 @@ func (pm *PublicMsg) UnmarshalJSON(b []byte) (err error) {
 	return
 }
 
-// Starts reading from the connection and sends data through given channels
+// Starts reading from the connection and sends data through given channels, until the feed is closed
 func (pf *PublicFeed) Dispatch(msgChan chan *PublicMsg, errChan chan error) {
 	go func(d *json.Decoder, mc chan<- *PublicMsg, ec chan<- error) {
 		var (
@@ -221,9 +225,20 @@ func (pf *PublicFeed) Dispatch(msgChan chan *PublicMsg, errChan chan error) {
 		for {
 			pMsg = new(PublicMsg)
 			if err = d.Decode(pMsg); err != nil {
-				ec <- err
+				pf.event(&Event{Kind: DecodeErrorEvent, Err: err})
+				select {
+				case ec <- err:
+				case <-pf.closed:
+					return
+				}
+			} else {
+				pf.event(&Event{Kind: MessageEvent, Type: pMsg.Type, Msg: pMsg})
+			}
+			select {
+			case mc <- pMsg:
+			case <-pf.closed:
+				return
 			}
-			msgChan <- pMsg
 		}
 	}(pf.decoder, msgChan, errChan)
 
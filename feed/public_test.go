@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/util/models"
 )
 
 var publicUnmarshalTests = []struct {
@@ -46,19 +48,19 @@ var publicUnmarshalTests = []struct {
 			M:              123,
 			TradeTimestamp: 123,
 			TickTimestamp:  123,
-			Bid:            1.1,
+			Bid:            models.NewDecimal(11, -1),
 			BidVolume:      1.1,
-			Ask:            1.1,
+			Ask:            models.NewDecimal(11, -1),
 			AskVolume:      1.1,
-			Close:          1.1,
-			High:           1.1,
-			Last:           1.1,
+			Close:          models.NewDecimal(11, -1),
+			High:           models.NewDecimal(11, -1),
+			Last:           models.NewDecimal(11, -1),
 			LastVolume:     1.1,
-			Low:            1.1,
-			Open:           1.1,
-			Turnover:       1.1,
+			Low:            models.NewDecimal(11, -1),
+			Open:           models.NewDecimal(11, -1),
+			Turnover:       models.NewDecimal(11, -1),
 			TurnoverVolume: 1.1,
-			EP:             1.1,
+			EP:             models.NewDecimal(11, -1),
 			Paired:         1.1,
 			Imbalance:      1.1,
 		}},
@@ -82,7 +84,7 @@ var publicUnmarshalTests = []struct {
 			I:              "test",
 			M:              123,
 			TradeTimestamp: 123,
-			Price:          1.1,
+			Price:          models.NewDecimal(11, -1),
 			Volume:         1.1,
 			BrokerBuying:   "test",
 			BrokerSelling:  "test",
@@ -123,25 +125,25 @@ var publicUnmarshalTests = []struct {
 			I:             "test",
 			M:             123,
 			TickTimestamp: 123,
-			Bid1:          1.1,
+			Bid1:          models.NewDecimal(11, -1),
 			BidVolume1:    1.1,
-			Ask1:          1.1,
+			Ask1:          models.NewDecimal(11, -1),
 			AskVolume1:    1.1,
-			Bid2:          1.1,
+			Bid2:          models.NewDecimal(11, -1),
 			BidVolume2:    1.1,
-			Ask2:          1.1,
+			Ask2:          models.NewDecimal(11, -1),
 			AskVolume2:    1.1,
-			Bid3:          1.1,
+			Bid3:          models.NewDecimal(11, -1),
 			BidVolume3:    1.1,
-			Ask3:          1.1,
+			Ask3:          models.NewDecimal(11, -1),
 			AskVolume3:    1.1,
-			Bid4:          1.1,
+			Bid4:          models.NewDecimal(11, -1),
 			BidVolume4:    1.1,
-			Ask4:          1.1,
+			Ask4:          models.NewDecimal(11, -1),
 			AskVolume4:    1.1,
-			Bid5:          1.1,
+			Bid5:          models.NewDecimal(11, -1),
 			BidVolume5:    1.1,
-			Ask5:          1.1,
+			Ask5:          models.NewDecimal(11, -1),
 			AskVolume5:    1.1,
 		}},
 	},
@@ -183,10 +185,10 @@ var publicUnmarshalTests = []struct {
 			I:             "test",
 			M:             "test",
 			TickTimestamp: 123,
-			High:          1.1,
-			Low:           1.1,
-			Last:          1.1,
-			Close:         1.1,
+			High:          models.NewDecimal(11, -1),
+			Low:           models.NewDecimal(11, -1),
+			Last:          models.NewDecimal(11, -1),
+			Close:         models.NewDecimal(11, -1),
 		}},
 	},
 	{
@@ -222,6 +224,40 @@ func TestPublicMsgUnmarshalJSON(t *testing.T) {
 	}
 }
 
+func TestPublicMsgJSONRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	// messages recorded from the feed are written back byte for byte, timestamps and prices included
+	for _, data := range []string{
+		`{"type":"price","data":{"i":"101","m":11,"trade_timestamp":1458289812250,"tick_timestamp":1458289812431,` +
+			`"bid":106.90,"bid_volume":3412,"ask":107.00,"ask_volume":1506,"close":106.2,"high":107.5,"last":107.00,` +
+			`"last_volume":200,"low":105.80,"open":106.1,"turnover":"412530768.50","turnover_volume":3874512,"ep":0,"paired":0,"imbalance":0}}`,
+		`{"type":"trading_status","data":{"i":"101","m":11,"tick_timestamp":1458284400000,"status":"C","source_status":"CONT","halted":"N"}}`,
+		`{"type":"news","data":{"itemid":"1450123","lang":"sv","datetime":"2016-03-18 09:30:12","sourceid":"2",` +
+			`"headline":"Ericsson vinner order","instruments":["16101932"]}}`,
+	} {
+		msg := &PublicMsg{}
+		if assert.NoError(json.Unmarshal([]byte(data), msg)) {
+			b, err := json.Marshal(msg)
+			assert.NoError(err)
+			assert.Equal(data, string(b))
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	assert := assert.New(t)
+
+	key := models.NewTradableKey(11, "101")
+	assert.Equal(key, PriceArgs{T: "price", I: "101", M: 11}.Key())
+	assert.Equal(key, TradingStatusArgs{T: "trading_status", I: "101", M: 11}.Key())
+	assert.Equal(key, PublicPrice{I: "101", M: 11}.Key())
+	assert.Equal(key, PublicDepth{I: "101", M: 11}.Key())
+	assert.Equal(key, PrivateTrade{Tradable: models.TradableId{Identifier: "101", MarketId: 11}}.Key())
+	assert.Equal(models.TradableKey("SIX:OMXS30"), IndicatorArgs{T: "indicator", I: "OMXS30", M: "SIX"}.Key())
+	assert.Equal(models.TradableKey("SIX:OMXS30"), PublicIndicator{I: "OMXS30", M: "SIX"}.Key())
+}
+
 var publicDispatchTests = []struct {
 	json     string
 	expected *PublicMsg
@@ -258,7 +294,7 @@ var publicDispatchTests = []struct {
 
 func TestPublicFeedDispatch(t *testing.T) {
 	b := &fakeConnection{&bytes.Buffer{}}
-	f := &Feed{b, json.NewEncoder(b), json.NewDecoder(b)}
+	f := &Feed{conn: b, encoder: json.NewEncoder(b), decoder: json.NewDecoder(b)}
 	feed := &PublicFeed{f}
 
 	for _, tt := range publicDispatchTests {
@@ -331,7 +367,7 @@ var subscribeTests = []struct {
 
 func TestSubscribe(t *testing.T) {
 	b := &fakeConnection{&bytes.Buffer{}}
-	f := &Feed{b, json.NewEncoder(b), json.NewDecoder(b)}
+	f := &Feed{conn: b, encoder: json.NewEncoder(b), decoder: json.NewDecoder(b)}
 	feed := &PublicFeed{f}
 
 	for _, tt := range subscribeTests {
@@ -389,7 +425,7 @@ var unsubscribeTests = []struct {
 
 func TestUnsubscribe(t *testing.T) {
 	b := &fakeConnection{&bytes.Buffer{}}
-	f := &Feed{b, json.NewEncoder(b), json.NewDecoder(b)}
+	f := &Feed{conn: b, encoder: json.NewEncoder(b), decoder: json.NewDecoder(b)}
 	feed := &PublicFeed{f}
 
 	for _, tt := range unsubscribeTests {
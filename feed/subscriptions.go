@@ -0,0 +1,72 @@
+package feed
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/denro/nordnet/util/models"
+)
+
+// Types of the subscriptions to the updates of a tradable on the public feed
+var TradableSubscriptionTypes = []string{"price", "depth", "trade", "trading_status"}
+
+// Returns the arguments subscribing to the updates of the given type, price, depth, trade or trading_status,
+// of the tradables in a comma separated list of keys like "11:101,11:1869".
+func ParseTradableSubscriptions(t, tradables string) (res []interface{}, err error) {
+	for _, tradable := range SplitList(tradables) {
+		id, err := models.TradableKey(tradable).TradableId()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t {
+		case "price":
+			res = append(res, &PriceArgs{T: t, I: id.Identifier, M: id.MarketId})
+		case "depth":
+			res = append(res, &DepthArgs{T: t, I: id.Identifier, M: id.MarketId})
+		case "trade":
+			res = append(res, &TradeArgs{T: t, I: id.Identifier, M: id.MarketId})
+		case "trading_status":
+			res = append(res, &TradingStatusArgs{T: t, I: id.Identifier, M: id.MarketId})
+		default:
+			return nil, fmt.Errorf("unknown subscription type %q", t)
+		}
+	}
+	return
+}
+
+// Returns the arguments subscribing to the news sources in a comma separated list of ids.
+func ParseNewsSubscriptions(sources string) (res []interface{}, err error) {
+	for _, source := range SplitList(sources) {
+		id, err := strconv.ParseInt(source, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid news source %q", source)
+		}
+		res = append(res, &NewsArgs{T: "news", S: id})
+	}
+	return
+}
+
+// Returns the arguments subscribing to the indicators in a comma separated list of keys of source and
+// identifier, like "SIX:OMXS30".
+func ParseIndicatorSubscriptions(indicators string) (res []interface{}, err error) {
+	for _, indicator := range SplitList(indicators) {
+		k, err := models.ParseTradableKey(indicator)
+		if err != nil {
+			return nil, fmt.Errorf("invalid indicator %q, expected src:identifier", indicator)
+		}
+		res = append(res, &IndicatorArgs{T: "indicator", I: k.Identifier(), M: k.Market()})
+	}
+	return
+}
+
+// Splits a comma separated list, trimming the items and leaving out the empty ones
+func SplitList(s string) (res []string) {
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			res = append(res, part)
+		}
+	}
+	return
+}
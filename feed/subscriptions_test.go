@@ -0,0 +1,34 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSubscriptions(t *testing.T) {
+	assert := assert.New(t)
+
+	args, err := ParseTradableSubscriptions("depth", " 11:101, ,11:1869")
+	assert.NoError(err)
+	assert.Equal([]interface{}{&DepthArgs{T: "depth", I: "101", M: 11}, &DepthArgs{T: "depth", I: "1869", M: 11}}, args)
+
+	_, err = ParseTradableSubscriptions("quote", "11:101")
+	assert.EqualError(err, `unknown subscription type "quote"`)
+	_, err = ParseTradableSubscriptions("price", "101")
+	assert.Error(err)
+
+	args, err = ParseNewsSubscriptions("2,3")
+	assert.NoError(err)
+	assert.Equal([]interface{}{&NewsArgs{T: "news", S: 2}, &NewsArgs{T: "news", S: 3}}, args)
+	_, err = ParseNewsSubscriptions("dj")
+	assert.EqualError(err, `invalid news source "dj"`)
+
+	args, err = ParseIndicatorSubscriptions("SIX:OMXS30")
+	assert.NoError(err)
+	assert.Equal([]interface{}{&IndicatorArgs{T: "indicator", I: "OMXS30", M: "SIX"}}, args)
+	_, err = ParseIndicatorSubscriptions("OMXS30")
+	assert.EqualError(err, `invalid indicator "OMXS30", expected src:identifier`)
+
+	assert.Empty(SplitList(" , "))
+}
@@ -0,0 +1,39 @@
+package feed
+
+import "github.com/denro/nordnet/util/models"
+
+// Returns the key of the subscribed tradable
+func (a PriceArgs) Key() models.TradableKey { return models.NewTradableKey(a.M, a.I) }
+
+// Returns the key of the subscribed tradable
+func (a DepthArgs) Key() models.TradableKey { return models.NewTradableKey(a.M, a.I) }
+
+// Returns the key of the subscribed tradable
+func (a TradeArgs) Key() models.TradableKey { return models.NewTradableKey(a.M, a.I) }
+
+// Returns the key of the subscribed tradable
+func (a TradingStatusArgs) Key() models.TradableKey { return models.NewTradableKey(a.M, a.I) }
+
+// Returns the key of the subscribed indicator, with the source in place of the market
+func (a IndicatorArgs) Key() models.TradableKey { return models.NewIndicatorKey(a.M, a.I) }
+
+// Returns the key of the tradable
+func (p PublicPrice) Key() models.TradableKey { return models.NewTradableKey(p.M, p.I) }
+
+// Returns the key of the tradable
+func (t PublicTrade) Key() models.TradableKey { return models.NewTradableKey(t.M, t.I) }
+
+// Returns the key of the tradable
+func (d PublicDepth) Key() models.TradableKey { return models.NewTradableKey(d.M, d.I) }
+
+// Returns the key of the tradable
+func (s PublicTradingStatus) Key() models.TradableKey { return models.NewTradableKey(s.M, s.I) }
+
+// Returns the key of the indicator, with the source in place of the market
+func (i PublicIndicator) Key() models.TradableKey { return models.NewIndicatorKey(i.M, i.I) }
+
+// Returns the key of the tradable
+func (o PrivateOrder) Key() models.TradableKey { return o.Tradable.Key() }
+
+// Returns the key of the tradable
+func (t PrivateTrade) Key() models.TradableKey { return t.Tradable.Key() }
@@ -0,0 +1,550 @@
+// Package gateway serves a curated REST/JSON API and the feeds of a single NEXT session to other services.
+//
+// The Gateway logs in once, keeps the session alive and shares it between all callers, which
+// authenticate with API keys of their own instead of the NEXT credentials. Every request made with
+// the session passes a central rate Limiter, and the public and private feeds are streamed to the
+// callers as Server-Sent Events or WebSockets over one upstream connection each.
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/bridge"
+	"github.com/denro/nordnet/feed"
+	"github.com/denro/nordnet/util/models"
+)
+
+// Returned when the gateway has no session, before Start and after Close
+var NoSessionError = errors.New("No session, the gateway is not started")
+
+// An API key accepted by the gateway
+type Key struct {
+	// Name of the service using the key
+	Name string
+
+	// Allows creating, modifying and deleting orders
+	OrderEntry bool
+
+	// Accounts that may be used on the account endpoints and streamed from the private feed
+	Accounts []int64
+
+	// Allows all accounts, also streaming the private feed without an account number
+	AllAccounts bool
+}
+
+// Checks that the key allows the account, accno is 0 for all accounts
+func (k Key) allows(accno int64) error {
+	switch {
+	case k.AllAccounts:
+		return nil
+	case accno == 0:
+		return fmt.Errorf("the API key of %s requires an account number", k.Name)
+	}
+	for _, a := range k.Accounts {
+		if a == accno {
+			return nil
+		}
+	}
+	return fmt.Errorf("the API key of %s does not allow account %d", k.Name, accno)
+}
+
+// Gateway implements the http.Handler interface, serving the API with the shared session of its client.
+// Callers authenticate with an "Authorization: Bearer <key>" or an "X-API-Key: <key>" header.
+// Mount it with http.StripPrefix to serve it below a path.
+type Gateway struct {
+	Client  api.Client
+	Keys    map[string]Key
+	Limiter *Limiter
+
+	// Opens the connections to the feeds, TLS or plain TCP as given by the login response when nil
+	Connect func(models.Feed) (io.ReadWriteCloser, error)
+
+	// Interval between touching the session, a failed touch logs in again
+	TouchInterval time.Duration
+
+	// Delivers the feeds to the streams, Server-Sent Event streams use its Policy and Buffer. Its
+	// Authorize checks private subscriptions against the Accounts of the keys.
+	Bridge *bridge.Bridge
+
+	// Called with the errors of logging in again and reconnecting the feeds in the background
+	OnError func(error)
+
+	session *models.Login
+	public  *feed.PublicFeed
+	private *feed.PrivateFeed
+	quit    chan struct{}
+	mu      sync.Mutex
+
+	// Serializes logging in, connecting and closing, which talk to the network and must not hold mu
+	lifecycle sync.Mutex
+}
+
+// Constructor function allowing ten requests per second, touching the session every minute and
+// closing streams falling more than 256 messages behind.
+func New(client api.Client, keys map[string]Key) *Gateway {
+	b := bridge.New(nil)
+	b.Policy = bridge.Disconnect
+	g := &Gateway{
+		Client:        client,
+		Keys:          keys,
+		Limiter:       NewLimiter(10, time.Second),
+		TouchInterval: time.Minute,
+		Bridge:        b,
+	}
+	b.Authorize = g.authorize
+	return g
+}
+
+// Logs in, connects the feeds and starts keeping the session alive. Nothing is left running when
+// an error is returned.
+func (g *Gateway) Start() error {
+	g.lifecycle.Lock()
+	defer g.lifecycle.Unlock()
+
+	if g.started() {
+		return nil
+	}
+	session, err := g.login()
+	if err != nil {
+		return err
+	}
+
+	quit := make(chan struct{})
+	g.mu.Lock()
+	g.session = session
+	g.quit = quit
+	g.mu.Unlock()
+	go g.keepAlive(quit)
+	return nil
+}
+
+// Closes the streams and the feeds and logs out.
+func (g *Gateway) Close() error {
+	g.lifecycle.Lock()
+	defer g.lifecycle.Unlock()
+
+	g.mu.Lock()
+	if g.session == nil {
+		g.mu.Unlock()
+		return nil
+	}
+	if g.quit != nil {
+		close(g.quit)
+		g.quit = nil
+	}
+	g.session = nil
+	g.mu.Unlock()
+
+	g.Bridge.Close()
+	g.closeFeeds()
+	_, err := g.Client.Logout()
+	return err
+}
+
+// Logs in and connects the feeds, logging out again when the feeds fail to connect. The lifecycle
+// lock must be held.
+func (g *Gateway) login() (*models.Login, error) {
+	if err := g.Limiter.Wait(context.Background()); err != nil {
+		return nil, err
+	}
+	session, err := g.Client.Login()
+	if err != nil {
+		return nil, err
+	}
+	if err = g.connectFeeds(session); err != nil {
+		g.closeFeeds()
+		g.Client.Logout()
+		return nil, err
+	}
+	return session, nil
+}
+
+// Touches the session every TouchInterval, logging in again when the session is lost and
+// reconnecting the feeds when they are disconnected
+func (g *Gateway) keepAlive(quit chan struct{}) {
+	ticker := time.NewTicker(g.TouchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+
+		var status *models.LoggedInStatus
+		err := g.Limiter.Wait(context.Background())
+		if err == nil {
+			status, err = g.Client.Touch()
+		}
+
+		g.lifecycle.Lock()
+		select {
+		case <-quit:
+			g.lifecycle.Unlock()
+			return
+		default:
+		}
+		if err != nil || status == nil || !status.LoggedIn {
+			g.closeFeeds()
+			var session *models.Login
+			if session, err = g.login(); err == nil {
+				g.mu.Lock()
+				g.session = session
+				g.mu.Unlock()
+			}
+		} else {
+			g.mu.Lock()
+			session := g.session
+			g.mu.Unlock()
+			err = g.connectFeeds(session)
+		}
+		g.lifecycle.Unlock()
+
+		if err != nil && g.OnError != nil {
+			g.OnError(err)
+		}
+	}
+}
+
+// Connects the disconnected feeds with the session and subscribes to what the streams need, the
+// lifecycle lock must be held
+func (g *Gateway) connectFeeds(session *models.Login) error {
+	connect := g.Connect
+	if connect == nil {
+		connect = dial
+	}
+
+	g.mu.Lock()
+	connected := g.public != nil
+	g.mu.Unlock()
+	if !connected {
+		conn, err := connect(session.PublicFeed)
+		if err != nil {
+			return err
+		}
+		public := &feed.PublicFeed{Feed: feed.NewFeed(conn)}
+		if err = public.Login(session.SessionKey, nil); err != nil {
+			public.Close()
+			return err
+		}
+		if err = g.Bridge.Attach(public); err != nil {
+			g.Bridge.Attach(nil)
+			public.Close()
+			return err
+		}
+		g.mu.Lock()
+		g.public = public
+		g.mu.Unlock()
+
+		msgs, errs := make(chan *feed.PublicMsg), make(chan error)
+		public.Dispatch(msgs, errs)
+		go g.readPublic(public, msgs, errs)
+	}
+
+	g.mu.Lock()
+	connected = g.private != nil
+	g.mu.Unlock()
+	if !connected {
+		conn, err := connect(session.PrivateFeed)
+		if err != nil {
+			return err
+		}
+		private := &feed.PrivateFeed{Feed: feed.NewFeed(conn)}
+		if err = private.Login(session.SessionKey, nil); err != nil {
+			private.Close()
+			return err
+		}
+		g.mu.Lock()
+		g.private = private
+		g.mu.Unlock()
+
+		msgs, errs := make(chan *feed.PrivateMsg), make(chan error)
+		private.Dispatch(msgs, errs)
+		go g.readPrivate(private, msgs, errs)
+	}
+	return nil
+}
+
+// Closes the feeds
+func (g *Gateway) closeFeeds() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.public != nil {
+		g.Bridge.Attach(nil)
+		g.public.Close()
+		g.public = nil
+	}
+	if g.private != nil {
+		g.private.Close()
+		g.private = nil
+	}
+}
+
+// Opens a connection to the feed, encrypted when the login response says so
+func dial(f models.Feed) (io.ReadWriteCloser, error) {
+	address := net.JoinHostPort(f.Hostname, strconv.FormatInt(f.Port, 10))
+	if f.Encrypted {
+		return tls.Dial("tcp", address, nil)
+	}
+	return net.Dial("tcp", address)
+}
+
+// Incoming request with the parts of the path matching the route
+type request struct {
+	*http.Request
+	ids    []int64
+	arg    string
+	params *api.Params
+}
+
+// An endpoint of the gateway, in the pattern ":id" matches a number and "*" matches a comma separated list
+type route struct {
+	method, pattern string
+	orderEntry      bool
+	handle          func(c api.Client, r *request) (interface{}, error)
+}
+
+var routes = []route{
+	{"GET", "status", false, func(c api.Client, r *request) (interface{}, error) { return c.SystemStatus() }},
+	{"GET", "accounts", false, func(c api.Client, r *request) (interface{}, error) { return c.Accounts() }},
+	{"GET", "accounts/:id", false, func(c api.Client, r *request) (interface{}, error) { return c.Account(r.ids[0]) }},
+	{"GET", "accounts/:id/ledgers", false, func(c api.Client, r *request) (interface{}, error) { return c.AccountLedgers(r.ids[0]) }},
+	{"GET", "accounts/:id/positions", false, func(c api.Client, r *request) (interface{}, error) { return c.AccountPositions(r.ids[0]) }},
+	{"GET", "accounts/:id/trades", false, func(c api.Client, r *request) (interface{}, error) { return c.AccountTrades(r.ids[0], r.params) }},
+	{"GET", "accounts/:id/orders", false, func(c api.Client, r *request) (interface{}, error) { return c.AccountOrders(r.ids[0], r.params) }},
+	{"POST", "accounts/:id/orders", true, func(c api.Client, r *request) (interface{}, error) { return c.CreateOrder(r.ids[0], r.params) }},
+	{"PUT", "accounts/:id/orders/:id", true, func(c api.Client, r *request) (interface{}, error) {
+		return c.UpdateOrder(r.ids[0], r.ids[1], r.params)
+	}},
+	{"DELETE", "accounts/:id/orders/:id", true, func(c api.Client, r *request) (interface{}, error) { return c.DeleteOrder(r.ids[0], r.ids[1]) }},
+	{"PUT", "accounts/:id/orders/:id/activate", true, func(c api.Client, r *request) (interface{}, error) {
+		return c.ActivateOrder(r.ids[0], r.ids[1])
+	}},
+	{"GET", "instruments", false, func(c api.Client, r *request) (interface{}, error) { return c.SearchInstruments(r.params) }},
+	{"GET", "instruments/*", false, func(c api.Client, r *request) (interface{}, error) { return c.Instruments(r.arg) }},
+	{"GET", "markets", false, func(c api.Client, r *request) (interface{}, error) { return c.Markets() }},
+	{"GET", "markets/*", false, func(c api.Client, r *request) (interface{}, error) { return c.Market(r.arg) }},
+	{"GET", "tradables/info/*", false, func(c api.Client, r *request) (interface{}, error) { return c.TradableInfo(r.arg) }},
+	{"GET", "tradables/intraday/*", false, func(c api.Client, r *request) (interface{}, error) { return c.TradableIntraday(r.arg) }},
+	{"GET", "tradables/trades/*", false, func(c api.Client, r *request) (interface{}, error) { return c.TradableTrades(r.arg) }},
+	{"GET", "indicators", false, func(c api.Client, r *request) (interface{}, error) { return c.Indicators() }},
+	{"GET", "news", false, func(c api.Client, r *request) (interface{}, error) { return c.SearchNews(r.params) }},
+	{"GET", "news/*", false, func(c api.Client, r *request) (interface{}, error) { return c.News(r.arg) }},
+	{"GET", "news_sources", false, func(c api.Client, r *request) (interface{}, error) { return c.NewsSources() }},
+}
+
+// Gateway implements the http.Handler interface, the feeds are streamed as Server-Sent Events from
+// "stream/public" and "stream/private" and over a WebSocket from "stream/ws", see bridge.Bridge.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := g.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="nordnet"`)
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "missing or invalid API key")
+		return
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	switch path {
+	case "stream/public", "stream/private", "stream/ws":
+		if r.Method != "GET" {
+			w.Header().Set("Allow", "GET")
+			writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "method not allowed")
+			return
+		}
+		if !g.started() {
+			g.writeErr(w, NoSessionError)
+		} else if path == "stream/ws" {
+			g.Bridge.ServeHTTP(w, r)
+		} else {
+			g.serveStream(w, r, path == "stream/private")
+		}
+		return
+	}
+
+	var allowed []string
+	for _, route := range routes {
+		req, ok := match(route.pattern, path)
+		if !ok {
+			continue
+		}
+		if route.method != r.Method {
+			allowed = append(allowed, route.method)
+			continue
+		}
+		if route.orderEntry && !key.OrderEntry {
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "the API key of "+key.Name+" does not allow order entry")
+			return
+		}
+		if strings.HasPrefix(route.pattern, "accounts/:id") {
+			if err := key.allows(req.ids[0]); err != nil {
+				writeError(w, http.StatusForbidden, "FORBIDDEN", err.Error())
+				return
+			}
+		}
+
+		if err := r.ParseForm(); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		if len(r.Form) > 0 {
+			params := api.Params{}
+			for name := range r.Form {
+				params[name] = r.Form.Get(name)
+			}
+			req.params = &params
+		}
+		req.Request = r
+
+		res, err := g.call(r.Context(), func() (interface{}, error) { return route.handle(g.Client, req) })
+		if err != nil {
+			g.writeErr(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "method not allowed")
+		return
+	}
+	writeError(w, http.StatusNotFound, "NOT_FOUND", "no such endpoint")
+}
+
+// Returns the key of the request, comparing in constant time
+func (g *Gateway) authenticate(r *http.Request) (key Key, ok bool) {
+	given := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		given = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if given == "" {
+		return
+	}
+
+	for k, v := range g.Keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(given)) == 1 {
+			key, ok = v, true
+		}
+	}
+	return
+}
+
+// Checks that the key of the request may stream the orders and trades of the account
+func (g *Gateway) authorize(r *http.Request, args *bridge.PrivateArgs) error {
+	key, ok := g.authenticate(r)
+	if !ok {
+		return errors.New("missing or invalid API key")
+	}
+	return key.allows(args.Accno)
+}
+
+// Matches the path against the pattern of a route
+func match(pattern, path string) (req *request, ok bool) {
+	patternSegments, pathSegments := strings.Split(pattern, "/"), strings.Split(path, "/")
+	if len(patternSegments) != len(pathSegments) {
+		return nil, false
+	}
+
+	req = &request{}
+	for i, segment := range patternSegments {
+		switch segment {
+		case ":id":
+			id, err := strconv.ParseInt(pathSegments[i], 10, 64)
+			if err != nil {
+				return nil, false
+			}
+			req.ids = append(req.ids, id)
+		case "*":
+			if pathSegments[i] == "" {
+				return nil, false
+			}
+			req.arg = pathSegments[i]
+		default:
+			if segment != pathSegments[i] {
+				return nil, false
+			}
+		}
+	}
+	return req, true
+}
+
+// Makes a request with the shared session, waiting for the limiter
+func (g *Gateway) call(ctx context.Context, fn func() (interface{}, error)) (interface{}, error) {
+	if !g.started() {
+		return nil, NoSessionError
+	}
+
+	if err := g.Limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	res, err := fn()
+	if err == api.TooManyRequestsError {
+		g.Limiter.TooManyRequests()
+	}
+	return res, err
+}
+
+func (g *Gateway) started() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.session != nil
+}
+
+// Writes the error of a request made with the session
+func (g *Gateway) writeErr(w http.ResponseWriter, err error) {
+	var (
+		apiErr       api.APIError
+		rateLimitErr *RateLimitError
+	)
+	switch {
+	case errors.As(err, &apiErr):
+		status := apiErr.StatusCode
+		if status == 0 {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, apiErr.Code, apiErr.Message)
+	case errors.As(err, &rateLimitErr):
+		retryAfter(w, rateLimitErr.RetryAfter)
+		writeError(w, http.StatusTooManyRequests, "TOO_MANY_REQUESTS", err.Error())
+	case err == api.TooManyRequestsError:
+		retryAfter(w, g.Limiter.Backoff)
+		writeError(w, http.StatusTooManyRequests, "TOO_MANY_REQUESTS", err.Error())
+	case err == api.OrderEntryHaltedError:
+		writeError(w, http.StatusServiceUnavailable, "ORDER_ENTRY_HALTED", err.Error())
+	case err == NoSessionError:
+		writeError(w, http.StatusServiceUnavailable, "NO_SESSION", err.Error())
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, "TIMEOUT", err.Error())
+	default:
+		writeError(w, http.StatusBadGateway, "BAD_GATEWAY", err.Error())
+	}
+}
+
+func retryAfter(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
+
+// Writes an error in the same format as the errors of the API
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&api.APIError{Code: code, Message: message})
+}
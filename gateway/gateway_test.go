@@ -0,0 +1,428 @@
+package gateway
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/api/apitest"
+	. "github.com/denro/nordnet/util/models"
+)
+
+// Server side of a feed connection opened by the gateway
+type fakeFeed struct {
+	host string
+	conn net.Conn
+	cmds chan string
+}
+
+func (f *fakeFeed) send(t *testing.T, msg string) {
+	if _, err := f.conn.Write([]byte(msg + "\n")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *fakeFeed) cmd(t *testing.T) string {
+	select {
+	case cmd := <-f.cmds:
+		return cmd
+	case <-time.After(time.Second):
+		t.Fatalf("no command on the %s feed", f.host)
+		return ""
+	}
+}
+
+func setup(t *testing.T, mock *apitest.Mock) (*Gateway, chan *fakeFeed) {
+	mock.LoginFunc = func() (*Login, error) {
+		return &Login{SessionKey: "SESSION", PublicFeed: Feed{Hostname: "public"}, PrivateFeed: Feed{Hostname: "private"}}, nil
+	}
+	if mock.TouchFunc == nil {
+		mock.TouchFunc = func() (*LoggedInStatus, error) { return &LoggedInStatus{LoggedIn: true}, nil }
+	}
+
+	g := New(mock, map[string]Key{
+		"reader-key":  {Name: "reader", Accounts: []int64{1}},
+		"trader-key":  {Name: "trader", OrderEntry: true, AllAccounts: true},
+		"limited-key": {Name: "limited", OrderEntry: true, Accounts: []int64{1}},
+	})
+
+	feeds := make(chan *fakeFeed, 10)
+	g.Connect = func(f Feed) (io.ReadWriteCloser, error) {
+		client, server := net.Pipe()
+		ff := &fakeFeed{host: f.Hostname, conn: server, cmds: make(chan string, 100)}
+		go func() {
+			scanner := bufio.NewScanner(server)
+			for scanner.Scan() {
+				ff.cmds <- scanner.Text()
+			}
+		}()
+		feeds <- ff
+		return client, nil
+	}
+	return g, feeds
+}
+
+func do(t *testing.T, ts *httptest.Server, method, path, key string, form url.Values) (*http.Response, string) {
+	req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp, strings.TrimSpace(string(body))
+}
+
+func TestAuthentication(t *testing.T) {
+	g, _ := setup(t, &apitest.Mock{AccountsFunc: func() ([]Account, error) { return []Account{{Accno: 1}}, nil }})
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	ts := httptest.NewServer(g)
+	defer ts.Close()
+
+	assert := assert.New(t)
+
+	resp, body := do(t, ts, "GET", "/accounts", "", nil)
+	assert.Equal(401, resp.StatusCode)
+	assert.Equal(`Bearer realm="nordnet"`, resp.Header.Get("WWW-Authenticate"))
+	assert.Equal(`{"code":"UNAUTHORIZED","message":"missing or invalid API key"}`, body)
+
+	resp, _ = do(t, ts, "GET", "/accounts", "wrong-key", nil)
+	assert.Equal(401, resp.StatusCode)
+
+	resp, body = do(t, ts, "GET", "/accounts", "reader-key", nil)
+	assert.Equal(200, resp.StatusCode)
+	assert.Equal("application/json", resp.Header.Get("Content-Type"))
+	assert.Contains(body, `"accno":1`)
+
+	req, _ := http.NewRequest("GET", ts.URL+"/accounts", nil)
+	req.Header.Set("X-API-Key", "trader-key")
+	if resp, err := http.DefaultClient.Do(req); assert.NoError(err) {
+		resp.Body.Close()
+		assert.Equal(200, resp.StatusCode)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	mock := &apitest.Mock{
+		AccountOrdersFunc: func(accno int64, params *api.Params) ([]Order, error) {
+			return []Order{{Accno: accno, OrderId: 5}}, nil
+		},
+		CreateOrderFunc: func(accno int64, params *api.Params) (*OrderReply, error) {
+			return &OrderReply{OrderId: 6, ResultCode: "OK"}, nil
+		},
+		DeleteOrderFunc: func(accno, orderId int64) (*OrderReply, error) {
+			return nil, api.OrderEntryHaltedError
+		},
+		InstrumentsFunc: func(ids string) ([]Instrument, error) {
+			return nil, api.APIError{Code: "NEXT_INVALID_INSTRUMENT", Message: "invalid instrument"}
+		},
+		MarketFunc: func(ids string) ([]Market, error) {
+			return nil, api.APIError{Code: "NEXT_NOT_FOUND", Message: "not found", StatusCode: 404}
+		},
+	}
+	g, _ := setup(t, mock)
+	ts := httptest.NewServer(g)
+	defer ts.Close()
+
+	assert := assert.New(t)
+
+	resp, body := do(t, ts, "GET", "/accounts", "reader-key", nil)
+	assert.Equal(503, resp.StatusCode)
+	assert.Equal(`{"code":"NO_SESSION","message":"No session, the gateway is not started"}`, body)
+
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	resp, body = do(t, ts, "GET", "/accounts/1/orders?deleted=true", "reader-key", nil)
+	assert.Equal(200, resp.StatusCode)
+	assert.Contains(body, `"order_id":5`)
+	if calls := mock.CallsTo("AccountOrders"); assert.Len(calls, 1) {
+		assert.Equal([]interface{}{int64(1), &api.Params{"deleted": "true"}}, calls[0].Args)
+	}
+
+	form := url.Values{"identifier": {"101"}, "market_id": {"11"}, "price": {"100"}, "volume": {"10"}, "side": {"BUY"}}
+	resp, body = do(t, ts, "POST", "/accounts/1/orders", "reader-key", form)
+	assert.Equal(403, resp.StatusCode)
+	assert.Equal(`{"code":"FORBIDDEN","message":"the API key of reader does not allow order entry"}`, body)
+	assert.Empty(mock.CallsTo("CreateOrder"))
+
+	resp, body = do(t, ts, "POST", "/accounts/1/orders", "trader-key", form)
+	assert.Equal(200, resp.StatusCode)
+	assert.Contains(body, `"order_id":6`)
+	if calls := mock.CallsTo("CreateOrder"); assert.Len(calls, 1) {
+		assert.Equal([]interface{}{int64(1), &api.Params{"identifier": "101", "market_id": "11", "price": "100", "volume": "10", "side": "BUY"}}, calls[0].Args)
+	}
+
+	resp, body = do(t, ts, "DELETE", "/accounts/1/orders/6", "trader-key", nil)
+	assert.Equal(503, resp.StatusCode)
+	assert.Contains(body, `"code":"ORDER_ENTRY_HALTED"`)
+	if calls := mock.CallsTo("DeleteOrder"); assert.Len(calls, 1) {
+		assert.Equal([]interface{}{int64(1), int64(6)}, calls[0].Args)
+	}
+
+	resp, body = do(t, ts, "GET", "/instruments/1,2", "reader-key", nil)
+	assert.Equal(400, resp.StatusCode)
+	assert.Equal(`{"code":"NEXT_INVALID_INSTRUMENT","message":"invalid instrument"}`, body)
+	if calls := mock.CallsTo("Instruments"); assert.Len(calls, 1) {
+		assert.Equal([]interface{}{"1,2"}, calls[0].Args)
+	}
+
+	// the status of the API is passed through
+	resp, body = do(t, ts, "GET", "/markets/99", "reader-key", nil)
+	assert.Equal(404, resp.StatusCode)
+	assert.Equal(`{"code":"NEXT_NOT_FOUND","message":"not found"}`, body)
+
+	// keys without AllAccounts are limited to their accounts
+	resp, body = do(t, ts, "GET", "/accounts/2/orders", "reader-key", nil)
+	assert.Equal(403, resp.StatusCode)
+	assert.Equal(`{"code":"FORBIDDEN","message":"the API key of reader does not allow account 2"}`, body)
+	assert.Len(mock.CallsTo("AccountOrders"), 1)
+	for _, path := range []string{"/accounts/2", "/accounts/2/ledgers", "/accounts/2/positions", "/accounts/2/trades"} {
+		resp, _ = do(t, ts, "GET", path, "reader-key", nil)
+		assert.Equal(403, resp.StatusCode, path)
+	}
+	resp, _ = do(t, ts, "POST", "/accounts/2/orders", "limited-key", form)
+	assert.Equal(403, resp.StatusCode)
+	resp, _ = do(t, ts, "PUT", "/accounts/2/orders/6", "limited-key", url.Values{"volume": {"5"}})
+	assert.Equal(403, resp.StatusCode)
+	resp, _ = do(t, ts, "DELETE", "/accounts/2/orders/6", "limited-key", nil)
+	assert.Equal(403, resp.StatusCode)
+	resp, _ = do(t, ts, "PUT", "/accounts/2/orders/6/activate", "limited-key", nil)
+	assert.Equal(403, resp.StatusCode)
+	assert.Len(mock.CallsTo("CreateOrder"), 1)
+	assert.Len(mock.CallsTo("DeleteOrder"), 1)
+	assert.Empty(mock.CallsTo("UpdateOrder"))
+	assert.Empty(mock.CallsTo("ActivateOrder"))
+
+	resp, _ = do(t, ts, "POST", "/accounts/1/orders", "limited-key", form)
+	assert.Equal(200, resp.StatusCode)
+
+	resp, _ = do(t, ts, "GET", "/accounts/abc", "reader-key", nil)
+	assert.Equal(404, resp.StatusCode)
+
+	resp, _ = do(t, ts, "PATCH", "/accounts/1/orders", "trader-key", nil)
+	assert.Equal(405, resp.StatusCode)
+	assert.Equal("GET, POST", resp.Header.Get("Allow"))
+}
+
+func TestRateLimit(t *testing.T) {
+	var accounts int32
+	g, _ := setup(t, &apitest.Mock{
+		AccountsFunc: func() ([]Account, error) {
+			if atomic.AddInt32(&accounts, 1) > 1 {
+				return nil, api.TooManyRequestsError
+			}
+			return []Account{}, nil
+		},
+	})
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	ts := httptest.NewServer(g)
+	defer ts.Close()
+
+	assert := assert.New(t)
+
+	g.Limiter = NewLimiter(1, time.Hour)
+	g.Limiter.MaxWait = 0
+
+	resp, _ := do(t, ts, "GET", "/accounts", "reader-key", nil)
+	assert.Equal(200, resp.StatusCode)
+	resp, body := do(t, ts, "GET", "/accounts", "reader-key", nil)
+	assert.Equal(429, resp.StatusCode)
+	assert.Equal("3600", resp.Header.Get("Retry-After"))
+	assert.Equal(`{"code":"TOO_MANY_REQUESTS","message":"rate limited, retry after 1h0m0s"}`, body)
+	assert.Equal(int32(1), atomic.LoadInt32(&accounts))
+
+	// the API rejecting a request holds back every request for the backoff
+	g.Limiter = NewLimiter(10, time.Second)
+	resp, _ = do(t, ts, "GET", "/accounts", "reader-key", nil)
+	assert.Equal(429, resp.StatusCode)
+	assert.Equal("10", resp.Header.Get("Retry-After"))
+	resp, _ = do(t, ts, "GET", "/accounts", "reader-key", nil)
+	assert.Equal(429, resp.StatusCode)
+	assert.Equal(int32(2), atomic.LoadInt32(&accounts))
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter(2, time.Second)
+	l.now = func() time.Time { return now }
+
+	assert := assert.New(t)
+
+	for i := 0; i < 2; i++ {
+		delay, err := l.reserve()
+		assert.NoError(err)
+		assert.Equal(time.Duration(0), delay)
+	}
+	delay, err := l.reserve()
+	assert.NoError(err)
+	assert.Equal(500*time.Millisecond, delay)
+
+	l.MaxWait = 500 * time.Millisecond
+	_, err = l.reserve()
+	assert.Equal(&RateLimitError{RetryAfter: time.Second}, err)
+
+	now = now.Add(time.Second)
+	delay, err = l.reserve()
+	assert.NoError(err)
+	assert.Equal(time.Duration(0), delay)
+
+	l.TooManyRequests()
+	_, err = l.reserve()
+	assert.Equal(&RateLimitError{RetryAfter: 10 * time.Second}, err)
+}
+
+func TestKeepAlive(t *testing.T) {
+	var touches int32
+	mock := &apitest.Mock{
+		TouchFunc: func() (*LoggedInStatus, error) {
+			return &LoggedInStatus{LoggedIn: atomic.AddInt32(&touches, 1) > 1}, nil
+		},
+	}
+	g, feeds := setup(t, mock)
+	g.TouchInterval = 10 * time.Millisecond
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	assert := assert.New(t)
+
+	public, private := <-feeds, <-feeds
+	assert.Equal(`{"cmd":"login","args":{"session_key":"SESSION"}}`, public.cmd(t))
+	assert.Equal(`{"cmd":"login","args":{"session_key":"SESSION"}}`, private.cmd(t))
+
+	// the first touch reports the session as lost, logging in again and reconnecting the feeds
+	public, private = <-feeds, <-feeds
+	assert.Equal("public", public.host)
+	assert.Equal("private", private.host)
+	assert.Len(mock.CallsTo("Login"), 2)
+
+	// a disconnected feed is connected again
+	public.conn.Close()
+	select {
+	case public = <-feeds:
+		assert.Equal("public", public.host)
+		assert.Equal(`{"cmd":"login","args":{"session_key":"SESSION"}}`, public.cmd(t))
+	case <-time.After(time.Second):
+		t.Fatal("public feed not reconnected")
+	}
+	assert.Len(mock.CallsTo("Login"), 2)
+}
+
+func TestStartFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	mock := &apitest.Mock{}
+	g, feeds := setup(t, mock)
+	connect := g.Connect
+	g.Connect = func(f Feed) (io.ReadWriteCloser, error) {
+		if f.Hostname == "private" {
+			return nil, io.ErrClosedPipe
+		}
+		return connect(f)
+	}
+
+	assert.Equal(io.ErrClosedPipe, g.Start())
+	assert.False(g.started())
+	assert.Len(mock.CallsTo("Logout"), 1)
+
+	// the public feed connected before the failure is closed
+	public := <-feeds
+	public.conn.SetReadDeadline(time.Now().Add(time.Second))
+	public.cmd(t)
+	_, err := public.conn.Read(make([]byte, 1))
+	assert.Error(err)
+
+	assert.NoError(g.Close())
+	assert.Len(mock.CallsTo("Logout"), 1)
+
+	g.Connect = connect
+	assert.NoError(g.Start())
+	assert.NoError(g.Close())
+	assert.Len(mock.CallsTo("Logout"), 2)
+}
+
+func TestKeepAliveWithoutStatus(t *testing.T) {
+	errs := make(chan error, 10)
+	mock := &apitest.Mock{
+		TouchFunc: func() (*LoggedInStatus, error) { return nil, nil },
+	}
+	g, feeds := setup(t, mock)
+	g.TouchInterval = 10 * time.Millisecond
+	g.OnError = func(err error) { errs <- err }
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	// a touch without status is taken as a lost session
+	<-feeds
+	<-feeds
+	select {
+	case f := <-feeds:
+		assert.Equal(t, "public", f.host)
+	case err := <-errs:
+		t.Fatal(err)
+	case <-time.After(time.Second):
+		t.Fatal("not logged in again")
+	}
+}
+
+func TestReconnectStopsDispatch(t *testing.T) {
+	g, feeds := setup(t, &apitest.Mock{})
+	g.TouchInterval = 10 * time.Millisecond
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	public, _ := <-feeds, <-feeds
+	reconnect := func() {
+		public.conn.Close()
+		select {
+		case public = <-feeds:
+			public.cmd(t)
+		case <-time.After(time.Second):
+			t.Fatal("public feed not reconnected")
+		}
+	}
+	reconnect()
+	time.Sleep(50 * time.Millisecond)
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 10; i++ {
+		reconnect()
+	}
+
+	// the readers and dispatchers of the closed feeds stop
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Error returned when a request would have to wait longer than the MaxWait of the limiter
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+// RateLimitError implements the error interface, the time is rounded up to whole seconds as in a Retry-After header
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %v", (e.RetryAfter + time.Second - 1).Truncate(time.Second))
+}
+
+// Limiter spaces out the requests made with the shared session, it is a token bucket
+// allowing Requests per Interval with bursts of up to Requests. It is safe for concurrent use.
+type Limiter struct {
+	Requests int
+	Interval time.Duration
+
+	// Longest time a request waits for its turn before it is rejected with a RateLimitError
+	MaxWait time.Duration
+
+	// Time all requests are held back after the API responded with Too Many Requests
+	Backoff time.Duration
+
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+	now          func() time.Time
+	mu           sync.Mutex
+}
+
+// Constructor function allowing requests per interval, waiting up to five seconds and
+// backing off for ten seconds as asked by the API.
+func NewLimiter(requests int, interval time.Duration) *Limiter {
+	return &Limiter{
+		Requests: requests,
+		Interval: interval,
+		MaxWait:  5 * time.Second,
+		Backoff:  10 * time.Second,
+		tokens:   float64(requests),
+		now:      time.Now,
+	}
+}
+
+// Waits until the request may be made, returns a RateLimitError without waiting if that would
+// take longer than MaxWait and the context error if it is done first.
+func (l *Limiter) Wait(ctx context.Context) error {
+	delay, err := l.reserve()
+	if err != nil || delay <= 0 {
+		return err
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Holds back all requests for the Backoff duration, called when the API responds with Too Many Requests.
+func (l *Limiter) TooManyRequests() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := l.now().Add(l.Backoff); until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// Takes a token and returns how long to wait before it may be used
+func (l *Limiter) reserve() (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += float64(now.Sub(l.last)) * float64(l.Requests) / float64(l.Interval)
+		if l.tokens > float64(l.Requests) {
+			l.tokens = float64(l.Requests)
+		}
+	}
+	l.last = now
+
+	var delay time.Duration
+	if l.tokens < 1 {
+		delay = time.Duration(math.Ceil((1 - l.tokens) * float64(l.Interval) / float64(l.Requests)))
+	}
+	if blocked := l.blockedUntil.Sub(now); blocked > delay {
+		delay = blocked
+	}
+	if delay > l.MaxWait {
+		return 0, &RateLimitError{RetryAfter: delay}
+	}
+
+	l.tokens--
+	return delay, nil
+}
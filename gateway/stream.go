@@ -0,0 +1,186 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/denro/nordnet/bridge"
+	"github.com/denro/nordnet/feed"
+)
+
+// Serves the public or private feed as Server-Sent Events. The public subscriptions are given
+// in the query as comma separated lists: price, depth, trade and trading_status take tradables
+// as market:identifier, news takes source ids and indicator takes src:identifier. A private
+// stream is limited to one account with accno, streaming all accounts requires a key with AllAccounts.
+func (g *Gateway) serveStream(w http.ResponseWriter, r *http.Request, private bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "STREAMING_UNSUPPORTED", "streaming is not supported")
+		return
+	}
+
+	var subscriptions []interface{}
+	if private {
+		args := &bridge.PrivateArgs{T: "private"}
+		if accno := r.URL.Query().Get("accno"); accno != "" {
+			var err error
+			if args.Accno, err = strconv.ParseInt(accno, 10, 64); err != nil {
+				writeError(w, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("invalid account number %q", accno))
+				return
+			}
+		}
+		if err := g.authorize(r, args); err != nil {
+			writeError(w, http.StatusForbidden, "FORBIDDEN", err.Error())
+			return
+		}
+		subscriptions = append(subscriptions, args)
+	} else {
+		var err error
+		if subscriptions, err = parseSubscriptions(r.URL.Query()); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		if len(subscriptions) == 0 {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "nothing to subscribe to")
+			return
+		}
+	}
+
+	c := g.Bridge.NewClient(g.Bridge.Policy)
+	defer c.Close()
+	for _, args := range subscriptions {
+		if err := c.Subscribe(args); err != nil {
+			g.writeErr(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case msg := <-c.Messages():
+			b, err := json.Marshal(msg.Data)
+			if err != nil {
+				continue
+			}
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, b); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-c.Done():
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Reads the public feed until it is disconnected and sends the messages to the streams subscribing to them,
+// closing the feed stops its Dispatch and the reader
+func (g *Gateway) readPublic(f *feed.PublicFeed, msgs chan *feed.PublicMsg, errs chan error) {
+	for {
+		select {
+		case msg := <-msgs:
+			// messages failing to decode are reported on the error channel
+			if msg.Data == nil {
+				continue
+			}
+			g.mu.Lock()
+			current := g.public == f
+			g.mu.Unlock()
+			if !current {
+				return
+			}
+			g.Bridge.Public(msg)
+		case err := <-errs:
+			if g.failed(f.Feed, err) {
+				return
+			}
+		case <-f.Done():
+			return
+		}
+	}
+}
+
+// Reads the private feed until it is disconnected and sends the messages to the private streams, closing
+// the feed stops its Dispatch and the reader
+func (g *Gateway) readPrivate(f *feed.PrivateFeed, msgs chan *feed.PrivateMsg, errs chan error) {
+	for {
+		select {
+		case msg := <-msgs:
+			if msg.Data == nil {
+				continue
+			}
+			g.mu.Lock()
+			current := g.private == f
+			g.mu.Unlock()
+			if !current {
+				return
+			}
+			g.Bridge.Private(msg)
+		case err := <-errs:
+			if g.failed(f.Feed, err) {
+				return
+			}
+		case <-f.Done():
+			return
+		}
+	}
+}
+
+// Handles a decode error of the feed, returns true when the reader should stop. Errors other than
+// type mismatches leave the decoder unusable, the feed is then closed and forgotten to be connected
+// again by the keep alive.
+func (g *Gateway) failed(f *feed.Feed, err error) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case g.public != nil && g.public.Feed == f:
+		if errors.As(err, &typeErr) {
+			return false
+		}
+		g.Bridge.Attach(nil)
+		g.public = nil
+	case g.private != nil && g.private.Feed == f:
+		if errors.As(err, &typeErr) {
+			return false
+		}
+		g.private = nil
+	default:
+		// closed by the gateway
+		return true
+	}
+	f.Close()
+	return true
+}
+
+// Parses the subscriptions of a public stream from the query
+func parseSubscriptions(query url.Values) (res []interface{}, err error) {
+	for _, t := range feed.TradableSubscriptionTypes {
+		args, err := feed.ParseTradableSubscriptions(t, query.Get(t))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, args...)
+	}
+
+	news, err := feed.ParseNewsSubscriptions(query.Get("news"))
+	if err != nil {
+		return nil, err
+	}
+	indicators, err := feed.ParseIndicatorSubscriptions(query.Get("indicator"))
+	if err != nil {
+		return nil, err
+	}
+	return append(append(res, news...), indicators...), nil
+}
@@ -0,0 +1,203 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/api/apitest"
+	"github.com/denro/nordnet/bridge"
+	"github.com/denro/nordnet/feed"
+	"github.com/denro/nordnet/util/models"
+)
+
+// Client side of a Server-Sent Events stream
+type sseClient struct {
+	resp   *http.Response
+	reader *bufio.Reader
+	cancel func()
+}
+
+func openStream(t *testing.T, ts *httptest.Server, path, key string) *sseClient {
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+path, nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("stream %s responded %d", path, resp.StatusCode)
+	}
+	return &sseClient{resp, bufio.NewReader(resp.Body), cancel}
+}
+
+// Reads the next event, the lines up to the blank line ending it
+func (c *sseClient) next(t *testing.T) string {
+	lines := make(chan string, 1)
+	go func() {
+		var event []string
+		for {
+			line, err := c.reader.ReadString('\n')
+			if err != nil || line == "\n" {
+				break
+			}
+			event = append(event, strings.TrimSuffix(line, "\n"))
+		}
+		lines <- strings.Join(event, "\n")
+	}()
+
+	select {
+	case event := <-lines:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event on the stream")
+		return ""
+	}
+}
+
+func (c *sseClient) close() {
+	c.cancel()
+	c.resp.Body.Close()
+}
+
+func TestPublicStream(t *testing.T) {
+	g, feeds := setup(t, &apitest.Mock{})
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	ts := httptest.NewServer(g)
+	defer ts.Close()
+
+	public, _ := <-feeds, <-feeds
+	public.cmd(t)
+
+	assert := assert.New(t)
+
+	first := openStream(t, ts, "/stream/public?price=11:101&news=2", "reader-key")
+	assert.Equal("text/event-stream", first.resp.Header.Get("Content-Type"))
+	assert.Equal(`{"cmd":"subscribe","args":{"t":"price","i":"101","m":11}}`, public.cmd(t))
+	assert.Equal(`{"cmd":"subscribe","args":{"t":"news","s":2}}`, public.cmd(t))
+
+	// the second stream shares the upstream price subscription
+	second := openStream(t, ts, "/stream/public?price=11:101,11:102", "reader-key")
+	assert.Equal(`{"cmd":"subscribe","args":{"t":"price","i":"102","m":11}}`, public.cmd(t))
+
+	public.send(t, `{"type": "price", "data": {"i": "101", "m": 11, "last": 99.5}}`)
+	public.send(t, `{"type": "price", "data": {"i": "102", "m": 11, "last": 10}}`)
+	public.send(t, `{"type": "news", "data": {"itemid": "1", "sourceid": "2", "headline": "Earnings"}}`)
+
+	assert.Contains(first.next(t), "event: price\ndata: {\"i\":\"101\",\"m\":11,")
+	assert.Contains(first.next(t), "event: news\ndata: {\"itemid\":\"1\"")
+	assert.Contains(second.next(t), "data: {\"i\":\"101\"")
+	assert.Contains(second.next(t), "data: {\"i\":\"102\"")
+
+	first.close()
+	assert.Equal(`{"cmd":"unsubscribe","args":{"t":"news","s":2}}`, public.cmd(t))
+	second.close()
+	unsubscribed := []string{public.cmd(t), public.cmd(t)}
+	assert.ElementsMatch([]string{
+		`{"cmd":"unsubscribe","args":{"t":"price","i":"101","m":11}}`,
+		`{"cmd":"unsubscribe","args":{"t":"price","i":"102","m":11}}`,
+	}, unsubscribed)
+
+	req, _ := http.NewRequest("GET", ts.URL+"/stream/public?price=101", nil)
+	req.Header.Set("X-API-Key", "reader-key")
+	if resp, err := http.DefaultClient.Do(req); assert.NoError(err) {
+		resp.Body.Close()
+		assert.Equal(400, resp.StatusCode)
+	}
+}
+
+func TestPrivateStream(t *testing.T) {
+	g, feeds := setup(t, &apitest.Mock{})
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(g)
+	defer ts.Close()
+
+	_, private := <-feeds, <-feeds
+	private.cmd(t)
+
+	assert := assert.New(t)
+
+	all := openStream(t, ts, "/stream/private", "trader-key")
+	defer all.close()
+	one := openStream(t, ts, "/stream/private?accno=1", "reader-key")
+	defer one.close()
+
+	// keys without AllAccounts are limited to their accounts
+	for _, path := range []string{"/stream/private", "/stream/private?accno=2"} {
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		req.Header.Set("X-API-Key", "reader-key")
+		if resp, err := http.DefaultClient.Do(req); assert.NoError(err) {
+			resp.Body.Close()
+			assert.Equal(403, resp.StatusCode, path)
+		}
+	}
+
+	private.send(t, `{"type": "order", "data": {"accno": 2, "order_id": 5}}`)
+	private.send(t, `{"type": "trade", "data": {"accno": 1, "order_id": 6}}`)
+
+	assert.Contains(all.next(t), `"order_id":5`)
+	assert.Contains(all.next(t), `"order_id":6`)
+	assert.Contains(one.next(t), "event: trade\ndata: {\"accno\":1,\"order_id\":6")
+
+	// closing the gateway ends the streams
+	assert.NoError(g.Close())
+	assert.Equal("", all.next(t))
+	assert.Equal(0, g.Bridge.Clients())
+}
+
+func TestWebSocketStream(t *testing.T) {
+	g, feeds := setup(t, &apitest.Mock{})
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	ts := httptest.NewServer(g)
+	defer ts.Close()
+
+	public, _ := <-feeds, <-feeds
+	public.cmd(t)
+
+	assert := assert.New(t)
+
+	header := http.Header{"X-Api-Key": {"reader-key"}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/stream/ws", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	assert.NoError(conn.WriteJSON(&feed.FeedCmd{Cmd: "subscribe", Args: &bridge.PrivateArgs{T: "private", Accno: 2}}))
+	var denied map[string]interface{}
+	if assert.NoError(conn.ReadJSON(&denied)) {
+		assert.Equal(map[string]interface{}{"type": "error", "data": map[string]interface{}{
+			"cmd": "subscribe", "message": "the API key of reader does not allow account 2",
+		}}, denied)
+	}
+
+	assert.NoError(conn.WriteJSON(&feed.FeedCmd{Cmd: "subscribe", Args: &feed.TradeArgs{T: "trade", I: "101", M: 11}}))
+	assert.Equal(`{"cmd":"subscribe","args":{"t":"trade","i":"101","m":11}}`, public.cmd(t))
+
+	public.send(t, `{"type": "trade", "data": {"i": "101", "m": 11, "price": 100, "volume": 5}}`)
+	var msg struct {
+		Type string
+		Data feed.PublicTrade
+	}
+	if assert.NoError(conn.ReadJSON(&msg)) {
+		assert.Equal("trade", msg.Type)
+		assert.Equal(feed.PublicTrade{I: "101", M: 11, Price: models.NewDecimal(100, 0), Volume: 5}, msg.Data)
+	}
+}
@@ -0,0 +1,300 @@
+/*
+	Package killswitch stops all trading on the accounts reachable by a client.
+
+	Triggering the switch halts order entry on the client, lists every account,
+	fetches the working orders of each account and deletes them concurrently.
+	Requests entering orders that were already sent when order entry was halted
+	can still add orders, so the orders are listed again after the deletes until
+	no new working order shows up.
+*/
+package killswitch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/denro/nordnet/api"
+	. "github.com/denro/nordnet/util/models"
+)
+
+// The number of times the orders of an account are listed before giving up on new orders showing up
+const maxListings = 5
+
+// Reported for an account when new working orders still showed up on the last listing, they are deleted
+// but more may follow
+var OrdersAppearingError = errors.New("New orders kept appearing on the account")
+
+// Outcome of deleting a single order
+type Result struct {
+	Accno    int64       `json:"accno"`
+	OrderId  int64       `json:"order_id"`
+	Attempts int         `json:"attempts"`
+	Reply    *OrderReply `json:"reply,omitempty"`
+	Err      error       `json:"-"`
+}
+
+// Result implements the Marshaler interface to include the error message
+func (r Result) MarshalJSON() ([]byte, error) {
+	type result Result // to avoid endless recursion below
+	out := struct {
+		result
+		Error string `json:"error,omitempty"`
+	}{result: result(r)}
+	if r.Err != nil {
+		out.Error = r.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// Summary of a triggered kill switch
+type Report struct {
+	StartedAt     time.Time       `json:"started_at"`
+	FinishedAt    time.Time       `json:"finished_at"`
+	Results       []Result        `json:"results"`
+	AccountErrors map[int64]error `json:"-"`
+
+	// Error listing the accounts, nothing was deleted when set
+	Err error `json:"-"`
+}
+
+// Report implements the Marshaler interface to include the error messages
+func (r Report) MarshalJSON() ([]byte, error) {
+	type report Report // to avoid endless recursion below
+	out := struct {
+		report
+		AccountErrors map[int64]string `json:"account_errors,omitempty"`
+		Error         string           `json:"error,omitempty"`
+	}{report: report(r)}
+	if r.Err != nil {
+		out.Error = r.Err.Error()
+	}
+	for accno, err := range r.AccountErrors {
+		if out.AccountErrors == nil {
+			out.AccountErrors = map[int64]string{}
+		}
+		out.AccountErrors[accno] = err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// Returns the results of the orders that could not be deleted
+func (r *Report) Failed() (res []Result) {
+	for _, result := range r.Results {
+		if result.Err != nil {
+			res = append(res, result)
+		}
+	}
+	return
+}
+
+// Reports whether every working order was deleted and every account could be read
+func (r *Report) OK() bool {
+	return r.Err == nil && len(r.AccountErrors) == 0 && len(r.Failed()) == 0
+}
+
+// The methods used by the kill switch, implemented by api.APIClient
+type Client interface {
+	Accounts() ([]Account, error)
+	AccountOrders(accountno int64, params *api.Params) ([]Order, error)
+	DeleteOrder(accountno int64, orderId int64) (*OrderReply, error)
+	HaltOrderEntry()
+}
+
+// KillSwitch cancels all working orders on every account of the client.
+type KillSwitch struct {
+	Client Client
+
+	// Number of extra attempts made for each failed delete or listing of orders
+	Retries int
+
+	// Delay between attempts, TooManyRequestsError always waits for 10 seconds
+	RetryDelay time.Duration
+
+	// Called with the report of every trigger started by a signal or an HTTP request
+	OnTrigger func(*Report)
+
+	mu sync.Mutex
+}
+
+// Constructor function with three retries one second apart.
+func New(client Client) *KillSwitch {
+	return &KillSwitch{Client: client, Retries: 3, RetryDelay: time.Second}
+}
+
+// Halts order entry on the client and deletes every working order on all accounts.
+// The returned error is only set if the accounts could not be listed, it is also the Err
+// of the report. Per-order and per-account failures are reported in the Report.
+func (k *KillSwitch) Trigger() (*Report, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.Client.HaltOrderEntry()
+
+	report := &Report{StartedAt: time.Now(), AccountErrors: map[int64]error{}}
+	defer func() { report.FinishedAt = time.Now() }()
+
+	accounts, err := k.Client.Accounts()
+	if err != nil {
+		report.Err = err
+		return report, err
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make(chan Result)
+		done    = make(chan struct{})
+	)
+
+	go func() {
+		for result := range results {
+			report.Results = append(report.Results, result)
+		}
+		close(done)
+	}()
+
+	for _, account := range accounts {
+		wg.Add(1)
+		go func(accno int64) {
+			defer wg.Done()
+			if err := k.deleteAll(accno, results); err != nil {
+				mu.Lock()
+				report.AccountErrors[accno] = err
+				mu.Unlock()
+			}
+		}(account.Accno)
+	}
+
+	wg.Wait()
+	close(results)
+	<-done
+
+	return report, nil
+}
+
+// Deletes the working orders of the account, listing them again after the deletes until no new
+// working order shows up
+func (k *KillSwitch) deleteAll(accno int64, results chan<- Result) error {
+	deleted := map[int64]bool{}
+	for listings := 1; ; listings++ {
+		var orders []Order
+		if _, err := k.retry(func() (err error) {
+			orders, err = k.Client.AccountOrders(accno, nil)
+			return
+		}); err != nil {
+			return err
+		}
+
+		var (
+			wg    sync.WaitGroup
+			found int
+		)
+		for _, order := range orders {
+			if !order.OrderState.IsWorking() || deleted[order.OrderId] {
+				continue
+			}
+			found++
+			deleted[order.OrderId] = true
+			wg.Add(1)
+			go func(orderId int64) {
+				defer wg.Done()
+				results <- k.delete(accno, orderId)
+			}(order.OrderId)
+		}
+		wg.Wait()
+
+		switch {
+		case found == 0:
+			return nil
+		case listings == maxListings:
+			return OrdersAppearingError
+		}
+	}
+}
+
+// Deletes an order, retrying failed attempts
+func (k *KillSwitch) delete(accno, orderId int64) (res Result) {
+	res = Result{Accno: accno, OrderId: orderId}
+	res.Attempts, res.Err = k.retry(func() (err error) {
+		res.Reply, err = k.Client.DeleteOrder(accno, orderId)
+		return
+	})
+	return
+}
+
+// Calls fn until it succeeds or the retries are used up, returns the number of attempts and the last error
+func (k *KillSwitch) retry(fn func() error) (attempts int, err error) {
+	for {
+		attempts++
+		if err = fn(); err == nil || attempts > k.Retries {
+			return
+		}
+
+		if err == api.TooManyRequestsError {
+			time.Sleep(10 * time.Second)
+		} else {
+			time.Sleep(k.RetryDelay)
+		}
+	}
+}
+
+// Triggers the kill switch when one of the signals is received, the returned function stops listening.
+func (k *KillSwitch) NotifyOnSignal(sig ...os.Signal) (stop func()) {
+	sigChan := make(chan os.Signal, 1)
+	quit := make(chan struct{})
+	signal.Notify(sigChan, sig...)
+
+	go func() {
+		for {
+			select {
+			case <-sigChan:
+				k.trigger()
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sigChan)
+			close(quit)
+		})
+	}
+}
+
+// KillSwitch implements the http.Handler interface, a POST triggers the switch and responds with the report.
+// It is meant to be served on a local address only.
+func (k *KillSwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, err := k.trigger()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !report.OK() {
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+func (k *KillSwitch) trigger() (*Report, error) {
+	report, err := k.Trigger()
+	if k.OnTrigger != nil {
+		k.OnTrigger(report)
+	}
+	return report, err
+}
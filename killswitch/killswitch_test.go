@@ -0,0 +1,198 @@
+package killswitch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/api"
+)
+
+var (
+	accountsJSON = `[{"accno": 1}, {"accno": 2}]`
+	orders1JSON  = `[{"accno": 1, "order_id": 10, "order_state": "ON_MARKET"}, {"accno": 1, "order_id": 11, "order_state": "DELETED"}]`
+	orders2JSON  = `[{"accno": 2, "order_id": 20, "order_state": "LOCAL"}, {"accno": 2, "order_id": 21, "order_state": "ON_MARKET"}]`
+	replyJSON    = `{"order_id": %d, "result_code": "OK", "order_state": "DELETED", "action_state": "DEL_CONF"}`
+	failJSON     = `{"code": "NEXT_INVALID_ORDER", "message": "fail"}`
+
+	// an order entered by a request sent before order entry was halted
+	lateJSON = `{"accno": 1, "order_id": 12, "order_state": "ON_MARKET"}`
+)
+
+type fakeNext struct {
+	sync.Mutex
+	deletes  map[string]int
+	listings map[string]int
+	failures map[string]int
+
+	// the listing of the orders of account 1 the late order shows up on, never when 0
+	late int
+}
+
+func (f *fakeNext) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if r.Method == "DELETE" {
+		f.deletes[r.URL.Path]++
+	} else {
+		f.listings[r.URL.Path]++
+	}
+	if f.failures[r.URL.Path] > 0 {
+		f.failures[r.URL.Path]--
+		w.WriteHeader(400)
+		w.Write([]byte(failJSON))
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/2/accounts":
+		w.Write([]byte(accountsJSON))
+	case r.Method == "GET" && r.URL.Path == "/2/accounts/1/orders":
+		if f.late > 0 && f.listings[r.URL.Path] >= f.late {
+			w.Write([]byte(orders1JSON[:len(orders1JSON)-1] + ", " + lateJSON + "]"))
+			return
+		}
+		w.Write([]byte(orders1JSON))
+	case r.Method == "GET" && r.URL.Path == "/2/accounts/2/orders":
+		w.Write([]byte(orders2JSON))
+	case r.Method == "DELETE":
+		var accno, orderId int64
+		fmt.Sscanf(r.URL.Path, "/2/accounts/%d/orders/%d", &accno, &orderId)
+		fmt.Fprintf(w, replyJSON, orderId)
+	default:
+		w.WriteHeader(404)
+		w.Write([]byte(`{"code": "NOT_FOUND", "message": "not found"}`))
+	}
+}
+
+func setup(failures map[string]int) (*KillSwitch, *fakeNext, *httptest.Server) {
+	next := &fakeNext{deletes: map[string]int{}, listings: map[string]int{}, failures: failures}
+	ts := httptest.NewServer(next)
+	client := &api.APIClient{URL: ts.URL, Service: api.NNSERVICE, Version: api.NNAPIVERSION}
+
+	k := New(client)
+	k.RetryDelay = 0
+	return k, next, ts
+}
+
+func TestTrigger(t *testing.T) {
+	k, next, ts := setup(map[string]int{"/2/accounts/2/orders/21": 2})
+	defer ts.Close()
+
+	report, err := k.Trigger()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert := assert.New(t)
+	assert.True(report.OK())
+	assert.True(k.Client.(*api.APIClient).OrderEntryHalted())
+	assert.Equal(map[string]int{
+		"/2/accounts/1/orders/10": 1,
+		"/2/accounts/2/orders/20": 1,
+		"/2/accounts/2/orders/21": 3,
+	}, next.deletes)
+
+	sort.Slice(report.Results, func(i, j int) bool { return report.Results[i].OrderId < report.Results[j].OrderId })
+	assert.Len(report.Results, 3)
+	assert.EqualValues(10, report.Results[0].Reply.OrderId)
+	assert.Equal(1, report.Results[0].Attempts)
+	assert.Equal(3, report.Results[2].Attempts)
+
+	_, err = k.Client.(*api.APIClient).CreateOrder(1, &api.Params{})
+	assert.Equal(api.OrderEntryHaltedError, err)
+}
+
+func TestTriggerFailures(t *testing.T) {
+	k, _, ts := setup(map[string]int{"/2/accounts/1/orders/10": 10})
+	defer ts.Close()
+	k.Retries = 1
+
+	report, err := k.Trigger()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert := assert.New(t)
+	assert.False(report.OK())
+	if failed := report.Failed(); assert.Len(failed, 1) {
+		assert.EqualValues(10, failed[0].OrderId)
+		assert.Equal(2, failed[0].Attempts)
+		assert.EqualError(failed[0].Err, "NEXT_INVALID_ORDER: fail")
+	}
+}
+
+func TestTriggerListsAgain(t *testing.T) {
+	// listing the orders is retried like the deletes
+	k, next, ts := setup(map[string]int{"/2/accounts/1/orders": 1})
+	defer ts.Close()
+	next.late = 3
+
+	report, err := k.Trigger()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert := assert.New(t)
+	assert.True(report.OK())
+	assert.Len(report.Results, 4)
+	assert.Equal(1, next.deletes["/2/accounts/1/orders/12"])
+	// a failure, the listing deleting order 10, the one showing the late order and one more
+	assert.Equal(4, next.listings["/2/accounts/1/orders"])
+	assert.Equal(2, next.listings["/2/accounts/2/orders"])
+}
+
+func TestTriggerAccountErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _, ts := setup(map[string]int{"/2/accounts": 1})
+	defer ts.Close()
+
+	report, err := k.Trigger()
+	assert.EqualError(err, "NEXT_INVALID_ORDER: fail")
+	assert.Equal(err, report.Err)
+	assert.False(report.OK())
+	b, _ := json.Marshal(report)
+	assert.Contains(string(b), `"error":"NEXT_INVALID_ORDER: fail"`)
+
+	k, next, ts := setup(map[string]int{"/2/accounts/2/orders": 10})
+	defer ts.Close()
+	k.Retries = 1
+
+	report, err = k.Trigger()
+	assert.NoError(err)
+	assert.False(report.OK())
+	assert.EqualError(report.AccountErrors[2], "NEXT_INVALID_ORDER: fail")
+	assert.Equal(2, next.listings["/2/accounts/2/orders"])
+	assert.Len(report.Results, 1)
+}
+
+func TestServeHTTP(t *testing.T) {
+	k, _, ts := setup(map[string]int{})
+	defer ts.Close()
+
+	var triggered *Report
+	k.OnTrigger = func(r *Report) { triggered = r }
+
+	assert := assert.New(t)
+
+	w := httptest.NewRecorder()
+	k.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusMethodNotAllowed, w.Code)
+	assert.Nil(triggered)
+
+	w = httptest.NewRecorder()
+	k.ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `"order_id":21`)
+	if assert.NotNil(triggered) {
+		assert.Len(triggered.Results, 3)
+	}
+}
@@ -0,0 +1,141 @@
+// Package logging writes structured logs about the REST client and the feeds using log/slog.
+//
+// Requests are logged at debug level when successful, at warn level when rejected by the API and at
+// error level when they fail. Logins, feed connections, reconnects and closes are logged at info level
+// and decode failures on the feeds at error level. Session keys, credentials and passwords are always
+// redacted, see NewRedactingHandler.
+package logging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+)
+
+// Logger logs the requests of instrumented clients and the events of instrumented feeds, it is safe for concurrent use.
+type Logger struct {
+	logger *slog.Logger
+
+	connections  map[string]int
+	disconnected map[string]bool
+	sync.Mutex
+}
+
+// Constructor function wrapping the handler of the given logger with a redacting handler, slog.Default is used when nil.
+func New(logger *slog.Logger) *Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Logger{
+		logger:       slog.New(NewRedactingHandler(logger.Handler())),
+		connections:  map[string]int{},
+		disconnected: map[string]bool{},
+	}
+}
+
+// Returns the redacting logger used for all records.
+func (l *Logger) Logger() *slog.Logger {
+	return l.logger
+}
+
+// Logs every request performed by the client.
+func (l *Logger) InstrumentClient(c *api.APIClient) {
+	c.AddHook(l.LogRequest)
+}
+
+// Logs the events of the feed under the given name. Instrumenting a new connection under the same
+// name is logged as a reconnect.
+func (l *Logger) InstrumentFeed(name string, f *feed.Feed) {
+	l.Lock()
+	l.connections[name]++
+	connections := l.connections[name]
+	delete(l.disconnected, name)
+	l.Unlock()
+
+	if connections > 1 {
+		l.logger.Info("nordnet feed reconnected", "feed", name, "connections", connections)
+	} else {
+		l.logger.Info("nordnet feed connected", "feed", name)
+	}
+
+	f.AddHook(func(e *feed.Event) { l.LogFeedEvent(name, e) })
+}
+
+// Logs a request, used as an api.Hook.
+func (l *Logger) LogRequest(info *api.RequestInfo) {
+	level := slog.LevelDebug
+	switch {
+	case info.APIError != nil, info.Err == api.TooManyRequestsError:
+		level = slog.LevelWarn
+	case info.Err != nil:
+		level = slog.LevelError
+	case info.Endpoint == "login" && (info.Method == "POST" || info.Method == "DELETE"):
+		level = slog.LevelInfo
+	}
+
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", info.Method),
+		slog.String("endpoint", info.Endpoint),
+		slog.Duration("duration", info.Duration),
+	}
+	if info.Request != nil {
+		attrs = append(attrs, slog.String("url", info.Request.URL.String()))
+		if id := info.Request.Header.Get(api.RequestIDHeader); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+	}
+	if info.StatusCode != 0 {
+		attrs = append(attrs, slog.Int("status", info.StatusCode))
+	}
+	if info.APIError != nil {
+		attrs = append(attrs, slog.String("code", info.APIError.Code))
+	}
+	if info.Err != nil {
+		attrs = append(attrs, slog.Any("error", info.Err))
+	}
+
+	l.logger.LogAttrs(ctx, level, "nordnet request", attrs...)
+}
+
+// Logs an event on the named feed, used as a feed.Hook.
+func (l *Logger) LogFeedEvent(name string, e *feed.Event) {
+	ctx := context.Background()
+	switch e.Kind {
+	case feed.MessageEvent:
+		if l.logger.Enabled(ctx, slog.LevelDebug) {
+			l.logger.DebugContext(ctx, "nordnet feed message", "feed", name, "type", e.Type)
+		}
+	case feed.DecodeErrorEvent:
+		if errors.Is(e.Err, io.EOF) || errors.Is(e.Err, io.ErrUnexpectedEOF) {
+			// the decoder keeps returning EOF after the connection is lost, only log it once
+			l.Lock()
+			logged := l.disconnected[name]
+			l.disconnected[name] = true
+			l.Unlock()
+			if logged {
+				return
+			}
+			l.logger.WarnContext(ctx, "nordnet feed disconnected", "feed", name, "error", e.Err)
+			return
+		}
+		l.logger.ErrorContext(ctx, "nordnet feed decode failed", "feed", name, "error", e.Err)
+	case feed.LoginEvent:
+		l.logger.InfoContext(ctx, "nordnet feed login", "feed", name)
+	case feed.SubscribeEvent:
+		l.logger.DebugContext(ctx, "nordnet feed subscribe", "feed", name, "args", e.Args)
+	case feed.UnsubscribeEvent:
+		l.logger.DebugContext(ctx, "nordnet feed unsubscribe", "feed", name, "args", e.Args)
+	case feed.CloseEvent:
+		l.logger.InfoContext(ctx, "nordnet feed closed", "feed", name)
+	}
+}
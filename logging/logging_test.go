@@ -0,0 +1,167 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+)
+
+type fakeConnection struct {
+	*bytes.Buffer
+}
+
+func (c *fakeConnection) Close() error {
+	return nil
+}
+
+func newLogger(level slog.Level) (*Logger, *bytes.Buffer) {
+	b := &bytes.Buffer{}
+	return New(slog.New(slog.NewJSONHandler(b, &slog.HandlerOptions{Level: level}))), b
+}
+
+func records(t *testing.T, b *bytes.Buffer) []map[string]interface{} {
+	res := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		record := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, record)
+	}
+	return res
+}
+
+func TestLogRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2/login":
+			w.Write([]byte(`{"session_key": "SECRETSESSION"}`))
+		case "/2/accounts":
+			w.Write([]byte(`[]`))
+		case "/2/countries":
+			w.WriteHeader(429)
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`{"code": "NOT_FOUND", "message": "not found"}`))
+		}
+	}))
+	defer ts.Close()
+
+	l, b := newLogger(slog.LevelDebug)
+	client := &api.APIClient{URL: ts.URL, Service: api.NNSERVICE, Version: api.NNAPIVERSION, Credentials: "SECRETCREDENTIALS"}
+	l.InstrumentClient(client)
+
+	client.Login()
+	client.Accounts()
+	client.Countries()
+	client.Account(1)
+
+	assert := assert.New(t)
+	assert.NotContains(b.String(), "SECRETSESSION")
+	assert.NotContains(b.String(), "SECRETCREDENTIALS")
+
+	logged := records(t, b)
+	if !assert.Len(logged, 4) {
+		return
+	}
+	assert.Equal("INFO", logged[0]["level"])
+	assert.Equal("login", logged[0]["endpoint"])
+	assert.Contains(logged[0]["url"], "auth=[REDACTED]")
+	assert.Equal("DEBUG", logged[1]["level"])
+	assert.EqualValues(200, logged[1]["status"])
+	assert.Equal("WARN", logged[2]["level"])
+	assert.EqualValues(429, logged[2]["status"])
+	assert.Equal("WARN", logged[3]["level"])
+	assert.Equal("accounts/:id", logged[3]["endpoint"])
+	assert.Equal("NOT_FOUND", logged[3]["code"])
+}
+
+func TestLogRequestLevel(t *testing.T) {
+	l, b := newLogger(slog.LevelInfo)
+	l.LogRequest(&api.RequestInfo{Method: "GET", Endpoint: "accounts"})
+	assert.Empty(t, b.String())
+
+	l.LogRequest(&api.RequestInfo{Method: "GET", Endpoint: "accounts", Err: errors.New("connection refused")})
+	if logged := records(t, b); assert.Len(t, logged, 1) {
+		assert.Equal(t, "ERROR", logged[0]["level"])
+		assert.Equal(t, "connection refused", logged[0]["error"])
+	}
+}
+
+func TestLogFeedEvents(t *testing.T) {
+	l, b := newLogger(slog.LevelDebug)
+
+	conn := &fakeConnection{&bytes.Buffer{}}
+	f := &feed.PublicFeed{Feed: feed.NewFeed(conn)}
+	l.InstrumentFeed("public", f.Feed)
+	f.Login("SECRETSESSION", nil)
+	f.Subscribe(&feed.PriceArgs{T: "price", I: "101", M: 11})
+
+	conn.Reset()
+	conn.WriteString(`{"type": "heartbeat", "data": {}}` + "\n" + `{"type": "price", "data": []}` + "\n")
+	msgs, errs := make(chan *feed.PublicMsg, 10), make(chan error, 10)
+	f.Dispatch(msgs, errs)
+	for i := 0; i < 4; i++ {
+		<-msgs
+	}
+
+	f.Close()
+	l.InstrumentFeed("public", feed.NewFeed(conn))
+
+	assert := assert.New(t)
+	assert.NotContains(b.String(), "SECRETSESSION")
+
+	messages := []string{}
+	for _, record := range records(t, b) {
+		messages = append(messages, record["level"].(string)+" "+record["msg"].(string))
+	}
+	assert.Equal([]string{
+		"INFO nordnet feed connected",
+		"INFO nordnet feed login",
+		"DEBUG nordnet feed subscribe",
+		"DEBUG nordnet feed message",
+		"ERROR nordnet feed decode failed",
+		"WARN nordnet feed disconnected",
+		"INFO nordnet feed closed",
+		"INFO nordnet feed reconnected",
+	}, messages)
+}
+
+func TestRedactingHandler(t *testing.T) {
+	b := &bytes.Buffer{}
+	logger := slog.New(NewRedactingHandler(slog.NewTextHandler(b, nil))).With("session_key", "SECRET1")
+
+	logger.Info("login failed",
+		"Password", "SECRET2",
+		"url", "https://example.com/next/2/login?auth=SECRET3&service=NEXTAPI",
+		"error", errors.New(`{"credentials": "SECRET4"}`),
+		slog.Group("request", "authorization", "Basic SECRET5"),
+		"params", &api.Params{"auth": "SECRET6", "service": "NEXTAPI"},
+	)
+
+	out := b.String()
+	assert := assert.New(t)
+	for _, secret := range []string{"SECRET1", "SECRET2", "SECRET3", "SECRET4", "SECRET5", "SECRET6"} {
+		assert.NotContains(out, secret)
+	}
+	assert.Contains(out, "service=NEXTAPI")
+	assert.Contains(out, "request.authorization=[REDACTED]")
+
+	// wrapping twice does not redact twice
+	h := NewRedactingHandler(slog.NewTextHandler(io.Discard, nil))
+	assert.Equal(h, NewRedactingHandler(h))
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/denro/nordnet/api"
+)
+
+// Attribute keys whose values are always redacted, compared case insensitively
+var SecretKeys = []string{"auth", "authorization", "credentials", "password", "session_key", "sessionkey"}
+
+// Used when redacting secrets
+const redacted = "[REDACTED]"
+
+type redactingHandler struct {
+	next slog.Handler
+}
+
+// Returns a handler redacting session keys, credentials and passwords before passing records to next.
+// Attributes named by SecretKeys are replaced and all strings, errors and stringers are passed through api.Redact.
+func NewRedactingHandler(next slog.Handler) slog.Handler {
+	if h, ok := next.(*redactingHandler); ok {
+		return h
+	}
+	return &redactingHandler{next}
+}
+
+// redactingHandler implements the slog.Handler interface
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// redactingHandler implements the slog.Handler interface
+func (h *redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	redactedRecord := slog.NewRecord(r.Time, r.Level, api.Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redactedRecord.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redactedRecord)
+}
+
+// redactingHandler implements the slog.Handler interface
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redactedAttrs[i] = redactAttr(a)
+	}
+	return &redactingHandler{h.next.WithAttrs(redactedAttrs)}
+}
+
+// redactingHandler implements the slog.Handler interface
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{h.next.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	if isSecret(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, api.Redact(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		redactedGroup := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			redactedGroup[i] = redactAttr(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redactedGroup...)}
+	case slog.KindAny:
+		switch any := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, api.Redact(any.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, api.Redact(any.String()))
+		case *api.Params:
+			return slog.Any(a.Key, redactParams(*any))
+		case api.Params:
+			return slog.Any(a.Key, redactParams(any))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+func redactParams(params api.Params) api.Params {
+	res := api.Params{}
+	for key, value := range params {
+		if isSecret(key) {
+			value = redacted
+		}
+		res[key] = value
+	}
+	return res
+}
+
+func isSecret(key string) bool {
+	for _, secret := range SecretKeys {
+		if strings.EqualFold(key, secret) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestsDesc = prometheus.NewDesc(
+		"nordnet_api_requests_total", "Number of requests to the REST API.",
+		[]string{"method", "endpoint", "status"}, nil)
+	requestErrorsDesc = prometheus.NewDesc(
+		"nordnet_api_request_errors_total", "Number of requests to the REST API returning an error.",
+		[]string{"method", "endpoint"}, nil)
+	latencyDesc = prometheus.NewDesc(
+		"nordnet_api_request_duration_seconds", "Latency of requests to the REST API.",
+		[]string{"method", "endpoint"}, nil)
+	tooManyRequestsDesc = prometheus.NewDesc(
+		"nordnet_api_too_many_requests_total", "Number of requests rejected with 429 Too Many Requests.",
+		nil, nil)
+	reloginsDesc = prometheus.NewDesc(
+		"nordnet_api_relogins_total", "Number of logins while the previous session was not logged out.",
+		nil, nil)
+	feedMessagesDesc = prometheus.NewDesc(
+		"nordnet_feed_messages_total", "Number of messages received on the feed.",
+		[]string{"feed", "type"}, nil)
+	feedDecodeErrorsDesc = prometheus.NewDesc(
+		"nordnet_feed_decode_errors_total", "Number of messages on the feed that could not be decoded.",
+		[]string{"feed"}, nil)
+	feedReconnectsDesc = prometheus.NewDesc(
+		"nordnet_feed_reconnects_total", "Number of connections made after the previous connection of the feed was lost.",
+		[]string{"feed"}, nil)
+	feedSubscriptionsDesc = prometheus.NewDesc(
+		"nordnet_feed_subscriptions", "Number of active subscriptions on the feed.",
+		[]string{"feed"}, nil)
+	feedHeartbeatLagDesc = prometheus.NewDesc(
+		"nordnet_feed_heartbeat_lag_seconds", "Time since the last heartbeat on the feed.",
+		[]string{"feed"}, nil)
+)
+
+var _ prometheus.Collector = (*Metrics)(nil)
+
+// Metrics implements the prometheus.Collector interface
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		requestsDesc, requestErrorsDesc, latencyDesc, tooManyRequestsDesc, reloginsDesc,
+		feedMessagesDesc, feedDecodeErrorsDesc, feedReconnectsDesc, feedSubscriptionsDesc, feedHeartbeatLagDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Metrics implements the prometheus.Collector interface
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	s := m.Snapshot()
+
+	for _, e := range s.Endpoints {
+		for status, count := range e.Statuses {
+			ch <- prometheus.MustNewConstMetric(requestsDesc, prometheus.CounterValue, float64(count), e.Method, e.Endpoint, strconv.Itoa(status))
+		}
+		ch <- prometheus.MustNewConstMetric(requestErrorsDesc, prometheus.CounterValue, float64(e.Errors), e.Method, e.Endpoint)
+
+		buckets := map[float64]uint64{}
+		var cumulative uint64
+		for i, bound := range LatencyBuckets {
+			cumulative += uint64(e.Buckets[i])
+			buckets[bound] = cumulative
+		}
+		ch <- prometheus.MustNewConstHistogram(latencyDesc, uint64(e.Count), e.TotalLatency.Seconds(), buckets, e.Method, e.Endpoint)
+	}
+
+	ch <- prometheus.MustNewConstMetric(tooManyRequestsDesc, prometheus.CounterValue, float64(s.TooManyRequests))
+	ch <- prometheus.MustNewConstMetric(reloginsDesc, prometheus.CounterValue, float64(s.Relogins))
+
+	for _, f := range s.Feeds {
+		for typ, count := range f.Messages {
+			ch <- prometheus.MustNewConstMetric(feedMessagesDesc, prometheus.CounterValue, float64(count), f.Name, typ)
+		}
+		ch <- prometheus.MustNewConstMetric(feedDecodeErrorsDesc, prometheus.CounterValue, float64(f.DecodeErrors), f.Name)
+		ch <- prometheus.MustNewConstMetric(feedReconnectsDesc, prometheus.CounterValue, float64(f.Reconnects), f.Name)
+		ch <- prometheus.MustNewConstMetric(feedSubscriptionsDesc, prometheus.GaugeValue, float64(f.Subscriptions), f.Name)
+		if !f.LastHeartbeat.IsZero() {
+			ch <- prometheus.MustNewConstMetric(feedHeartbeatLagDesc, prometheus.GaugeValue, f.HeartbeatLag.Seconds(), f.Name)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+// Package metrics collects statistics about the REST client and the feeds.
+//
+// Statistics are available as a plain Go Snapshot and through a prometheus.Collector.
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+)
+
+// Upper bounds in seconds of the request latency buckets
+var LatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// The endpoints of the API, ":id" matches any segment. Requests to other paths are counted under OtherEndpoint,
+// so the number of endpoints stays bounded whatever the paths hold.
+var Endpoints = []string{
+	"", "accounts", "accounts/:id", "accounts/:id/ledgers", "accounts/:id/orders", "accounts/:id/orders/:id",
+	"accounts/:id/orders/:id/activate", "accounts/:id/positions", "accounts/:id/trades",
+	"countries", "countries/:id", "indicators", "indicators/:id",
+	"instruments", "instruments/:id", "instruments/:id/leverages", "instruments/:id/leverages/filters",
+	"instruments/:id/option_pairs", "instruments/:id/option_pairs/filters", "instruments/lookup/:id/:id",
+	"instruments/sectors", "instruments/sectors/:id", "instruments/types", "instruments/types/:id",
+	"instruments/underlyings/:id/:id", "lists", "lists/:id", "login", "markets", "markets/:id",
+	"news", "news/:id", "news_sources", "realtime_access", "tick_sizes", "tick_sizes/:id",
+	"tradables/info/:id", "tradables/intraday/:id", "tradables/trades/:id",
+}
+
+// The endpoint of the requests to paths not in Endpoints
+const OtherEndpoint = "other"
+
+// Statistics about the requests to one endpoint
+type EndpointStats struct {
+	Method   string
+	Endpoint string
+
+	Count    int64
+	Errors   int64
+	Statuses map[int]int64
+
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+
+	// Number of requests per latency bucket, not cumulative, the last bucket counts requests above the last bound
+	Buckets []int64
+}
+
+// Statistics about one feed
+type FeedStats struct {
+	Name string
+
+	Messages      map[string]int64
+	DecodeErrors  int64
+	Connections   int64
+	Subscriptions int64
+
+	// Number of connections made after the previous connection was lost, not closed
+	Reconnects int64
+
+	LastHeartbeat time.Time
+
+	// Time since the last heartbeat when the snapshot was taken
+	HeartbeatLag time.Duration
+}
+
+// Snapshot of all collected statistics
+type Snapshot struct {
+	Endpoints       []EndpointStats
+	TooManyRequests int64
+	Logins          int64
+	Feeds           []FeedStats
+
+	// Number of logins while the previous session was not logged out, like after it expired
+	Relogins int64
+}
+
+type endpointKey struct {
+	method, endpoint string
+}
+
+// The state of the current connection of a feed
+type connection struct {
+	closed, lost bool
+}
+
+// Metrics collects the statistics, it is safe for concurrent use.
+type Metrics struct {
+	endpoints       map[endpointKey]*EndpointStats
+	feeds           map[string]*FeedStats
+	connections     map[string]*connection
+	tooManyRequests int64
+	logins          int64
+	relogins        int64
+	loggedIn        bool
+
+	now func() time.Time
+	sync.Mutex
+}
+
+// Constructor function for empty metrics.
+func New() *Metrics {
+	return &Metrics{
+		endpoints:   map[endpointKey]*EndpointStats{},
+		feeds:       map[string]*FeedStats{},
+		connections: map[string]*connection{},
+		now:         time.Now,
+	}
+}
+
+// Collects statistics about every request performed by the client.
+func (m *Metrics) InstrumentClient(c *api.APIClient) {
+	c.AddHook(m.ObserveRequest)
+}
+
+// Collects statistics about the feed under the given name. Instrumenting a new connection under
+// the same name resets the subscription count, it counts as a reconnect when the previous connection
+// failed to read without being closed.
+func (m *Metrics) InstrumentFeed(name string, f *feed.Feed) {
+	m.Lock()
+	stats := m.feed(name)
+	stats.Connections++
+	if conn, ok := m.connections[name]; ok && conn.lost {
+		stats.Reconnects++
+	}
+	m.connections[name] = &connection{}
+	stats.Subscriptions = 0
+	m.Unlock()
+
+	f.AddHook(func(e *feed.Event) { m.ObserveFeedEvent(name, e) })
+}
+
+// Records a request, used as an api.Hook.
+func (m *Metrics) ObserveRequest(info *api.RequestInfo) {
+	m.Lock()
+	defer m.Unlock()
+
+	key := endpointKey{info.Method, endpoint(info.Path)}
+	stats, ok := m.endpoints[key]
+	if !ok {
+		stats = &EndpointStats{
+			Method:   key.method,
+			Endpoint: key.endpoint,
+			Statuses: map[int]int64{},
+			Buckets:  make([]int64, len(LatencyBuckets)+1),
+		}
+		m.endpoints[key] = stats
+	}
+
+	stats.Count++
+	if info.Err != nil {
+		stats.Errors++
+	}
+	stats.Statuses[info.StatusCode]++
+	stats.TotalLatency += info.Duration
+	if info.Duration > stats.MaxLatency {
+		stats.MaxLatency = info.Duration
+	}
+	stats.Buckets[bucket(info.Duration)]++
+
+	if info.StatusCode == 429 {
+		m.tooManyRequests++
+	}
+	if key.endpoint == "login" && info.Err == nil {
+		switch info.Method {
+		case "POST":
+			m.logins++
+			if m.loggedIn {
+				m.relogins++
+			}
+			m.loggedIn = true
+		case "DELETE":
+			m.loggedIn = false
+		}
+	}
+}
+
+// Records an event on the named feed, used as a feed.Hook.
+func (m *Metrics) ObserveFeedEvent(name string, e *feed.Event) {
+	m.Lock()
+	defer m.Unlock()
+
+	stats := m.feed(name)
+	switch e.Kind {
+	case feed.MessageEvent:
+		stats.Messages[e.Type]++
+		if e.Type == "heartbeat" {
+			stats.LastHeartbeat = e.Time
+		}
+	case feed.DecodeErrorEvent:
+		stats.DecodeErrors++
+		if conn := m.connections[name]; conn != nil && !conn.closed && connectionError(e.Err) {
+			conn.lost = true
+		}
+	case feed.CloseEvent:
+		if conn := m.connections[name]; conn != nil {
+			conn.closed = true
+		}
+	case feed.SubscribeEvent:
+		stats.Subscriptions++
+	case feed.UnsubscribeEvent:
+		if stats.Subscriptions > 0 {
+			stats.Subscriptions--
+		}
+	}
+}
+
+// Returns a copy of the collected statistics, sorted by endpoint and feed name.
+func (m *Metrics) Snapshot() *Snapshot {
+	m.Lock()
+	defer m.Unlock()
+
+	s := &Snapshot{TooManyRequests: m.tooManyRequests, Logins: m.logins, Relogins: m.relogins}
+
+	for _, stats := range m.endpoints {
+		e := *stats
+		e.Statuses = map[int]int64{}
+		for k, v := range stats.Statuses {
+			e.Statuses[k] = v
+		}
+		e.Buckets = append([]int64{}, stats.Buckets...)
+		s.Endpoints = append(s.Endpoints, e)
+	}
+	sort.Slice(s.Endpoints, func(i, j int) bool {
+		a, b := s.Endpoints[i], s.Endpoints[j]
+		return a.Endpoint < b.Endpoint || (a.Endpoint == b.Endpoint && a.Method < b.Method)
+	})
+
+	now := m.now()
+	for _, stats := range m.feeds {
+		f := *stats
+		f.Messages = map[string]int64{}
+		for k, v := range stats.Messages {
+			f.Messages[k] = v
+		}
+		if !f.LastHeartbeat.IsZero() {
+			f.HeartbeatLag = now.Sub(f.LastHeartbeat)
+		}
+		s.Feeds = append(s.Feeds, f)
+	}
+	sort.Slice(s.Feeds, func(i, j int) bool { return s.Feeds[i].Name < s.Feeds[j].Name })
+
+	return s
+}
+
+func (m *Metrics) feed(name string) *FeedStats {
+	stats, ok := m.feeds[name]
+	if !ok {
+		stats = &FeedStats{Name: name, Messages: map[string]int64{}}
+		m.feeds[name] = stats
+	}
+	return stats
+}
+
+// Returns the endpoint of a request path, OtherEndpoint when it is not one of Endpoints. Literal
+// segments take precedence over ids, "instruments/types" is not "instruments/:id".
+func endpoint(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	res, fewest := OtherEndpoint, len(segments)+1
+	for _, e := range Endpoints {
+		pattern := strings.Split(e, "/")
+		if len(pattern) != len(segments) {
+			continue
+		}
+		ids := 0
+		for i, p := range pattern {
+			if p == ":id" && segments[i] != "" {
+				ids++
+			} else if p != segments[i] {
+				ids = -1
+				break
+			}
+		}
+		if ids >= 0 && ids < fewest {
+			res, fewest = e, ids
+		}
+	}
+	return res
+}
+
+// Reports whether a read error of a feed means the connection is lost, rather than a message failing to decode
+func connectionError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+func bucket(d time.Duration) int {
+	seconds := d.Seconds()
+	for i, bound := range LatencyBuckets {
+		if seconds <= bound {
+			return i
+		}
+	}
+	return len(LatencyBuckets)
+}
@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+)
+
+type fakeConnection struct {
+	*bytes.Buffer
+}
+
+func (c *fakeConnection) Close() error {
+	return nil
+}
+
+func setupClient(m *Metrics) (*api.APIClient, *httptest.Server) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2/login":
+			w.Write([]byte(`{"session_key": "abc"}`))
+		case "/2/accounts/1":
+			w.Write([]byte(`{}`))
+		case "/2/accounts/2":
+			w.WriteHeader(429)
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`{"code": "NOT_FOUND", "message": "not found"}`))
+		}
+	}))
+	client := &api.APIClient{URL: ts.URL, Version: api.NNAPIVERSION}
+	m.InstrumentClient(client)
+	return client, ts
+}
+
+func TestRequestMetrics(t *testing.T) {
+	m := New()
+	client, ts := setupClient(m)
+	defer ts.Close()
+
+	client.Login()
+	client.Login()
+	// logging in after logging out is not a relogin
+	client.Logout()
+	client.Login()
+	client.Account(1)
+	client.Account(2)
+	client.Markets()
+
+	s := m.Snapshot()
+
+	assert := assert.New(t)
+	assert.EqualValues(1, s.TooManyRequests)
+	assert.EqualValues(3, s.Logins)
+	assert.EqualValues(1, s.Relogins)
+	if assert.Len(s.Endpoints, 4) {
+		e := s.Endpoints[0]
+		assert.Equal("GET", e.Method)
+		assert.Equal("accounts/:id", e.Endpoint)
+		assert.EqualValues(2, e.Count)
+		assert.EqualValues(1, e.Errors)
+		assert.Equal(map[int]int64{200: 1, 429: 1}, e.Statuses)
+		assert.True(e.TotalLatency > 0)
+
+		assert.Equal("login", s.Endpoints[1].Endpoint)
+		assert.Equal("DELETE", s.Endpoints[1].Method)
+		assert.Equal("login", s.Endpoints[2].Endpoint)
+		assert.Equal(map[int]int64{404: 1}, s.Endpoints[3].Statuses)
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	for path, expected := range map[string]string{
+		"":                              "",
+		"accounts/1/orders/2":           "accounts/:id/orders/:id",
+		"countries/SE,DK":               "countries/:id",
+		"instruments/types":             "instruments/types",
+		"instruments/types/ESH":         "instruments/types/:id",
+		"instruments/16101932":          "instruments/:id",
+		"instruments/lookup/isin/SE000": "instruments/lookup/:id/:id",
+		"tradables/info/11:101":         "tradables/info/:id",
+		"accounts//orders":              OtherEndpoint,
+		"instruments/1/2/3/4/5":         OtherEndpoint,
+		"unknown":                       OtherEndpoint,
+	} {
+		assert.Equal(expected, endpoint(path), path)
+	}
+}
+
+func TestFeedMetrics(t *testing.T) {
+	m := New()
+	now := time.Now()
+	m.now = func() time.Time { return now.Add(5 * time.Second) }
+
+	b := &fakeConnection{&bytes.Buffer{}}
+	f := &feed.PublicFeed{Feed: feed.NewFeed(b)}
+	m.InstrumentFeed("public", f.Feed)
+
+	f.Subscribe(&feed.PriceArgs{T: "price", I: "101", M: 11})
+	f.Subscribe(&feed.DepthArgs{T: "depth", I: "101", M: 11})
+	f.Unsubscribe(&feed.DepthArgs{T: "depth", I: "101", M: 11})
+
+	m.ObserveFeedEvent("public", &feed.Event{Kind: feed.MessageEvent, Type: "heartbeat", Time: now})
+	m.ObserveFeedEvent("public", &feed.Event{Kind: feed.MessageEvent, Type: "price", Time: now})
+	m.ObserveFeedEvent("public", &feed.Event{Kind: feed.DecodeErrorEvent, Time: now})
+
+	s := m.Snapshot()
+	assert := assert.New(t)
+	if assert.Len(s.Feeds, 1) {
+		stats := s.Feeds[0]
+		assert.Equal(map[string]int64{"heartbeat": 1, "price": 1}, stats.Messages)
+		assert.EqualValues(1, stats.DecodeErrors)
+		assert.EqualValues(1, stats.Subscriptions)
+		assert.EqualValues(0, stats.Reconnects)
+		assert.Equal(5*time.Second, stats.HeartbeatLag)
+	}
+
+	// a connection closed before failing to read is not reconnected
+	f.Close()
+	m.ObserveFeedEvent("public", &feed.Event{Kind: feed.DecodeErrorEvent, Err: io.EOF, Time: now})
+	m.InstrumentFeed("public", feed.NewFeed(b))
+	stats := m.Snapshot().Feeds[0]
+	assert.EqualValues(0, stats.Reconnects)
+	assert.EqualValues(0, stats.Subscriptions)
+
+	m.ObserveFeedEvent("public", &feed.Event{Kind: feed.DecodeErrorEvent, Err: io.ErrUnexpectedEOF, Time: now})
+	m.InstrumentFeed("public", feed.NewFeed(b))
+	stats = m.Snapshot().Feeds[0]
+	assert.EqualValues(1, stats.Reconnects)
+	assert.EqualValues(3, stats.Connections)
+}
+
+func TestCollector(t *testing.T) {
+	m := New()
+	client, ts := setupClient(m)
+	defer ts.Close()
+	client.Account(1)
+	client.Account(2)
+	m.ObserveFeedEvent("private", &feed.Event{Kind: feed.MessageEvent, Type: "order", Time: time.Now()})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(m)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			switch {
+			case metric.Counter != nil:
+				values[family.GetName()] += metric.GetCounter().GetValue()
+			case metric.Gauge != nil:
+				values[family.GetName()] += metric.GetGauge().GetValue()
+			case metric.Histogram != nil:
+				values[family.GetName()] += float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]float64{
+		"nordnet_api_requests_total":           2,
+		"nordnet_api_request_errors_total":     1,
+		"nordnet_api_request_duration_seconds": 2,
+		"nordnet_api_too_many_requests_total":  1,
+		"nordnet_api_relogins_total":           0,
+		"nordnet_feed_messages_total":          1,
+		"nordnet_feed_decode_errors_total":     0,
+		"nordnet_feed_reconnects_total":        0,
+		"nordnet_feed_subscriptions":           0,
+	}, values)
+}
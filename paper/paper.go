@@ -0,0 +1,804 @@
+// Package paper provides a simulated broker for paper trading against live market data.
+//
+// The Broker offers the same order methods as api.APIClient and fills orders against
+// the PublicPrice, PublicDepth and PublicTrade messages of the public feed. Order and
+// trade updates are sent as PrivateMsg values, just like on the private feed.
+//
+// Orders are matched against the levels of the depth messages of a tradable, or the best
+// bid and ask of its price messages until a depth message has been received. Orders are
+// valid for the day, they are deleted at the close or when the feed reports the tradable closed.
+package paper
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+)
+
+// Order types supported by the simulator
+const (
+	orderTypeNormal = "NORMAL"
+	orderTypeFAK    = "FAK"
+	orderTypeFOK    = "FOK"
+)
+
+// Errors returned by the simulator, they use the same type as the errors returned by the API
+var (
+	InvalidAccountError = api.APIError{Code: "NEXT_INVALID_ACCOUNT", Message: "The account does not exist"}
+	InvalidOrderError   = api.APIError{Code: "NEXT_INVALID_ORDER", Message: "The order does not exist or can not be changed"}
+	InvalidParamsError  = api.APIError{Code: "NEXT_INVALID_PARAMS", Message: "Missing or invalid order parameters"}
+	InsufficientFunds   = api.APIError{Code: "NEXT_INSUFFICIENT_FUNDS", Message: "Insufficient trading power"}
+	InsufficientHolding = api.APIError{Code: "NEXT_INSUFFICIENT_HOLDING", Message: "Insufficient holding to sell"}
+)
+
+var (
+	_ api.AccountReader = (*Broker)(nil)
+	_ api.OrderEntry    = (*Broker)(nil)
+)
+
+// A price level in the simulated order book, the volume is what is left of the quoted volume after the fills
+type level struct {
+	Price, Volume, Quoted float64
+}
+
+// Returns a level quoting the volume at the price
+func quote(price Decimal, volume float64) level {
+	return level{price.Float64(), volume, volume}
+}
+
+// Returns the quoted levels with the volume consumed from the earlier levels of the same price and quoted
+// volume, the volume of a level only comes back when the market changes it
+func requote(earlier, quoted []level) []level {
+	for i := range quoted {
+		for _, l := range earlier {
+			if l.Price == quoted[i].Price && l.Quoted == quoted[i].Quoted {
+				quoted[i].Volume = l.Volume
+				break
+			}
+		}
+	}
+	return quoted
+}
+
+// The last known market state of a tradable, the best bid and ask of the price messages are kept
+// apart from the levels of the depth messages
+type book struct {
+	bids, asks           []level
+	depthBids, depthAsks []level
+	last                 float64
+}
+
+// The levels an order on the given side is matched against
+func (bk *book) levels(side Side) []level {
+	if side == Sell {
+		if bk.depthBids != nil {
+			return bk.depthBids
+		}
+		return bk.bids
+	}
+	if bk.depthAsks != nil {
+		return bk.depthAsks
+	}
+	return bk.asks
+}
+
+type account struct {
+	currency  string
+	cash      float64
+	positions map[TradableId]*Position
+	orders    []*Order
+	trades    []Trade
+}
+
+// Time of day the Stockholm exchange closes
+const DefaultMarketClose = 17*time.Hour + 30*time.Minute
+
+// Broker is a simulated broker, it is safe for concurrent use.
+type Broker struct {
+	// Returns the commission for a fill, no commission is charged when nil
+	Commission func(price, volume float64) float64
+
+	// Returns the price a buy (or sell) order is filled at when it matches the given price, like the price
+	// moved against the order by the market impact. Fills are never made at a better price than matched or
+	// past the limit of the order, nothing is added when nil.
+	Slippage func(price float64, buy bool) float64
+
+	// Returns the current time, defaults to time.Now
+	Now func() time.Time
+
+	// Allow selling more than the current holding
+	AllowShort bool
+
+	// Time of day in Stockholm the market closes, DAY orders still working are deleted at the first
+	// update of the market after the close. Defaults to DefaultMarketClose.
+	MarketClose time.Duration
+
+	accounts    map[int64]*account
+	books       map[TradableId]*book
+	nextOrderId int64
+	nextTradeId int64
+	msgChan     chan *feed.PrivateMsg
+	notify      func(*feed.PrivateMsg)
+	sending     sync.Mutex
+
+	sync.Mutex
+}
+
+// Constructor function for a broker without any accounts.
+func NewBroker() *Broker {
+	return &Broker{
+		Now:         time.Now,
+		MarketClose: DefaultMarketClose,
+		accounts:    map[int64]*account{},
+		books:       map[TradableId]*book{},
+		nextOrderId: 1,
+		nextTradeId: 1,
+	}
+}
+
+// Opens a simulated account with the given cash balance.
+func (b *Broker) OpenAccount(accountno int64, currency string, cash float64) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.accounts[accountno] = &account{currency: currency, cash: cash, positions: map[TradableId]*Position{}}
+}
+
+// Order and trade updates are sent on msgChan, the channel must be drained by another goroutine than the one calling the broker.
+func (b *Broker) Dispatch(msgChan chan *feed.PrivateMsg) {
+	b.Lock()
+	b.msgChan = msgChan
+	b.Unlock()
+}
+
+// Order and trade updates are passed to fn as they happen, fn must not call the broker.
+func (b *Broker) Notify(fn func(*feed.PrivateMsg)) {
+	b.Lock()
+	b.notify = fn
+	b.Unlock()
+}
+
+// Returns a list of the simulated accounts.
+func (b *Broker) Accounts() (res []Account, err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	res = []Account{}
+	for accno := range b.accounts {
+		res = append(res, Account{Accno: accno, Type: "PAPER"})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Accno < res[j].Accno })
+	return
+}
+
+// The account summary, values are calculated from the last known prices.
+func (b *Broker) Account(accountno int64) (res *AccountInfo, err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	acc, ok := b.accounts[accountno]
+	if !ok {
+		return nil, InvalidAccountError
+	}
+
+	var marketValue float64
+	for id, pos := range acc.positions {
+		marketValue += pos.Qty * b.markPrice(id, pos.AcqPrice.Float64())
+	}
+
+	amount := func(v float64) Amount { return Amount{Value: NewDecimalFromFloat(v), Currency: acc.currency} }
+	res = &AccountInfo{
+		AccountCurrency: acc.currency,
+		AccountSum:      amount(acc.cash),
+		FullMarketvalue: amount(marketValue),
+		OwnCapital:      amount(acc.cash + marketValue),
+		TradingPower:    amount(acc.cash - b.reserved(acc)),
+	}
+	return
+}
+
+// Information about the currency ledger of the account, the simulator keeps a single ledger in the account currency.
+func (b *Broker) AccountLedgers(accountno int64) (res []LedgerInformation, err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	acc, ok := b.accounts[accountno]
+	if !ok {
+		return nil, InvalidAccountError
+	}
+
+	sum := Amount{Value: NewDecimalFromFloat(acc.cash), Currency: acc.currency}
+	res = []LedgerInformation{{
+		Total: sum,
+		Ledgers: []Ledger{{
+			Currency:      acc.currency,
+			AccountSum:    sum,
+			AccountSumAcc: sum,
+			ExchangeRate:  Amount{Value: NewDecimal(1, 0), Currency: acc.currency},
+		}},
+	}}
+	return
+}
+
+// Get all orders belonging to an account.
+func (b *Broker) AccountOrders(accountno int64, params *api.Params) (res []Order, err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	acc, ok := b.accounts[accountno]
+	if !ok {
+		return nil, InvalidAccountError
+	}
+
+	res = []Order{}
+	deleted := params != nil && (*params)["deleted"] == "true"
+	for _, o := range acc.orders {
+		if o.OrderState != OrderDeleted || deleted {
+			res = append(res, *o)
+		}
+	}
+	return
+}
+
+// Get all trades belonging to an account.
+func (b *Broker) AccountTrades(accountno int64, params *api.Params) (res []Trade, err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	acc, ok := b.accounts[accountno]
+	if !ok {
+		return nil, InvalidAccountError
+	}
+
+	res = append([]Trade{}, acc.trades...)
+	return
+}
+
+// Returns a list of all positions of the account.
+func (b *Broker) AccountPositions(accountno int64) (res []Position, err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	acc, ok := b.accounts[accountno]
+	if !ok {
+		return nil, InvalidAccountError
+	}
+
+	res = []Position{}
+	for id, pos := range acc.positions {
+		p := *pos
+		p.MarketValue = Amount{Value: NewDecimalFromFloat(p.Qty * b.markPrice(id, p.AcqPrice.Float64())), Currency: acc.currency}
+		p.MarketValueAcc = p.MarketValue
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i].Instrument.Tradables[0], res[j].Instrument.Tradables[0]
+		return a.MarketId < b.MarketId || (a.MarketId == b.MarketId && a.Identifier < b.Identifier)
+	})
+	return
+}
+
+// Enter a new order, takes the same params as api.APIClient.CreateOrder.
+// Supported order types are NORMAL, FAK and FOK, orders entered with the MANUAL activation condition stay inactive until activated.
+func (b *Broker) CreateOrder(accountno int64, params *api.Params) (res *OrderReply, err error) {
+	if params == nil {
+		return nil, InvalidParamsError
+	}
+
+	p := *params
+	price, err1 := ParseDecimal(p["price"])
+	volume, err2 := strconv.ParseFloat(p["volume"], 64)
+	marketId, err3 := strconv.ParseInt(p["market_id"], 10, 64)
+	side := Side(p["side"])
+	if err1 != nil || err2 != nil || err3 != nil || volume <= 0 || p["identifier"] == "" || !side.Known() {
+		return nil, InvalidParamsError
+	}
+
+	orderType := p["order_type"]
+	if orderType == "" {
+		orderType = orderTypeNormal
+	}
+	if orderType != orderTypeNormal && orderType != orderTypeFAK && orderType != orderTypeFOK {
+		return nil, InvalidParamsError
+	}
+
+	b.Lock()
+	acc, ok := b.accounts[accountno]
+	if !ok {
+		b.Unlock()
+		return nil, InvalidAccountError
+	}
+
+	order := &Order{
+		Accno:           accountno,
+		Price:           Amount{Value: price, Currency: acc.currency},
+		Volume:          volume,
+		OpenVolume:      volume,
+		Tradable:        TradableId{Identifier: p["identifier"], MarketId: marketId},
+		Side:            side,
+		Reference:       p["reference"],
+		PriceCondition:  "LIMIT",
+		VolumeCondition: orderType,
+		Validity:        Validity{Type: ValidDay, ValidUntil: b.closeAfter(b.Now())},
+		ActionState:     InsertConfirmed,
+		OrderState:      OrderOnMarket,
+	}
+	if ActivationType(p["activation_condition"]) == ActivationManual {
+		order.OrderState = OrderLocal
+		order.ActivationCondition = ActivationCondition{Type: ActivationManual}
+	}
+
+	if err = b.checkFunds(acc, order); err != nil {
+		b.Unlock()
+		return nil, err
+	}
+
+	order.OrderId = b.nextOrderId
+	b.nextOrderId++
+	order.Modified = b.timestamp()
+	acc.orders = append(acc.orders, order)
+
+	msgs := []*feed.PrivateMsg{orderMsg(order)}
+	if order.OrderState == OrderOnMarket {
+		msgs = append(msgs, b.enter(acc, order)...)
+	}
+	res = reply(order)
+	b.unlockAndSend(msgs)
+	return
+}
+
+// Activate an inactive order.
+func (b *Broker) ActivateOrder(accountno int64, orderId int64) (res *OrderReply, err error) {
+	b.Lock()
+	acc, order, err := b.order(accountno, orderId)
+	if err != nil || order.OrderState != OrderLocal {
+		b.Unlock()
+		return nil, InvalidOrderError
+	}
+
+	order.OrderState = OrderOnMarket
+	order.ActionState = InsertConfirmed
+	order.Modified = b.timestamp()
+
+	msgs := append([]*feed.PrivateMsg{orderMsg(order)}, b.enter(acc, order)...)
+	res = reply(order)
+	b.unlockAndSend(msgs)
+	return
+}
+
+// Modify price and or volume on an order, volume is the new total volume of the order.
+func (b *Broker) UpdateOrder(accountno int64, orderId int64, params *api.Params) (res *OrderReply, err error) {
+	if params == nil {
+		return nil, InvalidParamsError
+	}
+
+	b.Lock()
+	acc, order, err := b.order(accountno, orderId)
+	if err != nil || !order.OrderState.IsWorking() {
+		b.Unlock()
+		return nil, InvalidOrderError
+	}
+
+	updated := *order
+	if v, ok := (*params)["price"]; ok {
+		if updated.Price.Value, err = ParseDecimal(v); err != nil {
+			b.Unlock()
+			return nil, InvalidParamsError
+		}
+	}
+	if v, ok := (*params)["volume"]; ok {
+		if updated.Volume, err = strconv.ParseFloat(v, 64); err != nil || updated.Volume <= updated.TradedVolume {
+			b.Unlock()
+			return nil, InvalidParamsError
+		}
+		updated.OpenVolume = updated.Volume - updated.TradedVolume
+	}
+
+	open := order.OpenVolume
+	order.OpenVolume = 0 // the order should not count against the funds it is replacing
+	err = b.checkFunds(acc, &updated)
+	order.OpenVolume = open
+	if err != nil {
+		b.Unlock()
+		return nil, err
+	}
+
+	*order = updated
+	order.ActionState = ModifyConfirmed
+	order.Modified = b.timestamp()
+
+	msgs := []*feed.PrivateMsg{orderMsg(order)}
+	if order.OrderState == OrderOnMarket {
+		msgs = append(msgs, b.match(acc, order)...)
+	}
+	res = reply(order)
+	b.unlockAndSend(msgs)
+	return
+}
+
+// Delete an order.
+func (b *Broker) DeleteOrder(accountno int64, orderId int64) (res *OrderReply, err error) {
+	b.Lock()
+	_, order, err := b.order(accountno, orderId)
+	if err != nil || !order.OrderState.IsWorking() {
+		b.Unlock()
+		return nil, InvalidOrderError
+	}
+
+	order.OrderState = OrderDeleted
+	order.ActionState = DeleteConfirmed
+	order.Modified = b.timestamp()
+
+	msgs := []*feed.PrivateMsg{orderMsg(order)}
+	res = reply(order)
+	b.unlockAndSend(msgs)
+	return
+}
+
+// Updates the market state with a message from the public feed and fills the orders that can be matched.
+func (b *Broker) Update(msg *feed.PublicMsg) {
+	b.Lock()
+
+	msgs := b.expire(func(order *Order) bool { return !b.Now().Before(order.Validity.ValidUntil.Time()) })
+	switch data := msg.Data.(type) {
+	case feed.PublicPrice:
+		bk := b.book(TradableId{Identifier: data.I, MarketId: data.M})
+		bk.bids = requote(bk.bids, []level{quote(data.Bid, data.BidVolume)})
+		bk.asks = requote(bk.asks, []level{quote(data.Ask, data.AskVolume)})
+		if !data.Last.IsZero() {
+			bk.last = data.Last.Float64()
+		}
+		msgs = append(msgs, b.matchAll()...)
+	case feed.PublicDepth:
+		bk := b.book(TradableId{Identifier: data.I, MarketId: data.M})
+		bk.depthBids = requote(bk.depthBids, []level{
+			quote(data.Bid1, data.BidVolume1), quote(data.Bid2, data.BidVolume2), quote(data.Bid3, data.BidVolume3),
+			quote(data.Bid4, data.BidVolume4), quote(data.Bid5, data.BidVolume5),
+		})
+		bk.depthAsks = requote(bk.depthAsks, []level{
+			quote(data.Ask1, data.AskVolume1), quote(data.Ask2, data.AskVolume2), quote(data.Ask3, data.AskVolume3),
+			quote(data.Ask4, data.AskVolume4), quote(data.Ask5, data.AskVolume5),
+		})
+		msgs = append(msgs, b.matchAll()...)
+	case feed.PublicTrade:
+		id := TradableId{Identifier: data.I, MarketId: data.M}
+		b.book(id).last = data.Price.Float64()
+		msgs = append(msgs, b.tradeThrough(id, data.Price.Float64(), data.Volume)...)
+	case feed.PublicTradingStatus:
+		if data.Status == TradingClosed {
+			id := TradableId{Identifier: data.I, MarketId: data.M}
+			msgs = append(msgs, b.expire(func(order *Order) bool { return order.Tradable == id })...)
+		}
+	}
+
+	b.unlockAndSend(msgs)
+}
+
+// Reads messages from the public feed until msgChan is closed.
+func (b *Broker) Run(msgChan <-chan *feed.PublicMsg) {
+	for msg := range msgChan {
+		b.Update(msg)
+	}
+}
+
+func (b *Broker) book(id TradableId) *book {
+	bk, ok := b.books[id]
+	if !ok {
+		bk = &book{}
+		b.books[id] = bk
+	}
+	return bk
+}
+
+func (b *Broker) order(accountno, orderId int64) (*account, *Order, error) {
+	acc, ok := b.accounts[accountno]
+	if !ok {
+		return nil, nil, InvalidAccountError
+	}
+	for _, o := range acc.orders {
+		if o.OrderId == orderId {
+			return acc, o, nil
+		}
+	}
+	return acc, nil, InvalidOrderError
+}
+
+// Matches a newly entered order and deletes whatever is left of FAK and FOK orders
+func (b *Broker) enter(acc *account, order *Order) (msgs []*feed.PrivateMsg) {
+	if order.VolumeCondition == orderTypeFOK && b.available(order) < order.OpenVolume {
+		return b.kill(order)
+	}
+
+	msgs = b.match(acc, order)
+	if order.VolumeCondition != orderTypeNormal && order.OrderState == OrderOnMarket {
+		msgs = append(msgs, b.kill(order)...)
+	}
+	return
+}
+
+// Deletes the working DAY orders the function returns true for
+func (b *Broker) expire(expired func(*Order) bool) (msgs []*feed.PrivateMsg) {
+	for _, accno := range b.accountNumbers() {
+		for _, order := range b.accounts[accno].orders {
+			if order.OrderState.IsWorking() && order.Validity.Type == ValidDay && expired(order) {
+				msgs = append(msgs, b.kill(order)...)
+			}
+		}
+	}
+	return
+}
+
+// The first close of a weekday at or after t, the close is a wall clock time also on the days
+// daylight saving time begins or ends
+func (b *Broker) closeAfter(t time.Time) Timestamp {
+	t = t.In(Stockholm)
+	hour, min, sec := int(b.MarketClose/time.Hour), int(b.MarketClose%time.Hour/time.Minute), int(b.MarketClose%time.Minute/time.Second)
+	for day := 0; ; day++ {
+		at := time.Date(t.Year(), t.Month(), t.Day()+day, hour, min, sec, 0, Stockholm)
+		if !at.Before(t) && at.Weekday() != time.Saturday && at.Weekday() != time.Sunday {
+			return NewTimestamp(at)
+		}
+	}
+}
+
+func (b *Broker) kill(order *Order) []*feed.PrivateMsg {
+	order.OrderState = OrderDeleted
+	order.ActionState = DeleteConfirmed
+	order.Modified = b.timestamp()
+	return []*feed.PrivateMsg{orderMsg(order)}
+}
+
+// Matches every working order in order of entry
+func (b *Broker) matchAll() (msgs []*feed.PrivateMsg) {
+	for _, accno := range b.accountNumbers() {
+		acc := b.accounts[accno]
+		for _, order := range acc.orders {
+			if order.OrderState == OrderOnMarket {
+				msgs = append(msgs, b.match(acc, order)...)
+			}
+		}
+	}
+	return
+}
+
+// Fills the order against the opposite side of the book, consuming the volume at each level
+func (b *Broker) match(acc *account, order *Order) (msgs []*feed.PrivateMsg) {
+	bk, ok := b.books[order.Tradable]
+	if !ok {
+		return
+	}
+
+	levels := bk.levels(order.Side)
+	for i := range levels {
+		if order.OpenVolume <= 0 || !crosses(order, levels[i].Price) {
+			break
+		}
+		if levels[i].Price <= 0 || levels[i].Volume <= 0 {
+			continue
+		}
+		volume := math.Min(order.OpenVolume, levels[i].Volume)
+		levels[i].Volume -= volume
+		msgs = append(msgs, b.fill(acc, order, levels[i].Price, volume)...)
+	}
+	return
+}
+
+// Fills resting orders with a strictly better price than a public trade, at the order price
+func (b *Broker) tradeThrough(id TradableId, price, volume float64) (msgs []*feed.PrivateMsg) {
+	for _, accno := range b.accountNumbers() {
+		acc := b.accounts[accno]
+		for _, order := range acc.orders {
+			if volume <= 0 {
+				return
+			}
+			if order.OrderState != OrderOnMarket || order.Tradable != id || order.Price.Float64() == price || !crosses(order, price) {
+				continue
+			}
+			filled := math.Min(order.OpenVolume, volume)
+			volume -= filled
+			msgs = append(msgs, b.fill(acc, order, order.Price.Float64(), filled)...)
+		}
+	}
+	return
+}
+
+func (b *Broker) fill(acc *account, order *Order, price, volume float64) []*feed.PrivateMsg {
+	price = b.slip(order, price)
+	commission := 0.0
+	if b.Commission != nil {
+		commission = b.Commission(price, volume)
+	}
+
+	signed := volume
+	if order.Side == Sell {
+		signed = -volume
+	}
+	acc.cash -= signed*price + commission
+
+	pos, ok := acc.positions[order.Tradable]
+	if !ok {
+		pos = &Position{
+			Accno:      order.Accno,
+			Instrument: Instrument{Currency: acc.currency, Tradables: []Tradable{{TradableId: order.Tradable}}},
+		}
+		acc.positions[order.Tradable] = pos
+	}
+	if qty := pos.Qty + signed; qty == 0 {
+		delete(acc.positions, order.Tradable)
+	} else {
+		if signed*pos.Qty >= 0 {
+			pos.AcqPrice.Value = NewDecimalFromFloat((pos.AcqPrice.Float64()*math.Abs(pos.Qty) + price*volume) / math.Abs(qty))
+		} else if qty*pos.Qty < 0 {
+			pos.AcqPrice.Value = NewDecimalFromFloat(price)
+		}
+		pos.AcqPrice.Currency = acc.currency
+		pos.AcqPriceAcc = pos.AcqPrice
+		pos.Qty = qty
+	}
+
+	order.OpenVolume -= volume
+	order.TradedVolume += volume
+	order.Modified = b.timestamp()
+	if order.OpenVolume <= 0 {
+		order.OrderState = OrderDone
+	}
+
+	trade := Trade{
+		Accno:        order.Accno,
+		OrderId:      order.OrderId,
+		TradeId:      fmt.Sprintf("P%d", b.nextTradeId),
+		Tradable:     order.Tradable,
+		Price:        Amount{Value: NewDecimalFromFloat(price), Currency: acc.currency},
+		Volume:       volume,
+		Side:         order.Side,
+		Counterparty: "PAPER",
+		Tradetime:    order.Modified,
+	}
+	b.nextTradeId++
+	acc.trades = append(acc.trades, trade)
+
+	return []*feed.PrivateMsg{
+		{Type: "trade", Data: feed.PrivateTrade(trade)},
+		orderMsg(order),
+	}
+}
+
+// Moves the fill price against the order, but not past its limit
+func (b *Broker) slip(order *Order, price float64) float64 {
+	if b.Slippage == nil {
+		return price
+	}
+	if order.Side == Buy {
+		return math.Min(math.Max(b.Slippage(price, true), price), order.Price.Float64())
+	}
+	return math.Max(math.Min(b.Slippage(price, false), price), order.Price.Float64())
+}
+
+// The volume that could be filled immediately
+func (b *Broker) available(order *Order) (volume float64) {
+	bk, ok := b.books[order.Tradable]
+	if !ok {
+		return
+	}
+
+	for _, l := range bk.levels(order.Side) {
+		if !crosses(order, l.Price) {
+			break
+		}
+		if l.Price > 0 {
+			volume += l.Volume
+		}
+	}
+	return
+}
+
+// Makes sure buy orders are covered by cash, including the commission, and sell orders by the holding
+func (b *Broker) checkFunds(acc *account, order *Order) error {
+	if order.Side == Buy {
+		if acc.cash-b.reserved(acc) < b.cost(order) {
+			return InsufficientFunds
+		}
+		return nil
+	}
+
+	if b.AllowShort {
+		return nil
+	}
+	holding := 0.0
+	if pos, ok := acc.positions[order.Tradable]; ok {
+		holding = pos.Qty
+	}
+	for _, o := range acc.orders {
+		if o.Side == Sell && o.Tradable == order.Tradable && o.OrderState.IsWorking() {
+			holding -= o.OpenVolume
+		}
+	}
+	if holding < order.OpenVolume {
+		return InsufficientHolding
+	}
+	return nil
+}
+
+// Cash reserved by working buy orders
+func (b *Broker) reserved(acc *account) (sum float64) {
+	for _, o := range acc.orders {
+		if o.Side == Buy && o.OrderState.IsWorking() {
+			sum += b.cost(o)
+		}
+	}
+	return
+}
+
+// Cash needed to fill the open volume of a buy order at its limit, with the commission
+func (b *Broker) cost(order *Order) float64 {
+	price := order.Price.Float64()
+	cost := price * order.OpenVolume
+	if b.Commission != nil && order.OpenVolume > 0 {
+		cost += b.Commission(price, order.OpenVolume)
+	}
+	return cost
+}
+
+// Last traded price or the given fallback if nothing has traded yet
+func (b *Broker) markPrice(id TradableId, fallback float64) float64 {
+	if bk, ok := b.books[id]; ok && bk.last != 0 {
+		return bk.last
+	}
+	return fallback
+}
+
+func (b *Broker) accountNumbers() (res []int64) {
+	for accno := range b.accounts {
+		res = append(res, accno)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return
+}
+
+func (b *Broker) timestamp() Timestamp {
+	return NewTimestamp(b.Now())
+}
+
+// Releases the lock and sends the messages, updates are always sent in the order they happened
+func (b *Broker) unlockAndSend(msgs []*feed.PrivateMsg) {
+	msgChan, notify := b.msgChan, b.notify
+	b.sending.Lock()
+	defer b.sending.Unlock()
+	b.Unlock()
+
+	for _, msg := range msgs {
+		if notify != nil {
+			notify(msg)
+		}
+		if msgChan != nil {
+			msgChan <- msg
+		}
+	}
+}
+
+func crosses(order *Order, price float64) bool {
+	if order.Side == Buy {
+		return price <= order.Price.Float64()
+	}
+	return price >= order.Price.Float64()
+}
+
+func orderMsg(order *Order) *feed.PrivateMsg {
+	return &feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder(*order)}
+}
+
+func reply(order *Order) *OrderReply {
+	return &OrderReply{
+		OrderId:     order.OrderId,
+		ResultCode:  "OK",
+		OrderState:  order.OrderState,
+		ActionState: order.ActionState,
+	}
+}
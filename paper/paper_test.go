@@ -0,0 +1,307 @@
+package paper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+)
+
+var epoch = time.Unix(1000, 0)
+
+func setup() (*Broker, chan *feed.PrivateMsg) {
+	b := NewBroker()
+	b.Now = func() time.Time { return epoch }
+	b.OpenAccount(1, "SEK", 10000)
+
+	msgChan := make(chan *feed.PrivateMsg, 100)
+	b.Dispatch(msgChan)
+	return b, msgChan
+}
+
+func price(bid, bidVol, ask, askVol float64) *feed.PublicMsg {
+	return &feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "101", M: 11, Bid: NewDecimalFromFloat(bid), BidVolume: bidVol, Ask: NewDecimalFromFloat(ask), AskVolume: askVol}}
+}
+
+func drain(msgChan chan *feed.PrivateMsg) (res []*feed.PrivateMsg) {
+	for {
+		select {
+		case msg := <-msgChan:
+			res = append(res, msg)
+		default:
+			return
+		}
+	}
+}
+
+func TestCreateOrderFillsAgainstPrice(t *testing.T) {
+	b, msgChan := setup()
+	b.Update(price(99, 100, 100, 30))
+
+	assert := assert.New(t)
+
+	reply, err := b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "100", "volume": "50", "side": "BUY"})
+	if assert.NoError(err) {
+		assert.Equal(&OrderReply{OrderId: 1, ResultCode: "OK", OrderState: "ON_MARKET", ActionState: "INS_CONF"}, reply)
+	}
+
+	msgs := drain(msgChan)
+	if assert.Len(msgs, 3) {
+		assert.Equal("order", msgs[0].Type)
+		assert.Equal("trade", msgs[1].Type)
+		trade := msgs[1].Data.(feed.PrivateTrade)
+		assert.EqualValues(30, trade.Volume)
+		assert.Equal(NewDecimal(100, 0), trade.Price.Value)
+		assert.EqualValues(1000000, trade.Tradetime)
+	}
+
+	// the consumed volume is not available again until the quote changes
+	b.Update(&feed.PublicMsg{Type: "heartbeat"})
+	assert.Empty(drain(msgChan))
+	b.Update(price(99, 100, 100, 30))
+	assert.Empty(drain(msgChan))
+
+	b.Update(price(99, 100, 100, 40))
+	msgs = drain(msgChan)
+	if assert.Len(msgs, 2) {
+		order := msgs[1].Data.(feed.PrivateOrder)
+		assert.Equal(OrderDone, order.OrderState)
+		assert.EqualValues(50, order.TradedVolume)
+	}
+
+	positions, _ := b.AccountPositions(1)
+	if assert.Len(positions, 1) {
+		assert.EqualValues(50, positions[0].Qty)
+		assert.Equal(NewDecimal(100, 0), positions[0].AcqPrice.Value)
+	}
+
+	info, _ := b.Account(1)
+	assert.Equal(NewDecimal(5000, 0), info.AccountSum.Value)
+	assert.Equal(NewDecimal(5000, 0), info.TradingPower.Value)
+}
+
+func TestCreateOrderWalksDepth(t *testing.T) {
+	b, msgChan := setup()
+	b.Update(&feed.PublicMsg{Type: "depth", Data: feed.PublicDepth{I: "101", M: 11, Ask1: NewDecimal(10, 0), AskVolume1: 5, Ask2: NewDecimal(11, 0), AskVolume2: 5, Ask3: NewDecimal(12, 0), AskVolume3: 5}})
+
+	_, err := b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "11", "volume": "20", "side": "BUY", "order_type": "FAK"})
+	assert := assert.New(t)
+	assert.NoError(err)
+
+	var fills []float64
+	var last feed.PrivateOrder
+	for _, msg := range drain(msgChan) {
+		switch data := msg.Data.(type) {
+		case feed.PrivateTrade:
+			fills = append(fills, data.Price.Float64())
+		case feed.PrivateOrder:
+			last = data
+		}
+	}
+	assert.Equal([]float64{10, 11}, fills)
+	assert.Equal(OrderDeleted, last.OrderState)
+	assert.EqualValues(10, last.TradedVolume)
+}
+
+func TestFillOrKill(t *testing.T) {
+	b, _ := setup()
+	b.Update(price(99, 10, 100, 10))
+
+	reply, err := b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "100", "volume": "20", "side": "BUY", "order_type": "FOK"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, OrderDeleted, reply.OrderState)
+	}
+
+	trades, _ := b.AccountTrades(1, nil)
+	assert.Empty(t, trades)
+}
+
+func TestTradeThrough(t *testing.T) {
+	b, _ := setup()
+	b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "95", "volume": "10", "side": "BUY"})
+
+	b.Update(&feed.PublicMsg{Type: "trade", Data: feed.PublicTrade{I: "101", M: 11, Price: NewDecimal(95, 0), Volume: 100}})
+	trades, _ := b.AccountTrades(1, nil)
+	assert.Empty(t, trades)
+
+	b.Update(&feed.PublicMsg{Type: "trade", Data: feed.PublicTrade{I: "101", M: 11, Price: NewDecimal(94, 0), Volume: 4}})
+	trades, _ = b.AccountTrades(1, nil)
+	if assert.Len(t, trades, 1) {
+		assert.Equal(t, NewDecimal(95, 0), trades[0].Price.Value)
+		assert.EqualValues(t, 4, trades[0].Volume)
+	}
+}
+
+func TestInactiveOrderAndUpdate(t *testing.T) {
+	b, _ := setup()
+	b.Update(price(99, 100, 100, 100))
+
+	assert := assert.New(t)
+
+	reply, _ := b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "100", "volume": "10", "side": "BUY", "activation_condition": "MANUAL"})
+	assert.Equal(OrderLocal, reply.OrderState)
+
+	_, err := b.UpdateOrder(1, reply.OrderId, &api.Params{"volume": "1000"})
+	assert.Equal(InsufficientFunds, err)
+
+	reply, err = b.UpdateOrder(1, reply.OrderId, &api.Params{"volume": "20"})
+	if assert.NoError(err) {
+		assert.Equal(ModifyConfirmed, reply.ActionState)
+	}
+
+	reply, err = b.ActivateOrder(1, reply.OrderId)
+	if assert.NoError(err) {
+		assert.Equal(OrderDone, reply.OrderState)
+	}
+
+	_, err = b.DeleteOrder(1, reply.OrderId)
+	assert.Equal(InvalidOrderError, err)
+}
+
+func TestCreateOrderErrors(t *testing.T) {
+	b, _ := setup()
+
+	assert := assert.New(t)
+
+	_, err := b.CreateOrder(2, &api.Params{"identifier": "101", "market_id": "11", "price": "1", "volume": "1", "side": "BUY"})
+	assert.Equal(InvalidAccountError, err)
+	_, err = b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "1", "volume": "1", "side": "HOLD"})
+	assert.Equal(InvalidParamsError, err)
+	_, err = b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "1", "volume": "1", "side": "SELL"})
+	assert.Equal(InsufficientHolding, err)
+	_, err = b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "1000", "volume": "11", "side": "BUY"})
+	assert.Equal(InsufficientFunds, err)
+
+	reply, _ := b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "10", "volume": "1", "side": "BUY"})
+	reply, err = b.DeleteOrder(1, reply.OrderId)
+	if assert.NoError(err) {
+		assert.Equal(OrderDeleted, reply.OrderState)
+	}
+
+	orders, _ := b.AccountOrders(1, nil)
+	assert.Empty(orders)
+	orders, _ = b.AccountOrders(1, &api.Params{"deleted": "true"})
+	assert.Len(orders, 1)
+}
+
+func TestFundsIncludeCommission(t *testing.T) {
+	b, _ := setup()
+	b.Commission = func(price, volume float64) float64 { return 39 }
+
+	assert := assert.New(t)
+	_, err := b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "100", "volume": "100", "side": "BUY"})
+	assert.Equal(InsufficientFunds, err)
+
+	_, err = b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "100", "volume": "99", "side": "BUY"})
+	assert.NoError(err)
+	info, _ := b.Account(1)
+	assert.Equal(NewDecimal(61, 0), info.TradingPower.Value)
+}
+
+func TestDayOrdersExpire(t *testing.T) {
+	b, msgChan := setup()
+	// a friday afternoon
+	now := time.Date(2026, 10, 16, 15, 0, 0, 0, Stockholm)
+	b.Now = func() time.Time { return now }
+
+	assert := assert.New(t)
+	reply, _ := b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "90", "volume": "10", "side": "BUY"})
+	b.CreateOrder(1, &api.Params{"identifier": "202", "market_id": "11", "price": "90", "volume": "10", "side": "BUY"})
+	orders, _ := b.AccountOrders(1, nil)
+	assert.Equal(NewTimestamp(time.Date(2026, 10, 16, 17, 30, 0, 0, Stockholm)), orders[0].Validity.ValidUntil)
+
+	// the tradable closing early deletes its orders only
+	b.Update(&feed.PublicMsg{Type: "trading_status", Data: feed.PublicTradingStatus{I: "101", M: 11, Status: TradingClosed}})
+	orders, _ = b.AccountOrders(1, nil)
+	if assert.Len(orders, 1) {
+		assert.Equal("202", orders[0].Tradable.Identifier)
+	}
+
+	now = now.Add(3 * time.Hour)
+	// entered after the close, valid until the close of the next weekday
+	late, _ := b.CreateOrder(1, &api.Params{"identifier": "303", "market_id": "11", "price": "90", "volume": "10", "side": "BUY"})
+	drain(msgChan)
+	b.Update(&feed.PublicMsg{Type: "heartbeat"})
+	msgs := drain(msgChan)
+	if assert.Len(msgs, 1) {
+		assert.Equal(OrderDeleted, msgs[0].Data.(feed.PrivateOrder).OrderState)
+		assert.NotEqual(reply.OrderId, msgs[0].Data.(feed.PrivateOrder).OrderId)
+	}
+	orders, _ = b.AccountOrders(1, nil)
+	if assert.Len(orders, 1) {
+		assert.Equal(late.OrderId, orders[0].OrderId)
+		assert.Equal(NewTimestamp(time.Date(2026, 10, 19, 17, 30, 0, 0, Stockholm)), orders[0].Validity.ValidUntil)
+	}
+	info, _ := b.Account(1)
+	assert.Equal(NewDecimal(9100, 0), info.TradingPower.Value)
+}
+
+func TestPriceKeepsDepth(t *testing.T) {
+	b, msgChan := setup()
+	b.Update(&feed.PublicMsg{Type: "depth", Data: feed.PublicDepth{I: "101", M: 11, Ask1: NewDecimal(10, 0), AskVolume1: 5, Ask2: NewDecimal(11, 0), AskVolume2: 5}})
+	b.Update(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "101", M: 11, Ask: NewDecimal(10, 0), AskVolume: 5, Last: NewDecimal(10, 0)}})
+
+	_, err := b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "11", "volume": "10", "side": "BUY"})
+	assert := assert.New(t)
+	assert.NoError(err)
+
+	var fills []float64
+	for _, msg := range drain(msgChan) {
+		if trade, ok := msg.Data.(feed.PrivateTrade); ok {
+			fills = append(fills, trade.Price.Float64())
+		}
+	}
+	assert.Equal([]float64{10, 11}, fills)
+}
+
+func TestDayOrdersExpireAcrossDST(t *testing.T) {
+	b, _ := setup()
+
+	assert := assert.New(t)
+	// entered on the sundays daylight saving time begins and ends
+	for entered, at := range map[time.Time]time.Time{
+		time.Date(2026, 3, 29, 10, 0, 0, 0, Stockholm):  time.Date(2026, 3, 30, 17, 30, 0, 0, Stockholm),
+		time.Date(2026, 10, 25, 10, 0, 0, 0, Stockholm): time.Date(2026, 10, 26, 17, 30, 0, 0, Stockholm),
+	} {
+		b.Now = func() time.Time { return entered }
+		reply, err := b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "10", "volume": "1", "side": "BUY"})
+		if !assert.NoError(err) {
+			continue
+		}
+		_, order, _ := b.order(1, reply.OrderId)
+		assert.True(at.Equal(order.Validity.ValidUntil.Time()), entered)
+
+		b.Now = func() time.Time { return at.Add(-time.Minute) }
+		b.Update(&feed.PublicMsg{Type: "heartbeat"})
+		assert.Equal(OrderOnMarket, order.OrderState)
+		b.Now = func() time.Time { return at }
+		b.Update(&feed.PublicMsg{Type: "heartbeat"})
+		assert.Equal(OrderDeleted, order.OrderState)
+	}
+}
+
+func TestRepeatedDepth(t *testing.T) {
+	b, msgChan := setup()
+	depth := &feed.PublicMsg{Type: "depth", Data: feed.PublicDepth{I: "101", M: 11, Ask1: NewDecimal(10, 0), AskVolume1: 5, Ask2: NewDecimal(11, 0), AskVolume2: 5}}
+	b.Update(depth)
+
+	assert := assert.New(t)
+	_, err := b.CreateOrder(1, &api.Params{"identifier": "101", "market_id": "11", "price": "10", "volume": "20", "side": "BUY"})
+	assert.NoError(err)
+	drain(msgChan)
+
+	// re-sent levels are not filled again
+	b.Update(depth)
+	b.Update(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "101", M: 11, Ask: NewDecimal(10, 0), AskVolume: 5, Last: NewDecimal(10, 0)}})
+	assert.Empty(drain(msgChan))
+
+	b.Update(&feed.PublicMsg{Type: "depth", Data: feed.PublicDepth{I: "101", M: 11, Ask1: NewDecimal(10, 0), AskVolume1: 8}})
+	trades, _ := b.AccountTrades(1, nil)
+	if assert.Len(trades, 2) {
+		assert.EqualValues(8, trades[1].Volume)
+	}
+}
@@ -0,0 +1,190 @@
+package portfolio
+
+import (
+	"github.com/denro/nordnet/api"
+	. "github.com/denro/nordnet/util/models"
+)
+
+// Consolidator totals the cash and holdings of all accounts of a session in a base currency.
+type Consolidator struct {
+	Client api.AccountReader
+
+	// The base currency of the totals
+	Currency string
+
+	// Converts the amounts to the base currency. When nil the rates implied by the accounts are used,
+	// the exchange rates of the ledgers and the market values of the positions in the account currencies.
+	Rates RateSource
+}
+
+// The cash and holdings of an account in the base currency
+type AccountTotal struct {
+	Account  Account
+	Cash     Amount
+	Holdings Amount
+	NetWorth Amount
+}
+
+// The cash and holdings in one currency
+type CurrencyExposure struct {
+	// Amounts in the currency
+	Cash     Amount
+	Holdings Amount
+
+	// Rate to the base currency and the amounts in it
+	Rate  Decimal
+	Value Amount
+}
+
+// Consolidation of the accounts at one point in time, the totals are in the base currency
+type Consolidation struct {
+	Currency string
+	Accounts []AccountTotal
+
+	Cash     Amount
+	Holdings Amount
+	NetWorth Amount
+
+	// What is held in every currency
+	Exposure map[string]CurrencyExposure
+}
+
+// The ledgers and positions of an account
+type accountData struct {
+	account   Account
+	ledgers   []LedgerInformation
+	positions []Position
+}
+
+// Constructor function for consolidating the accounts of the client in a base currency.
+func NewConsolidator(client api.AccountReader, currency string) *Consolidator {
+	return &Consolidator{Client: client, Currency: currency}
+}
+
+// Fetches the ledgers and positions of all accounts and totals them in the base currency.
+func (c *Consolidator) Consolidate() (*Consolidation, error) {
+	accounts, err := c.Client.Accounts()
+	if err != nil {
+		return nil, err
+	}
+
+	var data []accountData
+	for _, account := range accounts {
+		ledgers, err := c.Client.AccountLedgers(account.Accno)
+		if err != nil {
+			return nil, err
+		}
+		positions, err := c.Client.AccountPositions(account.Accno)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, accountData{account, ledgers, positions})
+	}
+
+	rates := c.Rates
+	if rates == nil {
+		rates = impliedRates(data)
+	}
+
+	res := &Consolidation{Currency: c.Currency, Exposure: map[string]CurrencyExposure{}}
+	for _, total := range []*Amount{&res.Cash, &res.Holdings, &res.NetWorth} {
+		total.Currency = c.Currency
+	}
+
+	for _, d := range data {
+		total := AccountTotal{Account: d.account}
+		for _, a := range []*Amount{&total.Cash, &total.Holdings, &total.NetWorth} {
+			a.Currency = c.Currency
+		}
+
+		for _, info := range d.ledgers {
+			for _, ledger := range info.Ledgers {
+				sum := Amount{Value: ledger.AccountSum.Value, Currency: ledgerCurrency(ledger)}
+				value, err := res.add(rates, sum, true)
+				if err != nil {
+					return nil, err
+				}
+				total.Cash.Value = total.Cash.Value.Add(value)
+			}
+		}
+		for _, position := range d.positions {
+			value, err := res.add(rates, position.MarketValue, false)
+			if err != nil {
+				return nil, err
+			}
+			total.Holdings.Value = total.Holdings.Value.Add(value)
+		}
+
+		total.NetWorth.Value = total.Cash.Value.Add(total.Holdings.Value)
+		res.Accounts = append(res.Accounts, total)
+		res.Cash.Value = res.Cash.Value.Add(total.Cash.Value)
+		res.Holdings.Value = res.Holdings.Value.Add(total.Holdings.Value)
+	}
+	res.NetWorth.Value = res.Cash.Value.Add(res.Holdings.Value)
+	return res, nil
+}
+
+// Adds cash or holdings to the exposure of their currency and returns their value in the base currency
+func (c *Consolidation) add(rates RateSource, amount Amount, cash bool) (Decimal, error) {
+	if amount.Value.IsZero() {
+		return Decimal{}, nil
+	}
+
+	e, ok := c.Exposure[amount.Currency]
+	if !ok {
+		rate, err := rates.Rate(amount.Currency, c.Currency)
+		if err != nil {
+			return Decimal{}, err
+		}
+		e = CurrencyExposure{
+			Cash:     Amount{Currency: amount.Currency},
+			Holdings: Amount{Currency: amount.Currency},
+			Rate:     rate,
+			Value:    Amount{Currency: c.Currency},
+		}
+	}
+
+	if cash {
+		e.Cash.Value = e.Cash.Value.Add(amount.Value)
+	} else {
+		e.Holdings.Value = e.Holdings.Value.Add(amount.Value)
+	}
+	value := amount.Value.Mul(e.Rate)
+	e.Value.Value = e.Value.Value.Add(value)
+	c.Exposure[amount.Currency] = e
+	return value, nil
+}
+
+// Returns the rates implied by the ledgers and positions of the accounts
+func impliedRates(data []accountData) *Rates {
+	rates := NewRates()
+	for _, d := range data {
+		for _, info := range d.ledgers {
+			for _, ledger := range info.Ledgers {
+				rate := ledger.ExchangeRate.Value
+				if rate.IsZero() && !ledger.AccountSum.Value.IsZero() {
+					rate = ledger.AccountSumAcc.Value.Div(ledger.AccountSum.Value, priceDecimals)
+				}
+				to := ledger.ExchangeRate.Currency
+				if to == "" {
+					to = ledger.AccountSumAcc.Currency
+				}
+				rates.Set(ledgerCurrency(ledger), to, rate)
+			}
+		}
+		for _, position := range d.positions {
+			if !position.MarketValue.Value.IsZero() {
+				rates.Set(position.MarketValue.Currency, position.MarketValueAcc.Currency,
+					position.MarketValueAcc.Value.Div(position.MarketValue.Value, priceDecimals))
+			}
+		}
+	}
+	return rates
+}
+
+func ledgerCurrency(ledger Ledger) string {
+	if ledger.Currency == "" {
+		return ledger.AccountSum.Currency
+	}
+	return ledger.Currency
+}
@@ -0,0 +1,104 @@
+package portfolio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/api/apitest"
+	. "github.com/denro/nordnet/util/models"
+)
+
+func eur(s string) Amount { return Amount{Value: MustParseDecimal(s), Currency: "EUR"} }
+
+func ledger(sum, sumAcc, rate Amount) Ledger {
+	return Ledger{Currency: sum.Currency, AccountSum: sum, AccountSumAcc: sumAcc, ExchangeRate: rate}
+}
+
+func newConsolidationMock() *apitest.Mock {
+	ledgers := map[int64][]Ledger{
+		1: {ledger(sek("1000"), sek("1000"), sek("1")), ledger(usd("100"), sek("1000"), sek("10"))},
+		// the USD ledger links the EUR account to the others
+		2: {ledger(eur("50"), eur("50"), eur("1")), ledger(usd("10"), eur("5"), eur("0.5"))},
+	}
+	positions := map[int64][]Position{
+		1: positions[:2],
+		2: {{Accno: 2, Qty: 10, MarketValue: eur("200"), MarketValueAcc: eur("200")}},
+	}
+
+	return &apitest.Mock{
+		AccountsFunc: func() ([]Account, error) { return []Account{{Accno: 1}, {Accno: 2}}, nil },
+		AccountLedgersFunc: func(accountno int64) ([]LedgerInformation, error) {
+			return []LedgerInformation{{Ledgers: ledgers[accountno]}}, nil
+		},
+		AccountPositionsFunc: func(accountno int64) ([]Position, error) { return positions[accountno], nil },
+	}
+}
+
+func TestConsolidate(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewConsolidator(newConsolidationMock(), "SEK")
+	res, err := c.Consolidate()
+	assert.NoError(err)
+
+	if assert.Len(res.Accounts, 2) {
+		assert.Equal(AccountTotal{Account: Account{Accno: 1}, Cash: sek("2000"), Holdings: sek("25000"), NetWorth: sek("27000")}, res.Accounts[0])
+		// EUR crossed through USD at 2 USD and 20 SEK
+		assert.Equal(AccountTotal{Account: Account{Accno: 2}, Cash: sek("1100"), Holdings: sek("4000"), NetWorth: sek("5100")}, res.Accounts[1])
+	}
+	assert.Equal(sek("3100"), res.Cash)
+	assert.Equal(sek("29000"), res.Holdings)
+	assert.Equal(sek("32100"), res.NetWorth)
+
+	assert.Equal(map[string]CurrencyExposure{
+		"SEK": {Cash: sek("1000"), Holdings: sek("9000"), Rate: MustParseDecimal("1"), Value: sek("10000")},
+		"USD": {Cash: usd("110"), Holdings: usd("1600"), Rate: MustParseDecimal("10"), Value: sek("17100")},
+		"EUR": {Cash: eur("50"), Holdings: eur("200"), Rate: MustParseDecimal("20"), Value: sek("5000")},
+	}, res.Exposure)
+}
+
+func TestConsolidateRates(t *testing.T) {
+	assert := assert.New(t)
+
+	rates := NewRates()
+	rates.Set("USD", "SEK", MustParseDecimal("10"))
+	rates.Set("EUR", "USD", MustParseDecimal("2"))
+
+	c := NewConsolidator(newConsolidationMock(), "USD")
+	c.Rates = rates
+	res, err := c.Consolidate()
+	assert.NoError(err)
+	assert.Equal(usd("310"), res.Cash)
+	assert.Equal(usd("2900"), res.Holdings)
+	assert.Equal(usd("3210"), res.NetWorth)
+	assert.Equal(MustParseDecimal("0.1"), res.Exposure["SEK"].Rate)
+
+	c.Currency = "NOK"
+	_, err = c.Consolidate()
+	assert.Equal(&RateError{"SEK", "NOK"}, err)
+}
+
+func TestRates(t *testing.T) {
+	assert := assert.New(t)
+
+	rates := NewRates()
+	rates.Set("USD", "SEK", MustParseDecimal("10"))
+	rates.Set("EUR", "SEK", MustParseDecimal("11"))
+	rates.Set("NOK", "SEK", Decimal{})
+
+	rate, err := rates.Rate("SEK", "SEK")
+	assert.NoError(err)
+	assert.Equal(MustParseDecimal("1"), rate)
+
+	rate, err = rates.Rate("SEK", "USD")
+	assert.NoError(err)
+	assert.Equal(MustParseDecimal("0.1"), rate)
+
+	rate, err = rates.Rate("EUR", "USD")
+	assert.NoError(err)
+	assert.Equal(MustParseDecimal("1.1"), rate)
+
+	_, err = rates.Rate("NOK", "SEK")
+	assert.EqualError(err, "no exchange rate from NOK to SEK")
+}
@@ -0,0 +1,99 @@
+package portfolio
+
+import (
+	. "github.com/denro/nordnet/util/models"
+)
+
+// Decimals kept of average prices
+const priceDecimals = 8
+
+// How the cost of the shares sold is determined
+type CostMethod int
+
+const (
+	// The shares are sold at the average price of all shares held
+	AverageCost CostMethod = iota
+	// The shares bought first are sold first
+	FIFO
+)
+
+// CostMethod implements the Stringer interface
+func (m CostMethod) String() string {
+	switch m {
+	case AverageCost:
+		return "average cost"
+	case FIFO:
+		return "FIFO"
+	}
+	return "unknown"
+}
+
+// Shares bought or sold short together at a price, the quantity is negative for short lots
+type lot struct {
+	qty   Decimal
+	price Decimal
+}
+
+// The open lots of a holding, long or short but never both
+type lots struct {
+	method CostMethod
+	open   []lot
+}
+
+// Adds a trade, positive quantities buy and negative ones sell. The trade first closes the open lots
+// of the other side, oldest first, and returns the profit of the closed quantity without multiplier.
+func (l *lots) add(qty, price Decimal) (realised Decimal) {
+	for !qty.IsZero() && len(l.open) > 0 && l.open[0].qty.Sign() != qty.Sign() {
+		open := &l.open[0]
+
+		// the closed quantity has the sign of the open lot
+		closed := open.qty
+		if qty.Abs().Cmp(open.qty.Abs()) < 0 {
+			closed = qty.Neg()
+		}
+		realised = realised.Add(price.Sub(open.price).Mul(closed))
+		open.qty = open.qty.Sub(closed)
+		qty = qty.Add(closed)
+		if open.qty.IsZero() {
+			l.open = l.open[1:]
+		}
+	}
+	if qty.IsZero() {
+		return
+	}
+
+	if l.method == AverageCost && len(l.open) > 0 {
+		open := &l.open[0]
+		total := open.qty.Add(qty)
+		open.price = open.price.Mul(open.qty).Add(price.Mul(qty)).Div(total, priceDecimals)
+		open.qty = total
+	} else {
+		l.open = append(l.open, lot{qty, price})
+	}
+	return
+}
+
+// Returns the quantity held, negative when short
+func (l *lots) qty() (qty Decimal) {
+	for _, open := range l.open {
+		qty = qty.Add(open.qty)
+	}
+	return
+}
+
+// Returns the total cost of the open lots, negative when short
+func (l *lots) cost() (cost Decimal) {
+	for _, open := range l.open {
+		cost = cost.Add(open.price.Mul(open.qty))
+	}
+	return
+}
+
+// Returns the average price of the open lots, 0 when there are none
+func (l *lots) price() Decimal {
+	qty := l.qty()
+	if qty.IsZero() {
+		return Decimal{}
+	}
+	return l.cost().Div(qty, priceDecimals)
+}
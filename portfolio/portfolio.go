@@ -0,0 +1,290 @@
+// Package portfolio values the positions of an account with live prices and tracks its profit and loss.
+//
+// A Portfolio is loaded with the positions and the trades of the day of an account and kept up to date
+// with the prices of the public feed and the trades of the private feed. Its Valuation has the unrealised
+// profit of every holding, the profit of the day against the morning price, the profit realised by the
+// trades with the FIFO or average cost method and the exposure by sector, currency and instrument type.
+//
+// A Consolidator totals the cash and holdings of all accounts in a base currency with the exchange rates
+// of the ledgers and positions or those of another RateSource, and reports what is held in every currency.
+package portfolio
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+)
+
+// Portfolio of an account, it is safe for concurrent use.
+type Portfolio struct {
+	Accno int64
+
+	// Currency of the account, the totals of the valuation are in it. Taken from the positions when empty.
+	Currency string
+
+	// How the cost of sold shares is determined, changing it takes effect on the next Load
+	Method CostMethod
+
+	holdings map[TradableKey]*holding
+	order    []TradableKey
+	// The holding of every tradable of the instruments held
+	tradables map[TradableKey]TradableKey
+	// Exchange rates from the currencies of the positions to the account currency
+	rates  map[string]Decimal
+	trades map[string]bool
+	mu     sync.RWMutex
+}
+
+// An instrument held or traded on the account
+type holding struct {
+	instrument Instrument
+	currency   string
+	lots       lots
+	// Whether the account held a position in the instrument when loaded
+	held bool
+	// The shares held in the morning and their cost
+	openingQty   Decimal
+	openingPrice Decimal
+	morning      Decimal
+	last         Decimal
+	// Paid for the shares bought today less the proceeds of the shares sold, without multiplier
+	netCash  Decimal
+	realised Decimal
+}
+
+// Constructor function for the portfolio of an account.
+func New(accno int64, method CostMethod) *Portfolio {
+	p := &Portfolio{Accno: accno, Method: method}
+	p.Load(nil, nil)
+	return p
+}
+
+// Fetches the positions and trades of the account with the client and loads them.
+func (p *Portfolio) Fetch(client api.AccountReader) error {
+	positions, err := client.AccountPositions(p.Accno)
+	if err != nil {
+		return err
+	}
+	trades, err := client.AccountTrades(p.Accno, nil)
+	if err != nil {
+		return err
+	}
+	p.Load(positions, trades)
+	return nil
+}
+
+// Replaces the holdings with the positions and replays the trades of the day, like the ones returned by
+// AccountTrades. The acquisition price of a position is the average price of the shares held now, so the
+// cost of the shares held in the morning is found by undoing the trades of the day on it. Positions closed
+// by the trades have no acquisition price, the shares they held in the morning are taken at the price of
+// the first trade and realise no profit.
+func (p *Portfolio) Load(positions []Position, trades []Trade) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.holdings = map[TradableKey]*holding{}
+	p.order = nil
+	p.tradables = map[TradableKey]TradableKey{}
+	p.rates = map[string]Decimal{}
+	p.trades = map[string]bool{}
+
+	for _, position := range positions {
+		if position.Accno != p.Accno || len(position.Instrument.Tradables) == 0 {
+			continue
+		}
+		if p.Currency == "" {
+			p.Currency = position.MarketValueAcc.Currency
+		}
+
+		h := p.holding(position.Instrument, position.Instrument.Currency)
+		h.held = true
+		h.openingQty = h.openingQty.Add(NewDecimalFromFloat(position.Qty))
+		h.openingPrice = position.AcqPrice.Value
+		h.morning = position.MorningPrice.Value
+		if units := NewDecimalFromFloat(position.Qty * multiplier(position.Instrument)); !units.IsZero() {
+			h.last = position.MarketValue.Value.Div(units, priceDecimals)
+		}
+		if !position.MarketValue.Value.IsZero() && position.MarketValue.Currency != position.MarketValueAcc.Currency {
+			p.rates[position.MarketValue.Currency] = position.MarketValueAcc.Value.Div(position.MarketValue.Value, priceDecimals)
+		}
+	}
+
+	// the shares held in the morning are the ones held now less the ones traded today
+	var today []Trade
+	for _, trade := range trades {
+		if trade.Accno != p.Accno || p.trades[trade.TradeId] {
+			continue
+		}
+		p.trades[trade.TradeId] = true
+		today = append(today, trade)
+	}
+	sort.SliceStable(today, func(i, j int) bool { return today[i].Tradetime < today[j].Tradetime })
+	for _, trade := range today {
+		h := p.tradeHolding(trade)
+		h.openingQty = h.openingQty.Sub(signedQty(trade))
+	}
+
+	for _, key := range p.order {
+		h := p.holdings[key]
+		var trades []Trade
+		for _, trade := range today {
+			if p.tradables[trade.Key()] == key {
+				trades = append(trades, trade)
+			}
+		}
+
+		if h.held {
+			h.openingPrice = morningPrice(h.openingQty, h.openingPrice, trades)
+		} else if len(trades) > 0 {
+			h.openingPrice = trades[0].Price.Value
+			h.morning = h.openingPrice
+		}
+		h.lots.add(h.openingQty, h.openingPrice)
+	}
+	for _, trade := range today {
+		if h := p.trade(trade); !h.held {
+			h.last = trade.Price.Value
+		}
+	}
+}
+
+// Returns the holding of an instrument, adding it when it is not held, the lock must be held
+func (p *Portfolio) holding(instrument Instrument, currency string) *holding {
+	key := instrument.Tradables[0].Key()
+	if h, ok := p.holdings[key]; ok {
+		return h
+	}
+
+	h := &holding{instrument: instrument, currency: currency, lots: lots{method: p.Method}}
+	p.holdings[key] = h
+	p.order = append(p.order, key)
+	for _, tradable := range instrument.Tradables {
+		if _, ok := p.tradables[tradable.Key()]; !ok {
+			p.tradables[tradable.Key()] = key
+		}
+	}
+	return h
+}
+
+// Returns the holding of the instrument traded, the lock must be held
+func (p *Portfolio) tradeHolding(trade Trade) *holding {
+	if key, ok := p.tradables[trade.Key()]; ok {
+		return p.holdings[key]
+	}
+	// the instrument of a tradable not held is not known
+	instrument := Instrument{Currency: trade.Price.Currency, Tradables: []Tradable{{TradableId: trade.Tradable}}}
+	return p.holding(instrument, trade.Price.Currency)
+}
+
+// Books a trade on its holding and returns the holding, the lock must be held
+func (p *Portfolio) trade(trade Trade) *holding {
+	h := p.tradeHolding(trade)
+	qty := signedQty(trade)
+	h.realised = h.realised.Add(h.lots.add(qty, trade.Price.Value))
+	h.netCash = h.netCash.Add(trade.Price.Value.Mul(qty))
+	return h
+}
+
+// Returns the average price of the shares held in the morning from the average price of the shares held
+// after the trades of the day. The trades are undone newest first, buys are removed at their price and
+// sells, which leave the average price unchanged, are added back at the average price.
+func morningPrice(openingQty, price Decimal, trades []Trade) Decimal {
+	qty := openingQty
+	for _, trade := range trades {
+		qty = qty.Add(signedQty(trade))
+	}
+	cost := price.Mul(qty)
+
+	for i := len(trades) - 1; i >= 0; i-- {
+		trade := trades[i]
+		traded := signedQty(trade)
+		if trade.Side.IsBuy() {
+			cost = cost.Sub(trade.Price.Value.Mul(traded))
+			qty = qty.Sub(traded)
+			continue
+		}
+
+		// the average price is not known when the shares were sold out, the sale then realises nothing
+		average := trade.Price.Value
+		if !qty.IsZero() {
+			average = cost.Div(qty, priceDecimals)
+		}
+		qty = qty.Sub(traded)
+		cost = average.Mul(qty)
+	}
+
+	if qty.IsZero() {
+		return Decimal{}
+	}
+	return cost.Div(qty, priceDecimals)
+}
+
+// Returns the traded volume, negative for sells
+func signedQty(trade Trade) Decimal {
+	qty := NewDecimalFromFloat(trade.Volume)
+	if trade.Side.IsSell() {
+		return qty.Neg()
+	}
+	return qty
+}
+
+func multiplier(instrument Instrument) float64 {
+	if instrument.Multiplier == 0 {
+		return 1
+	}
+	return instrument.Multiplier
+}
+
+// Updates the portfolio with a message of the public or private feed, as delivered by a feed or bus
+// subscriber. Prices and public trades update the last price of the holdings, private trades of the account
+// are booked. Reports whether the valuation changed.
+func (p *Portfolio) Update(msg interface{}) bool {
+	switch msg := msg.(type) {
+	case *feed.PublicMsg:
+		switch data := msg.Data.(type) {
+		case feed.PublicPrice:
+			return p.price(data.Key(), data.Last)
+		case feed.PublicTrade:
+			return p.price(data.Key(), data.Price)
+		}
+	case *feed.PrivateMsg:
+		if data, ok := msg.Data.(feed.PrivateTrade); ok {
+			return p.Trade(Trade(data))
+		}
+	}
+	return false
+}
+
+// Sets the last price of the holding of a tradable
+func (p *Portfolio) price(key TradableKey, last Decimal) bool {
+	if last.IsZero() {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	holdingKey, ok := p.tradables[key]
+	if !ok || p.holdings[holdingKey].last.Equal(last) {
+		return false
+	}
+	p.holdings[holdingKey].last = last
+	return true
+}
+
+// Books a trade of the account made after Load, trades already booked are ignored. Reports whether the
+// trade was booked.
+func (p *Portfolio) Trade(trade Trade) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if trade.Accno != p.Accno || p.trades[trade.TradeId] {
+		return false
+	}
+	p.trades[trade.TradeId] = true
+	p.trade(trade).last = trade.Price.Value
+	return true
+}
@@ -0,0 +1,196 @@
+package portfolio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/api/apitest"
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+)
+
+func sek(s string) Amount { return Amount{Value: MustParseDecimal(s), Currency: "SEK"} }
+func usd(s string) Amount { return Amount{Value: MustParseDecimal(s), Currency: "USD"} }
+
+var (
+	eric = TradableId{Identifier: "101", MarketId: 11}
+	aapl = TradableId{Identifier: "AAPL", MarketId: 19}
+
+	positions = []Position{
+		{
+			Accno: 1,
+			Instrument: Instrument{InstrumentId: 16101932, Symbol: "ERIC B", Currency: "SEK", Sector: "IT", InstrumentType: InstrumentShare,
+				Tradables: []Tradable{{TradableId: eric}, {TradableId: TradableId{Identifier: "101", MarketId: 80}}}},
+			// the average price after the trades of the day
+			Qty: 100, AcqPrice: sek("82"), MorningPrice: sek("85"), MarketValue: sek("9000"), MarketValueAcc: sek("9000"),
+		},
+		{
+			Accno: 1,
+			Instrument: Instrument{InstrumentId: 16200000, Symbol: "AAPL", Currency: "USD", Sector: "IT", InstrumentType: InstrumentShare,
+				Tradables: []Tradable{{TradableId: aapl}}},
+			Qty: 10, AcqPrice: usd("100"), MorningPrice: usd("150"), MarketValue: usd("1600"), MarketValueAcc: sek("16000"),
+		},
+		{Accno: 2, Instrument: Instrument{Tradables: []Tradable{{TradableId: eric}}}, Qty: 1},
+	}
+
+	trades = []Trade{
+		{Accno: 1, TradeId: "2", Tradable: eric, Price: sek("88"), Volume: 20, Side: Sell, Tradetime: 2000},
+		{Accno: 1, TradeId: "1", Tradable: eric, Price: sek("86"), Volume: 40, Side: Buy, Tradetime: 1000},
+		{Accno: 2, TradeId: "3", Tradable: eric, Price: sek("84"), Volume: 50, Side: Buy, Tradetime: 1000},
+	}
+)
+
+func TestValuation(t *testing.T) {
+	assert := assert.New(t)
+
+	mock := &apitest.Mock{
+		AccountPositionsFunc: func(accountno int64) ([]Position, error) { return positions, nil },
+		AccountTradesFunc:    func(accountno int64, params *api.Params) ([]Trade, error) { return trades, nil },
+	}
+	p := New(1, FIFO)
+	assert.NoError(p.Fetch(mock))
+
+	v := p.Valuation()
+	assert.Equal("SEK", v.Currency)
+	if assert.Len(v.Holdings, 2) {
+		h := v.Holdings[0]
+		assert.Equal(float64(100), h.Qty)
+		// 80 held in the morning at 80, 40 bought at 86 and 20 of the first sold at 88
+		assert.Equal(sek("82.4"), h.AcqPrice)
+		assert.Equal(sek("90"), h.Last)
+		assert.Equal(sek("9000"), h.MarketValue)
+		assert.Equal(sek("760"), h.Unrealised)
+		assert.Equal(sek("160"), h.Realised)
+		assert.Equal(sek("520"), h.Daily)
+
+		h = v.Holdings[1]
+		assert.Equal(usd("600"), h.Unrealised)
+		assert.Equal(usd("100"), h.Daily)
+		assert.Equal(MustParseDecimal("10"), h.Rate)
+	}
+	assert.Equal(sek("25000"), v.MarketValue)
+	assert.Equal(sek("6760"), v.Unrealised)
+	assert.Equal(sek("1520"), v.Daily)
+	assert.Equal(sek("160"), v.Realised)
+
+	assert.Equal(map[string]Amount{"IT": sek("25000")}, v.Exposure(BySector))
+	assert.Equal(map[string]Amount{"SEK": sek("9000"), "USD": sek("16000")}, v.Exposure(ByCurrency))
+	assert.Equal(map[string]Amount{"ESH": sek("25000")}, v.Exposure(ByInstrumentType))
+}
+
+func TestUpdates(t *testing.T) {
+	assert := assert.New(t)
+
+	p := New(1, FIFO)
+	p.Load(positions, trades)
+
+	// any tradable of the instrument prices it
+	assert.True(p.Update(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "101", M: 80, Last: MustParseDecimal("91")}}))
+	assert.False(p.Update(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "101", M: 80, Last: MustParseDecimal("91")}}))
+	// the same price in another form is not a change
+	assert.False(p.Update(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "101", M: 80, Last: MustParseDecimal("91.0")}}))
+	assert.False(p.Update(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "101", M: 11}}))
+	assert.False(p.Update(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "1869", M: 11, Last: MustParseDecimal("200")}}))
+	assert.Equal(sek("860"), p.Valuation().Holdings[0].Unrealised)
+
+	sell := feed.PrivateTrade{Accno: 1, TradeId: "4", Tradable: eric, Price: sek("91"), Volume: 100, Side: Sell}
+	assert.True(p.Update(&feed.PrivateMsg{Type: "trade", Data: sell}))
+	assert.False(p.Update(&feed.PrivateMsg{Type: "trade", Data: sell}))
+	assert.False(p.Trade(trades[1]))
+	assert.False(p.Trade(Trade{Accno: 2, TradeId: "5", Tradable: eric, Price: sek("91"), Volume: 1, Side: Buy}))
+
+	h := p.Valuation().Holdings[0]
+	assert.Equal(float64(0), h.Qty)
+	assert.Equal(sek("0"), h.Unrealised)
+	assert.Equal(sek("1020"), h.Realised)
+	assert.Equal(sek("620"), h.Daily)
+
+	// instruments not held are added by their trades
+	assert.True(p.Trade(Trade{Accno: 1, TradeId: "6", Tradable: TradableId{Identifier: "1869", MarketId: 11}, Price: sek("200"), Volume: 10, Side: Buy}))
+	assert.True(p.Update(&feed.PublicMsg{Type: "trade", Data: feed.PublicTrade{I: "1869", M: 11, Price: MustParseDecimal("210")}}))
+	v := p.Valuation()
+	if assert.Len(v.Holdings, 3) {
+		assert.Equal(sek("100"), v.Holdings[2].Unrealised)
+		assert.Equal(sek("100"), v.Holdings[2].Daily)
+	}
+	assert.Equal(map[string]Amount{"SEK": sek("2100"), "USD": sek("16000")}, v.Exposure(ByCurrency))
+}
+
+func TestAverageCost(t *testing.T) {
+	assert := assert.New(t)
+
+	p := New(1, AverageCost)
+	p.Load(positions, trades)
+
+	// 80 at 80 and 40 at 86 average 82, the acquisition price of the position
+	h := p.Valuation().Holdings[0]
+	assert.Equal(sek("82"), h.AcqPrice)
+	assert.Equal(sek("120"), h.Realised)
+	assert.Equal(sek("800"), h.Unrealised)
+	assert.Equal(sek("520"), h.Daily)
+}
+
+func TestClosedPosition(t *testing.T) {
+	assert := assert.New(t)
+
+	// the position was sold before loading, its cost is not known
+	p := New(1, FIFO)
+	p.Load(nil, []Trade{{Accno: 1, TradeId: "1", Tradable: eric, Price: sek("88"), Volume: 30, Side: Sell}})
+	h := p.Valuation().Holdings[0]
+	assert.Equal(float64(0), h.Qty)
+	assert.Equal(sek("0"), h.Realised)
+	assert.Equal(sek("0"), h.Daily)
+}
+
+func TestLots(t *testing.T) {
+	assert := assert.New(t)
+
+	d := MustParseDecimal
+	for _, method := range []CostMethod{FIFO, AverageCost} {
+		l := lots{method: method}
+		assert.Equal(d("0"), l.add(d("10"), d("100")), method.String())
+		assert.Equal(d("0"), l.add(d("10"), d("110")), method.String())
+
+		// selling more than held goes short at the trade price
+		realised := l.add(d("-25"), d("120"))
+		assert.Equal(d("-5"), l.qty(), method.String())
+		assert.Equal(d("120"), l.price(), method.String())
+		assert.Equal(d("300"), realised, method.String())
+
+		// the short lot gains when bought back lower
+		assert.Equal(d("20"), l.add(d("2"), d("110")), method.String())
+		assert.Equal(d("-3"), l.qty(), method.String())
+	}
+
+	fifo := lots{method: FIFO}
+	fifo.add(d("10"), d("100"))
+	fifo.add(d("10"), d("110"))
+	assert.Equal(d("100"), fifo.add(d("-10"), d("110")))
+	assert.Equal(d("110"), fifo.price())
+
+	average := lots{method: AverageCost}
+	average.add(d("10"), d("100"))
+	average.add(d("10"), d("110"))
+	assert.Equal(d("50"), average.add(d("-10"), d("110")))
+	assert.Equal(d("105"), average.price())
+}
+
+func TestMorningPrice(t *testing.T) {
+	assert := assert.New(t)
+
+	d := MustParseDecimal
+	trade := func(side Side, volume float64, price string) Trade {
+		return Trade{Side: side, Volume: volume, Price: sek(price)}
+	}
+
+	assert.Equal(d("80"), morningPrice(d("80"), d("80"), nil))
+	// bought 40 at 86 and sold 20 with 80 held at 80
+	assert.Equal(d("80"), morningPrice(d("80"), d("82"), []Trade{trade(Buy, 40, "86"), trade(Sell, 20, "88")}))
+	// sold 20 and bought 40 at 86 with 80 held at 80
+	assert.Equal(d("80"), morningPrice(d("80"), d("82.4"), []Trade{trade(Sell, 20, "88"), trade(Buy, 40, "86")}))
+	// sold out and bought 50 again, the morning price is not known
+	assert.Equal(d("88"), morningPrice(d("100"), d("84"), []Trade{trade(Sell, 100, "88"), trade(Buy, 50, "84")}))
+	assert.Equal(d("0"), morningPrice(d("0"), d("84"), []Trade{trade(Buy, 50, "84")}))
+}
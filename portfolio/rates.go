@@ -0,0 +1,97 @@
+package portfolio
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	. "github.com/denro/nordnet/util/models"
+)
+
+// RateSource provides the exchange rates used to consolidate accounts, like a market data service
+// or a table of fixed rates.
+type RateSource interface {
+	// Returns how many units of the to currency one unit of the from currency is worth
+	Rate(from, to string) (Decimal, error)
+}
+
+// RateError is returned when there is no exchange rate between two currencies
+type RateError struct {
+	From string
+	To   string
+}
+
+// RateError implements the error interface
+func (e *RateError) Error() string {
+	return fmt.Sprintf("no exchange rate from %s to %s", e.From, e.To)
+}
+
+// Rates is a RateSource of known exchange rates, it is safe for concurrent use. Rates between currencies
+// that are not set directly are crossed through the other currencies, like USD to EUR through SEK.
+type Rates struct {
+	rates map[string]map[string]Decimal
+	mu    sync.RWMutex
+}
+
+// Constructor function for an empty set of rates.
+func NewRates() *Rates {
+	return &Rates{rates: map[string]map[string]Decimal{}}
+}
+
+// Sets the rate from one currency to another and its inverse, zero rates are ignored.
+func (r *Rates) Set(from, to string, rate Decimal) {
+	if from == to || rate.Sign() <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.set(from, to, rate)
+	r.set(to, from, NewDecimal(1, 0).Div(rate, priceDecimals))
+}
+
+// Sets a rate in one direction, the lock must be held
+func (r *Rates) set(from, to string, rate Decimal) {
+	if r.rates[from] == nil {
+		r.rates[from] = map[string]Decimal{}
+	}
+	r.rates[from][to] = rate
+}
+
+// Rates implements the RateSource interface, preferring the rate with the fewest crosses and then the
+// alphabetically first currencies
+func (r *Rates) Rate(from, to string) (Decimal, error) {
+	one := NewDecimal(1, 0)
+	if from == to {
+		return one, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// breadth first through the currencies reachable from the from currency
+	found := map[string]Decimal{from: one}
+	queue := []string{from}
+	for len(queue) > 0 {
+		currency := queue[0]
+		queue = queue[1:]
+		var nexts []string
+		for next := range r.rates[currency] {
+			nexts = append(nexts, next)
+		}
+		sort.Strings(nexts)
+
+		for _, next := range nexts {
+			if _, ok := found[next]; ok {
+				continue
+			}
+			found[next] = found[currency].Mul(r.rates[currency][next]).Round(priceDecimals)
+			if next == to {
+				return found[next], nil
+			}
+			queue = append(queue, next)
+		}
+	}
+	return Decimal{}, &RateError{from, to}
+}
@@ -0,0 +1,114 @@
+package portfolio
+
+import (
+	. "github.com/denro/nordnet/util/models"
+)
+
+// Holding is the valuation of an instrument held or traded today, the amounts are in the currency
+// of the instrument.
+type Holding struct {
+	Instrument Instrument
+	Qty        float64
+
+	// Average price of the shares held, by the cost method of the portfolio
+	AcqPrice    Amount
+	Last        Amount
+	Morning     Amount
+	MarketValue Amount
+
+	// Profit of the shares held against their acquisition price
+	Unrealised Amount
+	// Profit of the day against the morning price, including the shares traded today
+	Daily Amount
+	// Profit of the shares sold today
+	Realised Amount
+
+	// Exchange rate to the account currency, implied by the market values of the positions in the currency.
+	// It is 0 when no position in the currency was loaded.
+	Rate Decimal
+}
+
+// Valuation of a portfolio at one point in time
+type Valuation struct {
+	Accno    int64
+	Currency string
+	Holdings []Holding
+
+	// Totals of the holdings in the account currency, holdings without exchange rate are left out
+	MarketValue Amount
+	Unrealised  Amount
+	Daily       Amount
+	Realised    Amount
+}
+
+// Values the holdings at their last prices.
+func (p *Portfolio) Valuation() *Valuation {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	v := &Valuation{Accno: p.Accno, Currency: p.Currency}
+	for _, total := range []*Amount{&v.MarketValue, &v.Unrealised, &v.Daily, &v.Realised} {
+		total.Currency = p.Currency
+	}
+
+	for _, key := range p.order {
+		h := p.holdings[key]
+		mult := NewDecimalFromFloat(multiplier(h.instrument))
+		qty := h.lots.qty()
+		amount := func(value Decimal) Amount { return Amount{Value: value, Currency: h.currency} }
+
+		holding := Holding{
+			Instrument:  h.instrument,
+			Qty:         qty.Float64(),
+			AcqPrice:    amount(h.lots.price()),
+			Last:        amount(h.last),
+			Morning:     amount(h.morning),
+			MarketValue: amount(h.last.Mul(qty).Mul(mult)),
+			Unrealised:  amount(h.last.Mul(qty).Sub(h.lots.cost()).Mul(mult)),
+			Daily:       amount(h.last.Mul(qty).Sub(h.morning.Mul(h.openingQty)).Sub(h.netCash).Mul(mult)),
+			Realised:    amount(h.realised.Mul(mult)),
+			Rate:        p.rate(h.currency),
+		}
+		v.Holdings = append(v.Holdings, holding)
+
+		if holding.Rate.IsZero() {
+			continue
+		}
+		v.MarketValue.Value = v.MarketValue.Value.Add(holding.MarketValue.Value.Mul(holding.Rate))
+		v.Unrealised.Value = v.Unrealised.Value.Add(holding.Unrealised.Value.Mul(holding.Rate))
+		v.Daily.Value = v.Daily.Value.Add(holding.Daily.Value.Mul(holding.Rate))
+		v.Realised.Value = v.Realised.Value.Add(holding.Realised.Value.Mul(holding.Rate))
+	}
+	return v
+}
+
+// Returns the exchange rate from the currency to the account currency, the lock must be held
+func (p *Portfolio) rate(currency string) Decimal {
+	if currency == p.Currency {
+		return NewDecimal(1, 0)
+	}
+	return p.rates[currency]
+}
+
+// Returns the market value of the holdings in the account currency by the groups returned by the
+// function, like BySector. Holdings without exchange rate are left out.
+func (v *Valuation) Exposure(group func(Holding) string) map[string]Amount {
+	res := map[string]Amount{}
+	for _, h := range v.Holdings {
+		if h.Rate.IsZero() || h.Qty == 0 {
+			continue
+		}
+		k := group(h)
+		res[k] = Amount{Value: res[k].Value.Add(h.MarketValue.Value.Mul(h.Rate)), Currency: v.Currency}
+	}
+	return res
+}
+
+// Groups the holdings by the sector of the instrument, the sectors are listed by InstrumentSectors
+func BySector(h Holding) string { return h.Instrument.Sector }
+
+// Groups the holdings by the currency of the instrument
+func ByCurrency(h Holding) string { return h.Instrument.Currency }
+
+// Groups the holdings by the type of the instrument
+func ByInstrumentType(h Holding) string { return h.Instrument.InstrumentType.String() }
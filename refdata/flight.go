@@ -0,0 +1,40 @@
+package refdata
+
+import "sync"
+
+// Fetches in flight by key, so concurrent misses of an entry share a single request
+type group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	wg  sync.WaitGroup
+	err error
+}
+
+// Calls fetch unless a call with the same key is in flight, in which case its result is awaited and returned
+func (g *group) do(key string, fetch func() error) error {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*call{}
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.err
+	}
+	c := &call{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.err = fetch()
+	return c.err
+}
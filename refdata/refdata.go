@@ -0,0 +1,474 @@
+// Package refdata caches the reference data of the API, the markets, tick sizes, instrument types, sectors,
+// countries and instruments that rarely change but are needed all the time.
+//
+// A Cache wraps an api.InstrumentFinder and implements it itself, so it can replace the client wherever
+// reference data is read. Entries expire after a TTL, concurrent misses of an entry share a single request,
+// and the cache can be warmed up at startup and saved to disk between runs.
+package refdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denro/nordnet/api"
+	. "github.com/denro/nordnet/util/models"
+)
+
+// Default times to live of the entries
+const (
+	DefaultTTL           = 24 * time.Hour
+	DefaultInstrumentTTL = time.Hour
+)
+
+// NotFoundError is returned by the lookups when the API does not know the id
+type NotFoundError struct {
+	Kind string
+	Id   string
+}
+
+// NotFoundError implements the error interface
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %s not found", e.Kind, e.Id)
+}
+
+// Cache of the reference data, it is safe for concurrent use. The methods not cached are passed to the
+// embedded InstrumentFinder. Returned values share their nested slices with the cache and must not be modified.
+type Cache struct {
+	api.InstrumentFinder
+
+	// Time to live of the markets, tick sizes, instrument types, sectors and countries
+	TTL time.Duration
+
+	// Time to live of the instruments
+	InstrumentTTL time.Duration
+
+	data      snapshot
+	tradables map[TradableKey]int64
+	flight    group
+	now       func() time.Time
+	mu        sync.RWMutex
+}
+
+// The cached data, as written to disk by Save
+type snapshot struct {
+	Markets         []Market             `json:"markets,omitempty"`
+	TickSizes       []TicksizeTable      `json:"tick_sizes,omitempty"`
+	InstrumentTypes []InstrumentType     `json:"instrument_types,omitempty"`
+	Sectors         []Sector             `json:"sectors,omitempty"`
+	Countries       []Country            `json:"countries,omitempty"`
+	Instruments     map[int64]Instrument `json:"instruments,omitempty"`
+
+	// Time every entry was fetched by its key, like "markets" or "instrument/16099874"
+	Fetched map[string]time.Time `json:"fetched"`
+}
+
+var _ api.InstrumentFinder = (*Cache)(nil)
+
+// Constructor function caching the reference data of the client with the default times to live.
+func New(client api.InstrumentFinder) *Cache {
+	c := &Cache{InstrumentFinder: client, TTL: DefaultTTL, InstrumentTTL: DefaultInstrumentTTL, now: time.Now}
+	c.reset(snapshot{})
+	return c
+}
+
+// Replaces the cached data and indexes the tradables of the instruments, the lock must be held
+func (c *Cache) reset(data snapshot) {
+	if data.Instruments == nil {
+		data.Instruments = map[int64]Instrument{}
+	}
+	if data.Fetched == nil {
+		data.Fetched = map[string]time.Time{}
+	}
+	c.data = data
+	c.tradables = map[TradableKey]int64{}
+	for _, instrument := range data.Instruments {
+		c.index(instrument)
+	}
+}
+
+// Adds the tradables of the instrument to the index, the lock must be held
+func (c *Cache) index(instrument Instrument) {
+	for _, tradable := range instrument.Tradables {
+		c.tradables[tradable.Key()] = instrument.InstrumentId
+	}
+}
+
+// Reports whether the entry was fetched within the time to live, the lock must be held
+func (c *Cache) fresh(key string, ttl time.Duration) bool {
+	fetched, ok := c.data.Fetched[key]
+	return ok && c.now().Sub(fetched) < ttl
+}
+
+// Fetches the entry unless it is fresh, concurrent callers missing the same entry share one fetch
+func (c *Cache) load(key string, ttl time.Duration, fetch func() error) error {
+	c.mu.RLock()
+	fresh := c.fresh(key, ttl)
+	c.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+	return c.flight.do(key, fetch)
+}
+
+// Stores a fetched entry with the given function
+func (c *Cache) store(key string, set func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	set()
+	c.data.Fetched[key] = c.now()
+}
+
+// Markets returns the cached markets, fetching them when expired
+func (c *Cache) Markets() ([]Market, error) {
+	err := c.load("markets", c.TTL, func() error {
+		markets, err := c.InstrumentFinder.Markets()
+		if err == nil {
+			c.store("markets", func() { c.data.Markets = markets })
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Market{}, c.data.Markets...), nil
+}
+
+// TickSizes returns the cached tick size tables, fetching them when expired
+func (c *Cache) TickSizes() ([]TicksizeTable, error) {
+	err := c.load("tick_sizes", c.TTL, func() error {
+		tickSizes, err := c.InstrumentFinder.TickSizes()
+		if err == nil {
+			c.store("tick_sizes", func() { c.data.TickSizes = tickSizes })
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]TicksizeTable{}, c.data.TickSizes...), nil
+}
+
+// InstrumentTypes returns the cached instrument types, fetching them when expired
+func (c *Cache) InstrumentTypes() ([]InstrumentType, error) {
+	err := c.load("instrument_types", c.TTL, func() error {
+		types, err := c.InstrumentFinder.InstrumentTypes()
+		if err == nil {
+			c.store("instrument_types", func() { c.data.InstrumentTypes = types })
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]InstrumentType{}, c.data.InstrumentTypes...), nil
+}
+
+// InstrumentSectors returns the cached sectors, fetching them when expired. Calls with params filtering
+// the sectors are not cached.
+func (c *Cache) InstrumentSectors(params *api.Params) ([]Sector, error) {
+	if params != nil && len(*params) > 0 {
+		return c.InstrumentFinder.InstrumentSectors(params)
+	}
+
+	err := c.load("sectors", c.TTL, func() error {
+		sectors, err := c.InstrumentFinder.InstrumentSectors(nil)
+		if err == nil {
+			c.store("sectors", func() { c.data.Sectors = sectors })
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Sector{}, c.data.Sectors...), nil
+}
+
+// Countries returns the cached countries, fetching them when expired
+func (c *Cache) Countries() ([]Country, error) {
+	err := c.load("countries", c.TTL, func() error {
+		countries, err := c.InstrumentFinder.Countries()
+		if err == nil {
+			c.store("countries", func() { c.data.Countries = countries })
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Country{}, c.data.Countries...), nil
+}
+
+// Instruments returns the instruments with the comma separated ids, fetching only the ones not cached or
+// expired. Like the API, ids unknown to the API are left out, they are not asked for again until they expire.
+func (c *Cache) Instruments(ids string) ([]Instrument, error) {
+	instrumentIds, err := parseIds(ids)
+	if err != nil {
+		return c.InstrumentFinder.Instruments(ids)
+	}
+
+	var missing []string
+	c.mu.RLock()
+	for _, id := range instrumentIds {
+		if !c.fresh(instrumentKey(id), c.InstrumentTTL) {
+			missing = append(missing, strconv.FormatInt(id, 10))
+		}
+	}
+	c.mu.RUnlock()
+
+	if len(missing) > 0 {
+		joined := strings.Join(missing, ",")
+		err := c.flight.do("instruments/"+joined, func() error {
+			instruments, err := c.InstrumentFinder.Instruments(joined)
+			if err == nil {
+				c.storeInstruments(missing, instruments)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res := []Instrument{}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, id := range instrumentIds {
+		if instrument, ok := c.data.Instruments[id]; ok {
+			res = append(res, instrument)
+		}
+	}
+	return res, nil
+}
+
+// Stores the fetched instruments, the requested ids missing from them are no longer cached
+func (c *Cache) storeInstruments(requested []string, instruments []Instrument) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for _, s := range requested {
+		id, _ := strconv.ParseInt(s, 10, 64)
+		delete(c.data.Instruments, id)
+		c.data.Fetched[instrumentKey(id)] = now
+	}
+	for _, instrument := range instruments {
+		c.data.Instruments[instrument.InstrumentId] = instrument
+		c.data.Fetched[instrumentKey(instrument.InstrumentId)] = now
+		c.index(instrument)
+	}
+}
+
+func instrumentKey(id int64) string {
+	return "instrument/" + strconv.FormatInt(id, 10)
+}
+
+// Parses comma separated instrument ids
+func parseIds(ids string) (res []int64, err error) {
+	for _, s := range strings.Split(ids, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, id)
+	}
+	return
+}
+
+// Returns the market with the id
+func (c *Cache) MarketById(marketId int64) (*Market, error) {
+	markets, err := c.Markets()
+	if err != nil {
+		return nil, err
+	}
+	for _, market := range markets {
+		if market.MarketId == marketId {
+			return &market, nil
+		}
+	}
+	return nil, &NotFoundError{"market", strconv.FormatInt(marketId, 10)}
+}
+
+// Returns the tick size table with the id
+func (c *Cache) TickSizeById(tickSizeId int64) (*TicksizeTable, error) {
+	tickSizes, err := c.TickSizes()
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range tickSizes {
+		if table.TickSizeId == tickSizeId {
+			return &table, nil
+		}
+	}
+	return nil, &NotFoundError{"tick size", strconv.FormatInt(tickSizeId, 10)}
+}
+
+// Returns the sector with the id, like the sector field of instruments
+func (c *Cache) SectorById(sector string) (*Sector, error) {
+	sectors, err := c.InstrumentSectors(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sectors {
+		if s.Sector == sector {
+			return &s, nil
+		}
+	}
+	return nil, &NotFoundError{"sector", sector}
+}
+
+// Returns the instrument with the id
+func (c *Cache) InstrumentById(instrumentId int64) (*Instrument, error) {
+	instruments, err := c.Instruments(strconv.FormatInt(instrumentId, 10))
+	if err != nil {
+		return nil, err
+	}
+	if len(instruments) == 0 {
+		return nil, &NotFoundError{"instrument", strconv.FormatInt(instrumentId, 10)}
+	}
+	return &instruments[0], nil
+}
+
+// Returns the instrument a tradable belongs to. Tradables of instruments not cached are looked up with
+// the market_id_identifier lookup.
+func (c *Cache) InstrumentByTradable(id TradableId) (*Instrument, error) {
+	key := id.Key()
+	c.mu.RLock()
+	instrumentId, ok := c.tradables[key]
+	c.mu.RUnlock()
+	if ok {
+		return c.InstrumentById(instrumentId)
+	}
+
+	err := c.flight.do("tradable/"+key.String(), func() error {
+		instruments, err := c.InstrumentFinder.InstrumentLookup("market_id_identifier", key.String())
+		if err == nil {
+			c.storeInstruments(nil, instruments)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	instrumentId, ok = c.tradables[key]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, &NotFoundError{"tradable", key.String()}
+	}
+	return c.InstrumentById(instrumentId)
+}
+
+// Returns the tick size table of a tradable, used to round order prices
+func (c *Cache) TradableTickSize(id TradableId) (*TicksizeTable, error) {
+	instrument, err := c.InstrumentByTradable(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, tradable := range instrument.Tradables {
+		if tradable.TradableId == id {
+			return c.TickSizeById(tradable.TickSizeId)
+		}
+	}
+	return nil, &NotFoundError{"tradable", id.Key().String()}
+}
+
+// Fetches the markets, tick sizes, instrument types, sectors and countries that are not fresh, and the
+// instruments with the given ids, concurrently. Returns the first error.
+func (c *Cache) Warm(instrumentIds ...int64) error {
+	fetches := []func() error{
+		func() (err error) { _, err = c.Markets(); return },
+		func() (err error) { _, err = c.TickSizes(); return },
+		func() (err error) { _, err = c.InstrumentTypes(); return },
+		func() (err error) { _, err = c.InstrumentSectors(nil); return },
+		func() (err error) { _, err = c.Countries(); return },
+	}
+	if len(instrumentIds) > 0 {
+		ids := make([]string, len(instrumentIds))
+		for i, id := range instrumentIds {
+			ids[i] = strconv.FormatInt(id, 10)
+		}
+		fetches = append(fetches, func() (err error) { _, err = c.Instruments(strings.Join(ids, ",")); return })
+	}
+
+	errs := make(chan error, len(fetches))
+	for _, fetch := range fetches {
+		go func(fetch func() error) { errs <- fetch() }(fetch)
+	}
+
+	var first error
+	for range fetches {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Writes the cached data to a file, replacing the file atomically.
+func (c *Cache) Save(path string) error {
+	c.mu.RLock()
+	b, err := json.Marshal(c.data)
+	c.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Replaces the cached data with the data saved to a file. The entries keep the time they were fetched and
+// expire as usual. A missing file is not an error, so Load can be called before the first Save.
+func (c *Cache) Load(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var data snapshot
+	if err = json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.reset(data)
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,209 @@
+package refdata
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/api/apitest"
+	. "github.com/denro/nordnet/util/models"
+)
+
+var (
+	ericsson = Instrument{InstrumentId: 16101932, Symbol: "ERIC B", Tradables: []Tradable{
+		{TradableId: TradableId{Identifier: "101", MarketId: 11}, TickSizeId: 11010},
+	}}
+	volvo = Instrument{InstrumentId: 16099874, Symbol: "VOLV B", Tradables: []Tradable{
+		{TradableId: TradableId{Identifier: "1869", MarketId: 11}, TickSizeId: 11010},
+	}}
+)
+
+func newMock() *apitest.Mock {
+	instruments := map[string][]Instrument{
+		"16101932":          {ericsson},
+		"16099874":          {volvo},
+		"16101932,16099874": {ericsson, volvo},
+		"16099874,16101932": {volvo, ericsson},
+	}
+	return &apitest.Mock{
+		MarketsFunc: func() ([]Market, error) {
+			return []Market{{MarketId: 11, Country: "SE", Name: "Nordnet Stockholm"}}, nil
+		},
+		TickSizesFunc: func() ([]TicksizeTable, error) {
+			return []TicksizeTable{{TickSizeId: 11010, Ticks: []TickSizeInterval{{FromPrice: MustParseDecimal("0"), ToPrice: MustParseDecimal("1000"), Tick: MustParseDecimal("0.05")}}}}, nil
+		},
+		InstrumentTypesFunc: func() ([]InstrumentType, error) {
+			return []InstrumentType{{InstrumentType: InstrumentShare, Name: "Aktie"}}, nil
+		},
+		InstrumentSectorsFunc: func(params *api.Params) ([]Sector, error) {
+			return []Sector{{Sector: "IT", Group: "TECH", Name: "Informationsteknik"}}, nil
+		},
+		CountriesFunc: func() ([]Country, error) {
+			return []Country{{Country: "SE", Name: "Sverige"}}, nil
+		},
+		InstrumentsFunc: func(ids string) ([]Instrument, error) {
+			return instruments[ids], nil
+		},
+		InstrumentLookupFunc: func(lookupType string, lookup string) ([]Instrument, error) {
+			if lookupType == "market_id_identifier" && lookup == "11:101" {
+				return []Instrument{ericsson}, nil
+			}
+			return []Instrument{}, nil
+		},
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	assert := assert.New(t)
+
+	mock := newMock()
+	now := time.Date(2016, 3, 18, 9, 0, 0, 0, time.UTC)
+	c := New(mock)
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		market, err := c.MarketById(11)
+		assert.NoError(err)
+		assert.Equal("SE", market.Country)
+	}
+	assert.Len(mock.CallsTo("Markets"), 1)
+
+	_, err := c.MarketById(12)
+	assert.Equal(&NotFoundError{"market", "12"}, err)
+	assert.EqualError(err, "market 12 not found")
+
+	now = now.Add(DefaultTTL)
+	c.Markets()
+	assert.Len(mock.CallsTo("Markets"), 2)
+
+	// errors are returned and not cached
+	mock.CountriesFunc = func() ([]Country, error) { return nil, api.TooManyRequestsError }
+	_, err = c.Countries()
+	assert.Equal(api.TooManyRequestsError, err)
+	mock.CountriesFunc = nil
+	_, err = c.Countries()
+	assert.NoError(err)
+	assert.Len(mock.CallsTo("Countries"), 2)
+
+	// filtered sectors pass through, the other methods are not cached
+	c.InstrumentSectors(&api.Params{"group": "TECH"})
+	c.InstrumentSectors(&api.Params{"group": "TECH"})
+	c.Lists()
+	assert.Len(mock.CallsTo("InstrumentSectors"), 2)
+	assert.Len(mock.CallsTo("Lists"), 1)
+}
+
+func TestCacheConcurrentMisses(t *testing.T) {
+	assert := assert.New(t)
+
+	mock := newMock()
+	release := make(chan struct{})
+	mock.TickSizesFunc = func() ([]TicksizeTable, error) {
+		<-release
+		return []TicksizeTable{{TickSizeId: 11010}}, nil
+	}
+	c := New(mock)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			table, err := c.TickSizeById(11010)
+			assert.NoError(err)
+			assert.Equal(int64(11010), table.TickSizeId)
+		}()
+	}
+	for len(mock.CallsTo("TickSizes")) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Len(mock.CallsTo("TickSizes"), 1)
+}
+
+func TestCacheInstruments(t *testing.T) {
+	assert := assert.New(t)
+
+	mock := newMock()
+	c := New(mock)
+
+	instruments, err := c.Instruments("16101932")
+	assert.NoError(err)
+	assert.Equal([]Instrument{ericsson}, instruments)
+
+	// only the missing instrument is fetched, the result keeps the order of the ids
+	instruments, err = c.Instruments("16099874,16101932")
+	assert.NoError(err)
+	assert.Equal([]Instrument{volvo, ericsson}, instruments)
+	assert.Equal([]apitest.Call{{"Instruments", []interface{}{"16101932"}}, {"Instruments", []interface{}{"16099874"}}}, mock.CallsTo("Instruments"))
+
+	// unknown instruments are not asked for again
+	_, err = c.InstrumentById(1)
+	assert.Equal(&NotFoundError{"instrument", "1"}, err)
+	c.InstrumentById(1)
+	assert.Len(mock.CallsTo("Instruments"), 3)
+
+	// tradables of cached instruments need no lookup
+	instrument, err := c.InstrumentByTradable(TradableId{Identifier: "1869", MarketId: 11})
+	assert.NoError(err)
+	assert.Equal("VOLV B", instrument.Symbol)
+	assert.Empty(mock.CallsTo("InstrumentLookup"))
+
+	c = New(mock)
+	table, err := c.TradableTickSize(TradableId{Identifier: "101", MarketId: 11})
+	assert.NoError(err)
+	assert.Equal(int64(11010), table.TickSizeId)
+	c.InstrumentByTradable(TradableId{Identifier: "101", MarketId: 11})
+	assert.Len(mock.CallsTo("InstrumentLookup"), 1)
+
+	_, err = c.InstrumentByTradable(TradableId{Identifier: "1", MarketId: 11})
+	assert.Equal(&NotFoundError{"tradable", "11:1"}, err)
+
+	// the ids are passed through when they are not numbers
+	c.Instruments("ERIC")
+	assert.Equal(apitest.Call{"Instruments", []interface{}{"ERIC"}}, mock.CallsTo("Instruments")[3])
+}
+
+func TestCacheWarmAndPersistence(t *testing.T) {
+	assert := assert.New(t)
+
+	mock := newMock()
+	c := New(mock)
+	assert.NoError(c.Warm(16101932, 16099874))
+	for _, method := range []string{"Markets", "TickSizes", "InstrumentTypes", "InstrumentSectors", "Countries", "Instruments"} {
+		assert.Len(mock.CallsTo(method), 1, method)
+	}
+
+	path := filepath.Join(t.TempDir(), "refdata.json")
+	assert.NoError(c.Save(path))
+
+	mock.Reset()
+	loaded := New(mock)
+	assert.NoError(loaded.Load(filepath.Join(t.TempDir(), "missing.json")))
+	assert.NoError(loaded.Load(path))
+	assert.NoError(loaded.Warm(16101932))
+	instrument, err := loaded.InstrumentByTradable(TradableId{Identifier: "101", MarketId: 11})
+	assert.NoError(err)
+	assert.Equal(ericsson, *instrument)
+	sector, err := loaded.SectorById("IT")
+	assert.NoError(err)
+	assert.Equal("TECH", sector.Group)
+	assert.Empty(mock.Calls())
+
+	// the saved entries expire as usual
+	loaded.now = func() time.Time { return time.Now().Add(DefaultInstrumentTTL) }
+	loaded.InstrumentById(16101932)
+	assert.Len(mock.CallsTo("Instruments"), 1)
+
+	mock.MarketsFunc = func() ([]Market, error) { return nil, errors.New("unavailable") }
+	loaded.now = func() time.Time { return time.Now().Add(DefaultTTL) }
+	assert.EqualError(loaded.Warm(), "unavailable")
+}
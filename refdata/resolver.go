@@ -0,0 +1,298 @@
+package refdata
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denro/nordnet/api"
+	. "github.com/denro/nordnet/util/models"
+)
+
+// The market of the smart order tradables, which are routed with the best execution policy of Nordnet.
+// Instruments traded on two or more markets have a tradable on it.
+const SmartOrderMarket = 80
+
+// AmbiguousError is returned by Resolve when several instruments match the query equally well
+type AmbiguousError struct {
+	Query      string
+	Candidates []Instrument
+}
+
+// AmbiguousError implements the error interface
+func (e *AmbiguousError) Error() string {
+	symbols := make([]string, len(e.Candidates))
+	for i, instrument := range e.Candidates {
+		symbols[i] = fmt.Sprintf("%s (%d)", instrument.Symbol, instrument.InstrumentId)
+	}
+	return fmt.Sprintf("%q is ambiguous: %s", e.Query, strings.Join(symbols, ", "))
+}
+
+// The instrument and tradable a query resolved to
+type Match struct {
+	Instrument Instrument
+	Tradable   Tradable
+}
+
+// Resolver turns the tickers, ISINs and names typed by users into instruments and the tradable to trade
+// them on, it is safe for concurrent use.
+type Resolver struct {
+	Client api.InstrumentFinder
+
+	// Preferred markets, the first one is preferred the most
+	Markets []int64
+
+	// Preferred currency of instruments traded in several currencies, like "SEK"
+	Currency string
+
+	// Time to live of the resolved queries, also of the queries not found
+	TTL time.Duration
+
+	resolved map[string]resolved
+	flight   group
+	now      func() time.Time
+	mu       sync.RWMutex
+}
+
+type resolved struct {
+	match   *Match
+	err     error
+	fetched time.Time
+}
+
+// Constructor function preferring the smart order market, caching the results for the default instrument TTL.
+func NewResolver(client api.InstrumentFinder) *Resolver {
+	return &Resolver{
+		Client:   client,
+		Markets:  []int64{SmartOrderMarket},
+		TTL:      DefaultInstrumentTTL,
+		resolved: map[string]resolved{},
+		now:      time.Now,
+	}
+}
+
+var isinPattern = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{9}[0-9]$`)
+
+// Resolves a ticker like "ERIC B", an ISIN like "SE0000108656", a name or a tradable as market:identifier
+// into an instrument and its preferred tradable, a tradable resolves to itself. Candidates are scored on
+// how well they match the query, the preferred currency and markets and the display order of their
+// tradables. Returns a *NotFoundError when nothing matches and an *AmbiguousError when several instruments
+// score the same.
+func (r *Resolver) Resolve(query string) (*Match, error) {
+	q := normalize(query)
+	if q == "" {
+		return nil, &NotFoundError{"instrument", query}
+	}
+
+	r.mu.RLock()
+	res, ok := r.resolved[q]
+	r.mu.RUnlock()
+	if !ok || r.now().Sub(res.fetched) >= r.TTL {
+		if err := r.flight.do(q, func() error {
+			match, err := r.resolve(q)
+			if _, failed := err.(*NotFoundError); err == nil || failed {
+				r.mu.Lock()
+				r.resolved[q] = resolved{match, err, r.now()}
+				r.mu.Unlock()
+			}
+			return err
+		}); err != nil {
+			return nil, err
+		}
+		r.mu.RLock()
+		res = r.resolved[q]
+		r.mu.RUnlock()
+	}
+
+	if res.err != nil {
+		return nil, res.err
+	}
+	match := *res.match
+	return &match, nil
+}
+
+// Looks up the candidates of the query and picks the best one
+func (r *Resolver) resolve(q string) (*Match, error) {
+	var (
+		instruments []Instrument
+		err         error
+		score       func(Instrument) int
+		// the tradable asked for by a query like "11:101"
+		wanted TradableKey
+	)
+	switch key, keyErr := ParseTradableKey(q); {
+	case keyErr == nil && isTradable(key):
+		wanted = key
+		instruments, err = r.Client.InstrumentLookup("market_id_identifier", key.String())
+		score = func(instrument Instrument) int {
+			if _, ok := tradableByKey(instrument, key); ok {
+				return 1
+			}
+			return 0
+		}
+	case IsISIN(q):
+		// only exact matches, the search also finds instruments mentioning the ISIN
+		instruments, err = r.Client.SearchInstruments(&api.Params{"query": q})
+		score = func(instrument Instrument) int {
+			if strings.ToUpper(instrument.IsinCode) == q {
+				return 1
+			}
+			return 0
+		}
+	default:
+		instruments, err = r.Client.SearchInstruments(&api.Params{"query": q})
+		score = func(instrument Instrument) int { return matchScore(q, instrument) }
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var best []candidate
+	for _, instrument := range instruments {
+		s := score(instrument)
+		if s <= 0 || len(instrument.Tradables) == 0 {
+			continue
+		}
+		c := r.candidate(instrument, s)
+		if wanted != "" {
+			c.tradable, _ = tradableByKey(instrument, wanted)
+		}
+		switch {
+		case len(best) == 0 || c.compare(best[0]) > 0:
+			best = []candidate{c}
+		case c.compare(best[0]) == 0:
+			best = append(best, c)
+		}
+	}
+
+	switch len(best) {
+	case 0:
+		return nil, &NotFoundError{"instrument", q}
+	case 1:
+		return &Match{Instrument: best[0].instrument, Tradable: best[0].tradable}, nil
+	}
+	ambiguous := &AmbiguousError{Query: q}
+	for _, c := range best {
+		ambiguous.Candidates = append(ambiguous.Candidates, c.instrument)
+	}
+	return nil, ambiguous
+}
+
+// Returns the tradable of the instrument with the key
+func tradableByKey(instrument Instrument, key TradableKey) (Tradable, bool) {
+	for _, tradable := range instrument.Tradables {
+		if tradable.Key() == key {
+			return tradable, true
+		}
+	}
+	return Tradable{}, false
+}
+
+// An instrument matching the query with its preferred tradable
+type candidate struct {
+	instrument Instrument
+	tradable   Tradable
+	match      int
+	currency   int
+	market     int
+}
+
+// Returns the candidate of an instrument with the preferred tradable of the instrument
+func (r *Resolver) candidate(instrument Instrument, match int) candidate {
+	c := candidate{instrument: instrument, match: match}
+	if r.Currency != "" && strings.EqualFold(instrument.Currency, r.Currency) {
+		c.currency = 1
+	}
+	for i, tradable := range instrument.Tradables {
+		market := r.marketScore(tradable.MarketId)
+		if i == 0 || market > c.market || market == c.market && tradable.DisplayOrder < c.tradable.DisplayOrder {
+			c.tradable, c.market = tradable, market
+		}
+	}
+	return c
+}
+
+// Compares the scores of the candidates, a positive result means c is better than o
+func (c candidate) compare(o candidate) int {
+	switch {
+	case c.match != o.match:
+		return c.match - o.match
+	case c.currency != o.currency:
+		return c.currency - o.currency
+	case c.market != o.market:
+		return c.market - o.market
+	case c.tradable.DisplayOrder != o.tradable.DisplayOrder:
+		// a lower display order is shown first
+		if c.tradable.DisplayOrder < o.tradable.DisplayOrder {
+			return 1
+		}
+		return -1
+	}
+	return 0
+}
+
+// Scores the preferred markets, the first one highest and markets not preferred 0
+func (r *Resolver) marketScore(marketId int64) int {
+	for i, preferred := range r.Markets {
+		if preferred == marketId {
+			return len(r.Markets) - i
+		}
+	}
+	return 0
+}
+
+// Scores how well an instrument matches a normalized query, 0 when it does not match
+func matchScore(q string, instrument Instrument) int {
+	symbol, name := normalize(instrument.Symbol), normalize(instrument.Name)
+	switch {
+	case symbol == q:
+		return 3
+	case name == q:
+		return 2
+	case strings.Contains(symbol, q) || strings.Contains(name, q):
+		return 1
+	}
+	return 0
+}
+
+// Upper cases the query and collapses its white space, like "eric  b" to "ERIC B"
+func normalize(s string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(s), " "))
+}
+
+// Reports whether the key is a tradable with a numeric market rather than a name with a colon
+func isTradable(key TradableKey) bool {
+	_, err := key.TradableId()
+	return err == nil
+}
+
+// Reports whether s is an ISIN with a valid check digit
+func IsISIN(s string) bool {
+	if !isinPattern.MatchString(s) {
+		return false
+	}
+
+	// the letters are replaced by two digits, A by 10 to Z by 35, and the Luhn algorithm applied to the digits
+	var digits []int
+	for _, ch := range s {
+		if ch >= 'A' {
+			n := int(ch-'A') + 10
+			digits = append(digits, n/10, n%10)
+		} else {
+			digits = append(digits, int(ch-'0'))
+		}
+	}
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
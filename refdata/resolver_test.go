@@ -0,0 +1,160 @@
+package refdata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/api/apitest"
+	. "github.com/denro/nordnet/util/models"
+)
+
+func tradable(market int64, identifier string, displayOrder int64) Tradable {
+	return Tradable{TradableId: TradableId{Identifier: identifier, MarketId: market}, DisplayOrder: displayOrder}
+}
+
+var (
+	ericA = Instrument{InstrumentId: 16101929, Symbol: "ERIC A", Name: "Ericsson A", IsinCode: "SE0000108649", Currency: "SEK",
+		Tradables: []Tradable{tradable(11, "100", 1)}}
+	ericB = Instrument{InstrumentId: 16101932, Symbol: "ERIC B", Name: "Ericsson B", IsinCode: "SE0000108656", Currency: "SEK",
+		Tradables: []Tradable{tradable(11, "101", 1), tradable(80, "101", 2), tradable(30, "ERIC", 3)}}
+	ericMini = Instrument{InstrumentId: 16500000, Symbol: "MINI L ERIC", Name: "Mini Long Ericsson", IsinCode: "SE0012345678", Currency: "SEK",
+		Tradables: []Tradable{tradable(11, "9999", 1)}, Underlyings: []UnderlyingInfo{{IsinCode: "SE0000108656"}}}
+	nokiaSEK = Instrument{InstrumentId: 16099878, Symbol: "NOKIA SEK", Name: "Nokia", Currency: "SEK",
+		Tradables: []Tradable{tradable(11, "1000", 1)}}
+	nokiaEUR = Instrument{InstrumentId: 16099879, Symbol: "NOKIA", Name: "Nokia", Currency: "EUR",
+		Tradables: []Tradable{tradable(24, "1001", 1)}}
+)
+
+func newResolverMock() *apitest.Mock {
+	return &apitest.Mock{
+		SearchInstrumentsFunc: func(params *api.Params) ([]Instrument, error) {
+			switch (*params)["query"] {
+			case "ERIC B", "ERIC", "SE0000108656":
+				return []Instrument{ericMini, ericA, ericB}, nil
+			case "NOKIA":
+				return []Instrument{nokiaSEK, nokiaEUR}, nil
+			}
+			return []Instrument{}, nil
+		},
+		InstrumentLookupFunc: func(lookupType string, lookup string) ([]Instrument, error) {
+			if lookup == "11:101" {
+				return []Instrument{ericB}, nil
+			}
+			return []Instrument{}, nil
+		},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	mock := newResolverMock()
+	r := NewResolver(mock)
+
+	// the smart order tradable is preferred
+	match, err := r.Resolve(" eric  b")
+	assert.NoError(err)
+	assert.Equal(ericB, match.Instrument)
+	assert.Equal(tradable(80, "101", 2), match.Tradable)
+
+	match, err = r.Resolve("SE0000108656")
+	assert.NoError(err)
+	assert.Equal(ericB, match.Instrument)
+
+	// the tradable asked for is kept over the preferred market
+	match, err = r.Resolve("11:101")
+	assert.NoError(err)
+	assert.Equal(ericB, match.Instrument)
+	assert.Equal(tradable(11, "101", 1), match.Tradable)
+	assert.Len(mock.CallsTo("InstrumentLookup"), 1)
+
+	// without preferred markets the lowest display order is preferred
+	r = NewResolver(mock)
+	r.Markets = nil
+	match, err = r.Resolve("ERIC B")
+	assert.NoError(err)
+	assert.Equal(tradable(11, "101", 1), match.Tradable)
+
+	_, err = r.Resolve("ericsson c")
+	assert.Equal(&NotFoundError{"instrument", "ERICSSON C"}, err)
+
+	_, err = r.Resolve("ERIC")
+	if assert.IsType(&AmbiguousError{}, err) {
+		assert.Equal([]Instrument{ericMini, ericA, ericB}, err.(*AmbiguousError).Candidates)
+		assert.EqualError(err, `"ERIC" is ambiguous: MINI L ERIC (16500000), ERIC A (16101929), ERIC B (16101932)`)
+	}
+}
+
+func TestResolveScoring(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewResolver(newResolverMock())
+
+	// the exact symbol wins
+	match, err := r.Resolve("nokia")
+	assert.NoError(err)
+	assert.Equal(nokiaEUR, match.Instrument)
+
+	// then the preferred currency, then the preferred markets
+	r.resolved = map[string]resolved{}
+	r.Currency = "SEK"
+	nokiaSEK.Symbol = "NOKIA"
+	defer func() { nokiaSEK.Symbol = "NOKIA SEK" }()
+	match, err = r.Resolve("nokia")
+	assert.NoError(err)
+	assert.Equal(nokiaSEK, match.Instrument)
+
+	r.resolved = map[string]resolved{}
+	r.Currency = ""
+	_, err = r.Resolve("nokia")
+	assert.IsType(&AmbiguousError{}, err)
+
+	r.resolved = map[string]resolved{}
+	r.Markets = []int64{SmartOrderMarket, 24}
+	match, err = r.Resolve("nokia")
+	assert.NoError(err)
+	assert.Equal(tradable(24, "1001", 1), match.Tradable)
+}
+
+func TestResolveCache(t *testing.T) {
+	assert := assert.New(t)
+
+	mock := newResolverMock()
+	now := time.Now()
+	r := NewResolver(mock)
+	r.now = func() time.Time { return now }
+
+	r.Resolve("ERIC B")
+	r.Resolve("eric b")
+	_, err := r.Resolve("unknown")
+	assert.IsType(&NotFoundError{}, err)
+	_, err = r.Resolve("UNKNOWN")
+	assert.IsType(&NotFoundError{}, err)
+	assert.Len(mock.CallsTo("SearchInstruments"), 2)
+
+	now = now.Add(r.TTL)
+	r.Resolve("ERIC B")
+	assert.Len(mock.CallsTo("SearchInstruments"), 3)
+
+	// other errors are not cached
+	mock.SearchInstrumentsFunc = func(params *api.Params) ([]Instrument, error) { return nil, api.TooManyRequestsError }
+	_, err = r.Resolve("VOLV B")
+	assert.Equal(api.TooManyRequestsError, err)
+	_, err = r.Resolve("VOLV B")
+	assert.Equal(api.TooManyRequestsError, err)
+	assert.Len(mock.CallsTo("SearchInstruments"), 5)
+}
+
+func TestIsISIN(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(IsISIN("SE0000108656"))
+	assert.True(IsISIN("SE0000108649"))
+	assert.True(IsISIN("US0378331005"))
+	assert.False(IsISIN("SE0000108657"))
+	assert.False(IsISIN("se0000108656"))
+	assert.False(IsISIN("ERIC B"))
+}
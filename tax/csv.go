@@ -0,0 +1,155 @@
+package tax
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	. "github.com/denro/nordnet/util/models"
+)
+
+// The columns of the transaction CSV, only date, id, side, qty, price and currency are required
+var transactionColumns = []string{"date", "id", "name", "section", "side", "qty", "price", "currency", "fee", "rate"}
+
+// The columns of the K4 CSV, as labelled on the form
+var k4Columns = []string{"Sektion", "Antal", "Beteckning", "Försäljningspris", "Omkostnadsbelopp", "Vinst", "Förlust"}
+
+// Reads transactions from CSV with a header naming the columns, in any order: date (like 2016-03-18), id,
+// name, section (A when empty), side (BUY or SELL), qty, price, currency, fee (in the currency of the price)
+// and rate (SEK per unit of the currency, looked up when empty).
+func ReadTransactions(r io.Reader) ([]Transaction, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"date", "id", "side", "qty", "price", "currency"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	var res []Transaction
+	for n, record := range records[1:] {
+		trade, err := parseTransaction(record, columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+2, err)
+		}
+		res = append(res, trade)
+	}
+	return res, nil
+}
+
+// Parses a record of the transaction CSV
+func parseTransaction(record []string, columns map[string]int) (trade Transaction, err error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	decimal := func(name string) (d Decimal) {
+		if s := field(name); s != "" && err == nil {
+			if d, err = ParseDecimal(s); err != nil {
+				err = fmt.Errorf("invalid %s %q", name, s)
+			}
+		}
+		return
+	}
+
+	trade = Transaction{
+		Date:    Date(field("date")),
+		Id:      field("id"),
+		Name:    field("name"),
+		Section: Section(strings.ToUpper(field("section"))),
+		Side:    Side(strings.ToUpper(field("side"))),
+		Qty:     decimal("qty"),
+		Price:   Amount{Value: decimal("price"), Currency: strings.ToUpper(field("currency"))},
+		Rate:    decimal("rate"),
+	}
+	trade.Fee = Amount{Value: decimal("fee"), Currency: trade.Price.Currency}
+	if err != nil {
+		return
+	}
+
+	if _, err = time.Parse(DateLayout, string(trade.Date)); err != nil {
+		return trade, fmt.Errorf("invalid date %q", trade.Date)
+	}
+	if trade.Id == "" {
+		return trade, fmt.Errorf("missing id")
+	}
+	if trade.Name == "" {
+		trade.Name = trade.Id
+	}
+	if trade.Section == "" {
+		trade.Section = SectionA
+	}
+	if !trade.Section.Known() {
+		return trade, fmt.Errorf("invalid section %q", trade.Section)
+	}
+	if !trade.Side.Known() {
+		return trade, fmt.Errorf("invalid side %q", trade.Side)
+	}
+	return trade, nil
+}
+
+// Writes transactions as CSV that ReadTransactions reads, like to keep the trades of the API for later years.
+// The fees must be in the currency of the price.
+func WriteTransactions(w io.Writer, trades []Transaction) error {
+	writer := csv.NewWriter(w)
+	writer.Write(transactionColumns)
+	for _, trade := range trades {
+		writer.Write([]string{
+			string(trade.Date),
+			trade.Id,
+			trade.Name,
+			trade.Section.String(),
+			trade.Side.String(),
+			trade.Qty.String(),
+			trade.Price.Value.String(),
+			trade.Price.Currency,
+			optional(trade.Fee.Value),
+			optional(trade.Rate),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Writes the rows of the K4 form as CSV
+func WriteK4(w io.Writer, rows []Row) error {
+	writer := csv.NewWriter(w)
+	writer.Write(k4Columns)
+	for _, row := range rows {
+		writer.Write([]string{
+			row.Section.String(),
+			row.Qty.String(),
+			row.Name,
+			row.Proceeds.String(),
+			row.Cost.String(),
+			optional(row.Gain),
+			optional(row.Loss),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Returns the decimal as a string, empty when 0
+func optional(d Decimal) string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.String()
+}
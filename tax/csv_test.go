@@ -0,0 +1,61 @@
+package tax
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/denro/nordnet/util/models"
+)
+
+func TestReadTransactions(t *testing.T) {
+	assert := assert.New(t)
+
+	trades, err := ReadTransactions(strings.NewReader(`Date, ID, Side, Qty, Price, Currency, Fee, Rate
+2022-03-01, ERIC B, buy, 100, 80, SEK, 39,
+2023-07-03, AAPL, SELL, 10, 190, usd, , 10.8
+`))
+	assert.NoError(err)
+	assert.Equal([]Transaction{
+		{Date: "2022-03-01", Id: "ERIC B", Name: "ERIC B", Section: SectionA, Side: Buy, Qty: MustParseDecimal("100"),
+			Price: sek("80"), Fee: sek("39")},
+		{Date: "2023-07-03", Id: "AAPL", Name: "AAPL", Section: SectionA, Side: Sell, Qty: MustParseDecimal("10"),
+			Price: usd("190"), Fee: Amount{Currency: "USD"}, Rate: MustParseDecimal("10.8")},
+	}, trades)
+
+	// written transactions are read back
+	var buf bytes.Buffer
+	assert.NoError(WriteTransactions(&buf, trades))
+	read, err := ReadTransactions(&buf)
+	assert.NoError(err)
+	assert.Equal(trades, read)
+
+	for input, msg := range map[string]string{
+		"date,id,side,qty,price\n":                                              `missing column "currency"`,
+		"date,id,side,qty,price,currency\n2022-13-01,X,BUY,1,1,SEK\n":           `line 2: invalid date "2022-13-01"`,
+		"date,id,side,qty,price,currency\n2022-03-01,X,BUY,one,1,SEK\n":         `line 2: invalid qty "one"`,
+		"date,id,side,qty,price,currency\n2022-03-01,X,HOLD,1,1,SEK\n":          `line 2: invalid side "HOLD"`,
+		"date,id,side,qty,price,currency,section\n2022-03-01,X,BUY,1,1,SEK,B\n": `line 2: invalid section "B"`,
+	} {
+		_, err := ReadTransactions(strings.NewReader(input))
+		assert.EqualError(err, msg, input)
+	}
+}
+
+func TestWriteK4(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	assert.NoError(WriteK4(&buf, []Row{
+		{Section: SectionA, Qty: MustParseDecimal("60"), Name: "ERIC B", Proceeds: MustParseDecimal("6561"),
+			Cost: MustParseDecimal("5231"), Gain: MustParseDecimal("1330")},
+		{Section: SectionC, Qty: MustParseDecimal("1"), Name: "Obligation, 2025", Proceeds: MustParseDecimal("990"),
+			Cost: MustParseDecimal("1000"), Loss: MustParseDecimal("10")},
+	}))
+	assert.Equal(`Sektion,Antal,Beteckning,Försäljningspris,Omkostnadsbelopp,Vinst,Förlust
+A,60,ERIC B,6561,5231,1330,
+C,1,"Obligation, 2025",990,1000,,10
+`, buf.String())
+}
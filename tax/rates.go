@@ -0,0 +1,67 @@
+package tax
+
+import (
+	"fmt"
+	"sort"
+
+	. "github.com/denro/nordnet/util/models"
+)
+
+// RateSource provides the exchange rates of past days
+type RateSource interface {
+	// Returns the SEK paid for one unit of the currency on the day
+	Rate(currency string, day Date) (Decimal, error)
+}
+
+// RateError is returned when there is no exchange rate for a currency on a day
+type RateError struct {
+	Currency string
+	Day      Date
+}
+
+// RateError implements the error interface
+func (e *RateError) Error() string {
+	return fmt.Sprintf("no exchange rate for %s on %s", e.Currency, e.Day)
+}
+
+// DailyRates is a RateSource of the rates of a table, like the daily rates published by the central bank.
+// Days without a rate, like weekends and holidays, take the rate of the closest day before them.
+type DailyRates struct {
+	days  map[string][]Date
+	rates map[string]map[Date]Decimal
+}
+
+// Constructor function for an empty table of rates.
+func NewDailyRates() *DailyRates {
+	return &DailyRates{days: map[string][]Date{}, rates: map[string]map[Date]Decimal{}}
+}
+
+// Sets the SEK paid for one unit of the currency on the day
+func (r *DailyRates) Set(currency string, day Date, rate Decimal) {
+	if r.rates[currency] == nil {
+		r.rates[currency] = map[Date]Decimal{}
+	}
+	if _, ok := r.rates[currency][day]; !ok {
+		days := r.days[currency]
+		i := sort.Search(len(days), func(i int) bool { return days[i] > day })
+		days = append(days, "")
+		copy(days[i+1:], days[i:])
+		days[i] = day
+		r.days[currency] = days
+	}
+	r.rates[currency][day] = rate
+}
+
+// DailyRates implements the RateSource interface
+func (r *DailyRates) Rate(currency string, day Date) (Decimal, error) {
+	if currency == "SEK" {
+		return NewDecimal(1, 0), nil
+	}
+
+	days := r.days[currency]
+	i := sort.Search(len(days), func(i int) bool { return days[i] > day })
+	if i == 0 {
+		return Decimal{}, &RateError{currency, day}
+	}
+	return r.rates[currency][days[i-1]], nil
+}
@@ -0,0 +1,325 @@
+// Package tax rebuilds the realised gains of a trade history for the Swedish K4 form.
+//
+// An Engine books trades with the average cost method (genomsnittsmetoden): the cost of every security
+// is the total paid for the shares held including fees, and a sale is charged the average cost of the
+// shares sold. All amounts are converted to SEK at the rate of the trade date. The sales of a year are
+// summed per security into the rows of sections A, C and D of the form and written as CSV.
+//
+// The API only returns the trades of the last days, so the history of earlier years is imported from CSV
+// and the trades of the API are converted with NewTransaction.
+package tax
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	. "github.com/denro/nordnet/util/models"
+)
+
+// Decimals kept of the costs in SEK
+const costDecimals = 8
+
+// Section of the K4 form
+type Section string
+
+const (
+	// Listed shares and share-like securities, like funds and derivatives
+	SectionA Section = "A"
+	// Listed receivables in SEK, like bonds
+	SectionC Section = "C"
+	// Other securities, like receivables in other currencies
+	SectionD Section = "D"
+)
+
+// Section implements the Stringer interface
+func (s Section) String() string { return string(s) }
+
+// Returns true for the sections of the K4 form supported by the package
+func (s Section) Known() bool { return s == SectionA || s == SectionC || s == SectionD }
+
+// Returns the section of the K4 form the sales of an instrument are reported in. Bonds are receivables,
+// reported in section C when in SEK and section D otherwise, all other instruments in section A. The
+// instrument types do not tell interest funds from other funds, set the Section of their transactions
+// to C.
+func SectionOf(instrument Instrument) Section {
+	if instrument.InstrumentType != InstrumentBond {
+		return SectionA
+	}
+	if instrument.Currency == "SEK" {
+		return SectionC
+	}
+	return SectionD
+}
+
+// A trade in the tax history, named apart from the trades of the API
+type Transaction struct {
+	Date Date
+
+	// Identifies the security, all trades with the same id share one average cost. Usually the ISIN.
+	Id      string
+	Name    string
+	Section Section
+
+	Side  Side
+	Qty   Decimal
+	Price Amount
+
+	// Brokerage and other costs of the trade, added to the cost of buys and deducted from the proceeds of sells
+	Fee Amount
+
+	// SEK per unit of the currency of the price, the rate of the trade date is looked up when 0
+	Rate Decimal
+}
+
+// Returns the transaction of a trade of the API in an instrument. The trades of the API carry no fees.
+func NewTransaction(trade Trade, instrument Instrument) Transaction {
+	id := instrument.IsinCode
+	if id == "" {
+		id = trade.Key().String()
+	}
+	name := instrument.Name
+	if name == "" {
+		name = instrument.Symbol
+	}
+
+	return Transaction{
+		Date:    NewDate(trade.Tradetime.Time()),
+		Id:      id,
+		Name:    name,
+		Section: SectionOf(instrument),
+		Side:    trade.Side,
+		Qty:     NewDecimalFromFloat(trade.Volume),
+		Price:   trade.Price,
+	}
+}
+
+// A sale with its proceeds and cost in SEK
+type Sale struct {
+	Date    Date
+	Id      string
+	Name    string
+	Section Section
+	Qty     Decimal
+
+	// Received for the shares less the fees
+	Proceeds Decimal
+	// The average cost of the shares sold (omkostnadsbelopp)
+	Cost Decimal
+}
+
+// Returns the gain of the sale, negative for losses
+func (s Sale) Gain() Decimal {
+	return s.Proceeds.Sub(s.Cost)
+}
+
+// OversoldError is returned when a sale is larger than the shares held, like when the history is incomplete
+type OversoldError struct {
+	Transaction Transaction
+	Held        Decimal
+}
+
+// OversoldError implements the error interface
+func (e *OversoldError) Error() string {
+	return fmt.Sprintf("sale of %s %s on %s exceeds the %s held", e.Transaction.Qty, e.Transaction.Id, e.Transaction.Date, e.Held)
+}
+
+// The shares held of a security and their total cost in SEK
+type holding struct {
+	qty  Decimal
+	cost Decimal
+}
+
+// Engine books trades with the average cost method and collects the sales.
+type Engine struct {
+	// Converts the amounts in other currencies than SEK on the trade date, when the trades carry no rate
+	Rates RateSource
+
+	holdings map[string]*holding
+	sales    []Sale
+	last     Date
+}
+
+// Constructor function for an engine converting amounts with the rates.
+func New(rates RateSource) *Engine {
+	return &Engine{Rates: rates, holdings: map[string]*holding{}}
+}
+
+// Books trades in the order of their dates. Trades of the same date keep their order, so the history must
+// be added from the oldest trades and trades dated before the trades already added are refused. Nothing is
+// booked when an error is returned.
+func (e *Engine) Add(trades ...Transaction) error {
+	trades = append([]Transaction(nil), trades...)
+	sort.SliceStable(trades, func(i, j int) bool { return trades[i].Date < trades[j].Date })
+	if len(trades) > 0 && trades[0].Date < e.last {
+		return fmt.Errorf("trade of %s on %s is before the trades already added", trades[0].Id, trades[0].Date)
+	}
+
+	// book on copies, so a failing trade leaves the engine as it was
+	holdings := map[string]*holding{}
+	for id, h := range e.holdings {
+		held := *h
+		holdings[id] = &held
+	}
+	var sales []Sale
+	for _, trade := range trades {
+		sale, err := e.book(holdings, trade)
+		if err != nil {
+			return err
+		}
+		if sale != nil {
+			sales = append(sales, *sale)
+		}
+	}
+
+	e.holdings = holdings
+	e.sales = append(e.sales, sales...)
+	if len(trades) > 0 {
+		e.last = trades[len(trades)-1].Date
+	}
+	return nil
+}
+
+// Books a trade on the holdings and returns the sale of sells
+func (e *Engine) book(holdings map[string]*holding, trade Transaction) (*Sale, error) {
+	if !trade.Side.Known() {
+		return nil, fmt.Errorf("trade of %s on %s has unknown side %q", trade.Id, trade.Date, trade.Side)
+	}
+	if trade.Qty.Sign() <= 0 {
+		return nil, fmt.Errorf("trade of %s on %s has no quantity", trade.Id, trade.Date)
+	}
+
+	value, err := e.sek(trade.Price, trade)
+	if err != nil {
+		return nil, err
+	}
+	fee, err := e.sek(trade.Fee, trade)
+	if err != nil {
+		return nil, err
+	}
+	value = value.Mul(trade.Qty)
+
+	h, ok := holdings[trade.Id]
+	if !ok {
+		h = &holding{}
+		holdings[trade.Id] = h
+	}
+
+	if trade.Side.IsBuy() {
+		h.qty = h.qty.Add(trade.Qty)
+		h.cost = h.cost.Add(value).Add(fee)
+		return nil, nil
+	}
+
+	if trade.Qty.Cmp(h.qty) > 0 {
+		return nil, &OversoldError{trade, h.qty}
+	}
+	cost := h.cost.Mul(trade.Qty).Div(h.qty, costDecimals)
+	h.qty = h.qty.Sub(trade.Qty)
+	h.cost = h.cost.Sub(cost)
+	if h.qty.IsZero() {
+		h.cost = Decimal{}
+	}
+
+	return &Sale{
+		Date:     trade.Date,
+		Id:       trade.Id,
+		Name:     trade.Name,
+		Section:  trade.Section,
+		Qty:      trade.Qty,
+		Proceeds: value.Sub(fee),
+		Cost:     cost,
+	}, nil
+}
+
+// Converts an amount of a trade to SEK
+func (e *Engine) sek(amount Amount, trade Transaction) (Decimal, error) {
+	if amount.Value.IsZero() || amount.Currency == "SEK" {
+		return amount.Value, nil
+	}
+	if amount.Currency == trade.Price.Currency && !trade.Rate.IsZero() {
+		return amount.Value.Mul(trade.Rate), nil
+	}
+	if e.Rates == nil {
+		return Decimal{}, &RateError{amount.Currency, trade.Date}
+	}
+	rate, err := e.Rates.Rate(amount.Currency, trade.Date)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return amount.Value.Mul(rate), nil
+}
+
+// Returns the shares held of a security and their average cost in SEK
+func (e *Engine) Holding(id string) (qty, price Decimal) {
+	h, ok := e.holdings[id]
+	if !ok || h.qty.IsZero() {
+		return
+	}
+	return h.qty, h.cost.Div(h.qty, costDecimals)
+}
+
+// Returns the sales of a year, all sales when the year is 0
+func (e *Engine) Sales(year int) []Sale {
+	prefix := ""
+	if year != 0 {
+		prefix = fmt.Sprintf("%04d-", year)
+	}
+
+	var res []Sale
+	for _, sale := range e.sales {
+		if strings.HasPrefix(string(sale.Date), prefix) {
+			res = append(res, sale)
+		}
+	}
+	return res
+}
+
+// A row of the K4 form, the amounts are whole SEK
+type Row struct {
+	Section  Section
+	Qty      Decimal
+	Name     string
+	Proceeds Decimal
+	Cost     Decimal
+	Gain     Decimal
+	Loss     Decimal
+}
+
+// Sums the sales per section and security into the rows of the K4 form, in the order of the sections and
+// then of the first sale of each security.
+func K4(sales []Sale) []Row {
+	type key struct {
+		section Section
+		id      string
+	}
+	rows := map[key]*Row{}
+	var order []key
+	for _, sale := range sales {
+		k := key{sale.Section, sale.Id}
+		row, ok := rows[k]
+		if !ok {
+			row = &Row{Section: sale.Section, Name: sale.Name}
+			rows[k] = row
+			order = append(order, k)
+		}
+		row.Qty = row.Qty.Add(sale.Qty)
+		row.Proceeds = row.Proceeds.Add(sale.Proceeds)
+		row.Cost = row.Cost.Add(sale.Cost)
+	}
+	sort.SliceStable(order, func(i, j int) bool { return order[i].section < order[j].section })
+
+	var res []Row
+	for _, k := range order {
+		row := rows[k]
+		row.Proceeds = row.Proceeds.Round(0)
+		row.Cost = row.Cost.Round(0)
+		if gain := row.Proceeds.Sub(row.Cost); gain.Sign() >= 0 {
+			row.Gain = gain
+		} else {
+			row.Loss = gain.Neg()
+		}
+		res = append(res, *row)
+	}
+	return res
+}
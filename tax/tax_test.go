@@ -0,0 +1,138 @@
+package tax
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/denro/nordnet/util/models"
+)
+
+func sek(s string) Amount { return Amount{Value: MustParseDecimal(s), Currency: "SEK"} }
+func usd(s string) Amount { return Amount{Value: MustParseDecimal(s), Currency: "USD"} }
+
+func transaction(date, id string, side Side, qty string, price, fee Amount) Transaction {
+	return Transaction{Date: Date(date), Id: id, Name: id, Section: SectionA, Side: side, Qty: MustParseDecimal(qty), Price: price, Fee: fee}
+}
+
+var history = []Transaction{
+	transaction("2022-03-01", "ERIC B", Buy, "100", sek("80"), sek("39")),
+	// the rate of the friday before the trade is used
+	transaction("2023-01-02", "AAPL", Buy, "10", usd("150"), Amount{}),
+	transaction("2023-05-10", "ERIC B", Buy, "50", sek("100"), sek("39")),
+	transaction("2023-06-01", "ERIC B", Sell, "60", sek("110"), sek("39")),
+	transaction("2024-02-01", "ERIC B", Sell, "90", sek("120"), sek("39")),
+}
+
+func newRates() *DailyRates {
+	rates := NewDailyRates()
+	rates.Set("USD", "2022-12-30", MustParseDecimal("10.4"))
+	rates.Set("USD", "2022-12-29", MustParseDecimal("10.5"))
+	return rates
+}
+
+func TestEngine(t *testing.T) {
+	assert := assert.New(t)
+
+	e := New(newRates())
+	assert.NoError(e.Add(history...))
+
+	aapl := transaction("2023-07-03", "AAPL", Sell, "10", usd("190"), Amount{})
+	aapl.Rate = MustParseDecimal("10.8")
+	bond := Transaction{Date: "2023-02-01", Id: "SE0001", Name: "Obligation", Section: SectionC, Side: Buy, Qty: MustParseDecimal("1"), Price: sek("1000")}
+	assert.EqualError(e.Add(bond), "trade of SE0001 on 2023-02-01 is before the trades already added")
+
+	e = New(newRates())
+	assert.NoError(e.Add(history[:2]...))
+	assert.NoError(e.Add(bond))
+	sold := bond
+	sold.Date, sold.Side, sold.Price = "2023-08-01", Sell, sek("990")
+	// trades are booked in the order of their dates
+	assert.NoError(e.Add(sold, aapl, history[3], history[2]))
+
+	qty, price := e.Holding("ERIC B")
+	assert.Equal(MustParseDecimal("90"), qty)
+	// 100 at 80.39 and 50 at 100.78 average 87.18666667
+	assert.Equal(MustParseDecimal("87.18666667"), price)
+
+	assert.NoError(e.Add(history[4]))
+
+	assert.Equal([]Sale{
+		{Date: "2023-06-01", Id: "ERIC B", Name: "ERIC B", Section: SectionA, Qty: MustParseDecimal("60"),
+			Proceeds: MustParseDecimal("6561"), Cost: MustParseDecimal("5231.2")},
+		{Date: "2023-07-03", Id: "AAPL", Name: "AAPL", Section: SectionA, Qty: MustParseDecimal("10"),
+			Proceeds: MustParseDecimal("20520"), Cost: MustParseDecimal("15600")},
+		{Date: "2023-08-01", Id: "SE0001", Name: "Obligation", Section: SectionC, Qty: MustParseDecimal("1"),
+			Proceeds: MustParseDecimal("990"), Cost: MustParseDecimal("1000")},
+	}, e.Sales(2023))
+	if sales := e.Sales(2024); assert.Len(sales, 1) {
+		assert.Equal(MustParseDecimal("10761"), sales[0].Proceeds)
+		assert.Equal(MustParseDecimal("7846.8"), sales[0].Cost)
+		assert.Equal(MustParseDecimal("2914.2"), sales[0].Gain())
+	}
+	assert.Len(e.Sales(0), 4)
+
+	qty, _ = e.Holding("ERIC B")
+	assert.True(qty.IsZero())
+
+	assert.Equal([]Row{
+		{Section: SectionA, Qty: MustParseDecimal("60"), Name: "ERIC B", Proceeds: MustParseDecimal("6561"),
+			Cost: MustParseDecimal("5231"), Gain: MustParseDecimal("1330")},
+		{Section: SectionA, Qty: MustParseDecimal("10"), Name: "AAPL", Proceeds: MustParseDecimal("20520"),
+			Cost: MustParseDecimal("15600"), Gain: MustParseDecimal("4920")},
+		{Section: SectionC, Qty: MustParseDecimal("1"), Name: "Obligation", Proceeds: MustParseDecimal("990"),
+			Cost: MustParseDecimal("1000"), Loss: MustParseDecimal("10")},
+	}, K4(e.Sales(2023)))
+}
+
+func TestEngineErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	e := New(nil)
+	assert.NoError(e.Add(history[0]))
+
+	// nothing is booked when a trade fails
+	err := e.Add(
+		transaction("2022-04-01", "ERIC B", Sell, "50", sek("90"), Amount{}),
+		transaction("2022-04-02", "ERIC B", Sell, "60", sek("90"), Amount{}),
+	)
+	if assert.IsType(&OversoldError{}, err) {
+		assert.EqualError(err, "sale of 60 ERIC B on 2022-04-02 exceeds the 50 held")
+	}
+	qty, _ := e.Holding("ERIC B")
+	assert.Equal(MustParseDecimal("100"), qty)
+	assert.Empty(e.Sales(0))
+
+	err = e.Add(transaction("2022-04-01", "AAPL", Buy, "1", usd("150"), Amount{}))
+	assert.Equal(&RateError{"USD", "2022-04-01"}, err)
+
+	e.Rates = newRates()
+	_, err = e.Rates.Rate("USD", "2022-12-28")
+	assert.EqualError(err, "no exchange rate for USD on 2022-12-28")
+
+	assert.Error(e.Add(transaction("2022-04-01", "ERIC B", "", "1", sek("90"), Amount{})))
+	assert.Error(e.Add(transaction("2022-04-01", "ERIC B", Buy, "0", sek("90"), Amount{})))
+}
+
+func TestNewTransaction(t *testing.T) {
+	assert := assert.New(t)
+
+	trade := Trade{
+		Tradable:  TradableId{Identifier: "101", MarketId: 11},
+		Price:     sek("88"),
+		Volume:    30,
+		Side:      Sell,
+		Tradetime: Timestamp(1458292200000), // 2016-03-18 10:10 in Stockholm
+	}
+	ericB := Instrument{Symbol: "ERIC B", Name: "Ericsson B", IsinCode: "SE0000108656", Currency: "SEK", InstrumentType: InstrumentShare}
+	assert.Equal(Transaction{Date: "2016-03-18", Id: "SE0000108656", Name: "Ericsson B", Section: SectionA, Side: Sell,
+		Qty: MustParseDecimal("30"), Price: sek("88")}, NewTransaction(trade, ericB))
+
+	tx := NewTransaction(trade, Instrument{Symbol: "OBL", Currency: "EUR", InstrumentType: InstrumentBond})
+	assert.Equal("11:101", tx.Id)
+	assert.Equal("OBL", tx.Name)
+	assert.Equal(SectionD, tx.Section)
+	assert.Equal(SectionC, SectionOf(Instrument{Currency: "SEK", InstrumentType: InstrumentBond}))
+	assert.Equal(SectionD, SectionOf(Instrument{Currency: "USD", InstrumentType: InstrumentBond}))
+	assert.Equal(SectionA, SectionOf(Instrument{Currency: "EUR", InstrumentType: InstrumentFund}))
+}
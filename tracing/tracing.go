@@ -0,0 +1,359 @@
+// Package tracing creates OpenTelemetry spans for API requests and follows orders through the private feed.
+//
+// Every request performed by an instrumented APIClient gets a span, started within the context given to
+// PerformContext and propagated to the API in the headers of the request. Entering an order starts a trace
+// for the order, the requests modifying the order and the order and trade messages on the private feed
+// are added to the same trace using the order id, or the reference until the order id is known.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+)
+
+// Name of the instrumentation library used when creating the tracer
+const InstrumentationName = "github.com/denro/nordnet/tracing"
+
+// Attribute keys set on the spans
+const (
+	MethodKey      = attribute.Key("http.request.method")
+	StatusCodeKey  = attribute.Key("http.response.status_code")
+	EndpointKey    = attribute.Key("nordnet.endpoint")
+	ErrorCodeKey   = attribute.Key("nordnet.error_code")
+	AccountKey     = attribute.Key("nordnet.accno")
+	OrderIdKey     = attribute.Key("nordnet.order_id")
+	ReferenceKey   = attribute.Key("nordnet.reference")
+	OrderStateKey  = attribute.Key("nordnet.order_state")
+	ActionStateKey = attribute.Key("nordnet.action_state")
+	TradeIdKey     = attribute.Key("nordnet.trade_id")
+	PriceKey       = attribute.Key("nordnet.price")
+	VolumeKey      = attribute.Key("nordnet.volume")
+	SideKey        = attribute.Key("nordnet.side")
+)
+
+// Number of finished orders remembered for trades arriving after the final order message
+const finishedOrders = 1000
+
+// Age after which the traces of orders never seen finishing are ended
+const DefaultMaxOrderAge = 24 * time.Hour
+
+var orderPath = regexp.MustCompile(`^accounts/(\d+)/orders(?:/(\d+)(?:/activate)?)?$`)
+
+type orderTrace struct {
+	span    trace.Span
+	started time.Time
+	ended   bool
+}
+
+type request struct {
+	ctx     context.Context
+	span    trace.Span
+	created *orderTrace
+}
+
+// Tracer creates the spans, it is safe for concurrent use.
+type Tracer struct {
+	// Injects the trace into the headers of the requests, the global propagator of otel by default
+	Propagator propagation.TextMapPropagator
+
+	// Order traces still open after this age are ended and forgotten, like orders whose final
+	// message was missed or when the private feed is not instrumented. Defaults to DefaultMaxOrderAge.
+	MaxOrderAge time.Duration
+
+	tracer     trace.Tracer
+	requests   map[*api.RequestInfo]*request
+	orders     map[int64]*orderTrace
+	references map[string]*orderTrace
+	finished   []int64
+	now        func() time.Time
+
+	sync.Mutex
+}
+
+// Constructor function taking the provider used to create spans, a no-op provider is used when nil.
+func New(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = noop.NewTracerProvider()
+	}
+	return &Tracer{
+		Propagator:  otel.GetTextMapPropagator(),
+		MaxOrderAge: DefaultMaxOrderAge,
+		tracer:      provider.Tracer(InstrumentationName),
+		requests:    map[*api.RequestInfo]*request{},
+		orders:      map[int64]*orderTrace{},
+		references:  map[string]*orderTrace{},
+		now:         time.Now,
+	}
+}
+
+// Creates a span for every request performed by the client. The span is started by a middleware from the
+// context of the request and the trace is injected into the headers of the request with the Propagator.
+func (t *Tracer) InstrumentClient(c *api.APIClient) {
+	c.Use(t.middleware)
+	c.AddHook(t.ObserveRequest)
+}
+
+// Adds the order and trade messages received on the private feed to the order traces.
+func (t *Tracer) InstrumentPrivateFeed(f *feed.Feed) {
+	f.AddHook(func(e *feed.Event) {
+		if msg, ok := e.Msg.(*feed.PrivateMsg); ok {
+			t.ObservePrivateMsg(msg)
+		}
+	})
+}
+
+// Starts the span of the requests performed by an APIClient, the span is ended by ObserveRequest
+func (t *Tracer) middleware(next http.RoundTripper) http.RoundTripper {
+	return api.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		info := api.RequestInfoFrom(req.Context())
+		if info == nil {
+			return next.RoundTrip(req)
+		}
+
+		t.Lock()
+		r, ok := t.requests[info]
+		t.Unlock()
+		// redirects are sent within the span of the first request
+		if !ok {
+			r = t.startRequest(req.Context(), info)
+			t.Lock()
+			t.requests[info] = r
+			t.Unlock()
+		}
+
+		req = req.Clone(r.ctx)
+		t.Propagator.Inject(r.ctx, propagation.HeaderCarrier(req.Header))
+		return next.RoundTrip(req)
+	})
+}
+
+// Ends the span of a performed request, used as an api.Hook. The span is created when the request was
+// not sent through the middleware of InstrumentClient.
+func (t *Tracer) ObserveRequest(info *api.RequestInfo) {
+	t.Lock()
+	r, ok := t.requests[info]
+	delete(t.requests, info)
+	t.Unlock()
+	if !ok {
+		r = t.startRequest(context.Background(), info)
+	}
+
+	if info.StatusCode != 0 {
+		r.span.SetAttributes(StatusCodeKey.Int(info.StatusCode))
+	}
+	if info.APIError != nil {
+		r.span.SetAttributes(ErrorCodeKey.String(info.APIError.Code))
+	}
+	if info.Err != nil {
+		r.span.RecordError(info.Err)
+		r.span.SetStatus(codes.Error, info.Err.Error())
+	}
+	end := info.Start.Add(info.Duration)
+	r.span.End(trace.WithTimestamp(end))
+
+	created := r.created
+	if created == nil {
+		return
+	}
+
+	reply, ok := info.Result.(*OrderReply)
+	if info.Err != nil || !ok {
+		// without a response the order may still have been entered, keep the trace open when
+		// the order can be matched by its reference on the private feed
+		if info.APIError != nil || referenceOf(info) == "" {
+			created.span.SetStatus(codes.Error, "order entry failed")
+			t.finish(0, referenceOf(info), created, end)
+		}
+		return
+	}
+
+	created.span.SetAttributes(OrderIdKey.Int64(reply.OrderId))
+	t.Lock()
+	t.orders[reply.OrderId] = created
+	t.Unlock()
+
+	if reply.OrderState.IsTerminal() {
+		t.finish(reply.OrderId, referenceOf(info), created, end)
+	}
+}
+
+// Starts the span of a request within the context, the span is a child of the root span of the order the
+// request enters or modifies while the context of the request is kept
+func (t *Tracer) startRequest(ctx context.Context, info *api.RequestInfo) *request {
+	attrs := []attribute.KeyValue{MethodKey.String(info.Method), EndpointKey.String(info.Endpoint)}
+
+	var created *orderTrace
+	if m := orderPath.FindStringSubmatch(info.Path); m != nil {
+		accno, _ := strconv.ParseInt(m[1], 10, 64)
+		attrs = append(attrs, AccountKey.Int64(accno))
+
+		if m[2] != "" {
+			orderId, _ := strconv.ParseInt(m[2], 10, 64)
+			attrs = append(attrs, OrderIdKey.Int64(orderId))
+			if order := t.order(orderId, ""); order != nil {
+				ctx = trace.ContextWithSpan(ctx, order.span)
+			}
+		} else if info.Method == "POST" {
+			created = t.startOrder(ctx, info, accno)
+			ctx = trace.ContextWithSpan(ctx, created.span)
+		}
+	}
+
+	ctx, span := t.tracer.Start(ctx, info.Method+" "+info.Endpoint,
+		trace.WithTimestamp(info.Start),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+	return &request{ctx, span, created}
+}
+
+// Adds an order or trade message from the private feed to the trace of the order.
+func (t *Tracer) ObservePrivateMsg(msg *feed.PrivateMsg) {
+	now := time.Now()
+
+	switch data := msg.Data.(type) {
+	case feed.PrivateOrder:
+		order := t.order(data.OrderId, data.Reference)
+		if order == nil {
+			return
+		}
+		_, span := t.tracer.Start(trace.ContextWithSpan(context.Background(), order.span), "nordnet.order.update", trace.WithTimestamp(now), trace.WithAttributes(
+			OrderIdKey.Int64(data.OrderId),
+			OrderStateKey.String(data.OrderState.String()),
+			ActionStateKey.String(data.ActionState.String()),
+			VolumeKey.Float64(data.TradedVolume),
+		))
+		span.End(trace.WithTimestamp(now))
+
+		if data.OrderState.IsTerminal() {
+			order.span.SetAttributes(OrderStateKey.String(data.OrderState.String()))
+			t.finish(data.OrderId, data.Reference, order, now)
+		}
+	case feed.PrivateTrade:
+		order := t.order(data.OrderId, "")
+		if order == nil {
+			return
+		}
+		_, span := t.tracer.Start(trace.ContextWithSpan(context.Background(), order.span), "nordnet.trade", trace.WithTimestamp(now), trace.WithAttributes(
+			OrderIdKey.Int64(data.OrderId),
+			TradeIdKey.String(data.TradeId),
+			PriceKey.Float64(data.Price.Float64()),
+			VolumeKey.Float64(data.Volume),
+			SideKey.String(data.Side.String()),
+		))
+		span.End(trace.WithTimestamp(now))
+	}
+}
+
+// Starts the root span of an order trace within the context of the request entering the order
+func (t *Tracer) startOrder(ctx context.Context, info *api.RequestInfo, accno int64) *orderTrace {
+	attrs := []attribute.KeyValue{AccountKey.Int64(accno)}
+	reference := referenceOf(info)
+	if reference != "" {
+		attrs = append(attrs, ReferenceKey.String(reference))
+	}
+
+	_, span := t.tracer.Start(ctx, "nordnet.order", trace.WithTimestamp(info.Start), trace.WithAttributes(attrs...))
+	order := &orderTrace{span: span, started: info.Start}
+
+	t.Lock()
+	defer t.Unlock()
+	t.evict()
+	if reference != "" {
+		t.references[reference] = order
+	}
+	return order
+}
+
+// Ends and forgets the order traces older than MaxOrderAge that are still open
+func (t *Tracer) evict() {
+	now := t.now()
+	stale := func(order *orderTrace) bool {
+		return !order.ended && now.Sub(order.started) > t.MaxOrderAge
+	}
+	var expired []*orderTrace
+	for reference, order := range t.references {
+		if stale(order) {
+			delete(t.references, reference)
+			expired = append(expired, order)
+		}
+	}
+	for orderId, order := range t.orders {
+		if stale(order) {
+			delete(t.orders, orderId)
+			expired = append(expired, order)
+		}
+	}
+	for _, order := range expired {
+		if !order.ended {
+			order.ended = true
+			order.span.AddEvent("expired")
+			order.span.End(trace.WithTimestamp(now))
+		}
+	}
+}
+
+// Looks up an order trace by id or reference
+func (t *Tracer) order(orderId int64, reference string) *orderTrace {
+	t.Lock()
+	defer t.Unlock()
+
+	if order, ok := t.orders[orderId]; ok {
+		return order
+	}
+	if order, ok := t.references[reference]; ok && reference != "" {
+		if orderId != 0 {
+			order.span.SetAttributes(OrderIdKey.Int64(orderId))
+			t.orders[orderId] = order
+		}
+		return order
+	}
+	return nil
+}
+
+// Ends the root span of an order, the order is remembered for late trade messages
+func (t *Tracer) finish(orderId int64, reference string, order *orderTrace, at time.Time) {
+	t.Lock()
+	defer t.Unlock()
+
+	if reference != "" && t.references[reference] == order {
+		delete(t.references, reference)
+	}
+	if orderId == 0 {
+		order.ended = true
+		order.span.End(trace.WithTimestamp(at))
+		return
+	}
+	if order.ended {
+		return
+	}
+
+	order.ended = true
+	order.span.End(trace.WithTimestamp(at))
+	t.finished = append(t.finished, orderId)
+	if len(t.finished) > finishedOrders {
+		delete(t.orders, t.finished[0])
+		t.finished = t.finished[1:]
+	}
+}
+
+func referenceOf(info *api.RequestInfo) string {
+	if info.Request == nil {
+		return ""
+	}
+	return info.Request.URL.Query().Get("reference")
+}
@@ -0,0 +1,258 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+)
+
+type fakeConnection struct {
+	*bytes.Buffer
+}
+
+func (c *fakeConnection) Close() error {
+	return nil
+}
+
+func setup(handler http.HandlerFunc) (*Tracer, *api.APIClient, *tracetest.InMemoryExporter, *httptest.Server) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := New(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	ts := httptest.NewServer(handler)
+	client := &api.APIClient{URL: ts.URL, Service: api.NNSERVICE, Version: api.NNAPIVERSION}
+	tracer.InstrumentClient(client)
+
+	return tracer, client, exporter, ts
+}
+
+func find(spans tracetest.SpanStubs, name string) *tracetest.SpanStub {
+	for i := range spans {
+		if spans[i].Name == name {
+			return &spans[i]
+		}
+	}
+	return nil
+}
+
+func value(span *tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestRequestSpan(t *testing.T) {
+	_, client, exporter, ts := setup(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		w.Write([]byte(`{"code": "NOT_FOUND", "message": "not found"}`))
+	})
+	defer ts.Close()
+
+	client.Account(1)
+
+	assert := assert.New(t)
+	spans := exporter.GetSpans()
+	if assert.Len(spans, 1) {
+		span := &spans[0]
+		assert.Equal("GET accounts/:id", span.Name)
+		assert.Equal("accounts/:id", value(span, EndpointKey).AsString())
+		assert.Equal("GET", value(span, MethodKey).AsString())
+		assert.EqualValues(404, value(span, StatusCodeKey).AsInt64())
+		assert.Equal("NOT_FOUND", value(span, ErrorCodeKey).AsString())
+		assert.Equal(codes.Error, span.Status.Code)
+		assert.False(span.Parent.IsValid())
+	}
+}
+
+func TestOrderTrace(t *testing.T) {
+	tracer, client, exporter, ts := setup(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			w.Write([]byte(`{"order_id": 5, "result_code": "OK", "order_state": "ON_MARKET", "action_state": "INS_CONF"}`))
+		case "PUT":
+			w.Write([]byte(`{"order_id": 5, "result_code": "OK", "order_state": "ON_MARKET", "action_state": "MOD_CONF"}`))
+		}
+	})
+	defer ts.Close()
+
+	b := &fakeConnection{&bytes.Buffer{}}
+	f := feed.NewFeed(b)
+	tracer.InstrumentPrivateFeed(f)
+	pf := &feed.PrivateFeed{Feed: f}
+
+	client.CreateOrder(1, &api.Params{"reference": "ref-1", "volume": "10"})
+	client.UpdateOrder(1, 5, &api.Params{"volume": "20"})
+	client.Account(1)
+
+	b.WriteString(`{"type": "trade", "data": {"accno": 1, "order_id": 5, "trade_id": "t1", "price": {"value": 100}, "volume": 20, "side": "BUY"}}` + "\n")
+	b.WriteString(`{"type": "order", "data": {"accno": 1, "order_id": 5, "reference": "ref-1", "order_state": "DONE", "action_state": "INS_CONF", "traded_volume": 20}}` + "\n")
+	b.WriteString(`{"type": "order", "data": {"accno": 1, "order_id": 6, "order_state": "DONE"}}` + "\n")
+	msgs := make(chan *feed.PrivateMsg, 10)
+	pf.Dispatch(msgs, make(chan error, 10))
+	for i := 0; i < 3; i++ {
+		<-msgs
+	}
+
+	assert := assert.New(t)
+	spans := exporter.GetSpans()
+	assert.Len(spans, 6)
+
+	root := find(spans, "nordnet.order")
+	if !assert.NotNil(root) {
+		return
+	}
+	assert.False(root.Parent.IsValid())
+	assert.EqualValues(5, value(root, OrderIdKey).AsInt64())
+	assert.Equal("ref-1", value(root, ReferenceKey).AsString())
+	assert.Equal("DONE", value(root, OrderStateKey).AsString())
+
+	for _, name := range []string{"POST accounts/:id/orders", "PUT accounts/:id/orders/:id", "nordnet.trade", "nordnet.order.update"} {
+		span := find(spans, name)
+		if assert.NotNil(span, name) {
+			assert.Equal(root.SpanContext.TraceID(), span.SpanContext.TraceID(), name)
+			assert.Equal(root.SpanContext.SpanID(), span.Parent.SpanID(), name)
+		}
+	}
+	assert.Equal(100.0, value(find(spans, "nordnet.trade"), PriceKey).AsFloat64())
+
+	other := find(spans, "GET accounts/:id")
+	if assert.NotNil(other) {
+		assert.NotEqual(root.SpanContext.TraceID(), other.SpanContext.TraceID())
+	}
+}
+
+func TestOrderTraceByReference(t *testing.T) {
+	tracer, client, exporter, ts := setup(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	defer ts.Close()
+
+	_, err := client.CreateOrder(1, &api.Params{"reference": "ref-2"})
+	assert := assert.New(t)
+	assert.Error(err)
+	assert.Len(exporter.GetSpans(), 1)
+
+	tracer.ObservePrivateMsg(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{OrderId: 7, Reference: "ref-2", OrderState: "ON_MARKET"}})
+	tracer.ObservePrivateMsg(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{OrderId: 7, OrderState: "DELETED"}})
+
+	spans := exporter.GetSpans()
+	assert.Len(spans, 4)
+	if root := find(spans, "nordnet.order"); assert.NotNil(root) {
+		assert.EqualValues(7, value(root, OrderIdKey).AsInt64())
+		assert.Equal("DELETED", value(root, OrderStateKey).AsString())
+	}
+}
+
+func TestFailedOrderEntry(t *testing.T) {
+	_, client, exporter, ts := setup(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+		w.Write([]byte(`{"code": "NEXT_INVALID_ORDER", "message": "fail"}`))
+	})
+	defer ts.Close()
+
+	client.CreateOrder(1, &api.Params{"reference": "ref-3"})
+
+	assert := assert.New(t)
+	spans := exporter.GetSpans()
+	assert.Len(spans, 2)
+	if root := find(spans, "nordnet.order"); assert.NotNil(root) {
+		assert.Equal(codes.Error, root.Status.Code)
+	}
+}
+
+func TestNoopProvider(t *testing.T) {
+	tracer := New(nil)
+	tracer.ObserveRequest(&api.RequestInfo{Method: "POST", Path: "accounts/1/orders", Endpoint: "accounts/:id/orders"})
+	tracer.ObservePrivateMsg(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{OrderId: 1, OrderState: "DONE"}})
+}
+
+func TestRequestContext(t *testing.T) {
+	var header string
+	tracer, client, exporter, ts := setup(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("traceparent")
+		w.Write([]byte(`{"order_id": 8, "result_code": "OK", "order_state": "DONE", "action_state": "INS_CONF"}`))
+	})
+	defer ts.Close()
+	tracer.Propagator = propagation.TraceContext{}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	var reply OrderReply
+	assert := assert.New(t)
+	assert.NoError(client.PerformContext(ctx, "POST", "accounts/1/orders", &api.Params{"reference": "ref-4"}, &reply))
+	parent.End()
+
+	spans := exporter.GetSpans()
+	root, span := find(spans, "nordnet.order"), find(spans, "POST accounts/:id/orders")
+	if assert.NotNil(root) && assert.NotNil(span) {
+		assert.Equal(parent.SpanContext().SpanID(), root.Parent.SpanID())
+		assert.Equal(root.SpanContext.SpanID(), span.Parent.SpanID())
+		assert.Equal(fmt.Sprintf("00-%s-%s-01", span.SpanContext.TraceID(), span.SpanContext.SpanID()), header)
+	}
+}
+
+func TestOrderRequestKeepsContext(t *testing.T) {
+	tracer, client, exporter, ts := setup(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"order_id": 5, "result_code": "OK", "order_state": "ON_MARKET", "action_state": "INS_CONF"}`))
+	})
+	defer ts.Close()
+	tracer.Propagator = propagation.TraceContext{}
+
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(client.PerformContext(ctx, "POST", "accounts/1/orders", &api.Params{"reference": "ref-5"}, &OrderReply{}))
+	cancel()
+
+	// the request on the order is not cancelled with the context of the request entering it
+	_, err := client.DeleteOrder(1, 5)
+	assert.NoError(err)
+
+	tracer.ObservePrivateMsg(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{OrderId: 5, OrderState: "DELETED"}})
+	spans := exporter.GetSpans()
+	root, span := find(spans, "nordnet.order"), find(spans, "DELETE accounts/:id/orders/:id")
+	if assert.NotNil(root) && assert.NotNil(span) {
+		assert.Equal(root.SpanContext.SpanID(), span.Parent.SpanID())
+	}
+}
+
+func TestStaleOrderTraces(t *testing.T) {
+	tracer, client, exporter, ts := setup(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"order_id": 5, "result_code": "OK", "order_state": "ON_MARKET", "action_state": "INS_CONF"}`))
+	})
+	defer ts.Close()
+
+	assert := assert.New(t)
+	client.CreateOrder(1, &api.Params{"reference": "ref-6"})
+	assert.Len(tracer.orders, 1)
+	assert.Len(tracer.references, 1)
+
+	now := time.Now().Add(DefaultMaxOrderAge + time.Minute)
+	tracer.now = func() time.Time { return now }
+	tracer.evict()
+	assert.Empty(tracer.orders)
+	assert.Empty(tracer.references)
+	if root := find(exporter.GetSpans(), "nordnet.order"); assert.NotNil(root) && assert.Len(root.Events, 1) {
+		assert.Equal("expired", root.Events[0].Name)
+	}
+
+	// messages of the forgotten order are ignored
+	tracer.ObservePrivateMsg(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder{OrderId: 5, OrderState: "DONE"}})
+	assert.Len(exporter.GetSpans(), 2)
+}
@@ -0,0 +1,75 @@
+package models
+
+import "fmt"
+
+// CurrencyMismatchError is returned when amounts in different currencies are combined
+type CurrencyMismatchError struct {
+	Currency string
+	Other    string
+}
+
+func (e *CurrencyMismatchError) Error() string {
+	return fmt.Sprintf("currency mismatch: %s and %s", e.Currency, e.Other)
+}
+
+// Returns the currency of the result of combining two amounts. The zero Amount has no currency
+// and combines with any amount, so sums can start from it.
+func (a Amount) currency(b Amount) (string, error) {
+	switch {
+	case a.Currency == b.Currency:
+		return a.Currency, nil
+	case a == Amount{}:
+		return b.Currency, nil
+	case b == Amount{}:
+		return a.Currency, nil
+	}
+	return "", &CurrencyMismatchError{a.Currency, b.Currency}
+}
+
+// Returns a + b, failing with a *CurrencyMismatchError when the currencies differ.
+func (a Amount) Add(b Amount) (Amount, error) {
+	currency, err := a.currency(b)
+	if err != nil {
+		return Amount{}, err
+	}
+	return Amount{a.Value.Add(b.Value), currency}, nil
+}
+
+// Returns a - b, failing with a *CurrencyMismatchError when the currencies differ.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	return a.Add(b.Neg())
+}
+
+// Returns the amount multiplied by a factor, like a price by a quantity
+func (a Amount) Mul(factor Decimal) Amount {
+	return Amount{a.Value.Mul(factor), a.Currency}
+}
+
+// Returns -a
+func (a Amount) Neg() Amount {
+	return Amount{a.Value.Neg(), a.Currency}
+}
+
+// Returns -1, 0 or +1 when a is less than, equal to or greater than b, failing with a
+// *CurrencyMismatchError when the currencies differ.
+func (a Amount) Cmp(b Amount) (int, error) {
+	if _, err := a.currency(b); err != nil {
+		return 0, err
+	}
+	return a.Value.Cmp(b.Value), nil
+}
+
+// Returns the value as the nearest float, for code still working with floats
+func (a Amount) Float64() float64 {
+	return a.Value.Float64()
+}
+
+// Returns the sum of the amounts, failing with a *CurrencyMismatchError when the currencies differ.
+func Sum(amounts ...Amount) (sum Amount, err error) {
+	for _, a := range amounts {
+		if sum, err = sum.Add(a); err != nil {
+			return Amount{}, err
+		}
+	}
+	return
+}
@@ -0,0 +1,336 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal is an exact decimal number for prices and amounts, the zero value is 0.
+//
+// A decimal holds up to 18 significant digits, which covers every price and amount of the API
+// exactly. Results needing more digits, like a price divided by three, are rounded half away
+// from zero. 1.50 and 1.5 are equal decimals, but a decimal read from JSON remembers how it was written,
+// with its trailing zeros and as a number or a string, and is written back the same way. Compare
+// decimals with Cmp or Equal, == and map keys also compare how they were written.
+type Decimal struct {
+	coef int64
+	exp  int32
+
+	// the decimal places and quotes of the JSON the decimal was read from, results of arithmetic
+	// are written without them
+	places int32
+	quoted bool
+}
+
+// The largest exponent accepted when parsing, guards against numbers too large to work with
+const maxExponent = 1000
+
+var bigTen = big.NewInt(10)
+
+// Constructor function for the decimal coef * 10^exp, NewDecimal(1995, -2) is 19.95.
+func NewDecimal(coef int64, exp int32) Decimal {
+	return normalize(big.NewInt(coef), exp)
+}
+
+// Constructor function converting a float to the shortest decimal printing as the same float,
+// 0.1 becomes exactly 0.1. NaN and the infinities become 0.
+func NewDecimalFromFloat(f float64) Decimal {
+	d, err := ParseDecimal(strconv.FormatFloat(f, 'g', -1, 64))
+	if err != nil {
+		return Decimal{}
+	}
+	return d
+}
+
+// Parses a decimal like "-12.50" or "1.2e3", as written in JSON.
+func ParseDecimal(s string) (Decimal, error) {
+	mantissa, exp := s, int64(0)
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		if exp, err = strconv.ParseInt(s[i+1:], 10, 32); err != nil || exp > maxExponent || exp < -maxExponent {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+		}
+		mantissa = s[:i]
+	}
+
+	digits := strings.TrimLeft(mantissa, "+-")
+	if len(mantissa)-len(digits) > 1 {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		exp -= int64(len(digits) - i - 1)
+		digits = digits[:i] + digits[i+1:]
+	}
+	if digits == "" || strings.TrimLeft(digits, "0123456789") != "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	coef, _ := new(big.Int).SetString(digits, 10)
+	if strings.HasPrefix(mantissa, "-") {
+		coef.Neg(coef)
+	}
+	return normalize(coef, int32(exp)), nil
+}
+
+// Parses a decimal and panics if it is invalid, for constants and tests.
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Strips trailing zeros and rounds the coefficient to fit in an int64
+func normalize(coef *big.Int, exp int32) Decimal {
+	if coef.Sign() == 0 {
+		return Decimal{}
+	}
+
+	for !coef.IsInt64() {
+		coef = divRound(coef, bigTen)
+		exp++
+	}
+
+	c := coef.Int64()
+	for c%10 == 0 {
+		c /= 10
+		exp++
+	}
+	return Decimal{coef: c, exp: exp}
+}
+
+// Returns the decimal without the form it was read in
+func (d Decimal) value() Decimal {
+	return Decimal{coef: d.coef, exp: d.exp}
+}
+
+// Divides rounding half away from zero
+func divRound(x, y *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	// compares twice the remainder with the divisor
+	r.Abs(r).Lsh(r, 1)
+	if r.CmpAbs(y) >= 0 {
+		if x.Sign()*y.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// Returns the coefficients of both decimals scaled to the smaller exponent
+func align(a, b Decimal) (x, y *big.Int, exp int32) {
+	x, y = big.NewInt(a.coef), big.NewInt(b.coef)
+	switch {
+	case a.exp > b.exp:
+		x.Mul(x, pow10(a.exp-b.exp))
+		return x, y, b.exp
+	case b.exp > a.exp:
+		y.Mul(y, pow10(b.exp-a.exp))
+	}
+	return x, y, a.exp
+}
+
+// Returns d + e
+func (d Decimal) Add(e Decimal) Decimal {
+	switch {
+	case e.coef == 0:
+		return d.value()
+	case d.coef == 0:
+		return e.value()
+	// the smaller number is below the precision of the larger one
+	case d.exp-e.exp > 40:
+		return d.value()
+	case e.exp-d.exp > 40:
+		return e.value()
+	}
+	x, y, exp := align(d, e)
+	return normalize(x.Add(x, y), exp)
+}
+
+// Returns d - e
+func (d Decimal) Sub(e Decimal) Decimal {
+	return d.Add(e.Neg())
+}
+
+// Returns d * e
+func (d Decimal) Mul(e Decimal) Decimal {
+	return normalize(new(big.Int).Mul(big.NewInt(d.coef), big.NewInt(e.coef)), d.exp+e.exp)
+}
+
+// Returns d / e rounded to the given number of decimal places. Like integer division it panics
+// when e is 0.
+func (d Decimal) Div(e Decimal, places int32) Decimal {
+	if e.coef == 0 {
+		panic("decimal division by zero")
+	}
+	x, y := big.NewInt(d.coef), big.NewInt(e.coef)
+	if n := d.exp - e.exp + places; n >= 0 {
+		x.Mul(x, pow10(n))
+	} else {
+		y.Mul(y, pow10(-n))
+	}
+	return normalize(divRound(x, y), -places)
+}
+
+// Returns d rounded half away from zero to the given number of decimal places.
+func (d Decimal) Round(places int32) Decimal {
+	if d.exp >= -places {
+		return d.value()
+	}
+	return normalize(divRound(big.NewInt(d.coef), pow10(-places-d.exp)), -places)
+}
+
+// Returns -d
+func (d Decimal) Neg() Decimal {
+	if d.coef == -1<<63 {
+		return normalize(new(big.Int).Neg(big.NewInt(d.coef)), d.exp)
+	}
+	return Decimal{coef: -d.coef, exp: d.exp}
+}
+
+// Returns the absolute value of d
+func (d Decimal) Abs() Decimal {
+	if d.coef < 0 {
+		return d.Neg()
+	}
+	return d.value()
+}
+
+// Returns -1, 0 or +1 depending on the sign of d
+func (d Decimal) Sign() int {
+	switch {
+	case d.coef < 0:
+		return -1
+	case d.coef > 0:
+		return 1
+	}
+	return 0
+}
+
+// Returns -1, 0 or +1 when d is less than, equal to or greater than e
+func (d Decimal) Cmp(e Decimal) int {
+	if d.Sign() != e.Sign() || d.exp == e.exp {
+		switch {
+		case d.Sign() < e.Sign(), d.Sign() == e.Sign() && d.coef < e.coef:
+			return -1
+		case d.Sign() > e.Sign(), d.coef > e.coef:
+			return 1
+		}
+		return 0
+	}
+	x, y, _ := align(d, e)
+	return x.Cmp(y)
+}
+
+// Reports whether d and e are the same number, however they were written
+func (d Decimal) Equal(e Decimal) bool {
+	return d.value() == e.value()
+}
+
+// Reports whether d is 0
+func (d Decimal) IsZero() bool {
+	return d.coef == 0
+}
+
+// Returns the nearest float, for code still working with floats
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// Decimal implements the Stringer interface, the number is written without exponent and with the
+// trailing zeros it was read with
+func (d Decimal) String() string {
+	s := d.value().string()
+	if n := d.places + min(d.exp, 0); n > 0 {
+		if d.exp >= 0 {
+			s += "."
+		}
+		s += strings.Repeat("0", int(n))
+	}
+	return s
+}
+
+func (d Decimal) string() string {
+	s := strconv.FormatInt(d.coef, 10)
+	if d.exp >= 0 {
+		if d.coef == 0 {
+			return s
+		}
+		return s + strings.Repeat("0", int(d.exp))
+	}
+
+	sign := ""
+	if d.coef < 0 {
+		sign, s = "-", s[1:]
+	}
+	if n := int(-d.exp); len(s) <= n {
+		s = strings.Repeat("0", n-len(s)+1) + s
+	}
+	i := len(s) + int(d.exp)
+	return sign + s[:i] + "." + s[i:]
+}
+
+// Returns d rounded to the given number of decimal places and padded with zeros, like %.2f.
+func (d Decimal) StringFixed(places int32) string {
+	s := d.Round(places).String()
+	if places <= 0 {
+		return s
+	}
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		return s + "." + strings.Repeat("0", int(places))
+	}
+	return s + strings.Repeat("0", int(places)-(len(s)-i-1))
+}
+
+// Decimal implements the json.Marshaler interface, the decimal is written as it was read, as a
+// number unless it was read from a string
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	if d.quoted {
+		return []byte(`"` + d.String() + `"`), nil
+	}
+	return []byte(d.String()), nil
+}
+
+// Decimal implements the json.Unmarshaler interface, reading numbers as well as strings
+// holding numbers. Empty strings are read as 0 and null leaves the decimal unchanged.
+func (d *Decimal) UnmarshalJSON(b []byte) (err error) {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	quoted := strings.HasPrefix(s, `"`)
+	if quoted {
+		if err = json.Unmarshal(b, &s); err != nil {
+			return
+		}
+		if s = strings.TrimSpace(s); s == "" {
+			*d = Decimal{}
+			return nil
+		}
+	}
+	if *d, err = ParseDecimal(s); err != nil {
+		return
+	}
+	d.quoted = quoted
+	// the trailing zeros, numbers with an exponent are written back without it
+	if i := strings.IndexByte(s, '.'); i >= 0 && !strings.ContainsAny(s, "eE") && int32(len(s)-i-1) > -d.exp {
+		d.places = int32(len(s) - i - 1)
+	}
+	return
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDecimal(t *testing.T) {
+	assert := assert.New(t)
+
+	for s, expected := range map[string]string{
+		"0":           "0",
+		"-0.00":       "0",
+		"12.50":       "12.5",
+		"+1":          "1",
+		"-0.001":      "-0.001",
+		"1.2e3":       "1200",
+		"15E-3":       "0.015",
+		"100":         "100",
+		".5":          "0.5",
+		"123456789.1": "123456789.1",
+	} {
+		d, err := ParseDecimal(s)
+		if assert.NoError(err, s) {
+			assert.Equal(expected, d.String(), s)
+		}
+	}
+
+	for _, s := range []string{"", "-", ".", "1..2", "--1", "1e", "abc", "NaN", "1e5000"} {
+		_, err := ParseDecimal(s)
+		assert.Error(err, s)
+	}
+
+	assert.Equal(MustParseDecimal("1.50"), MustParseDecimal("1.5"))
+	assert.True(MustParseDecimal("1.50").Equal(NewDecimal(15, -1)))
+	assert.Equal(NewDecimal(1995, -2), MustParseDecimal("19.95"))
+	assert.Equal(NewDecimal(0, 5), Decimal{})
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	assert := assert.New(t)
+	d := MustParseDecimal
+
+	// the classic float failure
+	assert.Equal(d("0.3"), d("0.1").Add(d("0.2")))
+	assert.Equal(d("-0.1"), d("0.2").Sub(d("0.3")))
+	assert.Equal(d("1234.5"), d("123.45").Mul(d("10")))
+	assert.Equal(d("0.33"), d("1").Div(d("3"), 2))
+	assert.Equal(d("0.67"), d("2").Div(d("3"), 2))
+	assert.Equal(d("-0.67"), d("-2").Div(d("3"), 2))
+	assert.Equal(d("2.5"), d("2.45").Round(1))
+	assert.Equal(d("-2.5"), d("-2.45").Round(1))
+	assert.Equal(d("2.45"), d("2.45").Round(4))
+	assert.Equal(d("1.23"), d("-1.23").Abs())
+	assert.Panics(func() { d("1").Div(Decimal{}, 2) })
+
+	// results beyond 18 digits are rounded
+	assert.Equal(d("333333333333333333"), d("1e18").Div(d("3"), 0))
+	assert.Equal(d("1e30"), d("1e30").Add(d("1e-30")))
+	assert.Equal(d("4e36"), d("2e18").Mul(d("2e18")))
+
+	assert.Equal(-1, d("1.5").Cmp(d("1.51")))
+	assert.Equal(0, d("1.50").Cmp(d("1.5")))
+	assert.Equal(1, d("100").Cmp(d("99.99")))
+	assert.Equal(1, d("0").Cmp(d("-5")))
+	assert.Equal(-1, d("-1e10").Cmp(d("-1")))
+
+	assert.Equal(0.1, d("0.1").Float64())
+	assert.Equal(d("0.1"), NewDecimalFromFloat(0.1))
+	assert.Equal("12.30", d("12.3").StringFixed(2))
+	assert.Equal("12.35", d("12.345").StringFixed(2))
+	assert.Equal("12", d("12").StringFixed(0))
+	assert.Equal("-0.05", d("-0.05").String())
+}
+
+func TestDecimalJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	var v struct {
+		A, B, C, D Decimal
+	}
+	v.D = NewDecimal(7, 0)
+	assert.NoError(json.Unmarshal([]byte(`{"a": 19.95, "b": "0.10", "c": "", "d": null}`), &v))
+	assert.Equal(NewDecimal(1995, -2), v.A)
+	assert.True(NewDecimal(1, -1).Equal(v.B))
+	assert.Equal("0.10", v.B.String())
+	assert.Equal(Decimal{}, v.C)
+	assert.Equal(NewDecimal(7, 0), v.D)
+
+	// results of arithmetic are written without the form of their operands
+	assert.Equal(NewDecimal(2, -1), v.B.Add(v.B))
+	assert.Equal(NewDecimal(1, -1), v.B.Round(2))
+
+	b, err := json.Marshal(Amount{MustParseDecimal("1200.50"), "SEK"})
+	assert.NoError(err)
+	assert.Equal(`{"value":1200.5,"currency":"SEK"}`, string(b))
+
+	assert.Error(json.Unmarshal([]byte(`{"a": "ten"}`), &v))
+	assert.Error(json.Unmarshal([]byte(`{"a": true}`), &v))
+}
+
+func TestDecimalJSONRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	// recorded responses keep their bytes, trailing zeros and quoted numbers included
+	for data, v := range map[string]interface{}{
+		`{"currency":"SEK","account_sum":{"value":10250.50,"currency":"SEK"},"account_sum_acc":{"value":10250.50,"currency":"SEK"},` +
+			`"acc_int_deb":{"value":0.00,"currency":"SEK"},"acc_int_cred":{"value":0.0,"currency":"SEK"},"exchange_rate":{"value":1.0,"currency":"SEK"}}`: &Ledger{},
+		`{"accno":1234567,"order_id":3,"price":{"value":"100.50","currency":"SEK"},"volume":10,"tradable":{"identifier":"101","market_id":11},` +
+			`"open_volume":10,"traded_volume":0,"side":"BUY","modified":1458289800250,"reference":"",` +
+			`"activation_condition":{"type":"STOP_PRICE","trailing_value":0,"trigger_value":"99.000","trigger_condition":""},` +
+			`"price_condition":"LIMIT","volume_condition":"NORMAL","validity":{"type":"DAY","valid_until":0},` +
+			`"action_state":"INS_PEND","order_state":"LOCAL"}`: &Order{},
+	} {
+		if assert.NoError(json.Unmarshal([]byte(data), v)) {
+			b, err := json.Marshal(v)
+			assert.NoError(err)
+			assert.Equal(data, string(b))
+		}
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	assert := assert.New(t)
+	sek := func(s string) Amount { return Amount{MustParseDecimal(s), "SEK"} }
+
+	sum, err := Sum(sek("0.1"), sek("0.2"), sek("100"))
+	assert.NoError(err)
+	assert.Equal(sek("100.3"), sum)
+
+	diff, err := sek("10").Sub(sek("12.5"))
+	assert.NoError(err)
+	assert.Equal(sek("-2.5"), diff)
+
+	_, err = sek("1").Add(Amount{NewDecimal(1, 0), "USD"})
+	assert.Equal(&CurrencyMismatchError{"SEK", "USD"}, err)
+	assert.EqualError(err, "currency mismatch: SEK and USD")
+
+	// an amount without currency only combines when it is zero
+	_, err = sek("1").Add(Amount{Value: NewDecimal(1, 0)})
+	assert.Error(err)
+
+	_, err = sek("1").Cmp(Amount{NewDecimal(1, 0), "USD"})
+	assert.Error(err)
+	cmp, err := sek("1").Cmp(sek("0.5"))
+	assert.NoError(err)
+	assert.Equal(1, cmp)
+
+	assert.Equal(sek("250"), sek("12.5").Mul(NewDecimal(20, 0)))
+	assert.Equal(12.5, sek("12.5").Float64())
+}
+
+func TestTicksizeTable(t *testing.T) {
+	d := MustParseDecimal
+	table := TicksizeTable{Ticks: []TickSizeInterval{
+		{Decimals: 4, FromPrice: d("0"), ToPrice: d("0.9999"), Tick: d("0.0001")},
+		{Decimals: 3, FromPrice: d("1"), ToPrice: d("9.995"), Tick: d("0.005")},
+		{Decimals: 2, FromPrice: d("10"), ToPrice: d("99.99"), Tick: d("0.01")},
+	}}
+
+	assert := assert.New(t)
+
+	interval, ok := table.Interval(d("5"))
+	assert.True(ok)
+	assert.Equal(int64(3), interval.Decimals)
+	_, ok = table.Interval(d("100"))
+	assert.False(ok)
+
+	assert.True(table.Valid(d("5.005")))
+	assert.False(table.Valid(d("5.002")))
+	assert.True(table.Valid(d("0.1234")))
+	assert.False(table.Valid(d("12.345")))
+	assert.False(table.Valid(d("100")))
+
+	assert.Equal(d("5.005"), table.Round(d("5.004")))
+	assert.Equal(d("12.35"), table.Round(d("12.345")))
+	assert.Equal(d("100.001"), table.Round(d("100.001")))
+}
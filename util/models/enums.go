@@ -0,0 +1,219 @@
+package models
+
+// The enumerations of the API are string types, so they are read from and written to JSON as the
+// text sent by the API. Values unknown to this package keep their original text and Known reports
+// whether a value is one of the constants.
+
+// Side of an order or trade
+type Side string
+
+const (
+	Buy  Side = "BUY"
+	Sell Side = "SELL"
+)
+
+// Side implements the Stringer interface
+func (s Side) String() string { return string(s) }
+
+func (s Side) Known() bool { return s == Buy || s == Sell }
+
+func (s Side) IsBuy() bool { return s == Buy }
+
+func (s Side) IsSell() bool { return s == Sell }
+
+// Returns the other side, unknown sides are returned as is
+func (s Side) Opposite() Side {
+	switch s {
+	case Buy:
+		return Sell
+	case Sell:
+		return Buy
+	}
+	return s
+}
+
+// State of an order
+type OrderState string
+
+const (
+	// Entered but not sent to the market, like orders waiting for manual activation
+	OrderLocal    OrderState = "LOCAL"
+	OrderOnMarket OrderState = "ON_MARKET"
+	OrderDone     OrderState = "DONE"
+	OrderDeleted  OrderState = "DELETED"
+)
+
+// OrderState implements the Stringer interface
+func (s OrderState) String() string { return string(s) }
+
+func (s OrderState) Known() bool {
+	return s == OrderLocal || s == OrderOnMarket || s == OrderDone || s == OrderDeleted
+}
+
+// Reports whether the order is filled or deleted and will not change anymore
+func (s OrderState) IsTerminal() bool { return s == OrderDone || s == OrderDeleted }
+
+// Reports whether the order can still be filled, modified or deleted
+func (s OrderState) IsWorking() bool { return s == OrderLocal || s == OrderOnMarket }
+
+// State of the last action on an order, an action like INS, MOD or DEL followed by its progress
+type ActionState string
+
+const (
+	InsertPending   ActionState = "INS_PEND"
+	InsertWaiting   ActionState = "INS_WAIT"
+	InsertConfirmed ActionState = "INS_CONF"
+	InsertFailed    ActionState = "INS_FAIL"
+	ModifyPending   ActionState = "MOD_PEND"
+	ModifyWaiting   ActionState = "MOD_WAIT"
+	ModifyConfirmed ActionState = "MOD_CONF"
+	ModifyFailed    ActionState = "MOD_FAIL"
+	DeletePending   ActionState = "DEL_PEND"
+	DeleteWaiting   ActionState = "DEL_WAIT"
+	DeleteConfirmed ActionState = "DEL_CONF"
+	DeleteFailed    ActionState = "DEL_FAIL"
+)
+
+// ActionState implements the Stringer interface
+func (s ActionState) String() string { return string(s) }
+
+func (s ActionState) Known() bool {
+	switch s {
+	case InsertPending, InsertWaiting, InsertConfirmed, InsertFailed,
+		ModifyPending, ModifyWaiting, ModifyConfirmed, ModifyFailed,
+		DeletePending, DeleteWaiting, DeleteConfirmed, DeleteFailed:
+		return true
+	}
+	return false
+}
+
+// Reports whether the action is still being processed
+func (s ActionState) IsPending() bool { return s.progress() == "PEND" || s.progress() == "WAIT" }
+
+func (s ActionState) IsConfirmed() bool { return s.Known() && s.progress() == "CONF" }
+
+func (s ActionState) IsFailed() bool { return s.Known() && s.progress() == "FAIL" }
+
+// Returns the progress part of a known action state
+func (s ActionState) progress() string {
+	if !s.Known() {
+		return ""
+	}
+	return string(s[4:])
+}
+
+// How long an order is valid
+type ValidityType string
+
+const (
+	ValidDay       ValidityType = "DAY"
+	ValidUntilDate ValidityType = "UNTIL_DATE"
+	ValidImmediate ValidityType = "IMMEDIATE"
+)
+
+// ValidityType implements the Stringer interface
+func (t ValidityType) String() string { return string(t) }
+
+func (t ValidityType) Known() bool {
+	return t == ValidDay || t == ValidUntilDate || t == ValidImmediate
+}
+
+// When an order is sent to the market
+type ActivationType string
+
+const (
+	ActivationNone ActivationType = "NONE"
+	// Held until activated with ActivateOrder
+	ActivationManual ActivationType = "MANUAL"
+	// Activated when the price reaches the trigger value
+	ActivationStopPrice ActivationType = "STOP_ACTPRICE"
+	// Activated when the price moves the trailing value in percent from its best level
+	ActivationStopPricePercent ActivationType = "STOP_ACTPRICE_PERC"
+)
+
+// ActivationType implements the Stringer interface
+func (t ActivationType) String() string { return string(t) }
+
+func (t ActivationType) Known() bool {
+	switch t {
+	case ActivationNone, ActivationManual, ActivationStopPrice, ActivationStopPricePercent:
+		return true
+	}
+	return false
+}
+
+// Reports whether the order waits for a condition before being sent to the market
+func (t ActivationType) IsConditional() bool { return t != "" && t != ActivationNone }
+
+// Reports whether the order is activated by price movements
+func (t ActivationType) IsStop() bool {
+	return t == ActivationStopPrice || t == ActivationStopPricePercent
+}
+
+// Type of an instrument, the instrument_type of Instrument. InstrumentTypes returns the names of all types.
+type InstrumentKind string
+
+const (
+	InstrumentShare       InstrumentKind = "ESH"
+	InstrumentFund        InstrumentKind = "FND"
+	InstrumentETF         InstrumentKind = "ETF"
+	InstrumentBond        InstrumentKind = "BND"
+	InstrumentWarrant     InstrumentKind = "WNT"
+	InstrumentCertificate InstrumentKind = "CRT"
+	InstrumentOption      InstrumentKind = "OPT"
+	InstrumentFuture      InstrumentKind = "FUT"
+	InstrumentIndex       InstrumentKind = "IDX"
+)
+
+// InstrumentKind implements the Stringer interface
+func (k InstrumentKind) String() string { return string(k) }
+
+func (k InstrumentKind) Known() bool {
+	switch k {
+	case InstrumentShare, InstrumentFund, InstrumentETF, InstrumentBond, InstrumentWarrant,
+		InstrumentCertificate, InstrumentOption, InstrumentFuture, InstrumentIndex:
+		return true
+	}
+	return false
+}
+
+// Reports whether the value of the instrument derives from an underlying instrument
+func (k InstrumentKind) IsDerivative() bool {
+	return k == InstrumentWarrant || k == InstrumentCertificate || k == InstrumentOption || k == InstrumentFuture
+}
+
+// Trading status of a tradable on the public feed, the status of the exchange is sent as the source status
+type TradingStatus string
+
+const (
+	// Continuous trading
+	TradingContinuous TradingStatus = "C"
+	// Auction, like the call periods before the open and the close, orders are matched when it ends
+	TradingAuction TradingStatus = "A"
+	// Trading halted by the exchange during the day
+	TradingHalted TradingStatus = "H"
+	// Trading suspended by the exchange until further notice
+	TradingSuspended TradingStatus = "S"
+	// Closed, outside the trading hours
+	TradingClosed TradingStatus = "X"
+)
+
+// TradingStatus implements the Stringer interface
+func (s TradingStatus) String() string { return string(s) }
+
+func (s TradingStatus) Known() bool {
+	switch s {
+	case TradingContinuous, TradingAuction, TradingHalted, TradingSuspended, TradingClosed:
+		return true
+	}
+	return false
+}
+
+// Reports whether orders are matched continuously
+func (s TradingStatus) IsContinuous() bool { return s == TradingContinuous }
+
+// Reports whether orders are collected to be matched when the auction ends
+func (s TradingStatus) IsAuction() bool { return s == TradingAuction }
+
+// Reports whether the exchange stopped the trading of the tradable, halted or suspended
+func (s TradingStatus) IsHalted() bool { return s == TradingHalted || s == TradingSuspended }
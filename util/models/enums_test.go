@@ -0,0 +1,75 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnumPredicates(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(Buy.IsBuy())
+	assert.False(Buy.IsSell())
+	assert.Equal(Sell, Buy.Opposite())
+	assert.Equal(Side("SHORT"), Side("SHORT").Opposite())
+	assert.False(Side("SHORT").Known())
+
+	for state, terminal := range map[OrderState]bool{OrderLocal: false, OrderOnMarket: false, OrderDone: true, OrderDeleted: true} {
+		assert.Equal(terminal, state.IsTerminal(), state.String())
+		assert.Equal(!terminal, state.IsWorking(), state.String())
+		assert.True(state.Known())
+	}
+	assert.False(OrderState("EXPIRED").IsTerminal())
+	assert.False(OrderState("EXPIRED").IsWorking())
+
+	assert.True(InsertPending.IsPending())
+	assert.True(DeleteWaiting.IsPending())
+	assert.True(ModifyConfirmed.IsConfirmed())
+	assert.True(InsertFailed.IsFailed())
+	assert.False(InsertFailed.IsPending())
+	assert.False(ActionState("PEND_PEND").IsPending())
+
+	assert.True(ValidUntilDate.Known())
+	assert.True(ActivationManual.IsConditional())
+	assert.False(ActivationNone.IsConditional())
+	assert.False(ActivationType("").IsConditional())
+	assert.True(ActivationStopPricePercent.IsStop())
+
+	assert.True(InstrumentWarrant.IsDerivative())
+	assert.False(InstrumentShare.IsDerivative())
+	assert.True(TradingContinuous.IsContinuous())
+	assert.True(TradingAuction.IsAuction())
+	assert.True(TradingSuspended.IsHalted())
+	assert.False(TradingClosed.IsHalted())
+	assert.True(TradingClosed.Known())
+	assert.False(TradingStatus("Z").Known())
+}
+
+func TestEnumJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	// unknown values keep their text both ways
+	data := `{"order_id":1,"side":"SELL","order_state":"EXPIRED","action_state":"INS_CONF","validity":{"type":"GTC","valid_until":0},"activation_condition":{"type":"MANUAL","trailing_value":0,"trigger_value":0,"trigger_condition":""}}`
+	var order struct {
+		OrderId             int64               `json:"order_id"`
+		Side                Side                `json:"side"`
+		OrderState          OrderState          `json:"order_state"`
+		ActionState         ActionState         `json:"action_state"`
+		Validity            Validity            `json:"validity"`
+		ActivationCondition ActivationCondition `json:"activation_condition"`
+	}
+	if assert.NoError(json.Unmarshal([]byte(data), &order)) {
+		assert.Equal(Sell, order.Side)
+		assert.Equal("EXPIRED", order.OrderState.String())
+		assert.False(order.OrderState.Known())
+		assert.True(order.ActionState.IsConfirmed())
+		assert.Equal(ValidityType("GTC"), order.Validity.Type)
+		assert.Equal(ActivationManual, order.ActivationCondition.Type)
+
+		b, err := json.Marshal(order)
+		assert.NoError(err)
+		assert.Equal(data, string(b))
+	}
+}
@@ -2,10 +2,10 @@
 package models
 
 type SystemStatus struct {
-	Timestamp     int64  `json:"timestamp"`
-	ValidVersion  bool   `json:"valid_version"`
-	SystemRunnnig bool   `json:"system_running"`
-	Message       string `json:"message"`
+	Timestamp     Timestamp `json:"timestamp"`
+	ValidVersion  bool      `json:"valid_version"`
+	SystemRunnnig bool      `json:"system_running"`
+	Message       string    `json:"message"`
 }
 
 type Account struct {
@@ -37,7 +37,7 @@ type AccountInfo struct {
 }
 
 type Amount struct {
-	Value    float64 `json:"value"`
+	Value    Decimal `json:"value"`
 	Currency string  `json:"currency"`
 }
 
@@ -65,15 +65,15 @@ type Order struct {
 	Tradable            TradableId          `json:"tradable"`
 	OpenVolume          float64             `json:"open_volume"`
 	TradedVolume        float64             `json:"traded_volume"`
-	Side                string              `json:"side"`
-	Modified            int64               `json:"modified"`
+	Side                Side                `json:"side"`
+	Modified            Timestamp           `json:"modified"`
 	Reference           string              `json:"reference"`
 	ActivationCondition ActivationCondition `json:"activation_condition"`
 	PriceCondition      string              `json:"price_condition"`
 	VolumeCondition     string              `json:"volume_condition"`
 	Validity            Validity            `json:"validity"`
-	ActionState         string              `json:"action_state"`
-	OrderState          string              `json:"order_state"`
+	ActionState         ActionState         `json:"action_state"`
+	OrderState          OrderState          `json:"order_state"`
 }
 
 type TradableId struct {
@@ -82,23 +82,23 @@ type TradableId struct {
 }
 
 type ActivationCondition struct {
-	Type             string  `json:"type"`
-	TrailingValue    float64 `json:"trailing_value"`
-	TriggerValue     float64 `json:"trigger_value"`
-	TriggerCondition string  `json:"trigger_condition"`
+	Type             ActivationType `json:"type"`
+	TrailingValue    Decimal        `json:"trailing_value"`
+	TriggerValue     Decimal        `json:"trigger_value"`
+	TriggerCondition string         `json:"trigger_condition"`
 }
 
 type Validity struct {
-	Type       string `json:"type"`
-	ValidUntil int64  `json:"valid_until"`
+	Type       ValidityType `json:"type"`
+	ValidUntil Timestamp    `json:"valid_until"`
 }
 
 type OrderReply struct {
-	OrderId     int64  `json:"order_id"`
-	ResultCode  string `json:"result_code"`
-	OrderState  string `json:"order_state"`
-	ActionState string `json:"action_state"`
-	Message     string `json:"message"`
+	OrderId     int64       `json:"order_id"`
+	ResultCode  string      `json:"result_code"`
+	OrderState  OrderState  `json:"order_state"`
+	ActionState ActionState `json:"action_state"`
+	Message     string      `json:"message"`
 }
 
 type Position struct {
@@ -118,15 +118,15 @@ type Instrument struct {
 	Tradables           []Tradable       `json:"tradables"`
 	Currency            string           `json:"currency"`
 	InstrumentGroupType string           `json:"instrument_group_type"`
-	InstrumentType      string           `json:"instrument_type"`
+	InstrumentType      InstrumentKind   `json:"instrument_type"`
 	Multiplier          float64          `json:"multiplier"`
 	Symbol              string           `json:"symbol"`
 	IsinCode            string           `json:"isin_code"`
 	MarketView          string           `json:"market_view"`
-	StrikePrice         float64          `json:"strike_price"`
+	StrikePrice         Decimal          `json:"strike_price"`
 	NumberOfSecurities  float64          `json:"number_of_securities"`
 	ProspectusUrl       string           `json:"prospectus_url"`
-	ExpirationDate      string           `json:"expiration_date"`
+	ExpirationDate      Date             `json:"expiration_date"`
 	Name                string           `json:"name"`
 	Sector              string           `json:"sector"`
 	SectorGroup         string           `json:"sector_group"`
@@ -153,9 +153,9 @@ type Trade struct {
 	Tradable     TradableId `json:"tradable"`
 	Price        Amount     `json:"price"`
 	Volume       float64    `json:"volume"`
-	Side         string     `json:"side"`
+	Side         Side       `json:"side"`
 	Counterparty string     `json:"counterparty"`
-	Tradetime    int64      `json:"tradetime"`
+	Tradetime    Timestamp  `json:"tradetime"`
 }
 
 type Country struct {
@@ -180,7 +180,7 @@ type Indicator struct {
 type LeverageFilter struct {
 	Issuers              []Issuer `json:"issuers"`
 	MarketView           []string `json:"market_view"`
-	ExpirationDates      []string `json:"expiration_dates"`
+	ExpirationDates      []Date   `json:"expiration_dates"`
 	InstrumentTypes      []string `json:"instrument_types"`
 	InstrumentGroupTypes []string `json:"instrument_group_types"`
 	Currencies           []string `json:"currencies"`
@@ -193,14 +193,14 @@ type Issuer struct {
 }
 
 type OptionPair struct {
-	StrikePrice    float64    `json:"strike_price"`
-	ExpirationDate string     `json:"expiration_date"`
+	StrikePrice    Decimal    `json:"strike_price"`
+	ExpirationDate Date       `json:"expiration_date"`
 	Call           Instrument `json:"call"`
 	Put            Instrument `json:"put"`
 }
 
 type OptionPairFilter struct {
-	ExpirationDates []string `json:"expiration_dates"`
+	ExpirationDates []Date `json:"expiration_dates"`
 }
 
 type Sector struct {
@@ -210,8 +210,8 @@ type Sector struct {
 }
 
 type InstrumentType struct {
-	InstrumentType string `json:"instrument_type"`
-	Name           string `json:"name"`
+	InstrumentType InstrumentKind `json:"instrument_type"`
+	Name           string         `json:"name"`
 }
 
 type List struct {
@@ -248,24 +248,24 @@ type Market struct {
 }
 
 type NewsPreview struct {
-	NewsId      int64   `json:"news_id"`
-	SourceId    int64   `json:"source_id"`
-	Headline    string  `json:"headline"`
-	Instruments []int64 `json:"instruments"`
-	Lang        string  `json:"lang"`
-	Type        string  `json:"type"`
-	Timestamp   int64   `json:"timestamp"`
+	NewsId      int64     `json:"news_id"`
+	SourceId    int64     `json:"source_id"`
+	Headline    string    `json:"headline"`
+	Instruments []int64   `json:"instruments"`
+	Lang        string    `json:"lang"`
+	Type        string    `json:"type"`
+	Timestamp   Timestamp `json:"timestamp"`
 }
 
 type NewsItem struct {
-	NewsId      int64   `json:"news_id"`
-	SourceId    int64   `json:"source_id"`
-	Headline    string  `json:"headline"`
-	Body        string  `json:"body"`
-	Instruments []int64 `json:"instruments"`
-	Lang        string  `json:"lang"`
-	Type        string  `json:"type"`
-	Timestamp   int64   `json:"timestamp"`
+	NewsId      int64     `json:"news_id"`
+	SourceId    int64     `json:"source_id"`
+	Headline    string    `json:"headline"`
+	Body        string    `json:"body"`
+	Instruments []int64   `json:"instruments"`
+	Lang        string    `json:"lang"`
+	Type        string    `json:"type"`
+	Timestamp   Timestamp `json:"timestamp"`
 }
 
 type NewsSource struct {
@@ -287,9 +287,9 @@ type TicksizeTable struct {
 
 type TickSizeInterval struct {
 	Decimals  int64   `json:"decimals"`
-	FromPrice float64 `json:"from_price"`
-	ToPrice   float64 `json:"to_price"`
-	Tick      float64 `json:"tick"`
+	FromPrice Decimal `json:"from_price"`
+	ToPrice   Decimal `json:"to_price"`
+	Tick      Decimal `json:"tick"`
 }
 
 type TradableInfo struct {
@@ -300,9 +300,9 @@ type TradableInfo struct {
 }
 
 type CalendarDay struct {
-	Date  string `json:"date"`
-	Open  int64  `json:"open"`
-	Close int64  `json:"close"`
+	Date  Date      `json:"date"`
+	Open  Timestamp `json:"open"`
+	Close Timestamp `json:"close"`
 }
 
 type OrderType struct {
@@ -316,12 +316,12 @@ type IntradayGraph struct {
 }
 
 type IntradayTick struct {
-	Timestamp  int64   `json:"timestamp"`
-	Last       float64 `json:"last"`
-	Low        float64 `json:"low"`
-	High       float64 `json:"high"`
-	Volume     float64 `json:"volume"`
-	NoOfTrades int64   `json:"no_of_trades"`
+	Timestamp  Timestamp `json:"timestamp"`
+	Last       Decimal   `json:"last"`
+	Low        Decimal   `json:"low"`
+	High       Decimal   `json:"high"`
+	Volume     float64   `json:"volume"`
+	NoOfTrades int64     `json:"no_of_trades"`
 }
 
 type PublicTrades struct {
@@ -330,11 +330,11 @@ type PublicTrades struct {
 }
 
 type PublicTrade struct {
-	BrokerBuying   string  `json:"broker_buying"`
-	BrokerSelling  string  `json:"broker_selling"`
-	Volume         int64   `json:"volume"`
-	Price          float64 `json:"price"`
-	TradeId        string  `json:"trade_id"`
-	TradeType      string  `json:"trade_type"`
-	TradeTimestamp int64   `json:"trade_timestamp"`
+	BrokerBuying   string    `json:"broker_buying"`
+	BrokerSelling  string    `json:"broker_selling"`
+	Volume         int64     `json:"volume"`
+	Price          Decimal   `json:"price"`
+	TradeId        string    `json:"trade_id"`
+	TradeType      string    `json:"trade_type"`
+	TradeTimestamp Timestamp `json:"trade_timestamp"`
 }
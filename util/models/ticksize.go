@@ -0,0 +1,29 @@
+package models
+
+// Returns the tick size interval containing the price
+func (t TicksizeTable) Interval(price Decimal) (TickSizeInterval, bool) {
+	for _, interval := range t.Ticks {
+		if price.Cmp(interval.FromPrice) >= 0 && price.Cmp(interval.ToPrice) <= 0 {
+			return interval, true
+		}
+	}
+	return TickSizeInterval{}, false
+}
+
+// Reports whether the price is a whole number of ticks, as required for orders
+func (t TicksizeTable) Valid(price Decimal) bool {
+	interval, ok := t.Interval(price)
+	if !ok || interval.Tick.Sign() <= 0 {
+		return false
+	}
+	return price.Div(interval.Tick, 0).Mul(interval.Tick).Equal(price)
+}
+
+// Returns the price rounded to the nearest tick, or the price itself when no interval contains it
+func (t TicksizeTable) Round(price Decimal) Decimal {
+	interval, ok := t.Interval(price)
+	if !ok || interval.Tick.Sign() <= 0 {
+		return price
+	}
+	return price.Div(interval.Tick, 0).Mul(interval.Tick)
+}
@@ -0,0 +1,101 @@
+package models
+
+import "time"
+
+// Layouts of the dates and times written as strings by the API
+const (
+	DateLayout     = "2006-01-02"
+	DateTimeLayout = "2006-01-02 15:04:05"
+)
+
+// The time zone of the API and the Stockholm exchange, dates and times without zone are in it.
+//
+// The time zones are loaded from the time zone database of the system when the package is initialized.
+// Programs running where there is none, like in scratch containers, import time/tzdata to embed it.
+var Stockholm = mustLoadLocation("Europe/Stockholm")
+
+// Time zones of the exchanges by country code
+var exchangeLocations = map[string]*time.Location{
+	"SE": Stockholm,
+	"DK": mustLoadLocation("Europe/Copenhagen"),
+	"FI": mustLoadLocation("Europe/Helsinki"),
+	"NO": mustLoadLocation("Europe/Oslo"),
+	"DE": mustLoadLocation("Europe/Berlin"),
+	"US": mustLoadLocation("America/New_York"),
+	"CA": mustLoadLocation("America/Toronto"),
+}
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// Returns the time zone of the exchanges in a country, Stockholm for unknown countries
+func CountryLocation(country string) *time.Location {
+	if loc, ok := exchangeLocations[country]; ok {
+		return loc
+	}
+	return Stockholm
+}
+
+// Returns the time zone of the market
+func (m Market) Location() *time.Location {
+	return CountryLocation(m.Country)
+}
+
+// Timestamp is a point in time in milliseconds since the Unix epoch, as sent by the API and the feeds.
+// It is written to JSON as the same number.
+type Timestamp int64
+
+// Constructor function for the timestamp of t, truncated to milliseconds.
+func NewTimestamp(t time.Time) Timestamp {
+	return Timestamp(t.UnixNano() / int64(time.Millisecond))
+}
+
+// Returns the time in the Stockholm time zone, the zero time when the timestamp is 0
+func (ts Timestamp) Time() time.Time {
+	return ts.In(Stockholm)
+}
+
+// Returns the time in the given time zone, like the zone of the exchange, the zero time when the timestamp is 0
+func (ts Timestamp) In(loc *time.Location) time.Time {
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(ts)/1000, int64(ts)%1000*int64(time.Millisecond)).In(loc)
+}
+
+// Date is a calendar day like "2016-03-18", written to JSON as the same string.
+type Date string
+
+// Constructor function for the day of t in its time zone.
+func NewDate(t time.Time) Date {
+	return Date(t.Format(DateLayout))
+}
+
+// Returns the start of the day in the Stockholm time zone
+func (d Date) Time() (time.Time, error) {
+	return d.In(Stockholm)
+}
+
+// Returns the start of the day in the given time zone, like the zone of the exchange
+func (d Date) In(loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation(DateLayout, string(d), loc)
+}
+
+// DateTime is a time without zone like "2016-03-18 09:30:00" in the Stockholm time zone, written to
+// JSON as the same string.
+type DateTime string
+
+// Constructor function for the time t in the Stockholm time zone.
+func NewDateTime(t time.Time) DateTime {
+	return DateTime(t.In(Stockholm).Format(DateTimeLayout))
+}
+
+// Returns the time in the Stockholm time zone
+func (d DateTime) Time() (time.Time, error) {
+	return time.ParseInLocation(DateTimeLayout, string(d), Stockholm)
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestamp(t *testing.T) {
+	assert := assert.New(t)
+
+	// 2016-03-18 09:30:00.250 in Stockholm, during winter time
+	ts := Timestamp(1458289800250)
+	assert.Equal(time.Date(2016, 3, 18, 9, 30, 0, 250*int(time.Millisecond), Stockholm), ts.Time())
+	assert.Equal("10:30:00.250", ts.In(CountryLocation("FI")).Format("15:04:05.000"))
+	assert.Equal(ts, NewTimestamp(ts.Time()))
+	assert.True(Timestamp(0).Time().IsZero())
+
+	// after the switch to summer time
+	assert.Equal("2016-03-28 09:00:00 +0200 CEST", Timestamp(1459148400000).Time().String())
+}
+
+func TestDate(t *testing.T) {
+	assert := assert.New(t)
+
+	day, err := Date("2016-03-18").Time()
+	assert.NoError(err)
+	assert.Equal(time.Date(2016, 3, 18, 0, 0, 0, 0, Stockholm), day)
+
+	day, err = Date("2016-03-18").In(Market{Country: "US"}.Location())
+	assert.NoError(err)
+	assert.Equal("2016-03-18 00:00:00 -0400 EDT", day.String())
+	assert.Equal(Date("2016-03-18"), NewDate(day))
+
+	_, err = Date("18/3 2016").Time()
+	assert.Error(err)
+
+	dt, err := DateTime("2016-03-18 09:30:00").Time()
+	assert.NoError(err)
+	assert.Equal(Timestamp(1458289800000), NewTimestamp(dt))
+	assert.Equal(DateTime("2016-03-18 09:30:00"), NewDateTime(dt.UTC()))
+
+	assert.Equal(Stockholm, CountryLocation("XX"))
+}
+
+func TestTimeJSONRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	// recorded data keeps its bytes, unknown date formats included
+	for _, data := range []string{
+		`{"date":"2016-03-18","open":1458284400000,"close":1458315000000}`,
+		`{"date":"test","open":0,"close":123}`,
+	} {
+		var day CalendarDay
+		if assert.NoError(json.Unmarshal([]byte(data), &day)) {
+			b, err := json.Marshal(day)
+			assert.NoError(err)
+			assert.Equal(data, string(b))
+		}
+	}
+
+	var day CalendarDay
+	json.Unmarshal([]byte(`{"date":"2016-03-18","open":1458284400000,"close":1458315000000}`), &day)
+	assert.Equal("08:00", day.Open.Time().Format("15:04"))
+	assert.Equal("16:30", day.Close.Time().Format("15:04"))
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TradableKey identifies a tradable as "market:identifier", like "11:101". Indicators have the source
+// in place of the market, like "SIX:OMXS30". Keys are comparable and can be used as map keys, also in
+// JSON objects.
+type TradableKey string
+
+// Constructor function for the key of the tradable on a market.
+func NewTradableKey(market int64, identifier string) TradableKey {
+	return TradableKey(strconv.FormatInt(market, 10) + ":" + identifier)
+}
+
+// Constructor function for the key of an indicator from a source.
+func NewIndicatorKey(src, identifier string) TradableKey {
+	return TradableKey(src + ":" + identifier)
+}
+
+// Parses a key written as "market:identifier", the market may be the source of an indicator.
+func ParseTradableKey(s string) (TradableKey, error) {
+	i := strings.Index(s, ":")
+	if i <= 0 || i == len(s)-1 {
+		return "", fmt.Errorf("invalid tradable %q, expected market:identifier", s)
+	}
+	return TradableKey(s), nil
+}
+
+// TradableKey implements the Stringer interface
+func (k TradableKey) String() string { return string(k) }
+
+// Returns the market of the key, or the source of an indicator
+func (k TradableKey) Market() string {
+	market, _ := k.split()
+	return market
+}
+
+func (k TradableKey) Identifier() string {
+	_, identifier := k.split()
+	return identifier
+}
+
+// Returns the id of the tradable, failing for keys of indicators and keys without a numeric market
+func (k TradableKey) TradableId() (TradableId, error) {
+	market, identifier := k.split()
+	id, err := strconv.ParseInt(market, 10, 64)
+	if err != nil || identifier == "" {
+		return TradableId{}, fmt.Errorf("invalid tradable %q, expected market:identifier", string(k))
+	}
+	return TradableId{Identifier: identifier, MarketId: id}, nil
+}
+
+func (k TradableKey) split() (market, identifier string) {
+	if i := strings.Index(string(k), ":"); i >= 0 {
+		return string(k[:i]), string(k[i+1:])
+	}
+	return string(k), ""
+}
+
+// Returns the key of the tradable
+func (id TradableId) Key() TradableKey {
+	return NewTradableKey(id.MarketId, id.Identifier)
+}
+
+// Returns the key of the tradable of the order
+func (o Order) Key() TradableKey { return o.Tradable.Key() }
+
+// Returns the key of the tradable of the trade
+func (t Trade) Key() TradableKey { return t.Tradable.Key() }
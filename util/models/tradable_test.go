@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTradableKey(t *testing.T) {
+	assert := assert.New(t)
+
+	id := TradableId{Identifier: "101", MarketId: 11}
+	assert.Equal(TradableKey("11:101"), id.Key())
+	assert.Equal(id.Key(), Tradable{TradableId: id}.Key())
+	assert.Equal(id.Key(), Order{Tradable: id}.Key())
+	assert.Equal(id.Key(), NewTradableKey(11, "101"))
+
+	k, err := ParseTradableKey("11:101")
+	assert.NoError(err)
+	assert.Equal("11", k.Market())
+	assert.Equal("101", k.Identifier())
+	parsed, err := k.TradableId()
+	assert.NoError(err)
+	assert.Equal(id, parsed)
+
+	k, err = ParseTradableKey("SIX:OMXS30")
+	assert.NoError(err)
+	assert.Equal(NewIndicatorKey("SIX", "OMXS30"), k)
+	_, err = k.TradableId()
+	assert.Error(err)
+
+	for _, s := range []string{"", "11", ":101", "11:"} {
+		_, err := ParseTradableKey(s)
+		assert.Error(err, s)
+		_, err = TradableKey(s).TradableId()
+		assert.Error(err, s)
+	}
+}
+
+func TestTradableKeyJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	prices := map[TradableKey]Decimal{NewTradableKey(11, "101"): MustParseDecimal("100.5")}
+	b, err := json.Marshal(prices)
+	assert.NoError(err)
+	assert.Equal(`{"11:101":100.5}`, string(b))
+
+	var decoded map[TradableKey]Decimal
+	if assert.NoError(json.Unmarshal(b, &decoded)) {
+		assert.Equal(prices, decoded)
+	}
+}